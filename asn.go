@@ -0,0 +1,208 @@
+package sublive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ASNInfo is the autonomous system an address is announced from.
+type ASNInfo struct {
+	Number int
+	Name   string
+}
+
+// ASNTable is an offline IP to ASN mapping loaded with LoadASNTable.
+type ASNTable struct {
+	v4, v6 []asnRange
+}
+
+type asnRange struct {
+	start, end net.IP
+	info       ASNInfo
+}
+
+// LoadASNTable reads a tab-separated mapping in the iptoasn.com layout:
+// range_start, range_end, AS number, country code, AS description. Ranges
+// with AS number 0 (not routed) are skipped.
+func LoadASNTable(path string) (*ASNTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t := &ASNTable{}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected range_start, range_end and AS number", path, n)
+		}
+		start, end := net.ParseIP(fields[0]), net.ParseIP(fields[1])
+		asn, err := strconv.Atoi(fields[2])
+		if start == nil || end == nil || err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid range or AS number", path, n)
+		}
+		if asn == 0 {
+			continue
+		}
+		r := asnRange{start: start, end: end, info: ASNInfo{Number: asn}}
+		if len(fields) >= 5 {
+			r.info.Name = fields[4]
+		}
+		if v4 := start.To4(); v4 != nil {
+			r.start, r.end = v4, end.To4()
+			t.v4 = append(t.v4, r)
+		} else {
+			t.v6 = append(t.v6, r)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	for _, rs := range [][]asnRange{t.v4, t.v6} {
+		sort.Slice(rs, func(i, j int) bool { return bytes.Compare(rs[i].start, rs[j].start) < 0 })
+	}
+	return t, nil
+}
+
+// Lookup returns the range containing ip.
+func (t *ASNTable) Lookup(ip net.IP) (ASNInfo, bool) {
+	rs := t.v6
+	if v4 := ip.To4(); v4 != nil {
+		ip, rs = v4, t.v4
+	} else {
+		ip = ip.To16()
+	}
+	// last range starting at or before ip
+	i := sort.Search(len(rs), func(i int) bool { return bytes.Compare(rs[i].start, ip) > 0 }) - 1
+	if i < 0 || bytes.Compare(ip, rs[i].end) > 0 {
+		return ASNInfo{}, false
+	}
+	return rs[i].info, true
+}
+
+// cymruOriginName returns the Team Cymru origin query name for ip.
+func cymruOriginName(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.origin.asn.cymru.com", v4[3], v4[2], v4[1], v4[0])
+	}
+	const hex = "0123456789abcdef"
+	b := make([]byte, 0, 64)
+	v6 := ip.To16()
+	for i := len(v6) - 1; i >= 0; i-- {
+		b = append(b, hex[v6[i]&0xf], '.', hex[v6[i]>>4], '.')
+	}
+	return string(b) + "origin6.asn.cymru.com"
+}
+
+// cymruFields splits a Team Cymru TXT answer ("13335 | 1.1.1.0/24 | US | ...").
+func cymruFields(txt string) []string {
+	parts := strings.Split(txt, "|")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+// LookupASNs maps every unique address in ips to its autonomous system,
+// from table when it is not nil and otherwise through Team Cymru's DNS
+// interface, with AS names fetched once per AS. Addresses that can't be
+// mapped are missing from the result.
+func LookupASNs(ctx context.Context, ips []string, table *ASNTable, resolvers []string, workers int) map[string]ASNInfo {
+	out := make(map[string]ASNInfo)
+	uniq := UniqStrings(ips)
+	if table != nil {
+		for _, s := range uniq {
+			if ip := net.ParseIP(s); ip != nil {
+				if info, ok := table.Lookup(ip); ok {
+					out[s] = info
+				}
+			}
+		}
+		return out
+	}
+
+	if workers <= 0 {
+		workers = 20
+	}
+	res := newResolver(resolvers)
+	var mu sync.Mutex
+	parallel := func(items []string, fn func(string)) {
+		ch := make(chan string)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for it := range ch {
+					fn(it)
+				}
+			}()
+		}
+		for _, it := range items {
+			ch <- it
+		}
+		close(ch)
+		wg.Wait()
+	}
+
+	parallel(uniq, func(s string) {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return
+		}
+		txts, err := res.LookupTXT(ctx, fqdn(cymruOriginName(ip)))
+		if err != nil || len(txts) == 0 {
+			return
+		}
+		// multi-origin prefixes list several AS numbers; the first is used
+		fields := strings.Fields(cymruFields(txts[0])[0])
+		if len(fields) == 0 {
+			return
+		}
+		asn, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		out[s] = ASNInfo{Number: asn}
+		mu.Unlock()
+	})
+
+	numbers := []string{}
+	for _, info := range out {
+		numbers = append(numbers, strconv.Itoa(info.Number))
+	}
+	names := make(map[int]string)
+	parallel(UniqStrings(numbers), func(n string) {
+		txts, err := res.LookupTXT(ctx, fqdn("AS"+n+".asn.cymru.com"))
+		if err != nil || len(txts) == 0 {
+			return
+		}
+		f := cymruFields(txts[0])
+		if len(f) < 5 {
+			return
+		}
+		asn, _ := strconv.Atoi(n)
+		mu.Lock()
+		names[asn] = f[4]
+		mu.Unlock()
+	})
+	for ip, info := range out {
+		info.Name = names[info.Number]
+		out[ip] = info
+	}
+	return out
+}
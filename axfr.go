@@ -0,0 +1,163 @@
+package sublive
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ZoneTransfer is the outcome of a zone transfer attempt against one
+// nameserver address.
+type ZoneTransfer struct {
+	// Server is the nameserver's host name and Addr the address tried.
+	Server string
+	Addr   string
+	// Names are the distinct in-zone owner names transferred, wildcards
+	// stripped of their "*." label.
+	Names []string
+	// Err is why the transfer failed; nil on success.
+	Err error
+}
+
+// TransferZone looks up the nameservers of domain through the Scanner's
+// Resolvers, over TCP with TCPDNS, and asks each of their addresses for a
+// zone transfer (AXFR) over TCP, every attempt bounded by timeout. The
+// lookups and transfers are sent from the next of SourceAddrs, if any. It
+// stops at the first success, which is then the last attempt returned.
+// err is set when the nameservers can't be looked up.
+func (s *Scanner) TransferZone(ctx context.Context, domain string, timeout time.Duration) ([]ZoneTransfer, error) {
+	srcs, err := newSources(s.SourceAddrs)
+	if err != nil {
+		return nil, err
+	}
+	ctx = srcs.with(ctx)
+	servers := s.Resolvers
+	if len(servers) == 0 && s.TCPDNS {
+		servers = systemNameservers()
+	}
+	r := newDNSResolver(servers, s.TCPDNS, s.OnDNSRetry)
+	ns, err := r.LookupNS(ctx, fqdn(domain))
+	if err != nil {
+		return nil, err
+	}
+	var attempts []ZoneTransfer
+	for _, n := range ns {
+		server := strings.TrimSuffix(n.Host, ".")
+		addrs, err := r.LookupHost(ctx, fqdn(server))
+		if err != nil {
+			attempts = append(attempts, ZoneTransfer{Server: server, Err: err})
+			continue
+		}
+		for _, a := range addrs {
+			tctx, cancel := context.WithTimeout(ctx, timeout)
+			names, err := transferZone(tctx, net.JoinHostPort(a, "53"), domain)
+			cancel()
+			attempts = append(attempts, ZoneTransfer{Server: server, Addr: a, Names: names, Err: err})
+			if err == nil || ctx.Err() != nil {
+				return attempts, nil
+			}
+		}
+	}
+	return attempts, nil
+}
+
+// transferZone runs one AXFR of domain against addr and returns the owner
+// names under domain. The transfer ends with the second SOA record.
+func transferZone(ctx context.Context, addr, domain string) ([]string, error) {
+	q, err := dnsmessage.NewName(domain + ".")
+	if err != nil {
+		return nil, err
+	}
+	id := uint16(rand.UintN(1 << 16))
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: q, Type: dnsmessage.TypeAXFR, Class: dnsmessage.ClassINET})
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	d := sourceDialer(ctx, "tcp", addr)
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	req := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(msg)), uint16(len(msg)))
+	if _, err := conn.Write(append(req, msg...)); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]struct{}{}
+	var names []string
+	soas := 0
+	for soas < 2 {
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("transfer ended early")
+			}
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		var p dnsmessage.Parser
+		h, err := p.Start(resp)
+		if err != nil {
+			return nil, err
+		}
+		if h.ID != id {
+			return nil, errors.New("answer to another query")
+		}
+		if h.RCode != dnsmessage.RCodeSuccess {
+			return nil, fmt.Errorf("refused (%s)", strings.TrimPrefix(h.RCode.String(), "RCode"))
+		}
+		if err := p.SkipAllQuestions(); err != nil {
+			return nil, err
+		}
+		answers := 0
+		for {
+			rh, err := p.AnswerHeader()
+			if errors.Is(err, dnsmessage.ErrSectionDone) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			answers++
+			if err := p.SkipAnswer(); err != nil {
+				return nil, err
+			}
+			if rh.Type == dnsmessage.TypeSOA {
+				if soas++; soas == 2 {
+					break
+				}
+				continue
+			}
+			name := strings.ToLower(strings.TrimSuffix(rh.Name.String(), "."))
+			name = strings.TrimPrefix(name, "*.")
+			if _, ok := seen[name]; ok || !InDomain(name, domain) {
+				continue
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+		if answers == 0 {
+			return nil, errors.New("refused (empty answer)")
+		}
+	}
+	return names, nil
+}
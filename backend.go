@@ -0,0 +1,256 @@
+package sublive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Resolver looks up the names the workers probe. Set one as
+// Scanner.Resolver to resolve through something other than DNS, such as
+// DoH or recorded answers.
+type Resolver interface {
+	// Resolve returns the addresses of host and the CNAME chain leading to
+	// them. A name that doesn't exist is reported as a *net.DNSError with
+	// IsNotFound; any other error is a failed lookup. The chain is kept even
+	// with an error, since a dangling CNAME ends in a name that doesn't
+	// resolve.
+	Resolve(ctx context.Context, host string) (ResolveResult, error)
+}
+
+// ResolveResult is the answer of a Resolver.
+type ResolveResult struct {
+	IPs    []string
+	CNAMEs []string
+}
+
+// Prober fetches the root page of a resolved name. Set one as
+// Scanner.Prober to probe through something other than the built-in HTTP
+// client, such as recorded responses.
+type Prober interface {
+	// Probe tries the schemes of target in order and returns the first
+	// response it gets, whose body the caller reads and closes. The error
+	// is the last failure when there was no response.
+	Probe(ctx context.Context, target ProbeTarget) (ProbeResult, error)
+}
+
+// ProbeTarget is a name for a Prober to fetch.
+type ProbeTarget struct {
+	// Host is the name sent in the request.
+	Host string
+	// IPs are the addresses Host resolved to; the built-in prober only
+	// connects to them.
+	IPs []string
+	// Schemes are "http" and "https" in the order to try, fewer when the
+	// preflight found a port closed, and none with Scanner.HTTP3Only.
+	Schemes []string
+	// Port is the port to connect to when not the default of the scheme,
+	// set for names given as URLs.
+	Port string
+	// Paths are the paths, with query, requested in turn on each scheme
+	// until one answers other than 404: the path of a name given as a URL
+	// or Scanner.Paths, just / when empty.
+	Paths []string
+}
+
+// address is the host and port of t as in a URL.
+func (t ProbeTarget) address() string {
+	if t.Port == "" {
+		return t.Host
+	}
+	return net.JoinHostPort(t.Host, t.Port)
+}
+
+// paths returns Paths, or / when there are none.
+func (t ProbeTarget) paths() []string {
+	if len(t.Paths) == 0 {
+		return []string{"/"}
+	}
+	return t.Paths
+}
+
+// url is the URL of path on t with scheme.
+func (t ProbeTarget) url(scheme, path string) string {
+	return scheme + "://" + t.address() + path
+}
+
+// ProbeResult is what a Prober got.
+type ProbeResult struct {
+	// Response is nil when every attempt failed, and Scheme is the scheme
+	// of the request that got it ("https" for HTTP/3) and Path its path.
+	Response *http.Response
+	Scheme   string
+	Path     string
+	// IP is the address Response came from when known.
+	IP string
+	// Attempts lists every request made, and Errors the error of each of
+	// them, nil for the one that got Response.
+	Attempts []ProbeAttempt
+	Errors   []error
+	// Timing, with Scanner.ProfileNet, has the connect, TLS and
+	// first-byte times of the last request; DNS is left to the caller.
+	Timing NetTiming
+}
+
+// Resolve is the default Resolver: the addresses from the Scanner's
+// resolvers and, when Scanner.CNAMEChains is in effect, the CNAME chain
+// from its nameservers.
+func (p *probe) Resolve(ctx context.Context, host string) (ResolveResult, error) {
+	ips, err := p.resolver.LookupHost(ctx, fqdn(host))
+	res := ResolveResult{IPs: ips}
+	if p.cnames {
+		res.CNAMEs = lookupCNAMEChain(ctx, p.nameservers, host, p.tcpDNS)
+	}
+	return res, unqualified(err)
+}
+
+// Probe is the default Prober: GET every path of target over the
+// Scanner's client for every scheme of target, all within the probe's
+// timeout, then the first path over HTTP/3 when that is on and TCP got
+// nothing. A scheme that fails to connect is left at its first path. ctx
+// carries the pinned addresses of the target. The timeout is released when
+// the response body is closed.
+func (p *probe) Probe(ctx context.Context, target ProbeTarget) (ProbeResult, error) {
+	var pr ProbeResult
+	var lastErr error
+	sub, ip := target.Host, ""
+	if len(target.IPs) > 0 {
+		ip = target.IPs[0]
+	}
+	paths := target.paths()
+	reqCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	for _, scheme := range target.Schemes {
+		for i, path := range paths {
+			rsp, err := p.get(ctx, reqCtx, &pr, target, scheme, path)
+			if err == nil && rsp.StatusCode == http.StatusNotFound && i < len(paths)-1 {
+				// on to the next path, with a chain of its own
+				rsp.Body.Close()
+				if h, ok := ctx.Value(harvestKey{}).(*redirectHarvest); ok {
+					h.chain = nil
+				}
+				if p.gate != nil && !p.gate.wait(ctx) {
+					cancel()
+					return pr, ctx.Err()
+				}
+				continue
+			}
+			if err == nil {
+				rsp.Body = &cancelBody{rsp.Body, cancel}
+				pr.Response, pr.Scheme, pr.Path = rsp, scheme, path
+				return pr, nil
+			}
+			lastErr = err
+			break
+		}
+	}
+	cancel()
+	// a plain HTTP URL has no HTTPS port to try QUIC on
+	if !p.http3 || target.Port != "" && len(target.Schemes) > 0 && !slices.Contains(target.Schemes, "https") {
+		return pr, lastErr
+	}
+	// a host dead on TCP may still answer on UDP 443, or the port of its URL
+	h3Ctx, cancel := context.WithTimeout(ctx, p.h3Timeout)
+	var inScope []string
+	for _, ip := range target.IPs {
+		if p.scope == nil || p.scope.Contains(ip) {
+			inScope = append(inScope, ip)
+		}
+	}
+	start := time.Now()
+	done := p.metrics.request()
+	rsp, err := p.h3Get(h3Ctx, target, inScope)
+	done()
+	if err != nil {
+		cancel()
+		pr.Attempts = append(pr.Attempts, newAttempt("h3", 0, err, time.Since(start)))
+		pr.Errors = append(pr.Errors, err)
+		if ctx.Err() == nil {
+			p.log.Info("request failed", "subdomain", sub, "ip", ip, "scheme", "h3", "reason", FailureReason(err), "error", err, "duration", time.Since(start))
+		}
+		return pr, err
+	}
+	p.log.Debug("request done", "subdomain", sub, "ip", ip, "scheme", "h3", "status", rsp.StatusCode, "duration", time.Since(start))
+	rsp.Body = &cancelBody{rsp.Body, cancel}
+	pr.Attempts = append(pr.Attempts, newAttempt("h3", rsp.StatusCode, nil, time.Since(start)))
+	pr.Errors = append(pr.Errors, nil)
+	pr.Response, pr.Scheme, pr.Path = rsp, "https", target.paths()[0]
+	return pr, nil
+}
+
+// get sends one GET of path on target with scheme within reqCtx,
+// recording the attempt and, with Scanner.ProfileNet, its timing in pr.
+// Failures are logged unless ctx, the scan's, has ended.
+func (p *probe) get(ctx, reqCtx context.Context, pr *ProbeResult, target ProbeTarget, scheme, path string) (*http.Response, error) {
+	sub, ip := target.Host, ""
+	if len(target.IPs) > 0 {
+		ip = target.IPs[0]
+	}
+	connIP := ""
+	trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+		if connIP == "" {
+			connIP, _, _ = net.SplitHostPort(info.Conn.RemoteAddr().String())
+		}
+	}}
+	var nt *netTrace
+	if p.profileNet {
+		nt = &netTrace{}
+		nt.hook(trace)
+	}
+	req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(reqCtx, trace), "GET", p.url(target, scheme, path), nil)
+	p.setHeaders(req)
+	start := time.Now()
+	done := p.metrics.request()
+	rsp, err := p.client.Do(req)
+	done()
+	if nt != nil {
+		pr.Timing = nt.get()
+	}
+	status := 0
+	if err == nil {
+		status = rsp.StatusCode
+		pr.IP = connIP
+		p.log.Debug("request done", "subdomain", sub, "ip", ip, "scheme", scheme, "path", path, "status", status, "duration", time.Since(start))
+	} else if ctx.Err() == nil {
+		p.log.Info("request failed", "subdomain", sub, "ip", ip, "scheme", scheme, "path", path, "reason", FailureReason(err), "error", err, "duration", time.Since(start))
+	}
+	a := newAttempt(scheme, status, err, time.Since(start))
+	if len(target.Paths) > 0 {
+		a.Path = path
+	}
+	pr.Attempts = append(pr.Attempts, a)
+	pr.Errors = append(pr.Errors, err)
+	return rsp, err
+}
+
+// url is the URL of path on target with scheme, with Scanner.CacheBust a
+// random query parameter added so no cache has an answer for it.
+func (p *probe) url(target ProbeTarget, scheme, path string) string {
+	u := target.url(scheme, path)
+	if !p.cacheBust {
+		return u
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_sl=%016x", u, sep, rand.Uint64())
+}
+
+// cancelBody releases the context of a request when its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
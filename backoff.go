@@ -0,0 +1,171 @@
+package sublive
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Backoff parameters: throttleCount throttled responses (429 or connection
+// reset) from one address within throttleWindow pause the whole scan. The
+// pause starts at backoffMin and doubles while storms keep coming, up to
+// backoffMax; afterwards probes are let through at a rising rate for as
+// long again. Throttled candidates are retried up to throttleRetries times.
+const (
+	throttleWindow  = 10 * time.Second
+	throttleCount   = 5
+	backoffMin      = 5 * time.Second
+	backoffMax      = 2 * time.Minute
+	rampStep        = 100 * time.Millisecond
+	throttleRetries = 3
+)
+
+// Backoff describes one pause of the scan after a burst of throttled
+// responses.
+type Backoff struct {
+	// IP is the address the burst came from and Count the number of
+	// throttled responses it sent within the window.
+	IP    string
+	Count int
+	// Pause is how long probing stops; RetryAfter is set when it was taken
+	// from a Retry-After header.
+	Pause      time.Duration
+	RetryAfter bool
+}
+
+// gate holds workers back during a backoff and spaces them out while the
+// scan ramps back up.
+type gate struct {
+	mu      sync.Mutex
+	until   time.Time
+	rampEnd time.Time
+	ramp    time.Duration
+	next    time.Time
+}
+
+// pause stops probing for d, followed by a ramp of the same length.
+func (g *gate) pause(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	until := time.Now().Add(d)
+	if until.After(g.until) {
+		g.until, g.ramp, g.rampEnd, g.next = until, d, until.Add(d), until
+	}
+}
+
+// paused reports whether a backoff is in progress.
+func (g *gate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return time.Now().Before(g.until)
+}
+
+// wait blocks until the caller may probe. During the ramp consecutive
+// probes are spaced by a gap that shrinks from rampStep to zero. It returns
+// false when ctx ends first.
+func (g *gate) wait(ctx context.Context) bool {
+	for {
+		g.mu.Lock()
+		now := time.Now()
+		var d time.Duration
+		switch {
+		case now.Before(g.until):
+			d = g.until.Sub(now)
+		case now.Before(g.rampEnd) && now.Before(g.next):
+			d = g.next.Sub(now)
+		case now.Before(g.rampEnd):
+			left := float64(g.rampEnd.Sub(now)) / float64(g.ramp)
+			g.next = now.Add(time.Duration(left * float64(rampStep)))
+		}
+		g.mu.Unlock()
+		if d == 0 {
+			return true
+		}
+		if !sleep(ctx, d) {
+			return false
+		}
+	}
+}
+
+// throttle watches the collector's results for throttling storms. It is
+// only used by the collector goroutine.
+type throttle struct {
+	gate *gate
+	// holds are the addresses held by a Retry-After
+	holds     *ipHolds
+	onBackoff func(Backoff)
+	hits      map[string][]time.Time
+	// pauses counts backoffs in a row, for doubling; last is the latest
+	pauses int
+	last   time.Time
+}
+
+func newThrottle(onBackoff func(Backoff)) *throttle {
+	return &throttle{gate: &gate{}, holds: newIPHolds(), onBackoff: onBackoff, hits: map[string][]time.Time{}}
+}
+
+// observe records a throttled result and starts a backoff when its address
+// crossed the threshold. Results arriving during a backoff were already in
+// flight when it started and are not counted.
+func (t *throttle) observe(r Result) {
+	if !r.throttled || r.IP == "" || t.gate.paused() {
+		return
+	}
+	now := time.Now()
+	hits := t.hits[r.IP]
+	for len(hits) > 0 && now.Sub(hits[0]) > throttleWindow {
+		hits = hits[1:]
+	}
+	hits = append(hits, now)
+	t.hits[r.IP] = hits
+	if len(hits) < throttleCount {
+		return
+	}
+	delete(t.hits, r.IP)
+	if now.Sub(t.last) > backoffMax {
+		t.pauses = 0
+	}
+	pause := min(backoffMin<<t.pauses, backoffMax)
+	t.pauses = min(t.pauses+1, 8)
+	t.last = now
+	ev := Backoff{IP: r.IP, Count: len(hits), Pause: pause}
+	if r.retryAfter > 0 {
+		ev.Pause, ev.RetryAfter = min(r.retryAfter, backoffMax), true
+	}
+	t.gate.pause(ev.Pause)
+	if t.onBackoff != nil {
+		t.onBackoff(ev)
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an
+// HTTP date; it returns 0 when there is none.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// sleep waits for d and returns false when ctx ends first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,63 @@
+package sublive
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBannerPorts are the ports tried by Banner when BannerPorts is nil.
+var DefaultBannerPorts = []int{21, 22, 25, 110, 143, 587, 3306}
+
+// maxBanner bounds how much of a service greeting is read.
+const maxBanner = 256
+
+// speaksFirst lists ports whose protocol sends a greeting unprompted; other
+// ports get a CRLF nudge.
+var speaksFirst = map[int]bool{21: true, 22: true, 23: true, 25: true, 110: true, 143: true, 587: true, 3306: true}
+
+// grabBanner connects to ip:port and reads at most maxBanner bytes within
+// timeout. open reports whether the connect succeeded.
+func grabBanner(ctx context.Context, ip string, port int, timeout time.Duration) (banner string, open bool) {
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+	d := sourceDialer(ctx, "tcp", addr)
+	d.Timeout = timeout
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if !speaksFirst[port] {
+		conn.Write([]byte("\r\n"))
+	}
+	buf := make([]byte, maxBanner)
+	n, _ := conn.Read(buf)
+	return sanitizeBanner(buf[:n]), true
+}
+
+// sanitizeBanner makes raw service output safe to print: printable ASCII is
+// kept, CR, LF and tab become \r, \n and \t, anything else is \xHH.
+func sanitizeBanner(b []byte) string {
+	var sb strings.Builder
+	for _, c := range []byte(strings.TrimRight(string(b), "\r\n\t ")) {
+		switch {
+		case c == '\r':
+			sb.WriteString(`\r`)
+		case c == '\n':
+			sb.WriteString(`\n`)
+		case c == '\t':
+			sb.WriteString(`\t`)
+		case c == '\\':
+			sb.WriteString(`\\`)
+		case c >= 0x20 && c < 0x7f:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,103 @@
+package sublive
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrBudgetExhausted is the error of the requests refused, and the cause
+// of the scan's end, once Scanner.MaxRequests or Scanner.MaxBytes is used
+// up.
+var ErrBudgetExhausted = errors.New("sublive: request budget exhausted")
+
+// budget counts the requests and bytes of a scan against Scanner's
+// MaxRequests and MaxBytes and ends the scan when either runs out. A nil
+// budget counts nothing.
+type budget struct {
+	maxRequests, maxBytes int64
+	requests, bytes       atomic.Int64
+	exhausted             atomic.Bool
+	// stop cancels the scan's context
+	stop func(error)
+}
+
+// request counts one request and reports whether it is within budget;
+// the first one past it ends the scan.
+func (b *budget) request() bool {
+	if b.exhausted.Load() {
+		return false
+	}
+	if n := b.requests.Add(1); b.maxRequests > 0 && n > b.maxRequests {
+		b.requests.Add(-1)
+		b.exhaust()
+		return false
+	}
+	return true
+}
+
+// read counts n bytes received.
+func (b *budget) read(n int64) {
+	if n := b.bytes.Add(n); b.maxBytes > 0 && n >= b.maxBytes {
+		b.exhaust()
+	}
+}
+
+func (b *budget) exhaust() {
+	if b.exhausted.CompareAndSwap(false, true) {
+		b.stop(ErrBudgetExhausted)
+	}
+}
+
+// wrap returns rt counting against b, or rt itself when b is nil.
+func (b *budget) wrap(rt http.RoundTripper) http.RoundTripper {
+	if b == nil {
+		return rt
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &budgetTransport{rt, b}
+}
+
+// budgetTransport counts every request it sends, redirects and retries
+// included, and the bytes of the answers: the status line and headers
+// approximately, and of the body what is read.
+type budgetTransport struct {
+	rt http.RoundTripper
+	b  *budget
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.b.request() {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, ErrBudgetExhausted
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(len(resp.Proto) + len(resp.Status) + 4)
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			n += int64(len(k) + len(v) + 4)
+		}
+	}
+	t.b.read(n)
+	resp.Body = &budgetBody{resp.Body, t.b}
+	return resp, nil
+}
+
+type budgetBody struct {
+	io.ReadCloser
+	b *budget
+}
+
+func (r *budgetBody) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.b.read(int64(n))
+	return n, err
+}
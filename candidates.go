@@ -0,0 +1,339 @@
+package sublive
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Candidate sources recorded on candidates and results.
+const (
+	SourceWordlist    = "wordlist"
+	SourcePermutation = "permutation"
+	SourceNumeric     = "numeric"
+	SourceCNAME       = "cname"
+	SourceRedirect    = "redirect"
+	SourceScrape      = "scrape"
+	SourceCT          = "ct"
+	SourcePTR         = "ptr"
+	SourceAXFR        = "axfr"
+	SourceInput       = "input"
+	SourceMined       = "mined"
+	SourceCert        = "cert"
+	// SourceKnown is a name from a file of earlier findings (see
+	// ReadKnownNames).
+	SourceKnown = "known"
+	// SourceRoot is a root domain itself, probed with Scanner.ProbeRoot.
+	SourceRoot = "root"
+)
+
+// Sources lists every candidate source, in the order the CLI prints them.
+var Sources = []string{SourceRoot, SourceInput, SourceKnown, SourceWordlist, SourceCT, SourceAXFR, SourcePermutation, SourceNumeric, SourceMined, SourceCNAME, SourceRedirect, SourceScrape, SourcePTR, SourceCert}
+
+// Candidate is a fully qualified name waiting to be probed.
+type Candidate struct {
+	// Name is the ASCII hostname to probe.
+	Name string
+	// Domain is the root domain the candidate belongs to.
+	Domain string
+	// Depth is 0 for seeded names and parent depth + 1 for deep mode
+	// permutations.
+	Depth int
+	// Source says how the name was discovered (one of the Source* values).
+	Source string
+	// Origin is the address the name was recovered from when it came
+	// from HarvestIPs, by PTR or certificate.
+	Origin string
+	// URL is set for a name given as a URL, which is fetched in place of
+	// the root page over http and https: its scheme is the only one tried
+	// and its port and path are kept.
+	URL *url.URL
+	// ips are the addresses of a candidate that was parked after
+	// resolution, so it is not resolved again, and cnames its CNAME chain,
+	// non-nil once looked up
+	ips    []string
+	cnames []string
+	// attempt counts earlier probes that were throttled, and dnsRetry
+	// earlier lookups answered REFUSED or SERVFAIL
+	attempt  int
+	dnsRetry int
+}
+
+// Candidates prefixes every word to domain, skipping names that are not
+// valid hostnames.
+func Candidates(words []string, domain string) []Candidate {
+	out := make([]Candidate, 0, len(words))
+	for _, w := range words {
+		name := w + "." + domain
+		if !ValidHostname(name) {
+			continue
+		}
+		out = append(out, Candidate{Name: name, Domain: domain, Source: SourceWordlist})
+	}
+	return out
+}
+
+// Candidate orders for Scanner.Order.
+const (
+	OrderAsIs   = "asis"
+	OrderSmart  = "smart"
+	OrderRandom = "random"
+)
+
+// Orders lists the valid Scanner.Order values.
+var Orders = []string{OrderAsIs, OrderSmart, OrderRandom}
+
+// PriorityLabels are the subdomain labels most likely to exist, most
+// common first. OrderSmart probes them before everything else.
+var PriorityLabels = []string{
+	"www", "mail", "api", "webmail", "smtp", "remote", "vpn", "blog", "ns1",
+	"ns2", "m", "dev", "shop", "ftp", "mx", "portal", "admin", "app",
+	"test", "staging", "stage", "secure", "cdn", "static", "autodiscover",
+	"beta", "cpanel", "support", "docs", "login", "sso", "auth", "owa",
+	"exchange", "imap", "pop", "git", "gitlab", "jenkins", "jira", "status",
+	"dashboard", "mobile", "intranet", "demo", "media", "img", "assets",
+	"help", "store", "cloud", "crm",
+}
+
+// OrderCandidates reorders cands in place: OrderSmart moves names whose
+// label under their domain (the first label of names without one) is in
+// PriorityLabels to the front, in priority order and otherwise keeping
+// their order; OrderRandom shuffles them; OrderAsIs and "" leave them be.
+func OrderCandidates(cands []Candidate, order string) error {
+	switch order {
+	case OrderAsIs, "":
+	case OrderSmart:
+		rank := make(map[string]int, len(PriorityLabels))
+		for i, l := range PriorityLabels {
+			rank[l] = i
+		}
+		of := func(c Candidate) int {
+			label, _, _ := strings.Cut(c.Name, ".")
+			if c.Domain != "" && strings.HasSuffix(c.Name, "."+c.Domain) {
+				label = strings.TrimSuffix(c.Name, "."+c.Domain)
+			}
+			if r, ok := rank[label]; ok {
+				return r
+			}
+			return len(PriorityLabels)
+		}
+		slices.SortStableFunc(cands, func(a, b Candidate) int {
+			return cmp.Compare(of(a), of(b))
+		})
+	case OrderRandom:
+		rand.Shuffle(len(cands), func(i, j int) {
+			cands[i], cands[j] = cands[j], cands[i]
+		})
+	default:
+		return fmt.Errorf("sublive: unknown candidate order %q", order)
+	}
+	return nil
+}
+
+// NormalizeWords converts wordlist entries to ASCII and removes duplicates.
+// rejected counts entries dropped as invalid or mixed-script IDN labels.
+func NormalizeWords(words []string) (out []string, rejected int) {
+	out = make([]string, 0, len(words))
+	for _, w := range words {
+		a, err := ToASCII(w)
+		if err != nil || a == "" {
+			rejected++
+			continue
+		}
+		out = append(out, a)
+	}
+	return UniqStrings(out), rejected
+}
+
+// ReadWordlist reads one entry per line, trimming whitespace and skipping
+// blank lines.
+func ReadWordlist(r io.Reader) ([]string, error) {
+	out := []string{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return out, s.Err()
+}
+
+// LoadWordlist reads a wordlist file (see ReadWordlist).
+func LoadWordlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadWordlist(f)
+}
+
+// UniqStrings returns in without empty strings and duplicates, keeping the
+// first occurrence order.
+func UniqStrings(in []string) []string {
+	m := make(map[string]struct{})
+	out := []string{}
+	for _, s := range in {
+		if s == "" {
+			continue
+		}
+		if _, ok := m[s]; !ok {
+			m[s] = struct{}{}
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// InDomain reports whether name is domain or one of its subdomains.
+func InDomain(name, domain string) bool {
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+// RegistrableDomain returns the domain name was registered under, one
+// label below its public suffix: example.co.uk for admin.example.co.uk. A
+// name that is a public suffix itself, such as co.uk, has none.
+func RegistrableDomain(name string) (string, error) {
+	return publicsuffix.EffectiveTLDPlusOne(name)
+}
+
+// IsPublicSuffix reports whether name is on the public suffix list, such
+// as com, co.uk or github.io, undelegated names (a TLD there is none of
+// its own) included.
+func IsPublicSuffix(name string) bool {
+	suffix, _ := publicsuffix.PublicSuffix(name)
+	return suffix == name
+}
+
+// validLabel reports whether s is a usable DNS label (LDH, 1-63 chars, no
+// leading or trailing hyphen). Underscores are tolerated as many real
+// records use them.
+func validLabel(s string) bool {
+	if len(s) == 0 || len(s) > 63 || s[0] == '-' || s[len(s)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidHostname reports whether every label of name is valid.
+func ValidHostname(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, l := range strings.Split(name, ".") {
+		if !validLabel(l) {
+			return false
+		}
+	}
+	return true
+}
+
+// PermPattern is a compiled deep-mode permutation template. The matched
+// subdomain prefix is inserted between prefix and suffix.
+type PermPattern struct {
+	prefix string
+	suffix string
+}
+
+// DefaultPermPatterns are used in deep mode when no patterns are given.
+var DefaultPermPatterns = []string{"{sub}-stage", "{sub}-dev", "api.{sub}"}
+
+// CompilePermPatterns parses permutation templates containing exactly one
+// %s or {sub} placeholder. Blank lines and # comments are ignored; templates
+// that cannot produce a valid name are skipped and returned as rejected.
+func CompilePermPatterns(lines []string) (pats []PermPattern, rejected []string) {
+	for _, line := range lines {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tmpl := strings.ReplaceAll(line, "%s", "{sub}")
+		if strings.Count(tmpl, "{sub}") != 1 {
+			rejected = append(rejected, line)
+			continue
+		}
+		i := strings.Index(tmpl, "{sub}")
+		p := PermPattern{prefix: tmpl[:i], suffix: tmpl[i+len("{sub}"):]}
+		if !ValidHostname(p.Apply("a")) {
+			rejected = append(rejected, line)
+			continue
+		}
+		pats = append(pats, p)
+	}
+	return pats, rejected
+}
+
+// Apply fills the placeholder with sub.
+func (p PermPattern) Apply(sub string) string {
+	return p.prefix + sub + p.suffix
+}
+
+// splitTrailingNumber splits "web02" into "web" and "02". digits is empty
+// when label does not end in a number.
+func splitTrailingNumber(label string) (base, digits string) {
+	i := len(label)
+	for i > 0 && label[i-1] >= '0' && label[i-1] <= '9' {
+		i--
+	}
+	return label[:i], label[i:]
+}
+
+// numericVariants returns numbered siblings of label. Trailing digits are
+// replaced by 0..limit (plain and zero-padded to the original width);
+// labels without digits get 0..limit appended directly, zero-padded to two
+// digits, and as -N suffixes.
+func numericVariants(label string, limit int) []string {
+	base, digits := splitTrailingNumber(label)
+	if base == "" {
+		return nil
+	}
+	out := []string{}
+	if digits != "" {
+		for n := 0; n <= limit; n++ {
+			out = append(out, base+fmt.Sprintf("%d", n))
+			if len(digits) > 1 {
+				out = append(out, base+fmt.Sprintf("%0*d", len(digits), n))
+			}
+		}
+		return out
+	}
+	for n := 0; n <= limit; n++ {
+		out = append(out, fmt.Sprintf("%s%d", base, n), fmt.Sprintf("%s%02d", base, n))
+		if n > 0 {
+			out = append(out, fmt.Sprintf("%s-%d", base, n))
+		}
+	}
+	return out
+}
+
+// nextNumbers continues a numbered label past a hit: "web07" with misses 3
+// yields web08, web09, web10. Each further hit extends the run, so a
+// sequence stops once misses consecutive numbers fail to respond.
+func nextNumbers(label string, misses int) []string {
+	base, digits := splitTrailingNumber(label)
+	if digits == "" || base == "" {
+		return nil
+	}
+	n := 0
+	fmt.Sscanf(digits, "%d", &n)
+	out := make([]string, 0, misses)
+	for k := 1; k <= misses; k++ {
+		out = append(out, base+fmt.Sprintf("%0*d", len(digits), n+k))
+	}
+	return out
+}
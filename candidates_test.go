@@ -0,0 +1,218 @@
+package sublive
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCandidates(t *testing.T) {
+	tests := []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{"www", "api", "dev.internal"}, []string{"www.example.com", "api.example.com", "dev.internal.example.com"}},
+		// invalid labels are skipped
+		{[]string{"-bad", "bad-", "sp ace", "", "ok_1", strings.Repeat("a", 64)}, []string{"ok_1.example.com"}},
+		{nil, []string{}},
+	}
+	for _, tt := range tests {
+		got := Candidates(tt.words, "example.com")
+		names := []string{}
+		for _, c := range got {
+			names = append(names, c.Name)
+			if c.Domain != "example.com" || c.Source != SourceWordlist || c.Depth != 0 {
+				t.Errorf("Candidates(%q): %+v", tt.words, c)
+			}
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("Candidates(%q) = %q, want %q", tt.words, names, tt.want)
+		}
+	}
+}
+
+func TestNormalizeWords(t *testing.T) {
+	tests := []struct {
+		words    []string
+		want     []string
+		rejected int
+	}{
+		{[]string{"www", "WWW", "api", "www", "Api"}, []string{"www", "api"}, 0},
+		{[]string{"bücher", "xn--bcher-kva"}, []string{"xn--bcher-kva"}, 0},
+		// mixed scripts in one label
+		{[]string{"pаypal", "mail"}, []string{"mail"}, 1},
+		// and already punycoded, in either case
+		{[]string{"xn--pypal-4ve", "XN--PYPAL-4VE", "mail"}, []string{"mail"}, 2},
+	}
+	for _, tt := range tests {
+		got, rejected := NormalizeWords(tt.words)
+		if !slices.Equal(got, tt.want) || rejected != tt.rejected {
+			t.Errorf("NormalizeWords(%q) = %q, %d; want %q, %d", tt.words, got, rejected, tt.want, tt.rejected)
+		}
+	}
+	if got, err := ToASCII("xn--pypal-4ve.example.com"); err == nil {
+		t.Errorf("ToASCII(xn--pypal-4ve.example.com) = %q, want a mixed-script error", got)
+	}
+	if got, err := ToASCII("xn--bcher-kva.example.com"); err != nil || got != "xn--bcher-kva.example.com" {
+		t.Errorf("ToASCII(xn--bcher-kva.example.com) = %q, %v", got, err)
+	}
+}
+
+func TestUniqStrings(t *testing.T) {
+	tests := []struct {
+		in, want []string
+	}{
+		{[]string{"b", "a", "b", "", "c", "a"}, []string{"b", "a", "c"}},
+		{[]string{"", ""}, []string{}},
+		{nil, []string{}},
+	}
+	for _, tt := range tests {
+		if got := UniqStrings(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("UniqStrings(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReadWordlist(t *testing.T) {
+	got, err := ReadWordlist(strings.NewReader("www\n  api \n\n\t\nmail\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"www", "api", "mail"}; !slices.Equal(got, want) {
+		t.Errorf("ReadWordlist = %q, want %q", got, want)
+	}
+}
+
+func TestValidHostname(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"www.example.com", true},
+		{"_dmarc.example.com", true},
+		{"a-b.example.com", true},
+		{"xn--bcher-kva.example.com", true},
+		{"", false},
+		{"-a.example.com", false},
+		{"a-.example.com", false},
+		{"a..example.com", false},
+		{"Www.example.com", false},
+		{"a b.example.com", false},
+		{strings.Repeat("a", 64) + ".example.com", false},
+		{strings.Repeat("a.", 127) + "com", false},
+	}
+	for _, tt := range tests {
+		if got := ValidHostname(tt.name); got != tt.want {
+			t.Errorf("ValidHostname(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInDomain(t *testing.T) {
+	tests := []struct {
+		name, domain string
+		want         bool
+	}{
+		{"example.com", "example.com", true},
+		{"a.b.example.com", "example.com", true},
+		{"badexample.com", "example.com", false},
+		{"example.com.evil.net", "example.com", false},
+	}
+	for _, tt := range tests {
+		if got := InDomain(tt.name, tt.domain); got != tt.want {
+			t.Errorf("InDomain(%q, %q) = %v, want %v", tt.name, tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"admin.example.com", "example.com"},
+		{"example.com", "example.com"},
+		{"a.b.example.co.uk", "example.co.uk"},
+		{"shop.foo.com.au", "foo.com.au"},
+		{"site.github.io", "site.github.io"},
+		{"co.uk", ""},
+		{"com", ""},
+	}
+	for _, tt := range tests {
+		got, err := RegistrableDomain(tt.name)
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("RegistrableDomain(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestIsPublicSuffix(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"com", true},
+		{"co.uk", true},
+		{"com.au", true},
+		{"github.io", true},
+		{"example.co.uk", false},
+		{"example.com", false},
+		{"uk.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublicSuffix(tt.name); got != tt.want {
+			t.Errorf("IsPublicSuffix(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrderCandidates(t *testing.T) {
+	cands := Candidates([]string{"zeta", "api", "alpha", "www", "dev.corp", "mail"}, "example.com")
+	if err := OrderCandidates(cands, OrderSmart); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range cands {
+		got = append(got, strings.TrimSuffix(c.Name, ".example.com"))
+	}
+	// priority labels first, in priority order; the rest as they were
+	if want := []string{"www", "mail", "api", "zeta", "alpha", "dev.corp"}; !slices.Equal(got, want) {
+		t.Errorf("smart order = %q, want %q", got, want)
+	}
+	if err := OrderCandidates(cands, "sorted"); err == nil {
+		t.Error("unknown order accepted")
+	}
+}
+
+func TestCompilePermPatterns(t *testing.T) {
+	pats, rejected := CompilePermPatterns([]string{"{sub}-dev", "# comment", "", "api.%s", "{sub}-{sub}", "static", "-{sub}", " {SUB}-stage "})
+	var got []string
+	for _, p := range pats {
+		got = append(got, p.Apply("shop"))
+	}
+	if want := []string{"shop-dev", "api.shop", "shop-stage"}; !slices.Equal(got, want) {
+		t.Errorf("patterns apply as %q, want %q", got, want)
+	}
+	if want := []string{"{sub}-{sub}", "static", "-{sub}"}; !slices.Equal(rejected, want) {
+		t.Errorf("rejected %q, want %q", rejected, want)
+	}
+}
+
+func TestNumericVariants(t *testing.T) {
+	tests := []struct {
+		label string
+		want  []string
+	}{
+		{"web02", []string{"web0", "web00", "web1", "web01", "web2", "web02"}},
+		{"db7", []string{"db0", "db1", "db2"}},
+		{"app", []string{"app0", "app00", "app1", "app01", "app-1", "app2", "app02", "app-2"}},
+		{"42", nil},
+	}
+	for _, tt := range tests {
+		if got := numericVariants(tt.label, 2); !slices.Equal(got, tt.want) {
+			t.Errorf("numericVariants(%q, 2) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+	if got, want := nextNumbers("web07", 3), []string{"web08", "web09", "web10"}; !slices.Equal(got, want) {
+		t.Errorf("nextNumbers(web07, 3) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package sublive
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+//go:embed cdnranges.txt
+var defaultCDNRanges string
+
+// cdnCNAMESuffixes maps CNAME target suffixes to the CDN they belong to.
+var cdnCNAMESuffixes = map[string]string{
+	"cloudfront.net":         "cloudfront",
+	"fastly.net":             "fastly",
+	"fastlylb.net":           "fastly",
+	"akamai.net":             "akamai",
+	"akamaiedge.net":         "akamai",
+	"akamaihd.net":           "akamai",
+	"akamaized.net":          "akamai",
+	"akamaitechnologies.com": "akamai",
+	"edgekey.net":            "akamai",
+	"edgesuite.net":          "akamai",
+	"cdn.cloudflare.net":     "cloudflare",
+	"azureedge.net":          "azure",
+	"azurefd.net":            "azure",
+	"incapdns.net":           "imperva",
+	"impervadns.net":         "imperva",
+	"stackpathdns.com":       "stackpath",
+	"hwcdn.net":              "stackpath",
+	"b-cdn.net":              "bunny",
+	"cdn77.org":              "cdn77",
+	"kxcdn.com":              "keycdn",
+	"sucuri.net":             "sucuri",
+	"edgecastcdn.net":        "edgecast",
+	"llnwd.net":              "limelight",
+	"vercel-dns.com":         "vercel",
+	"netlifyglobalcdn.com":   "netlify",
+}
+
+// cdnHeaders maps response header names to the CDN that sets them.
+var cdnHeaders = map[string]string{
+	"Cf-Ray":              "cloudflare",
+	"X-Amz-Cf-Id":         "cloudfront",
+	"X-Fastly-Request-Id": "fastly",
+	"Akamai-Grn":          "akamai",
+	"X-Azure-Ref":         "azure",
+	"X-Iinfo":             "imperva",
+	"X-Sucuri-Id":         "sucuri",
+	"X-Vercel-Id":         "vercel",
+	"X-Nf-Request-Id":     "netlify",
+}
+
+// cidrNode is a binary trie over address bits; provider is set on nodes
+// that end a range.
+type cidrNode struct {
+	child    [2]*cidrNode
+	provider string
+}
+
+func (n *cidrNode) insert(ip net.IP, bits int, provider string) {
+	for i := 0; i < bits; i++ {
+		b := ip[i/8] >> (7 - uint(i%8)) & 1
+		if n.child[b] == nil {
+			n.child[b] = &cidrNode{}
+		}
+		n = n.child[b]
+	}
+	n.provider = provider
+}
+
+// lookup returns the provider of the longest range containing ip.
+func (n *cidrNode) lookup(ip net.IP) string {
+	found := n.provider
+	for i := 0; i < len(ip)*8 && n != nil; i++ {
+		n = n.child[ip[i/8]>>(7-uint(i%8))&1]
+		if n != nil && n.provider != "" {
+			found = n.provider
+		}
+	}
+	return found
+}
+
+// CDNDetector tags hosts served by a CDN from their response headers, CNAME
+// chain and addresses.
+type CDNDetector struct {
+	v4, v6 *cidrNode
+}
+
+// NewCDNDetector returns a detector using the embedded address ranges.
+func NewCDNDetector() *CDNDetector {
+	d, err := readCDNRanges(strings.NewReader(defaultCDNRanges))
+	if err != nil {
+		panic("sublive: bad embedded CDN ranges: " + err.Error())
+	}
+	return d
+}
+
+// LoadCDNRanges returns a detector using the "provider cidr" lines in path
+// instead of the embedded ranges.
+func LoadCDNRanges(path string) (*CDNDetector, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := readCDNRanges(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return d, nil
+}
+
+func readCDNRanges(r io.Reader) (*CDNDetector, error) {
+	d := &CDNDetector{v4: &cidrNode{}, v6: &cidrNode{}}
+	err := readRangeLines(r, func(provider string, ipnet *net.IPNet) {
+		bits, _ := ipnet.Mask.Size()
+		if v4 := ipnet.IP.To4(); v4 != nil {
+			d.v4.insert(v4, bits, provider)
+		} else {
+			d.v6.insert(ipnet.IP.To16(), bits, provider)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// readRangeLines calls add for every "provider cidr" line of r, skipping
+// blank lines and # comments.
+func readRangeLines(r io.Reader, add func(provider string, ipnet *net.IPNet)) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("line %d: expected \"provider cidr\"", n)
+		}
+		_, ipnet, err := net.ParseCIDR(fields[1])
+		if err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+		add(fields[0], ipnet)
+	}
+	return s.Err()
+}
+
+// Detect returns the CDN serving a host, or "". Response headers are the
+// strongest signal, then CNAME targets, then the address.
+func (d *CDNDetector) Detect(ip string, cnames []string, h http.Header) string {
+	for name := range h {
+		if p, ok := cdnHeaders[name]; ok {
+			return p
+		}
+		if strings.HasPrefix(name, "X-Akamai-") {
+			return "akamai"
+		}
+	}
+	if strings.EqualFold(h.Get("Server"), "cloudflare") {
+		return "cloudflare"
+	}
+	for _, c := range cnames {
+		for suffix, p := range cdnCNAMESuffixes {
+			if InDomain(c, suffix) {
+				return p
+			}
+		}
+	}
+	if addr := net.ParseIP(ip); addr != nil {
+		if v4 := addr.To4(); v4 != nil {
+			return d.v4.lookup(v4)
+		}
+		return d.v6.lookup(addr.To16())
+	}
+	return ""
+}
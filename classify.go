@@ -0,0 +1,242 @@
+package sublive
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Class is the summary bucket a result falls into.
+type Class string
+
+// Summary buckets, in the order the CLI prints them.
+const (
+	ClassLive        Class = "live"
+	ClassSoft404     Class = "soft-404"
+	ClassEdgeDefault Class = "edge-default"
+	ClassRedirect    Class = "redirect"
+	ClassAuth        Class = "auth"
+	ClassClientError Class = "client-error"
+	ClassServerError Class = "server-error"
+	ClassOther       Class = "other"
+	ClassBadCert     Class = "bad-cert"
+	ClassNoHTTP      Class = "resolved-no-http"
+	ClassNoDNS       Class = "no-dns"
+	// ClassUnreachable is what Classify returns for status 0, as it can't
+	// tell ClassNoHTTP from ClassNoDNS; ClassifyResult never returns it.
+	ClassUnreachable Class = "unreachable"
+)
+
+// Classes lists every Class ClassifyResult returns, in summary order.
+var Classes = []Class{ClassLive, ClassSoft404, ClassEdgeDefault, ClassRedirect, ClassAuth, ClassClientError, ClassServerError, ClassOther, ClassBadCert, ClassNoHTTP, ClassNoDNS}
+
+// Classify buckets an HTTP status: 2xx is live, every 3xx a redirect, 401
+// and 403 auth-gated, the rest of 4xx and 5xx client and server errors.
+// 0 means no HTTP response at all; anything else is ClassOther.
+func Classify(status int) Class {
+	switch {
+	case status == 0:
+		return ClassUnreachable
+	case status >= 200 && status < 300:
+		return ClassLive
+	case status >= 300 && status < 400:
+		return ClassRedirect
+	case status == 401 || status == 403:
+		return ClassAuth
+	case status >= 400 && status < 500:
+		return ClassClientError
+	case status >= 500 && status < 600:
+		return ClassServerError
+	default:
+		return ClassOther
+	}
+}
+
+// ClassifyResult buckets r by its status like Classify, splitting results
+// without a response into names that resolved (ClassNoHTTP) and names that
+// didn't (ClassNoDNS). Hosts that only failed certificate verification are
+// ClassBadCert, and poisoned names count as not resolving. A 2xx that
+// Scanner.Soft404 found answering random paths the same way is
+// ClassSoft404, unless it was kept with Scanner.KeepSoft404, and one that
+// Scanner.EdgeThreshold marked Result.EdgeDefault is ClassEdgeDefault.
+func ClassifyResult(r Result) Class {
+	switch {
+	case r.Soft404 && !r.Soft404Kept:
+		return ClassSoft404
+	case r.EdgeDefault:
+		return ClassEdgeDefault
+	case r.Status != 0:
+		return Classify(r.Status)
+	case r.TLSError != "":
+		return ClassBadCert
+	case r.IP != "" && r.Validation != ValidationPoisoned:
+		return ClassNoHTTP
+	default:
+		return ClassNoDNS
+	}
+}
+
+// IsLive reports whether status is 2xx or 3xx, the hosts deep mode and
+// the other Scanner features treat as live. It is broader than ClassLive.
+func IsLive(status int) bool {
+	return status >= 200 && status < 400
+}
+
+// StatusRanges is a set of HTTP status codes as inclusive ranges, sorted
+// and without overlaps, such as Scanner.LiveCodes.
+type StatusRanges [][2]int
+
+// ParseStatusRanges parses a comma-separated list of status codes and
+// ranges, such as "200-299,301,302,401,403". Codes must be 100 to 599 and
+// no two entries may overlap.
+func ParseStatusRanges(s string) (StatusRanges, error) {
+	var sr StatusRanges
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("bad status code %q", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(hi); err != nil {
+				return nil, fmt.Errorf("bad status range %q", part)
+			}
+		}
+		if from < 100 || to > 599 {
+			return nil, fmt.Errorf("status range %q is not within 100-599", part)
+		}
+		if from > to {
+			return nil, fmt.Errorf("status range %q ends before it starts", part)
+		}
+		sr = append(sr, [2]int{from, to})
+	}
+	slices.SortFunc(sr, func(a, b [2]int) int { return a[0] - b[0] })
+	for i := 1; i < len(sr); i++ {
+		if sr[i][0] <= sr[i-1][1] {
+			return nil, fmt.Errorf("status ranges %s and %s overlap", formatRange(sr[i-1]), formatRange(sr[i]))
+		}
+	}
+	return sr, nil
+}
+
+// Contains reports whether status is in sr.
+func (sr StatusRanges) Contains(status int) bool {
+	for _, r := range sr {
+		if status >= r[0] && status <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// With returns sr with the codes it lacks added.
+func (sr StatusRanges) With(codes ...int) StatusRanges {
+	out := slices.Clone(sr)
+	for _, c := range codes {
+		if !out.Contains(c) {
+			out = append(out, [2]int{c, c})
+		}
+	}
+	slices.SortFunc(out, func(a, b [2]int) int { return a[0] - b[0] })
+	return out
+}
+
+// String formats sr the way ParseStatusRanges reads it.
+func (sr StatusRanges) String() string {
+	parts := make([]string, len(sr))
+	for i, r := range sr {
+		parts[i] = formatRange(r)
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatRange(r [2]int) string {
+	if r[0] == r[1] {
+		return strconv.Itoa(r[0])
+	}
+	return fmt.Sprintf("%d-%d", r[0], r[1])
+}
+
+// Failure reasons of Result.Reason, in the order the CLI prints them.
+// ReasonServfail is a lookup the resolvers answered with SERVFAIL, and
+// ReasonDNSRefused one they answered with REFUSED or another error code.
+const (
+	ReasonNXDOMAIN   = "dns-nxdomain"
+	ReasonDNSRefused = "dns-refused"
+	ReasonServfail   = "dns-servfail"
+	ReasonRefused    = "conn-refused"
+	ReasonTLS        = "tls-handshake"
+	ReasonTimeout    = "timeout"
+	ReasonReset      = "reset"
+	ReasonOther      = "other"
+)
+
+// Reasons lists every failure reason.
+var Reasons = []string{ReasonNXDOMAIN, ReasonDNSRefused, ReasonServfail, ReasonRefused, ReasonTLS, ReasonTimeout, ReasonReset, ReasonOther}
+
+// FailureReason sorts the error of a lookup or request into one of the
+// Reason values. Timeouts win over the rest, so a TLS handshake that timed
+// out is ReasonTimeout.
+func FailureReason(err error) string {
+	var dnsErr *net.DNSError
+	var ne net.Error
+	var certErr *tls.CertificateVerificationError
+	var recErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return ReasonNXDOMAIN
+	case errors.As(err, &dnsErr) && dnsErr.Err == "server misbehaving":
+		// the Go resolver's error for an answer with an error code; only
+		// SERVFAIL is marked temporary
+		if dnsErr.IsTemporary {
+			return ReasonServfail
+		}
+		return ReasonDNSRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return ReasonTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ReasonRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ReasonReset
+	case errors.As(err, &certErr), errors.As(err, &recErr), strings.Contains(err.Error(), "tls: "),
+		// net/http's report of a plain-text answer to the ClientHello
+		strings.Contains(err.Error(), "server gave HTTP response to HTTPS client"):
+		return ReasonTLS
+	}
+	return ReasonOther
+}
+
+// setFailure records err as the reason r got no response.
+func (r *Result) setFailure(err error) {
+	r.Reason, r.Error = FailureReason(err), err.Error()
+}
+
+// ProbeAttempt is one HTTP attempt of a probe (see Result.Attempts): the
+// scheme ("http", "https" or "h3"), the path with Scanner.Paths, the
+// status it got, or the failure reason and error when it got none, and
+// how long it took.
+type ProbeAttempt struct {
+	Scheme     string `json:"scheme"`
+	Path       string `json:"path,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+func newAttempt(scheme string, status int, err error, took time.Duration) ProbeAttempt {
+	a := ProbeAttempt{Scheme: scheme, Status: status, DurationMs: took.Milliseconds()}
+	if err != nil {
+		a.Reason, a.Error = FailureReason(err), err.Error()
+	}
+	return a
+}
@@ -0,0 +1,139 @@
+package sublive
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		status int
+		want   Class
+	}{
+		{0, ClassUnreachable},
+		{200, ClassLive},
+		{204, ClassLive},
+		{299, ClassLive},
+		{301, ClassRedirect},
+		{302, ClassRedirect},
+		{303, ClassRedirect},
+		{307, ClassRedirect},
+		{308, ClassRedirect},
+		{401, ClassAuth},
+		{403, ClassAuth},
+		{400, ClassClientError},
+		{404, ClassClientError},
+		{429, ClassClientError},
+		{500, ClassServerError},
+		{503, ClassServerError},
+		{100, ClassOther},
+		{600, ClassOther},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.status); got != tt.want {
+			t.Errorf("Classify(%d) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyResult(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Result
+		want Class
+	}{
+		{"no address, no status", Result{}, ClassNoDNS},
+		{"address, no status", Result{IP: "192.0.2.1"}, ClassNoHTTP},
+		{"address and status", Result{IP: "192.0.2.1", Status: 200}, ClassLive},
+		{"status without address", Result{Status: 302}, ClassRedirect},
+		{"address, bad certificate", Result{IP: "192.0.2.1", TLSError: "x509: certificate signed by unknown authority"}, ClassBadCert},
+		{"poisoned address", Result{IP: "192.0.2.1", Validation: ValidationPoisoned}, ClassNoDNS},
+		{"soft 404", Result{IP: "192.0.2.1", Status: 200, Soft404: true}, ClassSoft404},
+		{"soft 404 kept", Result{IP: "192.0.2.1", Status: 200, Soft404: true, Soft404Kept: true}, ClassLive},
+		{"edge default", Result{IP: "192.0.2.1", Status: 200, EdgeDefault: true}, ClassEdgeDefault},
+		{"forbidden", Result{IP: "192.0.2.1", Status: 403}, ClassAuth},
+		{"server error", Result{IP: "192.0.2.1", Status: 500}, ClassServerError},
+	}
+	for _, tt := range tests {
+		if got := ClassifyResult(tt.r); got != tt.want {
+			t.Errorf("%s: ClassifyResult = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsLive(t *testing.T) {
+	for status, want := range map[int]bool{0: false, 199: false, 200: true, 302: true, 399: true, 401: false, 500: false} {
+		if got := IsLive(status); got != want {
+			t.Errorf("IsLive(%d) = %v, want %v", status, got, want)
+		}
+	}
+	s := &Scanner{LiveCodes: StatusRanges{{200, 299}, {401, 401}}}
+	for status, want := range map[int]bool{200: true, 302: false, 401: true, 403: false} {
+		if got := s.IsLive(status); got != want {
+			t.Errorf("LiveCodes %v: IsLive(%d) = %v, want %v", s.LiveCodes, status, got, want)
+		}
+	}
+}
+
+func TestParseStatusRanges(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"200", "200", false},
+		{"200-299,301,302", "200-299,301,302", false},
+		{" 403 , 200-204 ", "200-204,403", false},
+		{"abc", "", true},
+		{"200-", "", true},
+		{"99", "", true},
+		{"200-600", "", true},
+		{"300-200", "", true},
+		{"200-299,250", "", true},
+	}
+	for _, tt := range tests {
+		sr, err := ParseStatusRanges(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseStatusRanges(%q) error %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && sr.String() != tt.want {
+			t.Errorf("ParseStatusRanges(%q) = %s, want %s", tt.in, sr, tt.want)
+		}
+	}
+	sr, _ := ParseStatusRanges("200-299")
+	if got := sr.With(401, 250, 403).String(); got != "200-299,401,403" {
+		t.Errorf("With = %s", got)
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&net.DNSError{Err: "no such host", IsNotFound: true}, ReasonNXDOMAIN},
+		{&net.DNSError{Err: "server misbehaving", IsTemporary: true}, ReasonServfail},
+		{&net.DNSError{Err: "server misbehaving"}, ReasonDNSRefused},
+		{context.DeadlineExceeded, ReasonTimeout},
+		{&net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, ReasonTimeout},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ReasonRefused},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), ReasonReset},
+		{&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, ReasonTLS},
+		{errors.New("tls: handshake failure"), ReasonTLS},
+		{errors.New("http: server gave HTTP response to HTTPS client"), ReasonTLS},
+		{errors.New("something else"), ReasonOther},
+	}
+	for _, tt := range tests {
+		if got := FailureReason(tt.err); got != tt.want {
+			t.Errorf("FailureReason(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package sublive
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+)
+
+//go:embed cloudranges.txt
+var defaultCloudRanges string
+
+// Cloud providers of CloudRanges.
+const (
+	CloudAWS   = "aws"
+	CloudGCP   = "gcp"
+	CloudAzure = "azure"
+)
+
+// cloudRange is one published range of a provider.
+type cloudRange struct {
+	provider string
+	ipnet    *net.IPNet
+}
+
+// CloudRanges tells the cloud provider an address belongs to from the
+// ranges AWS, Google Cloud and Azure publish. Scanner.Cloud uses it to find
+// dangling records: names still pointing at cloud addresses that nothing
+// answers on any more, which whoever is handed the address next can serve
+// content for.
+type CloudRanges struct {
+	v4, v6 *cidrNode
+}
+
+// NewCloudRanges returns ranges built from the embedded coarse snapshot.
+func NewCloudRanges() *CloudRanges {
+	c, err := LoadCloudRanges()
+	if err != nil {
+		panic("sublive: bad embedded cloud ranges: " + err.Error())
+	}
+	return c
+}
+
+// LoadCloudRanges returns the embedded ranges with those of each provider
+// that has one of paths replaced by that file. Files are the JSON the
+// providers publish: AWS ip-ranges.json, Google Cloud cloud.json and Azure
+// ServiceTags_Public.json, told apart by their fields, so they can be
+// refreshed by downloading them again.
+func LoadCloudRanges(paths ...string) (*CloudRanges, error) {
+	var ranges []cloudRange
+	err := readRangeLines(strings.NewReader(defaultCloudRanges), func(provider string, ipnet *net.IPNet) {
+		ranges = append(ranges, cloudRange{provider, ipnet})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		provider, nets, err := parseCloudJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		ranges = slices.DeleteFunc(ranges, func(r cloudRange) bool { return r.provider == provider })
+		for _, n := range nets {
+			ranges = append(ranges, cloudRange{provider, n})
+		}
+	}
+	c := &CloudRanges{v4: &cidrNode{}, v6: &cidrNode{}}
+	for _, r := range ranges {
+		bits, _ := r.ipnet.Mask.Size()
+		if v4 := r.ipnet.IP.To4(); v4 != nil {
+			c.v4.insert(v4, bits, r.provider)
+		} else {
+			c.v6.insert(r.ipnet.IP.To16(), bits, r.provider)
+		}
+	}
+	return c, nil
+}
+
+// parseCloudJSON returns the provider and the ranges of a published range
+// file.
+func parseCloudJSON(data []byte) (string, []*net.IPNet, error) {
+	var doc struct {
+		// AWS uses ip_prefix and ipv6_prefixes, Google Cloud ipv4Prefix
+		// and ipv6Prefix in prefixes
+		Prefixes []struct {
+			IPPrefix   string `json:"ip_prefix"`
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPv6Prefix string `json:"ipv6_prefix"`
+		} `json:"ipv6_prefixes"`
+		// Azure lists its service tags
+		Values []struct {
+			Properties struct {
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", nil, err
+	}
+	var provider string
+	var cidrs []string
+	for _, p := range doc.Prefixes {
+		switch {
+		case p.IPPrefix != "":
+			provider = CloudAWS
+			cidrs = append(cidrs, p.IPPrefix)
+		case p.IPv4Prefix != "" || p.IPv6Prefix != "":
+			provider = CloudGCP
+			cidrs = append(cidrs, p.IPv4Prefix+p.IPv6Prefix)
+		}
+	}
+	for _, p := range doc.IPv6Prefixes {
+		provider = CloudAWS
+		cidrs = append(cidrs, p.IPv6Prefix)
+	}
+	for _, v := range doc.Values {
+		provider = CloudAzure
+		cidrs = append(cidrs, v.Properties.AddressPrefixes...)
+	}
+	if provider == "" {
+		return "", nil, errors.New("no AWS, Google Cloud or Azure address ranges")
+	}
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return "", nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return provider, nets, nil
+}
+
+// Provider returns the provider whose ranges hold ip, or "".
+func (c *CloudRanges) Provider(ip string) string {
+	addr := net.ParseIP(ip)
+	switch {
+	case addr == nil:
+		return ""
+	case addr.To4() != nil:
+		return c.v4.lookup(addr.To4())
+	default:
+		return c.v6.lookup(addr.To16())
+	}
+}
+
+// danglingCloud returns the provider of the first of ips in a cloud range
+// when a second lookup of host gives the same addresses, and "" otherwise:
+// a name whose answers change between lookups is load-balanced or being
+// moved rather than left behind.
+func (p *probe) danglingCloud(ctx context.Context, host string, ips []string) string {
+	provider := ""
+	for _, ip := range ips {
+		if provider = p.cloud.Provider(ip); provider != "" {
+			break
+		}
+	}
+	if provider == "" {
+		return ""
+	}
+	res, err := p.lookup.Resolve(ctx, host)
+	again := res.IPs
+	if err != nil || !sameAddrs(ips, again) {
+		p.log.Debug("cloud address not stable", "subdomain", host, "provider", provider, "ips", ips, "again", again, "error", err)
+		return ""
+	}
+	return provider
+}
+
+// sameAddrs reports whether a and b hold the same addresses in any order.
+func sameAddrs(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// checkpointer writes the -checkpoint-every snapshots of a running scan
+// next to the -o file, numbered as out.checkpoint-3.json: the JSON
+// document of the results so far, which -resume, -recheck and diff take
+// as they are, followed by an interim summary. It is fed by gatherResults
+// on the collector's goroutine and writes on one of its own, so the scan
+// goes on meanwhile; a checkpoint that comes due while the last one is
+// still being written is put off until the next result. Only the last keep
+// are left on disk. A nil checkpointer does nothing.
+type checkpointer struct {
+	base     string
+	interval time.Duration
+	every    int
+	keep     int
+	target   string
+	start    time.Time
+	codes    sublive.StatusRanges
+	summary  io.Writer
+	// next is when the next checkpoint is due by interval, since counts
+	// the results toward every, and n numbers the checkpoints
+	next  time.Time
+	since int
+	n     int
+	// done is closed when the checkpoint being written is; written and
+	// paths, the files kept, oldest first, are only read after that
+	done    chan struct{}
+	written int
+	paths   []string
+}
+
+// parseCheckpointEvery reads -checkpoint-every: a duration such as 10m, or
+// a number of results.
+func parseCheckpointEvery(s string) (time.Duration, int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 {
+			return 0, 0, fmt.Errorf("-checkpoint-every must be >= 1")
+		}
+		return 0, n, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf("-checkpoint-every %q: want a duration such as 10m or a number of results", s)
+	}
+	return d, 0, nil
+}
+
+// newCheckpointer returns the checkpointer of -checkpoint-every every,
+// nil when that is empty, for the -o file outfile, keeping the last keep
+// checkpoints (0 keeps all), with interim summaries to summary.
+func newCheckpointer(every string, keep int, outfile, target string, start time.Time, codes sublive.StatusRanges, summary io.Writer) (*checkpointer, error) {
+	if every == "" {
+		return nil, nil
+	}
+	interval, n, err := parseCheckpointEvery(every)
+	if err != nil {
+		return nil, err
+	}
+	if outfile == "" {
+		return nil, fmt.Errorf("-checkpoint-every needs -o, the checkpoints are written next to it")
+	}
+	if keep < 0 {
+		return nil, fmt.Errorf("-checkpoint-keep must be >= 0")
+	}
+	return &checkpointer{
+		base:     strings.TrimSuffix(outfile, filepath.Ext(outfile)),
+		interval: interval,
+		every:    n,
+		keep:     keep,
+		target:   target,
+		start:    start,
+		codes:    codes,
+		summary:  summary,
+		next:     time.Now().Add(interval),
+	}, nil
+}
+
+// add counts a new result, found being the first result of every name so
+// far, and starts a checkpoint of them when one is due.
+func (cp *checkpointer) add(found map[string]sublive.Result) {
+	if cp == nil {
+		return
+	}
+	cp.since++
+	if cp.every > 0 && cp.since < cp.every || cp.interval > 0 && time.Now().Before(cp.next) {
+		return
+	}
+	if cp.done != nil {
+		select {
+		case <-cp.done:
+		default:
+			return
+		}
+	}
+	results := make([]sublive.Result, 0, len(found))
+	for _, r := range found {
+		results = append(results, r)
+	}
+	cp.since, cp.next = 0, time.Now().Add(cp.interval)
+	cp.n++
+	cp.done = make(chan struct{})
+	go cp.write(cp.n, results, cp.done)
+}
+
+// write saves checkpoint n, removes those beyond keep and prints the
+// interim summary, then closes done.
+func (cp *checkpointer) write(n int, results []sublive.Result, done chan struct{}) {
+	defer close(done)
+	slices.SortFunc(results, func(a, b sublive.Result) int { return strings.Compare(a.Subdomain, b.Subdomain) })
+	path := fmt.Sprintf("%s.checkpoint-%d.json", cp.base, n)
+	meta := newRunMeta(cp.target, cp.start, false)
+	meta.summary = summarize(results, cp.codes)
+	if err := writeResultsFile(path, meta, cp.target, nil, results, "json", false); err != nil {
+		logger.Warn("writing a checkpoint failed", "file", path, "error", err)
+		return
+	}
+	cp.written++
+	cp.paths = append(cp.paths, path)
+	for cp.keep > 0 && len(cp.paths) > cp.keep {
+		os.Remove(cp.paths[0])
+		cp.paths = cp.paths[1:]
+	}
+	fmt.Fprintf(cp.summary, "\nCheckpoint %d after %s: %d results written to %s\n", n, time.Since(cp.start).Round(time.Second), len(results), path)
+	printSummaryCounts(cp.summary, meta.summary, cp.codes)
+}
+
+// wait returns once the checkpoint being written, if any, is done.
+func (cp *checkpointer) wait() {
+	if cp != nil && cp.done != nil {
+		<-cp.done
+	}
+}
+
+// count returns how many checkpoints were written, once wait returned.
+func (cp *checkpointer) count() int {
+	if cp == nil {
+		return 0
+	}
+	return cp.written
+}
+
+// printSummary reports the checkpoints written and the last of them.
+func (cp *checkpointer) printSummary(w io.Writer) {
+	if cp == nil {
+		return
+	}
+	fmt.Fprintf(w, "  checkpoints: %d written", cp.written)
+	if len(cp.paths) > 0 {
+		fmt.Fprintf(w, ", the last %s", cp.paths[len(cp.paths)-1])
+	}
+	fmt.Fprintln(w)
+}
+
+// loadResume reads the -resume file, a checkpoint or the output or
+// .partial file of an unfinished run, whose results the scan starts from.
+func loadResume(path string) ([]sublive.Result, error) {
+	if path == "" {
+		return nil, nil
+	}
+	prev, err := sublive.LoadResults(path)
+	if err != nil {
+		return nil, fmt.Errorf("-resume: %v", err)
+	}
+	logger.Info("resuming", "file", path, "results", len(prev))
+	return prev, nil
+}
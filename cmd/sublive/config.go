@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// listFlag is a repeatable flag. With split set, each value may also hold a
+// comma-separated list.
+type listFlag struct {
+	values []string
+	split  bool
+}
+
+func (l *listFlag) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(l.values, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	if !l.split {
+		l.values = append(l.values, v)
+		return nil
+	}
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			l.values = append(l.values, p)
+		}
+	}
+	return nil
+}
+
+// configAliases maps readable config keys to flag names. Any flag name is
+// also accepted as a key.
+var configAliases = map[string]string{
+	"concurrency":   "c",
+	"resolvers":     "r",
+	"headers":       "H",
+	"user-agent":    "ua",
+	"output-format": "format",
+	"wordlist":      "w",
+}
+
+// configEntry is one key of the config file with the line it appeared on.
+type configEntry struct {
+	key    string
+	line   int
+	values []string
+}
+
+// defaultConfigPath returns ~/.config/sublive/config.yaml.
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "sublive", "config.yaml")
+}
+
+// loadConfig parses a YAML mapping of option names to scalars or lists of
+// scalars.
+func loadConfig(path string) ([]configEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: expected a mapping of option names to values", path, root.Line)
+	}
+	entries := []configEntry{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		k, v := root.Content[i], root.Content[i+1]
+		e := configEntry{key: k.Value, line: k.Line}
+		switch v.Kind {
+		case yaml.ScalarNode:
+			e.values = []string{v.Value}
+		case yaml.SequenceNode:
+			for _, item := range v.Content {
+				if item.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("%s:%d: key %q: list items must be plain values", path, item.Line, e.key)
+				}
+				e.values = append(e.values, item.Value)
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: key %q: expected a value or a list of values", path, v.Line, e.key)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// applyConfig sets every config entry whose flag was not given on the
+// command line, parsing values exactly like the flag would. sources records
+// "config" for each flag set this way.
+func applyConfig(fset *flag.FlagSet, path string, entries []configEntry, sources map[string]string) error {
+	for _, e := range entries {
+		name := e.key
+		if alias, ok := configAliases[name]; ok {
+			name = alias
+		}
+		f := fset.Lookup(name)
+		if f == nil || name == "config" || name == "config-dump" {
+			return fmt.Errorf("%s:%d: unknown key %q", path, e.line, e.key)
+		}
+		if sources[name] == "flag" {
+			continue
+		}
+		if _, ok := f.Value.(*listFlag); !ok && len(e.values) != 1 {
+			return fmt.Errorf("%s:%d: key %q takes a single value", path, e.line, e.key)
+		}
+		for _, v := range e.values {
+			if err := fset.Set(name, v); err != nil {
+				return fmt.Errorf("%s:%d: key %q: invalid value %q: %v", path, e.line, e.key, v, err)
+			}
+		}
+		sources[name] = "config"
+	}
+	return nil
+}
+
+// loadAndApplyConfig reads the config at path (or the default location when
+// path is empty; a missing default file is not an error) and applies it.
+// It returns the path actually used, or "".
+func loadAndApplyConfig(fset *flag.FlagSet, path string, sources map[string]string) (string, error) {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+		if path == "" {
+			return "", nil
+		}
+	}
+	entries, err := loadConfig(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return path, applyConfig(fset, path, entries, sources)
+}
+
+// dumpConfig prints the effective value of every flag in config file syntax,
+// annotated with where it came from.
+func dumpConfig(w io.Writer, fset *flag.FlagSet, path string, sources map[string]string) {
+	keys := map[string]string{}
+	for k, v := range configAliases {
+		keys[v] = k
+	}
+	if path != "" {
+		fmt.Fprintf(w, "# config file: %s\n", path)
+	} else {
+		fmt.Fprintf(w, "# config file: none\n")
+	}
+	type item struct{ key, name string }
+	items := []item{}
+	fset.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "config-dump" {
+			return
+		}
+		key := f.Name
+		if k, ok := keys[f.Name]; ok {
+			key = k
+		}
+		items = append(items, item{key, f.Name})
+	})
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+	for _, it := range items {
+		key, name := it.key, it.name
+		f := fset.Lookup(name)
+		src := sources[name]
+		if src == "" {
+			src = "default"
+		}
+		var val string
+		if l, ok := f.Value.(*listFlag); ok {
+			quoted := make([]string, len(l.values))
+			for i, v := range l.values {
+				quoted[i] = fmt.Sprintf("%q", v)
+			}
+			val = "[" + strings.Join(quoted, ", ") + "]"
+		} else {
+			val = fmt.Sprintf("%q", f.Value.String())
+		}
+		fmt.Fprintf(w, "%s: %s # %s\n", key, val, src)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// redacted replaces durations in the -deterministic summary.
+const redacted = "<redacted>"
+
+// makeDeterministic strips what differs between runs over the same
+// network answers from results, for -deterministic: check and first-seen
+// times, attempt durations and -profile-net timings. Results are sorted
+// by name and the name lists gathered concurrently sorted too, so the
+// order they came in doesn't show.
+func makeDeterministic(results []sublive.Result) {
+	slices.SortFunc(results, func(a, b sublive.Result) int { return strings.Compare(a.Subdomain, b.Subdomain) })
+	for i := range results {
+		r := &results[i]
+		r.CheckedAt, r.FirstSeen = time.Time{}, time.Time{}
+		r.Timing = nil
+		if r.Attempts != nil {
+			r.Attempts = slices.Clone(r.Attempts)
+			for j := range r.Attempts {
+				r.Attempts[j].DurationMs = 0
+			}
+		}
+		for _, names := range []*[]string{&r.Aliases, &r.PTR, &r.Referenced} {
+			*names = slices.Sorted(slices.Values(*names))
+		}
+	}
+}
+
+// elapsedText is d for the summary heading, or redacted with
+// -deterministic.
+func elapsedText(d time.Duration, deterministic bool) string {
+	if deterministic {
+		return redacted
+	}
+	return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// deterministicResults returns results with every field -deterministic
+// normalizes set, including the timings that differ between runs.
+func deterministicResults(at time.Time) []sublive.Result {
+	return []sublive.Result{
+		{Subdomain: "www.example.com", Domain: "example.com", Status: 200, Source: sublive.SourceWordlist, IP: "192.0.2.1", ASN: 64500, ASName: "EXAMPLE", CDN: "cloudflare", CheckedAt: at, FirstSeen: at, Aliases: []string{"web.example.com", "cdn.example.com"}, PTR: []string{"b.example.net", "a.example.net"}, Attempts: []sublive.ProbeAttempt{{DurationMs: at.UnixMilli() % 1000}}, Class: sublive.ClassLive},
+		{Subdomain: "api.example.com", Domain: "example.com", Status: 401, Source: sublive.SourceCT, IP: "192.0.2.2", ASN: 64501, ASName: "OTHER", CheckedAt: at, Referenced: []string{"z.example.com", "m.example.com"}, Findings: []string{sublive.FindingInterestingName}, Class: sublive.ClassAuth},
+		{Subdomain: "old.example.com", Domain: "example.com", Error: "no such host", CheckedAt: at, Class: sublive.ClassNoDNS},
+		{Subdomain: "moved.example.com", Domain: "example.com", Status: 301, IP: "192.0.2.1", ASN: 64500, ASName: "EXAMPLE", CheckedAt: at, Timing: &sublive.NetTiming{}, Class: sublive.ClassRedirect},
+		{Subdomain: "bucket.example.com", Domain: "example.com", Status: 404, DanglingCloud: "s3", Findings: []string{sublive.FindingDanglingCloud, sublive.FindingInterestingName}, CheckedAt: at, Class: sublive.ClassClientError},
+	}
+}
+
+// render writes results the way scan does with -deterministic: every
+// result format, the findings and the summary sections.
+func render(t *testing.T, results []sublive.Result, start time.Time) []byte {
+	t.Helper()
+	makeDeterministic(results)
+	meta := newRunMeta("example.com", start, true).finish().redact()
+	meta.summary = summarize(results, nil)
+	var b bytes.Buffer
+	for _, format := range []string{"plain", "extended", "json"} {
+		if err := writeResults(&b, meta, "example.com", nil, results, format, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFindings(&b, meta, results, format, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.WriteString(elapsedText(time.Since(start), true))
+	printCounts(&b, results, nil)
+	printStatusCodes(&b, results)
+	printReasons(&b, meta.summary)
+	printSources(&b, meta.summary)
+	printFindingCounts(&b, results)
+	printDangling(&b, results)
+	printTopASNs(&b, results, 10)
+	printCDNCounts(&b, results)
+	return b.Bytes()
+}
+
+func TestDeterministic(t *testing.T) {
+	first := deterministicResults(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	want := render(t, first, time.Now().Add(-time.Minute))
+	for i := range 5 {
+		// another run: the same answers at another time, in another order
+		results := deterministicResults(time.Date(2026, 3, 2, 8, 30, 0, i*int(time.Millisecond), time.UTC))
+		rand.Shuffle(len(results), func(i, j int) { results[i], results[j] = results[j], results[i] })
+		for j := range results {
+			slices.Reverse(results[j].Aliases)
+			slices.Reverse(results[j].PTR)
+		}
+		if got := render(t, results, time.Now().Add(-time.Duration(i)*time.Second)); !bytes.Equal(got, want) {
+			t.Fatalf("run %d differs:\n%s\nwant\n%s", i, got, want)
+		}
+	}
+}
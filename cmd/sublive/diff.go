@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// formatChange renders c as one human-readable line, ending in when the
+// host was first seen, or last seen for removed hosts, when known.
+func formatChange(c sublive.Change) string {
+	var line string
+	seen := c.FirstSeen
+	switch c.Kind {
+	case sublive.ChangeAdded:
+		line = fmt.Sprintf("+ %s %d", c.Subdomain, c.NewStatus)
+		if c.NewIP != "" {
+			line += " " + c.NewIP
+		}
+	case sublive.ChangeRemoved:
+		line = fmt.Sprintf("- %s %d", c.Subdomain, c.OldStatus)
+		seen = c.LastSeen
+	case sublive.ChangeStatus:
+		line = fmt.Sprintf("~ %s status %d -> %d", c.Subdomain, c.OldStatus, c.NewStatus)
+	default:
+		line = fmt.Sprintf("~ %s ip %s -> %s", c.Subdomain, c.OldIP, c.NewIP)
+	}
+	switch {
+	case seen.IsZero():
+	case c.Kind == sublive.ChangeRemoved:
+		line += " (last seen " + seen.Format(time.RFC3339) + ")"
+	default:
+		line += " (first seen " + seen.Format(time.RFC3339) + ")"
+	}
+	return line
+}
+
+// filterChanges returns the changes of the names that keep, the output
+// filters, lets through in either cur or prev, so a host that dropped out
+// of -x output since is still reported. The changes are computed over the
+// unfiltered results first; diffing the filtered ones would report every
+// host that fell out of the filter as removed.
+func filterChanges(changes []sublive.Change, prev, cur []sublive.Result, keep func([]sublive.Result) []sublive.Result) []sublive.Change {
+	kept := map[string]bool{}
+	for _, rs := range [][]sublive.Result{prev, cur} {
+		for _, r := range keep(slices.Clone(rs)) {
+			kept[r.Subdomain] = true
+		}
+	}
+	var out []sublive.Change
+	for _, c := range changes {
+		if kept[c.Subdomain] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// writeChanges writes changes as lines followed by a count, or as a JSON
+// document with format "json".
+func writeChanges(w io.Writer, prev, cur string, changes []sublive.Change, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Previous string           `json:"previous"`
+			Current  string           `json:"current,omitempty"`
+			Changes  []sublive.Change `json:"changes"`
+		}{prev, cur, changes})
+	}
+	counts := map[sublive.ChangeKind]int{}
+	for _, c := range changes {
+		counts[c.Kind]++
+		if _, err := fmt.Fprintln(w, formatChange(c)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d added, %d removed, %d status changed, %d ip changed\n",
+		counts[sublive.ChangeAdded], counts[sublive.ChangeRemoved], counts[sublive.ChangeStatus], counts[sublive.ChangeIP])
+	return err
+}
+
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: sublive diff [flags] previous current\n\nCompare two result files (JSON or plain \"host status\" lines) keyed by subdomain.\n\n")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "text", "output format: text or json")
+	jsonOut := fs.Bool("json", false, "shorthand for -format json")
+	manifests := fs.String("manifests", "", "the -manifest files of the previous and the current run, comma-separated: warn when their settings differ")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *jsonOut {
+		*format = "json"
+	}
+	if *manifests != "" {
+		if err := checkManifests(*manifests); err != nil {
+			fmt.Fprintf(os.Stderr, "diff: -manifests: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	prev, err := sublive.LoadResults(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		os.Exit(1)
+	}
+	cur, err := sublive.LoadResults(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		os.Exit(1)
+	}
+	if err := writeChanges(os.Stdout, fs.Arg(0), fs.Arg(1), sublive.Diff(prev, cur), *format); err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// checkManifests warns when the runs of the two manifests in list, the
+// previous and the current one, had settings that make their results
+// unfit to compare.
+func checkManifests(list string) error {
+	paths := strings.Split(list, ",")
+	if len(paths) != 2 {
+		return fmt.Errorf("want two files, the previous and the current run's, got %q", list)
+	}
+	prev, err := loadManifest(paths[0])
+	if err != nil {
+		return err
+	}
+	cur, err := loadManifest(paths[1])
+	if err != nil {
+		return err
+	}
+	warnIncomparable("the runs of "+paths[0]+" and "+paths[1], settingDiffs(prev, cur))
+	return nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// A _bulk request that fails with 429, a 5xx or no answer at all, and the
+// documents of one the cluster pushed back with 429, are sent again up to
+// esRetries times, waiting esRetryWait and then twice as long each time.
+const esRetries = 3
+
+var esRetryWait = time.Second
+
+// esDoc is the document indexed for one result.
+type esDoc struct {
+	Timestamp   time.Time     `json:"@timestamp"`
+	ScanID      string        `json:"scan_id"`
+	ScanStarted time.Time     `json:"scan_started,omitzero"`
+	Target      string        `json:"target,omitempty"`
+	Subdomain   string        `json:"subdomain"`
+	Domain      string        `json:"domain,omitempty"`
+	IP          string        `json:"ip,omitempty"`
+	IPs         []string      `json:"ips,omitempty"`
+	Status      int           `json:"status"`
+	Class       sublive.Class `json:"class"`
+	Reason      string        `json:"reason,omitempty"`
+	CNAME       []string      `json:"cname,omitempty"`
+	Title       string        `json:"title,omitempty"`
+	URL         string        `json:"url,omitempty"`
+	Source      string        `json:"source,omitempty"`
+	Tags        []string      `json:"tags,omitempty"`
+	Findings    []string      `json:"findings,omitempty"`
+}
+
+// esTemplate is the index template of -es-create-template: names, classes
+// and tags as keywords, the addresses as IPs, the times as dates.
+var esTemplate = map[string]any{
+	"mappings": map[string]any{
+		"properties": map[string]any{
+			"@timestamp":   map[string]string{"type": "date"},
+			"scan_id":      map[string]string{"type": "keyword"},
+			"scan_started": map[string]string{"type": "date"},
+			"target":       map[string]string{"type": "keyword"},
+			"subdomain":    map[string]string{"type": "keyword"},
+			"domain":       map[string]string{"type": "keyword"},
+			"ip":           map[string]string{"type": "ip"},
+			"ips":          map[string]string{"type": "ip"},
+			"status":       map[string]string{"type": "integer"},
+			"class":        map[string]string{"type": "keyword"},
+			"reason":       map[string]string{"type": "keyword"},
+			"cname":        map[string]string{"type": "keyword"},
+			"title":        map[string]any{"type": "text", "fields": map[string]any{"raw": map[string]any{"type": "keyword", "ignore_above": 256}}},
+			"url":          map[string]string{"type": "keyword"},
+			"source":       map[string]string{"type": "keyword"},
+			"tags":         map[string]string{"type": "keyword"},
+			"findings":     map[string]string{"type": "keyword"},
+		},
+	},
+}
+
+// esExporter is -es-url: it bulk-indexes the results of a run into an
+// Elasticsearch or OpenSearch index, batch documents per _bulk request.
+// Documents are keyed by scan ID and name, so one sent twice by a retry
+// is indexed once. A cluster that can't be reached never fails the run:
+// the documents that didn't make it are counted, and once a request has
+// failed every retry the cluster is taken to be down and the rest of the
+// run's documents are not sent. A nil esExporter does nothing.
+type esExporter struct {
+	url    string
+	index  string
+	user   string
+	pass   string
+	apiKey string
+	batch  int
+	client *http.Client
+	// indexed and failed count the documents of every run so far, and err
+	// is the last failure
+	indexed, failed int
+	err             error
+}
+
+// newESExporter returns the exporter of -es-url esURL into index, nil when
+// esURL is empty. user is user:password for basic auth and apiKey an API
+// key; when empty they are read from SUBLIVE_ES_USER and
+// SUBLIVE_ES_API_KEY. createTemplate puts the index template first, and
+// only warns when that fails.
+func newESExporter(esURL, index, user, apiKey string, batch int, createTemplate bool) (*esExporter, error) {
+	if esURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(esURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("-es-url %q: want http(s)://host:port", esURL)
+	}
+	if index == "" || index != strings.ToLower(index) || strings.ContainsAny(index, ` "*?<>|,#/\:`) || strings.HasPrefix(index, "_") {
+		return nil, fmt.Errorf("-es-index %q: want a lowercase index name", index)
+	}
+	if batch < 1 {
+		return nil, fmt.Errorf("-es-batch must be >= 1")
+	}
+	user = cmp.Or(user, os.Getenv("SUBLIVE_ES_USER"))
+	e := &esExporter{
+		url:    strings.TrimSuffix(esURL, "/"),
+		index:  index,
+		apiKey: cmp.Or(apiKey, os.Getenv("SUBLIVE_ES_API_KEY")),
+		batch:  batch,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	e.user, e.pass, _ = strings.Cut(user, ":")
+	if createTemplate {
+		if err := e.putTemplate(); err != nil {
+			logger.Warn("creating the -es-index template failed, indexing anyway", "index", index, "error", err)
+		}
+	}
+	return e, nil
+}
+
+// putTemplate creates or replaces the index template of the index.
+func (e *esExporter) putTemplate() error {
+	body, err := json.Marshal(map[string]any{
+		"index_patterns": []string{e.index, e.index + "-*"},
+		"template":       esTemplate,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := e.do(http.MethodPut, "/_index_template/sublive-"+e.index, "application/json", body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// do sends one request to the cluster with the credentials.
+func (e *esExporter) do(method, path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, e.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	switch {
+	case e.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	case e.user != "":
+		req.SetBasicAuth(e.user, e.pass)
+	}
+	return e.client.Do(req)
+}
+
+// export sends results, the results of the run of meta, and returns how
+// many of them were indexed and how many not.
+func (e *esExporter) export(results iter.Seq[sublive.Result], meta *runMeta) (indexed, failed int) {
+	if e == nil {
+		return 0, 0
+	}
+	scanID := fmt.Sprintf("%s-%s", cmp.Or(meta.Target, "results"), meta.Started.UTC().Format("20060102T150405Z"))
+	down := false
+	var batch []esDoc
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if down {
+			failed += len(batch)
+		} else {
+			ok, err := e.send(scanID, batch)
+			indexed += ok
+			failed += len(batch) - ok
+			if err != nil {
+				e.err = err
+				var unreachable *esUnreachable
+				down = errors.As(err, &unreachable)
+				logger.Warn("indexing results failed", "url", e.url, "index", e.index, "documents", len(batch)-ok, "error", err)
+			}
+		}
+		batch = batch[:0]
+	}
+	for r := range results {
+		batch = append(batch, esDoc{
+			Timestamp:   cmp.Or(r.CheckedAt, meta.Finished),
+			ScanID:      scanID,
+			ScanStarted: meta.Started,
+			Target:      meta.Target,
+			Subdomain:   r.Subdomain,
+			Domain:      r.Domain,
+			IP:          r.IP,
+			IPs:         r.IPs,
+			Status:      r.Status,
+			Class:       r.Class,
+			Reason:      r.Reason,
+			CNAME:       r.CNAMEs,
+			Title:       r.Title,
+			URL:         r.URL,
+			Source:      r.Source,
+			Tags:        resultTags(r),
+			Findings:    r.Findings,
+		})
+		if len(batch) == e.batch {
+			send()
+		}
+	}
+	send()
+	e.indexed += indexed
+	e.failed += failed
+	return indexed, failed
+}
+
+// esUnreachable is the error of a _bulk request that got no usable answer
+// on any try.
+type esUnreachable struct{ err error }
+
+func (e *esUnreachable) Error() string { return e.err.Error() }
+func (e *esUnreachable) Unwrap() error { return e.err }
+
+// esBulkResponse is the part of a _bulk answer that is read: the outcome
+// of every document, in order.
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// send indexes docs with _bulk requests, sending the documents pushed
+// back with 429 again, and returns how many were indexed and why the
+// others were not.
+func (e *esExporter) send(scanID string, docs []esDoc) (int, error) {
+	indexed := 0
+	wait := esRetryWait
+	var lastErr error
+	for try := 0; try <= esRetries && len(docs) > 0; try++ {
+		if try > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		var body bytes.Buffer
+		enc := json.NewEncoder(&body)
+		for _, d := range docs {
+			action := map[string]map[string]string{"index": {"_index": e.index, "_id": scanID + ":" + d.Subdomain}}
+			if err := enc.Encode(action); err != nil {
+				return indexed, err
+			}
+			if err := enc.Encode(d); err != nil {
+				return indexed, err
+			}
+		}
+		resp, err := e.do(http.MethodPost, "/_bulk", "application/x-ndjson", body.Bytes())
+		if err != nil {
+			lastErr = &esUnreachable{err}
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch {
+		case err != nil:
+			lastErr = &esUnreachable{err}
+			continue
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			lastErr = &esUnreachable{fmt.Errorf("_bulk: %s", resp.Status)}
+			continue
+		case resp.StatusCode >= 300:
+			// bad credentials, a bad index name and the like: no retry helps
+			return indexed, fmt.Errorf("_bulk: %s: %s", resp.Status, strings.TrimSpace(string(data[:min(len(data), 200)])))
+		}
+		var br esBulkResponse
+		if err := json.Unmarshal(data, &br); err != nil || len(br.Items) != len(docs) {
+			return indexed, fmt.Errorf("_bulk: unexpected answer")
+		}
+		var again []esDoc
+		lastErr = nil
+		for i, item := range br.Items {
+			for _, res := range item {
+				switch {
+				case res.Status < 300:
+					indexed++
+				case res.Status == http.StatusTooManyRequests:
+					again = append(again, docs[i])
+					lastErr = &esUnreachable{fmt.Errorf("_bulk: %d documents pushed back with 429", len(again))}
+				case res.Error != nil:
+					lastErr = fmt.Errorf("%s: %s", res.Error.Type, res.Error.Reason)
+				default:
+					lastErr = fmt.Errorf("_bulk: document status %d", res.Status)
+				}
+			}
+		}
+		if len(again) == 0 {
+			return indexed, lastErr
+		}
+		docs = again
+	}
+	return indexed, lastErr
+}
+
+// printSummary reports the documents indexed and those that were not,
+// with the last failure.
+func (e *esExporter) printSummary(w io.Writer) {
+	if e == nil {
+		return
+	}
+	fmt.Fprintf(w, "  elasticsearch: %d documents indexed into %s", e.indexed, e.index)
+	if e.failed > 0 {
+		fmt.Fprintf(w, ", %d not indexed (%v)", e.failed, e.err)
+	}
+	fmt.Fprintln(w)
+}
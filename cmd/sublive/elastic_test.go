@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// fakeES is an httptest cluster that records the _bulk requests it gets
+// and answers each with reply, given the request number and its
+// document IDs: the HTTP status and the status of every document.
+type fakeES struct {
+	*httptest.Server
+	reply func(n int, ids []string) (int, []int)
+
+	mu       sync.Mutex
+	bulks    [][]string
+	auth     []string
+	template string
+}
+
+func serveES(t *testing.T, reply func(n int, ids []string) (int, []int)) *fakeES {
+	f := &fakeES{reply: reply}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.auth = append(f.auth, r.Header.Get("Authorization"))
+		if r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_index_template/") {
+			f.template = r.URL.Path
+			return
+		}
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var ids []string
+		sc := bufio.NewScanner(r.Body)
+		for line := 0; sc.Scan(); line++ {
+			if line%2 == 0 {
+				var action map[string]map[string]string
+				json.Unmarshal(sc.Bytes(), &action)
+				ids = append(ids, action["index"]["_id"])
+			}
+		}
+		f.bulks = append(f.bulks, ids)
+		code, statuses := f.reply(len(f.bulks), ids)
+		if code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		var items []map[string]map[string]int
+		for _, st := range statuses {
+			items = append(items, map[string]map[string]int{"index": {"status": st}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"errors": slices.ContainsFunc(statuses, func(s int) bool { return s >= 300 }), "items": items})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// allOK answers every document of every request with 201.
+func allOK(n int, ids []string) (int, []int) {
+	return http.StatusOK, slices.Repeat([]int{201}, len(ids))
+}
+
+func esResults(n int) []sublive.Result {
+	var rs []sublive.Result
+	for i := range n {
+		rs = append(rs, sublive.Result{Subdomain: fmt.Sprintf("h%d.example.com", i), Status: 200})
+	}
+	return rs
+}
+
+func TestESExport(t *testing.T) {
+	wait := esRetryWait
+	esRetryWait = time.Millisecond
+	t.Cleanup(func() { esRetryWait = wait })
+	meta := &runMeta{Target: "example.com", Started: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		name            string
+		reply           func(n int, ids []string) (int, []int)
+		indexed, failed int
+		// sizes are the documents of each _bulk request made
+		sizes []int
+	}{
+		{"batches", allOK, 5, 0, []int{2, 2, 1}},
+		{"5xx retried", func(n int, ids []string) (int, []int) {
+			if n == 1 {
+				return http.StatusServiceUnavailable, nil
+			}
+			return allOK(n, ids)
+		}, 5, 0, []int{2, 2, 2, 1}},
+		// only the pushed back document is sent again
+		{"429 documents retried", func(n int, ids []string) (int, []int) {
+			if n == 1 {
+				return http.StatusOK, []int{201, 429}
+			}
+			return allOK(n, ids)
+		}, 5, 0, []int{2, 1, 2, 1}},
+		// a cluster down for every try of the first batch gets no more
+		{"down", func(n int, ids []string) (int, []int) { return http.StatusBadGateway, nil }, 0, 5, []int{2, 2, 2, 2}},
+		// no retry helps a rejected request; the next batch is still tried
+		{"rejected", func(n int, ids []string) (int, []int) {
+			if n == 1 {
+				return http.StatusUnauthorized, nil
+			}
+			return allOK(n, ids)
+		}, 3, 2, []int{2, 2, 1}},
+		{"document error", func(n int, ids []string) (int, []int) {
+			return http.StatusOK, append([]int{400}, slices.Repeat([]int{201}, len(ids)-1)...)
+		}, 2, 3, []int{2, 2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := serveES(t, tt.reply)
+			e, err := newESExporter(es.URL, "recon", "", "", 2, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			indexed, failed := e.export(slices.Values(esResults(5)), meta)
+			if indexed != tt.indexed || failed != tt.failed {
+				t.Errorf("%d indexed and %d failed, want %d and %d", indexed, failed, tt.indexed, tt.failed)
+			}
+			es.mu.Lock()
+			defer es.mu.Unlock()
+			var sizes []int
+			for _, ids := range es.bulks {
+				sizes = append(sizes, len(ids))
+			}
+			if !slices.Equal(sizes, tt.sizes) {
+				t.Errorf("_bulk sizes %v, want %v", sizes, tt.sizes)
+			}
+			if id := es.bulks[0][0]; id != "example.com-20260301T120000Z:h0.example.com" {
+				t.Errorf("document ID %q", id)
+			}
+		})
+	}
+}
+
+func TestESExporterAuth(t *testing.T) {
+	es := serveES(t, allOK)
+	e, err := newESExporter(es.URL+"/", "recon", "", "c2VjcmV0", 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.export(slices.Values(esResults(1)), &runMeta{})
+	b, err := newESExporter(es.URL, "recon", "elastic:changeme", "", 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.export(slices.Values(esResults(1)), &runMeta{})
+	var sum strings.Builder
+	b.printSummary(&sum)
+	if want := "  elasticsearch: 1 documents indexed into recon\n"; sum.String() != want {
+		t.Errorf("summary %q, want %q", sum.String(), want)
+	}
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.template != "/_index_template/sublive-recon" {
+		t.Errorf("template put at %q", es.template)
+	}
+	want := []string{"ApiKey c2VjcmV0", "ApiKey c2VjcmV0", "Basic ZWxhc3RpYzpjaGFuZ2VtZQ=="}
+	if !slices.Equal(es.auth, want) {
+		t.Errorf("authorization %q, want %q", es.auth, want)
+	}
+	for _, bad := range []struct{ url, index string }{{"localhost:9200", "recon"}, {es.URL, "Recon"}, {es.URL, "_recon"}} {
+		if _, err := newESExporter(bad.url, bad.index, "", "", 10, false); err == nil {
+			t.Errorf("-es-url %q -es-index %q accepted", bad.url, bad.index)
+		}
+	}
+}
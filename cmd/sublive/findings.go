@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rishavand1/sublive"
+)
+
+// interestingPattern compiles the -interesting expression; an empty one
+// turns the interesting-name finding off.
+func interestingPattern(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("-interesting: %v", err)
+	}
+	return re, nil
+}
+
+// filterFindings returns the results of subs with at least one finding.
+func filterFindings(subs []sublive.Result) []sublive.Result {
+	out := []sublive.Result{}
+	for _, r := range subs {
+		if len(r.Findings) > 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// writeFindings writes results grouped by finding tag, most severe first,
+// as lines of format under a "tag (n):" heading; a result with several
+// findings is listed under each. JSON is written by writeResults as is.
+func writeFindings(w io.Writer, meta *runMeta, results []sublive.Result, format string, punycodeOnly bool) error {
+	if format == "json" {
+		return writeResults(w, meta, "", nil, results, format, punycodeOnly)
+	}
+	if meta != nil && meta.comments {
+		if err := meta.writeComments(w); err != nil {
+			return err
+		}
+	}
+	first := true
+	for _, tag := range sublive.Findings {
+		var group []sublive.Result
+		for _, r := range results {
+			if slices.Contains(r.Findings, tag) {
+				group = append(group, r)
+			}
+		}
+		if len(group) == 0 {
+			continue
+		}
+		heading := fmt.Sprintf("%s (%d):\n", tag, len(group))
+		if !first {
+			heading = "\n" + heading
+		}
+		first = false
+		if _, err := io.WriteString(w, heading); err != nil {
+			return err
+		}
+		var b strings.Builder
+		writeResults(&b, nil, "", nil, group, format, punycodeOnly)
+		for line := range strings.Lines(b.String()) {
+			if _, err := io.WriteString(w, "  "+line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// printFindingCounts prints how many results have each finding.
+func printFindingCounts(w io.Writer, results []sublive.Result) {
+	counts := map[string]int{}
+	for _, r := range results {
+		for _, f := range r.Findings {
+			counts[f]++
+		}
+	}
+	parts := []string{}
+	for _, tag := range sublive.Findings {
+		if counts[tag] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[tag], tag))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "none")
+	}
+	fmt.Fprintf(w, "  findings: %s\n", strings.Join(parts, ", "))
+}
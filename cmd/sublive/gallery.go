@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// shotClasses are the classes -screenshot captures.
+var shotClasses = []sublive.Class{sublive.ClassLive, sublive.ClassRedirect, sublive.ClassAuth}
+
+// takeScreenshots captures the live, redirecting and auth-gated results
+// into dir with an index.html gallery and prints the outcome to w. A
+// missing browser is reported and otherwise ignored.
+func takeScreenshots(w io.Writer, meta *runMeta, dir string, results []sublive.Result, workers int, timeout time.Duration) {
+	shots, err := screenshots(context.Background(), filterClasses(results, shotClasses), dir, workers, timeout)
+	if errors.Is(err, errNoBrowser) {
+		logger.Warn("-screenshot skipped", "error", err)
+		return
+	}
+	if err != nil {
+		logger.Warn("-screenshot failed", "error", err)
+		return
+	}
+	if err := writeGallery(filepath.Join(dir, "index.html"), meta, shots); err != nil {
+		logger.Warn("-screenshot: writing index.html failed", "error", err)
+	}
+	failed := 0
+	for _, s := range shots {
+		if s.Err != nil {
+			failed++
+		}
+	}
+	fmt.Fprintf(w, "  screenshots: %d saved to %s, %d failed\n", len(shots)-failed, dir, failed)
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>sublive screenshots</title>
+<style>
+body{font-family:sans-serif;margin:1em}
+.shot{display:inline-block;vertical-align:top;width:330px;margin:0 1em 1em 0;font-size:13px;word-wrap:break-word}
+.shot img{width:320px;border:1px solid #ccc}
+.err{color:#a00}
+.meta{color:#555}
+</style></head><body>
+<h1>{{len .Shots}} hosts</h1>
+{{with .Meta}}<p class="meta">{{.Tool}} {{.Version}}{{with .Target}} &middot; {{.}}{{end}} &middot; {{.Started.Format "2006-01-02T15:04:05Z07:00"}} to {{.Finished.Format "2006-01-02T15:04:05Z07:00"}}<br><code>{{.Command}}</code></p>{{end}}
+{{range .Shots}}<div class="shot">
+{{if .File}}<a href="{{.File}}"><img src="{{.File}}" alt="{{.Result.Subdomain}}" loading="lazy"></a>{{end}}
+<div><a href="{{.Result.URL}}">{{.Result.URL}}</a> [{{.Result.Status}}]</div>
+{{with .Result.Title}}<div>{{.}}</div>{{end}}
+<div>{{.Result.IP}}{{with .Result.CDN}} ({{.}}){{end}}</div>
+{{with .Err}}<div class="err">{{.}}</div>{{end}}
+</div>
+{{end}}</body></html>
+`))
+
+// writeGallery writes an HTML page at path headed by meta, when not nil,
+// with a thumbnail and the result data of every shot, sorted by subdomain.
+func writeGallery(path string, meta *runMeta, shots []shot) error {
+	shots = slices.Clone(shots)
+	slices.SortFunc(shots, func(a, b shot) int {
+		if a.Result.Subdomain < b.Result.Subdomain {
+			return -1
+		}
+		if a.Result.Subdomain > b.Result.Subdomain {
+			return 1
+		}
+		return 0
+	})
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := galleryTemplate.Execute(f, struct {
+		Meta  *runMeta
+		Shots []shot
+	}{meta, shots}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
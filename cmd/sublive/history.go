@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// writeTimeline writes the history of domain: its runs and, per
+// subdomain, when it was first and last seen and how it answered in each
+// run. format "json" writes a JSON document instead.
+func writeTimeline(w io.Writer, domain string, runs []time.Time, records []sublive.HistoryRecord, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Domain string                  `json:"domain"`
+			Runs   []time.Time             `json:"runs"`
+			Hosts  []sublive.HistoryRecord `json:"hosts"`
+		}{domain, runs, records})
+	}
+	fmt.Fprintf(w, "%s: %d runs, %s to %s, %d hosts\n", domain, len(runs),
+		runs[0].Format(time.RFC3339), runs[len(runs)-1].Format(time.RFC3339), len(records))
+	for _, rec := range records {
+		fmt.Fprintf(w, "\n%s first seen %s, last seen %s\n", rec.Subdomain, rec.FirstSeen.Format(time.RFC3339), rec.LastSeen.Format(time.RFC3339))
+		for _, run := range rec.Runs {
+			line := fmt.Sprintf("  %s %d", run.At.Format(time.RFC3339), run.Status)
+			if run.IP != "" {
+				line += " " + run.IP
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runHistory(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: sublive history [flags] domain\n\nShow what the scan -db history file remembers about a domain.\n\n")
+		flags.PrintDefaults()
+	}
+	dbPath := flags.String("db", "history.db", "history file written by scan -db")
+	format := flags.String("format", "text", "output format: text or json")
+	jsonOut := flags.Bool("json", false, "shorthand for -format json")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *jsonOut {
+		*format = "json"
+	}
+	domain, err := sublive.ToASCII(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid domain '%s': %v\n", flags.Arg(0), err)
+		os.Exit(1)
+	}
+	// opening read-only doesn't create a missing file; say so plainly
+	if _, err := os.Stat(*dbPath); errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "history: %s does not exist (scan -db writes it)\n", *dbPath)
+		os.Exit(1)
+	}
+	history, err := sublive.OpenHistory(*dbPath, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "history: %v\n", err)
+		os.Exit(1)
+	}
+	defer history.Close()
+	runs, records, err := history.Timeline(domain)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "history: %v\n", err)
+		os.Exit(1)
+	}
+	if len(runs) == 0 {
+		fmt.Fprintf(os.Stderr, "history: no runs for %s in %s\n", domain, *dbPath)
+		os.Exit(1)
+	}
+	if err := writeTimeline(os.Stdout, domain, runs, records, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "history: %v\n", err)
+		os.Exit(1)
+	}
+}
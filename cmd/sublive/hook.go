@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// execHook is the Scanner.Hook of -exec-hook: the results that pass keep,
+// the output filters, are collected into batches of size and each batch
+// is fed to the command as JSON lines on its stdin, so hosts don't cost a
+// fork each. It runs on the scanner's hook goroutine, which a slow
+// command only holds up until the hook queue fills and results are
+// dropped; a command that fails is logged and the scan goes on. A nil
+// execHook does nothing.
+type execHook struct {
+	args    []string
+	size    int
+	timeout time.Duration
+	keep    func([]sublive.Result) []sublive.Result
+	pending []sublive.Result
+	// sent counts the results handed to the command, batches its runs
+	// and failed those that didn't exit 0
+	sent, batches, failed int
+}
+
+// newExecHook returns the hook running command, split on spaces into the
+// program and its arguments, for batches of size results, each run
+// limited to timeout.
+func newExecHook(command string, size int, timeout time.Duration, keep func([]sublive.Result) []sublive.Result) (*execHook, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("-exec-hook: no command")
+	}
+	if size < 1 {
+		return nil, fmt.Errorf("-exec-hook-batch must be >= 1")
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, fmt.Errorf("-exec-hook: %v", err)
+	}
+	return &execHook{args: args, size: size, timeout: timeout, keep: keep}, nil
+}
+
+// add is the Scanner.Hook: it queues r when it passes the filters and
+// runs the command once a batch is full.
+func (h *execHook) add(r sublive.Result) {
+	if len(h.keep([]sublive.Result{r})) == 0 {
+		return
+	}
+	h.pending = append(h.pending, r)
+	if len(h.pending) >= h.size {
+		h.flush()
+	}
+}
+
+// flush runs the command for the results still queued. It is called when
+// the scan's result channel is closed, so the hook goroutine is done.
+func (h *execHook) flush() {
+	if h == nil || len(h.pending) == 0 {
+		return
+	}
+	batch := h.pending
+	h.pending = nil
+	h.batches++
+	h.sent += len(batch)
+	if err := h.run(batch); err != nil {
+		h.failed++
+		logger.Warn("exec hook failed", "command", strings.Join(h.args, " "), "results", len(batch), "error", err)
+	}
+}
+
+// run feeds batch to one run of the command, whose output goes to stderr.
+func (h *execHook) run(batch []sublive.Result) error {
+	var in bytes.Buffer
+	enc := json.NewEncoder(&in)
+	for _, r := range batch {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	ctx := context.Background()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, h.args[0], h.args[1:]...)
+	cmd.Stdin = &in
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("killed after %s", h.timeout)
+	}
+	return err
+}
+
+// printSummary reports what the hook sent, and what it lost to a full
+// queue or a scan cut short (dropped, from Scanner.HookDropped) or to
+// failures.
+func (h *execHook) printSummary(w io.Writer, dropped int) {
+	fmt.Fprintf(w, "  exec hook: %d results in %d batches", h.sent, h.batches)
+	if h.failed > 0 {
+		fmt.Fprintf(w, ", %d batches failed", h.failed)
+	}
+	if dropped > 0 {
+		fmt.Fprintf(w, ", %d results dropped by the hook queue", dropped)
+	}
+	fmt.Fprintln(w)
+}
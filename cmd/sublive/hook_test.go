@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// hookScript writes a shell script that appends the number of lines it
+// reads to a log file, then exits with code, and returns them.
+func hookScript(t *testing.T, code int) (script, log string) {
+	t.Helper()
+	dir := t.TempDir()
+	script, log = filepath.Join(dir, "hook.sh"), filepath.Join(dir, "hook.log")
+	body := fmt.Sprintf("#!/bin/sh\nwc -l | tr -d ' ' >> %s\nexit %d\n", log, code)
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return script, log
+}
+
+func TestExecHook(t *testing.T) {
+	live := func(rs []sublive.Result) []sublive.Result {
+		var out []sublive.Result
+		for _, r := range rs {
+			if r.Status == 200 {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+	tests := []struct {
+		name    string
+		code    int
+		batches string
+		dropped int
+		summary string
+	}{
+		{"batches", 0, "2\n2\n1\n", 0, "  exec hook: 5 results in 3 batches\n"},
+		{"nonzero exit", 3, "2\n2\n1\n", 4, "  exec hook: 5 results in 3 batches, 3 batches failed, 4 results dropped by the hook queue\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, log := hookScript(t, tt.code)
+			h, err := newExecHook(script, 2, 10*time.Second, live)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the dead names in between are filtered out before batching
+			for i := range 5 {
+				h.add(sublive.Result{Subdomain: fmt.Sprintf("h%d.example.com", i), Status: 200})
+				h.add(sublive.Result{Subdomain: fmt.Sprintf("gone%d.example.com", i)})
+			}
+			h.flush()
+			b, err := os.ReadFile(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.batches {
+				t.Errorf("batch sizes %q, want %q", b, tt.batches)
+			}
+			var sum strings.Builder
+			h.printSummary(&sum, tt.dropped)
+			if sum.String() != tt.summary {
+				t.Errorf("summary %q, want %q", sum.String(), tt.summary)
+			}
+		})
+	}
+}
+
+func TestExecHookTimeout(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "slow.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexec sleep 10\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	h, err := newExecHook(script, 1, 50*time.Millisecond, func(rs []sublive.Result) []sublive.Result { return rs })
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	h.add(sublive.Result{Subdomain: "a.example.com"})
+	if d := time.Since(start); d > 5*time.Second || h.failed != 1 {
+		t.Errorf("hung hook ran %s, %d failed", d, h.failed)
+	}
+	if _, err := newExecHook("no-such-hook-command", 1, 0, nil); err == nil {
+		t.Error("a missing command was accepted")
+	}
+}
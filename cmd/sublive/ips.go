@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/rishavand1/sublive"
+)
+
+// maxIPTargets caps the addresses one ips run expands its input to.
+const maxIPTargets = 1 << 20
+
+// expandTargets returns the addresses of specs, which are single
+// addresses or CIDRs, in order and without duplicates.
+func expandTargets(specs []string) ([]string, error) {
+	seen := map[netip.Addr]bool{}
+	var out []string
+	add := func(a netip.Addr) error {
+		if seen[a] {
+			return nil
+		}
+		if len(out) == maxIPTargets {
+			return fmt.Errorf("more than %d addresses", maxIPTargets)
+		}
+		seen[a] = true
+		out = append(out, a.String())
+		return nil
+	}
+	for _, spec := range specs {
+		if !strings.Contains(spec, "/") {
+			a, err := netip.ParseAddr(spec)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an address or CIDR", spec)
+			}
+			if err := add(a); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		p, err := netip.ParsePrefix(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR", spec)
+		}
+		if p.Addr().BitLen()-p.Bits() > 20 {
+			return nil, fmt.Errorf("%s has more than %d addresses", spec, maxIPTargets)
+		}
+		p = p.Masked()
+		for a := p.Addr(); a.IsValid() && p.Contains(a); a = a.Next() {
+			if err := add(a); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// readTargetFile returns the lines of path other than blank ones and #
+// comments.
+func readTargetFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var specs []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			specs = append(specs, line)
+		}
+	}
+	return specs, s.Err()
+}
+
+// ipSeeds turns the names recovered from addresses into candidates,
+// each once with the first address and source that produced it. With
+// domains only names inside one of them are kept, with it as their
+// domain.
+func ipSeeds(found []sublive.IPNames, domains []string) []sublive.Candidate {
+	seen := map[string]bool{}
+	var seeds []sublive.Candidate
+	add := func(name, source, ip string) {
+		if seen[name] {
+			return
+		}
+		domain := ""
+		if len(domains) > 0 {
+			for _, d := range domains {
+				if sublive.InDomain(name, d) {
+					domain = d
+					break
+				}
+			}
+			if domain == "" {
+				return
+			}
+		}
+		seen[name] = true
+		seeds = append(seeds, sublive.Candidate{Name: name, Domain: domain, Source: source, Origin: ip})
+	}
+	for _, f := range found {
+		for _, n := range f.PTR {
+			add(n, sublive.SourcePTR, f.IP)
+		}
+		for _, n := range f.Cert {
+			add(n, sublive.SourceCert, f.IP)
+		}
+	}
+	return seeds
+}
+
+func runIPs(args []string) {
+	probeCommand("ips", "usage: sublive ips [flags] -cidr 203.0.113.0/24 | -iL ips.txt\n\nRecover hostnames from addresses by PTR lookups and the certificate served on port 443, then probe them like probe does.\n\n", args,
+		func(fs *flag.FlagSet) seedReader {
+			cidrs := &listFlag{split: true}
+			fs.Var(cidrs, "cidr", "addresses or CIDRs to recover names from, comma-separated or repeated")
+			list := fs.String("iL", "", "file with one address or CIDR per line")
+			domains := &listFlag{split: true}
+			fs.Var(domains, "domain", "keep only recovered names in these domains, comma-separated or repeated")
+			return func(env seedEnv) ([]sublive.Candidate, string, error) {
+				specs := cidrs.values
+				if *list != "" {
+					more, err := readTargetFile(*list)
+					if err != nil {
+						return nil, "", fmt.Errorf("-iL: %v", err)
+					}
+					specs = append(specs, more...)
+				}
+				if len(specs) == 0 {
+					return nil, "", fmt.Errorf("no input: give -cidr or -iL")
+				}
+				ips, err := expandTargets(specs)
+				if err != nil {
+					return nil, "", err
+				}
+				var scope []string
+				for _, d := range domains.values {
+					d, err := sublive.ToASCII(d)
+					if err != nil {
+						return nil, "", fmt.Errorf("-domain: %v", err)
+					}
+					scope = append(scope, d)
+				}
+				found := sublive.HarvestIPs(context.Background(), ips, env.resolvers, env.workers, env.timeout)
+				seeds := ipSeeds(found, scope)
+				logger.Info("recovered names", "addresses", len(ips), "with_names", len(found), "names", len(seeds))
+				if len(seeds) == 0 {
+					logger.Warn("no names recovered", "addresses", len(ips))
+				}
+				return seeds, strings.Join(specs, ","), nil
+			}
+		})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logger receives diagnostics: on stderr at warn level (info with -v)
+// and, with -log, in a file at -log-level. Only results go to stdout.
+var logger = slog.New(consoleHandler(slog.LevelWarn))
+
+// logFile is the -log half of logger, nil without -log.
+var logFile slog.Handler
+
+// consoleHandler writes records of level and above to stderr, without
+// the timestamp a terminal doesn't need.
+func consoleHandler(level slog.Level) slog.Handler {
+	return slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+}
+
+// setupLogging replaces logger according to -v, -log, -log-level and
+// -log-json. level defaults to info for the file; without a file it sets
+// the console level instead. Errors name the offending flag.
+func setupLogging(path, level string, jsonFormat, verbose bool) error {
+	fileLevel, console := slog.LevelInfo, slog.LevelWarn
+	if verbose {
+		console = slog.LevelInfo
+	}
+	if level != "" {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil || strings.ContainsAny(level, "+-") {
+			return fmt.Errorf("-log-level: %q is not debug, info, warn or error", level)
+		}
+		fileLevel = l
+		if path == "" {
+			console = l
+		}
+	}
+	if path == "" {
+		if jsonFormat {
+			return fmt.Errorf("-log-json: needs -log")
+		}
+		logger = slog.New(consoleHandler(console))
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("-log: %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: fileLevel}
+	logFile = slog.NewTextHandler(f, opts)
+	if jsonFormat {
+		logFile = slog.NewJSONHandler(f, opts)
+	}
+	logger = slog.New(slog.NewMultiHandler(consoleHandler(console), logFile))
+	return nil
+}
@@ -0,0 +1,64 @@
+// sublive - fast CLI subdomain liveness scanner
+// Usage: go build -o sublive ./cmd/sublive && ./sublive scan -u example.com -t 2 -v -x -o result.txt
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: sublive <command> [flags]
+
+commands:
+  scan     brute-force and probe subdomains of a domain (-u example.com)
+  resolve  resolve names read from stdin (DNS only)
+  probe    check HTTP liveness of names read from stdin (no wordlist or domain)
+  ips      recover names from addresses or CIDRs by PTR and certificate, then probe them
+  diff     compare two result files (sublive diff old.json new.json)
+  history  show what a scan -db history file remembers about a domain
+
+Run "sublive <command> -h" for the flags of a command.
+
+Compatibility note for scripts parsing the summary: redirects now count every
+3xx (was 301/302), 401/403 are "auth-gated", the remaining 4xx (404 included)
+and 5xx have their own lines, and "unreachable" is split into "resolved, no
+HTTP" and "no DNS". -x keeps 2xx only (was 200-399); add -include-auth for
+401/403.
+`)
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "scan":
+		runScan(args[1:])
+	case "resolve":
+		runResolve(args[1:])
+	case "probe":
+		runProbe(args[1:])
+	case "ips":
+		runIPs(args[1:])
+	case "diff":
+		runDiff(args[1:])
+	case "history":
+		runHistory(args[1:])
+	case "help", "-h", "-help", "--help":
+		usage()
+	default:
+		if !strings.HasPrefix(args[0], "-") {
+			fmt.Fprintf(os.Stderr, "sublive: unknown command %q\n\n", args[0])
+			usage()
+			os.Exit(2)
+		}
+		// legacy flat flags map to scan
+		fmt.Fprintln(os.Stderr, "sublive: running without a command is deprecated and will be removed in a future release; use \"sublive scan ...\"")
+		runScan(args)
+	}
+}
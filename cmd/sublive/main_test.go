@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the command itself when a test re-executes the test
+// binary with SUBLIVE_TEST_MAIN set, so tests see its real streams.
+func TestMain(m *testing.M) {
+	if os.Getenv("SUBLIVE_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs sublive with args and stdin in a scratch directory and
+// returns what it wrote to stdout and stderr.
+func runMain(t *testing.T, stdin string, args ...string) (stdout, stderr string) {
+	t.Helper()
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "SUBLIVE_TEST_MAIN=1", "HOME="+dir)
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("sublive %s: %v\n%s", strings.Join(args, " "), err, errOut.String())
+	}
+	return out.String(), errOut.String()
+}
+
+func TestStreams(t *testing.T) {
+	words := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(words, []byte("gone\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// a closed resolver port fails every lookup at once, without a network
+	scan := []string{"scan", "-u", "example.com", "-w", words, "-r", "127.0.0.1:1", "-force", "-v"}
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		// results and summary say whether stdout carries them; the
+		// summary is on stderr otherwise
+		results, summary bool
+		json             bool
+	}{
+		{"scan", "", scan, true, true, false},
+		{"scan quiet", "", append(scan, "-q"), false, true, false},
+		{"scan json", "", append(scan, "-json"), true, false, true},
+		{"probe", "gone.example.com\n", []string{"probe", "-r", "127.0.0.1:1", "-v"}, true, false, false},
+		{"probe quiet", "gone.example.com\n", []string{"probe", "-r", "127.0.0.1:1", "-v", "-q"}, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := runMain(t, tt.stdin, tt.args...)
+			if strings.Contains(stdout, "level=") {
+				t.Errorf("diagnostics on stdout:\n%s", stdout)
+			}
+			if !strings.Contains(stderr, "msg=checked subdomain=gone.example.com") {
+				t.Errorf("no -v progress on stderr:\n%s", stderr)
+			}
+			if got := strings.Contains(stdout, "gone.example.com"); got != tt.results {
+				t.Errorf("results on stdout %v, want %v:\n%s", got, tt.results, stdout)
+			}
+			summary := "Summary for example.com"
+			if tt.args[0] == "probe" {
+				summary = "Probed 1 names"
+			}
+			if got := strings.Contains(stdout, summary); got != tt.summary {
+				t.Errorf("summary on stdout %v, want %v:\n%s", got, tt.summary, stdout)
+			}
+			if !tt.summary && !strings.Contains(stderr, summary) {
+				t.Errorf("no summary on stderr:\n%s", stderr)
+			}
+			if tt.json && !json.Valid([]byte(stdout)) {
+				t.Errorf("stdout is not one JSON document:\n%s", stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rishavand1/sublive"
+)
+
+// manifestInputs are the flags naming input files, whose contents the
+// manifest hashes.
+var manifestInputs = []string{"w", "l", "known-file", "perm-file", "rL", "scope-file", "recheck", "diff", "geoip", "asn-file", "cdn-ranges", "cloud-ranges", "resume"}
+
+// manifestOutputs are the flags that change where and how results are
+// written but not what is found; settingDiffs ignores them.
+var manifestOutputs = []string{"o", "format", "json", "q", "no-summary", "metadata", "deterministic", "manifest", "o-dir", "ou", "o-hosts", "screenshot", "screenshot-workers", "screenshot-timeout", "log", "log-level", "log-json", "v", "tui", "metrics", "state", "webhook", "interval", "db", "config", "config-dump", "checkpoint-every", "checkpoint-keep", "es-url", "es-index", "es-user", "es-api-key", "es-batch", "es-create-template"}
+
+// manifest is the -manifest record of a run, to reproduce and audit it:
+// the metadata of the JSON output, the flags set and where, the hashes of
+// the input files, the resolvers, and the summary counts and budget of
+// the run. diff and monitor check two of them with settingDiffs.
+type manifest struct {
+	runMeta
+	// Partial marks a run that was interrupted or stopped early; one
+	// written on a second interrupt has no counts
+	Partial bool `json:"partial,omitempty"`
+	// Flags are the values of every flag, by name, and whether they were
+	// given on the command line ("flag"), in the config file ("config") or
+	// left at the default ("default")
+	Flags     map[string]manifestFlag `json:"flags"`
+	Config    string                  `json:"config,omitempty"`
+	Files     []manifestFile          `json:"files,omitempty"`
+	Resolvers []string                `json:"resolvers"`
+	// Skipped are the candidates not probed, RateDeferred the probes
+	// held back by a Retry-After
+	Skipped       int                    `json:"skipped"`
+	RateDeferred  int                    `json:"rate_deferred,omitempty"`
+	Summary       *resultSummary         `json:"summary,omitempty"`
+	Budget        *manifestBudget        `json:"budget,omitempty"`
+	ResolverStats []sublive.ResolverStat `json:"resolver_stats,omitempty"`
+}
+
+type manifestFlag struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// manifestFile is one input file of a flag.
+type manifestFile struct {
+	Flag   string `json:"flag"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// manifestBudget is the consumption of -max-requests and -max-bytes.
+type manifestBudget struct {
+	Requests    int64 `json:"requests"`
+	Bytes       int64 `json:"bytes"`
+	MaxRequests int64 `json:"max_requests,omitempty"`
+	MaxBytes    int64 `json:"max_bytes,omitempty"`
+	Exhausted   bool  `json:"exhausted,omitempty"`
+}
+
+// newManifest starts the manifest of a run with the flags of fs, those in
+// sources set, the config file used, if any, and the resolvers, none meaning
+// those of /etc/resolv.conf. The input files are hashed right away, as
+// the run reads them.
+func newManifest(fs *flag.FlagSet, sources map[string]string, config string, resolvers []string) (*manifest, error) {
+	m := &manifest{Flags: map[string]manifestFlag{}, Config: config, Resolvers: resolvers}
+	if len(m.Resolvers) == 0 {
+		m.Resolvers = sublive.SystemNameservers()
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		source := cmp.Or(sources[f.Name], "default")
+		value := redactValue(f.Name, f.Value.String())
+		if l, ok := f.Value.(*listFlag); ok {
+			values := make([]string, len(l.values))
+			for i, v := range l.values {
+				values[i] = redactValue(f.Name, v)
+			}
+			value = strings.Join(values, ",")
+		}
+		m.Flags[f.Name] = manifestFlag{value, source}
+		if source == "default" || !slices.Contains(manifestInputs, f.Name) {
+			return
+		}
+		paths := []string{f.Value.String()}
+		if l, ok := f.Value.(*listFlag); ok {
+			paths = l.values
+		}
+		for _, path := range paths {
+			var file manifestFile
+			if file, err = hashFile(path); err != nil {
+				err = fmt.Errorf("-manifest: -%s: %v", f.Name, err)
+				return
+			}
+			file.Flag = f.Name
+			m.Files = append(m.Files, file)
+		}
+	})
+	return m, err
+}
+
+// hashFile returns the size and SHA-256 of the file at path.
+func hashFile(path string) (manifestFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return manifestFile{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return manifestFile{}, err
+	}
+	return manifestFile{Path: path, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// finish fills in the results of the run: meta, with its summary, and
+// the counters of scanner. partial marks a run that stopped early.
+func (m *manifest) finish(meta *runMeta, scanner *sublive.Scanner, partial bool) *manifest {
+	m.runMeta = *meta
+	m.Summary = meta.summary
+	m.Partial = partial
+	m.Skipped = scanner.Skipped()
+	m.RateDeferred = scanner.RateDeferred()
+	if scanner.MaxRequests > 0 || scanner.MaxBytes > 0 {
+		requests, bytes := scanner.Usage()
+		m.Budget = &manifestBudget{requests, bytes, scanner.MaxRequests, scanner.MaxBytes, scanner.BudgetExhausted()}
+	}
+	if scanner.ResolverSet != nil {
+		m.ResolverStats = scanner.ResolverSet.Stats()
+	}
+	return m
+}
+
+// write saves m to path as indented JSON.
+func (m *manifest) write(path string) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+}
+
+// loadManifest reads a manifest written with -manifest.
+func loadManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// settingDiffs lists the differences between the settings of the runs of
+// two manifests that make their results unfit to compare: the version,
+// the target, the flags other than manifestOutputs, the contents of the
+// input files, the resolvers, and a run that stopped early. It is empty
+// when there are none.
+func settingDiffs(prev, cur *manifest) []string {
+	var out []string
+	if prev.Version != cur.Version {
+		out = append(out, fmt.Sprintf("version %s vs %s", prev.Version, cur.Version))
+	}
+	if prev.Target != cur.Target {
+		out = append(out, fmt.Sprintf("target %q vs %q", prev.Target, cur.Target))
+	}
+	names := []string{}
+	for name := range prev.Flags {
+		names = append(names, name)
+	}
+	for name := range cur.Flags {
+		if _, ok := prev.Flags[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	value := func(m *manifest, name string) string {
+		if f, ok := m.Flags[name]; ok {
+			return f.Value
+		}
+		return "(none)"
+	}
+	for _, name := range names {
+		// input files are compared by content below, wherever they are
+		if slices.Contains(manifestOutputs, name) || slices.Contains(manifestInputs, name) {
+			continue
+		}
+		if a, b := value(prev, name), value(cur, name); a != b {
+			out = append(out, fmt.Sprintf("-%s %s vs %s", name, a, b))
+		}
+	}
+	hashes := func(m *manifest, name string) string {
+		var hs []string
+		for _, f := range m.Files {
+			if f.Flag == name {
+				hs = append(hs, f.SHA256)
+			}
+		}
+		slices.Sort(hs)
+		return strings.Join(hs, ",")
+	}
+	for _, name := range manifestInputs {
+		if name == "diff" || name == "recheck" {
+			continue
+		}
+		if hashes(prev, name) != hashes(cur, name) {
+			out = append(out, fmt.Sprintf("-%s file contents differ", name))
+		}
+	}
+	if !slices.Equal(slices.Sorted(slices.Values(prev.Resolvers)), slices.Sorted(slices.Values(cur.Resolvers))) {
+		out = append(out, fmt.Sprintf("resolvers %s vs %s", strings.Join(prev.Resolvers, ","), strings.Join(cur.Resolvers, ",")))
+	}
+	if prev.Partial {
+		out = append(out, "the previous run stopped early")
+	}
+	if cur.Partial {
+		out = append(out, "the current run stopped early")
+	}
+	return out
+}
+
+// warnIncomparable prints the differences of settingDiffs to stderr, so
+// they stand out above the comparison of the results of runs that follows.
+func warnIncomparable(runs string, diffs []string) {
+	if len(diffs) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[!] WARNING: %s used different settings, the changes may not be real:\n", runs)
+	for _, d := range diffs {
+		fmt.Fprintf(os.Stderr, "[!]   %s\n", d)
+	}
+}
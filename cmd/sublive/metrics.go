@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// serveMetrics serves m on /metrics at addr until ctx ends, then shuts
+// the server down. The listener is opened before returning so a bad
+// -metrics-addr fails at startup; scrapes only read atomics and never
+// hold up the scan.
+func serveMetrics(ctx context.Context, addr string, m *sublive.Metrics) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Warn("metrics server failed", "addr", addr, "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+	logger.Info("serving metrics", "addr", ln.Addr().String())
+	return nil
+}
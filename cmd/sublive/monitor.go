@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// monitor rescans one domain every interval and reports the changes between
+// consecutive cycles.
+type monitor struct {
+	scanner      *sublive.Scanner
+	domain       string
+	words        []string
+	seeds        []sublive.Candidate
+	ct           bool
+	ctTimeout    time.Duration
+	interval     time.Duration
+	statePath    string
+	webhook      string
+	outfile      string
+	format       string
+	punycodeOnly bool
+	// prepare is the output filters of scan, applied to every cycle
+	prepare  func([]sublive.Result) []sublive.Result
+	maxTime  time.Duration
+	metadata bool
+	// quiet leaves the changes out of the cycle lines
+	quiet bool
+	// manifest, with -manifest, is rewritten to manifestPath after every
+	// cycle
+	manifest     *manifest
+	manifestPath string
+	// hook is nil without -exec-hook, es without -es-url
+	hook *execHook
+	es   *esExporter
+}
+
+// logf prints one timestamped monitor line to stdout: the cycles and their
+// changes, the output of -monitor.
+func logf(format string, args ...interface{}) {
+	stampf(os.Stdout, format, args...)
+}
+
+// notef prints one timestamped line of diagnostics, such as a failure or
+// when the next cycle starts, to stderr.
+func notef(format string, args ...interface{}) {
+	stampf(os.Stderr, format, args...)
+}
+
+func stampf(w io.Writer, format string, args ...interface{}) {
+	fmt.Fprintf(w, "[%s] %s\n", time.Now().UTC().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+func (m *monitor) run() {
+	if m.interval <= 0 {
+		fmt.Fprintln(os.Stderr, "-interval must be > 0")
+		os.Exit(1)
+	}
+
+	// the first interrupt lets the running cycle finish and report, the
+	// second one exits at once
+	stop := make(chan struct{})
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Fprintln(os.Stderr, "[!] interrupted: stopping after the current cycle (interrupt again to quit now)")
+		close(stop)
+		<-sigs
+		os.Exit(130)
+	}()
+
+	var previous []sublive.Result
+	if m.statePath != "" {
+		prev, err := sublive.LoadResults(m.statePath)
+		switch {
+		case err == nil:
+			previous = prev
+			notef("loaded %d previous results from %s", len(prev), m.statePath)
+		case errors.Is(err, fs.ErrNotExist):
+		default:
+			logger.Warn("ignoring state file", "file", m.statePath, "error", err)
+		}
+	}
+	// the manifest of an earlier monitor tells whether its state was found
+	// with the same settings
+	if m.manifest != nil {
+		m.manifest.runMeta = *newRunMeta(m.domain, time.Now(), false)
+		prev, err := loadManifest(m.manifestPath)
+		switch {
+		case err == nil:
+			warnIncomparable("the monitor of "+m.manifestPath+" and this one", settingDiffs(prev, m.manifest))
+		case errors.Is(err, fs.ErrNotExist):
+		default:
+			logger.Warn("ignoring manifest", "file", m.manifestPath, "error", err)
+		}
+	}
+
+	for cycle := 1; ; cycle++ {
+		previous = m.cycle(cycle, previous)
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		notef("next cycle at %s", time.Now().Add(m.interval).UTC().Format(time.RFC3339))
+		select {
+		case <-stop:
+			return
+		case <-time.After(m.interval):
+		}
+	}
+}
+
+// cycle runs and reports cycle n against the results of the one before
+// and returns the results to compare the next one with, previous again
+// when the cycle failed.
+func (m *monitor) cycle(n int, previous []sublive.Result) []sublive.Result {
+	start := time.Now()
+	current, probed, err := m.scan()
+	took := time.Since(start).Round(time.Second)
+	if err != nil {
+		notef("cycle %d failed after %s: %v", n, took, err)
+		return previous
+	}
+	if probed != nil {
+		current = keepUnprobed(previous, current, probed)
+	}
+	sublive.CarryFirstSeen(previous, current)
+	m.report(n, previous, current, took, newRunMeta(m.domain, start, m.metadata).finish())
+	return current
+}
+
+// keepUnprobed returns current, the results of a cycle -max-time cut
+// short, with the previous results of the names it didn't get to, so
+// they aren't reported removed now and added again by the next full
+// cycle. probed holds the names the cycle has a result for, before the
+// output filters.
+func keepUnprobed(previous, current []sublive.Result, probed map[string]bool) []sublive.Result {
+	kept := 0
+	for _, r := range previous {
+		if !probed[r.Subdomain] {
+			current = append(current, r)
+			kept++
+		}
+	}
+	if kept > 0 {
+		notef("kept the previous results of %d names not probed", kept)
+		slices.SortFunc(current, func(a, b sublive.Result) int { return strings.Compare(a.Subdomain, b.Subdomain) })
+	}
+	return current
+}
+
+// scan runs one cycle. Seeds are rebuilt every time so new certificate
+// transparency names are picked up. probed is nil for a complete cycle;
+// for one -max-time cut short it holds the names that got a result.
+func (m *monitor) scan() (results []sublive.Result, probed map[string]bool, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	seeds := append(sublive.Candidates(m.words, m.domain), m.seeds...)
+	if m.ct {
+		seeds = addCTSeeds(seeds, m.domain, m.ctTimeout)
+	}
+	m.scanner.Seeds = seeds
+	ctx := context.Background()
+	if m.maxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.maxTime)
+		defer cancel()
+	}
+	results, err = gatherResults(ctx, m.scanner, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.hook.flush()
+	if ctx.Err() != nil {
+		notef("cycle truncated by -max-time %s, %d candidates not probed", m.maxTime, m.scanner.Skipped())
+		probed = make(map[string]bool, len(results))
+		for _, r := range results {
+			probed[r.Subdomain] = true
+		}
+	}
+	return m.prepare(results), probed, nil
+}
+
+// report prints the changes of one cycle and saves its results with meta.
+// The first cycle without a state file only establishes the baseline.
+func (m *monitor) report(cycle int, previous, current []sublive.Result, took time.Duration, meta *runMeta) {
+	if previous == nil {
+		logf("cycle %d: baseline of %d results in %s", cycle, len(current), took)
+	} else {
+		changes := sublive.Diff(previous, current)
+		if len(changes) == 0 {
+			logf("cycle %d: no changes (%d results in %s)", cycle, len(current), took)
+		} else {
+			logf("cycle %d: %d changes (%d results in %s)", cycle, len(changes), len(current), took)
+			if !m.quiet {
+				for _, c := range changes {
+					logf("%s", formatChange(c))
+				}
+			}
+		}
+		if m.webhook != "" {
+			if err := m.notify(newlyLive(changes, current, m.scanner.IsLive)); err != nil {
+				notef("webhook failed: %v", err)
+			}
+		}
+	}
+
+	if m.outfile != "" {
+		if err := writeResultsFile(m.outfile, meta, m.domain, nil, current, m.format, m.punycodeOnly); err != nil {
+			notef("failed to write output: %v", err)
+		}
+	}
+	if m.statePath != "" {
+		if err := writeResultsFile(m.statePath, meta, m.domain, nil, current, "json", false); err != nil {
+			notef("failed to save state: %v", err)
+		}
+	}
+	if m.es != nil {
+		if indexed, failed := m.es.export(slices.Values(current), meta); failed > 0 {
+			notef("%d of %d results not indexed into %s: %v", failed, indexed+failed, m.es.index, m.es.err)
+		}
+	}
+	if m.manifest != nil {
+		cycleMeta := *meta
+		cycleMeta.summary = summarize(current, m.scanner.LiveCodes)
+		if err := m.manifest.finish(&cycleMeta, m.scanner, m.scanner.Skipped() > 0).write(m.manifestPath); err != nil {
+			notef("failed to write -manifest: %v", err)
+		}
+	}
+}
+
+// newlyLive returns the results of hosts that were added live or turned
+// live, by isLive.
+func newlyLive(changes []sublive.Change, current []sublive.Result, isLive func(int) bool) []sublive.Result {
+	byName := make(map[string]sublive.Result, len(current))
+	for _, r := range current {
+		byName[r.Subdomain] = r
+	}
+	out := []sublive.Result{}
+	for _, c := range changes {
+		switch {
+		case c.Kind == sublive.ChangeAdded && isLive(c.NewStatus),
+			c.Kind == sublive.ChangeStatus && !isLive(c.OldStatus) && isLive(c.NewStatus):
+			out = append(out, byName[c.Subdomain])
+		}
+	}
+	return out
+}
+
+// notify POSTs hosts to the webhook as JSON. The text field makes the payload
+// usable by chat webhooks as is.
+func (m *monitor) notify(hosts []sublive.Result) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+	names := make([]string, len(hosts))
+	for i, r := range hosts {
+		names[i] = fmt.Sprintf("%s (%d)", r.Subdomain, r.Status)
+	}
+	body, err := json.Marshal(struct {
+		Text   string           `json:"text"`
+		Domain string           `json:"domain"`
+		Hosts  []sublive.Result `json:"hosts"`
+	}{
+		Text:   fmt.Sprintf("sublive: %d new live hosts on %s: %s", len(hosts), m.domain, strings.Join(names, ", ")),
+		Domain: m.domain,
+		Hosts:  hosts,
+	})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Post(m.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// writeResultsFile replaces path with results, writing a temporary file
+// first so readers never see a partial file.
+func writeResultsFile(path string, meta *runMeta, domain string, records map[string]map[string][]string, results []sublive.Result, format string, punycodeOnly bool) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return writeResults(w, meta, domain, records, results, format, punycodeOnly)
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// monitorBackend resolves every name to one address and answers with the
+// status of pages; while hang is set, names missing from pages wait for
+// the end of the probe's context instead.
+type monitorBackend struct {
+	mu    sync.Mutex
+	pages map[string]int
+	hang  atomic.Bool
+}
+
+func (b *monitorBackend) Resolve(ctx context.Context, host string) (sublive.ResolveResult, error) {
+	return sublive.ResolveResult{IPs: []string{"192.0.2.20"}}, nil
+}
+
+func (b *monitorBackend) Probe(ctx context.Context, target sublive.ProbeTarget) (sublive.ProbeResult, error) {
+	b.mu.Lock()
+	status, ok := b.pages[target.Host]
+	b.mu.Unlock()
+	if !ok && b.hang.Load() {
+		<-ctx.Done()
+		return sublive.ProbeResult{}, ctx.Err()
+	}
+	if !ok {
+		status = 200
+	}
+	return sublive.ProbeResult{
+		Response: &http.Response{StatusCode: status, Proto: "HTTP/1.1", Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))},
+		Scheme:   target.Schemes[0],
+		IP:       target.IPs[0],
+	}, nil
+}
+
+func TestMonitorTruncated(t *testing.T) {
+	var mu sync.Mutex
+	var notified []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Hosts []sublive.Result }
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		for _, h := range body.Hosts {
+			notified = append(notified, h.Subdomain)
+		}
+		mu.Unlock()
+	}))
+	defer hook.Close()
+	backend := &monitorBackend{pages: map[string]int{"a.example.com": 200, "b.example.com": 404, "new.example.com": 200}}
+	backend.hang.Store(true)
+	state := filepath.Join(t.TempDir(), "state.json")
+	m := &monitor{
+		scanner:   &sublive.Scanner{Domains: []string{"example.com"}, NoBackoff: true, Resolver: backend, Prober: backend},
+		domain:    "example.com",
+		words:     []string{"a", "b", "new", "slow"},
+		statePath: state,
+		webhook:   hook.URL,
+		prepare:   func(rs []sublive.Result) []sublive.Result { return rs },
+		maxTime:   200 * time.Millisecond,
+		quiet:     true,
+	}
+	previous := []sublive.Result{
+		{Subdomain: "a.example.com", Domain: "example.com", Status: 200},
+		{Subdomain: "b.example.com", Domain: "example.com", Status: 200},
+		{Subdomain: "slow.example.com", Domain: "example.com", Status: 200},
+	}
+
+	// slow is cut off by -max-time: it keeps its last result
+	current := m.cycle(2, previous)
+	byName := map[string]int{}
+	for _, r := range current {
+		byName[r.Subdomain] = r.Status
+	}
+	want := map[string]int{"a.example.com": 200, "b.example.com": 404, "new.example.com": 200, "slow.example.com": 200}
+	if len(byName) != len(want) {
+		t.Errorf("truncated cycle results %v, want %v", byName, want)
+	}
+	for name, st := range want {
+		if byName[name] != st {
+			t.Errorf("%s: status %d, want %d", name, byName[name], st)
+		}
+	}
+	for _, c := range sublive.Diff(previous, current) {
+		if c.Kind == sublive.ChangeRemoved {
+			t.Errorf("truncated cycle removed %s", c.Subdomain)
+		}
+	}
+	saved, err := sublive.LoadResults(state)
+	if err != nil || len(saved) != len(want) {
+		t.Errorf("state file has %d results (%v), want %d", len(saved), err, len(want))
+	}
+
+	// the next, full, cycle gets to slow: nothing is added or new
+	backend.hang.Store(false)
+	m.maxTime = 0
+	next := m.cycle(3, current)
+	for _, c := range sublive.Diff(current, next) {
+		t.Errorf("full cycle change %+v", c)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(notified, ",") != "new.example.com" {
+		t.Errorf("webhook notified %q, want only new.example.com", notified)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/rishavand1/sublive"
+)
+
+// netSlowest is how many of the slowest hosts -profile-net lists.
+const netSlowest = 10
+
+// netProfile aggregates the Result.Timing of a -profile-net run: the
+// percentiles of every phase, over the probes where it happened, and the
+// hosts that took longest overall.
+type netProfile struct {
+	DNS     phaseStats `json:"dns"`
+	Connect phaseStats `json:"connect"`
+	TLS     phaseStats `json:"tls"`
+	TTFB    phaseStats `json:"ttfb"`
+	Slowest []slowHost `json:"slowest"`
+}
+
+type phaseStats struct {
+	Count int     `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	MaxMs float64 `json:"max_ms"`
+}
+
+type slowHost struct {
+	Subdomain string `json:"subdomain"`
+	sublive.NetTiming
+	TotalMs float64 `json:"total_ms"`
+}
+
+// profileNet returns the netProfile of results, or nil when none was
+// timed.
+func profileNet(results []sublive.Result) *netProfile {
+	var dns, connect, tlsMs, ttfb []float64
+	var hosts []slowHost
+	for _, r := range results {
+		t := r.Timing
+		if t == nil {
+			continue
+		}
+		for _, ph := range []struct {
+			ms  float64
+			all *[]float64
+		}{{t.DNSMs, &dns}, {t.ConnectMs, &connect}, {t.TLSMs, &tlsMs}, {t.TTFBMs, &ttfb}} {
+			if ph.ms > 0 {
+				*ph.all = append(*ph.all, ph.ms)
+			}
+		}
+		hosts = append(hosts, slowHost{r.Subdomain, *t, t.TotalMs()})
+	}
+	if hosts == nil {
+		return nil
+	}
+	slices.SortStableFunc(hosts, func(a, b slowHost) int { return cmp.Compare(b.TotalMs, a.TotalMs) })
+	return &netProfile{
+		DNS:     newPhaseStats(dns),
+		Connect: newPhaseStats(connect),
+		TLS:     newPhaseStats(tlsMs),
+		TTFB:    newPhaseStats(ttfb),
+		Slowest: hosts[:min(netSlowest, len(hosts))],
+	}
+}
+
+func newPhaseStats(ms []float64) phaseStats {
+	if len(ms) == 0 {
+		return phaseStats{}
+	}
+	slices.Sort(ms)
+	return phaseStats{Count: len(ms), P50Ms: percentile(ms, 50), P95Ms: percentile(ms, 95), MaxMs: ms[len(ms)-1]}
+}
+
+// percentile returns the nearest-rank p-th percentile of the sorted ms.
+func percentile(ms []float64, p float64) float64 {
+	i := int(math.Ceil(p/100*float64(len(ms)))) - 1
+	return ms[max(i, 0)]
+}
+
+// printNetProfile prints the phase percentiles and slowest hosts of
+// -profile-net.
+func printNetProfile(w io.Writer, np *netProfile) {
+	if np == nil {
+		return
+	}
+	fmt.Fprintf(w, "  network: dns p50/p95 %s, connect p50/p95 %s, tls p50/p95 %s, ttfb p50/p95 %s\n", np.DNS, np.Connect, np.TLS, np.TTFB)
+	fmt.Fprintf(w, "  slowest hosts:\n")
+	for _, h := range np.Slowest {
+		fmt.Fprintf(w, "    %-40s %8.1fms (dns %.1f, connect %.1f, tls %.1f, ttfb %.1f)\n", h.Subdomain, h.TotalMs, h.DNSMs, h.ConnectMs, h.TLSMs, h.TTFBMs)
+	}
+}
+
+func (s phaseStats) String() string {
+	if s.Count == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f/%.1fms", s.P50Ms, s.P95Ms)
+}
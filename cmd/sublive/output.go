@@ -0,0 +1,936 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// displaySuffix returns " (<unicode form>)" for internationalized names so
+// output lines can show it after the xn-- form, or "" when punycodeOnly is set.
+func displaySuffix(r sublive.Result, punycodeOnly bool) string {
+	if punycodeOnly || r.Unicode == "" {
+		return ""
+	}
+	return " (" + r.Unicode + ")"
+}
+
+// geoText returns "country city org" for log records.
+func geoText(g *sublive.GeoInfo) string {
+	parts := []string{}
+	for _, p := range []string{g.Country, g.City, g.Org} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// tagSuffix returns the bracketed markers of r, such as " [out-of-scope]",
+// or "".
+func tagSuffix(r sublive.Result) string {
+	tags := resultTags(r)
+	if len(tags) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(tags, ",") + "]"
+}
+
+// resultTags returns the markers of r in text output, such as "root" or
+// "redirect apex https://example.com/".
+func resultTags(r sublive.Result) []string {
+	tags := []string{}
+	if r.Source == sublive.SourceRoot {
+		tags = append(tags, "root")
+	}
+	if r.Status == 0 {
+		tags = append(tags, string(sublive.ClassifyResult(r)))
+	}
+	if r.BannerPort != 0 {
+		tags = append(tags, fmt.Sprintf("tcp/%d %s", r.BannerPort, r.Banner))
+	}
+	if r.Validation == sublive.ValidationPoisoned || r.Validation == sublive.ValidationUnvalidated {
+		tags = append(tags, r.Validation)
+	}
+	if len(r.PTR) > 0 {
+		tags = append(tags, "ptr "+strings.Join(r.PTR, " "))
+	}
+	switch len(r.Aliases) {
+	case 0:
+	case 1:
+		tags = append(tags, "+1 alias")
+	default:
+		tags = append(tags, fmt.Sprintf("+%d aliases", len(r.Aliases)))
+	}
+	if r.SNI != "" {
+		tags = append(tags, "sni "+r.SNI)
+	}
+	if r.Path != "" && r.URL != "" {
+		tags = append(tags, "url "+r.URL+r.Path)
+	} else if r.Path != "" {
+		tags = append(tags, "path "+r.Path)
+	}
+	if r.RedirectClass != "" {
+		tags = append(tags, fmt.Sprintf("redirect %s %s", r.RedirectClass, r.RedirectTarget))
+	}
+	if r.Origin != "" {
+		tags = append(tags, fmt.Sprintf("from %s %s", r.Origin, r.Source))
+	}
+	if r.Soft404 {
+		tags = append(tags, "soft-404")
+	}
+	if r.EdgeDefault {
+		tags = append(tags, "edge-default")
+	}
+	if r.Inherited {
+		tags = append(tags, "inherited from "+r.InheritedFrom)
+	}
+	if r.RateLimit != nil && r.RateLimit.RetryAfter > 0 {
+		tags = append(tags, fmt.Sprintf("retry-after %ds", r.RateLimit.RetryAfter))
+	}
+	if r.DanglingCloud != "" {
+		tags = append(tags, "dangling-cloud "+r.DanglingCloud)
+	}
+	for _, f := range r.Findings {
+		// the other findings have their own tags
+		if f == sublive.FindingTakeover || f == sublive.FindingExpiredCert || f == sublive.FindingInterestingName {
+			tags = append(tags, f)
+		}
+	}
+	if r.Internal {
+		tags = append(tags, "internal")
+	}
+	if r.OutOfScope {
+		tags = append(tags, "out-of-scope")
+	}
+	if r.ScopePartial {
+		tags = append(tags, "partly-out-of-scope")
+	}
+	if r.IPv6Skipped {
+		tags = append(tags, "ipv6-skipped")
+	}
+	if r.FamilyStatus != nil {
+		tags = append(tags, fmt.Sprintf("ipv4 %d ipv6 %d", r.FamilyStatus[sublive.FamilyIPv4], r.FamilyStatus[sublive.FamilyIPv6]))
+	}
+	return tags
+}
+
+// streams are where a run's output goes: the results to stdout unless -o
+// takes them or -q drops them, and the summary to its own writer.
+// Diagnostics go to neither but through logger, to stderr, so piped
+// results are never mixed with them.
+type streams struct {
+	results, summary io.Writer
+}
+
+// newStreams returns the streams of a run whose summary goes to summary,
+// os.Stdout for scan and os.Stderr for probe: on stderr as well while JSON
+// results take stdout, so the document stays parseable, and nowhere with
+// -no-summary.
+func newStreams(summary io.Writer, outfile, format string, quiet, noSummary bool) streams {
+	s := streams{results: os.Stdout, summary: summary}
+	if quiet {
+		s.results = io.Discard
+	} else if outfile == "" && format == "json" {
+		s.summary = os.Stderr
+	}
+	if noSummary {
+		s.summary = io.Discard
+	}
+	return s
+}
+
+// writeResults writes results as plain "host status" lines or, with format
+// "json", as a JSON document that also carries meta and the -records of
+// the root domains, by domain. The "extended" format brackets the status and adds the
+// body counts, as in "host [200] [1234B, 210W, 56L]". Rechecked results
+// end in " (was <status>)". Text output starts with meta when that is set
+// for comments. meta may be nil.
+func writeResults(w io.Writer, meta *runMeta, domain string, records map[string]map[string][]string, results []sublive.Result, format string, punycodeOnly bool) error {
+	return writeResultsSeq(w, meta, domain, records, slices.Values(results), format, punycodeOnly)
+}
+
+// writeResultsSeq is writeResults for results read one at a time, such as
+// those of a -low-memory spool. The JSON document is written as it goes,
+// laid out like one encoded at once.
+func writeResultsSeq(w io.Writer, meta *runMeta, domain string, records map[string]map[string][]string, results iter.Seq[sublive.Result], format string, punycodeOnly bool) error {
+	if format == "json" {
+		var summary *resultSummary
+		if meta != nil {
+			summary = meta.summary
+		}
+		var head bytes.Buffer
+		enc := json.NewEncoder(&head)
+		enc.SetIndent("", "  ")
+		// previews stay greppable for "<title>" and the like
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(struct {
+			Metadata   *runMeta                       `json:"metadata,omitempty"`
+			Domain     string                         `json:"domain,omitempty"`
+			DNSRecords map[string]map[string][]string `json:"dns_records,omitempty"`
+			Summary    *resultSummary                 `json:"summary,omitempty"`
+		}{meta, domain, records, summary}); err != nil {
+			return err
+		}
+		// reopen the object for the results
+		open := strings.TrimSuffix(strings.TrimSuffix(head.String(), "\n"), "}")
+		if open == "{" {
+			open += "\n"
+		} else {
+			open = strings.TrimSuffix(open, "\n") + ",\n"
+		}
+		bw := bufio.NewWriter(w)
+		bw.WriteString(open + `  "results": [`)
+		var item bytes.Buffer
+		enc = json.NewEncoder(&item)
+		enc.SetIndent("    ", "  ")
+		enc.SetEscapeHTML(false)
+		n := 0
+		for r := range results {
+			if n > 0 {
+				bw.WriteString(",")
+			}
+			item.Reset()
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+			bw.WriteString("\n    ")
+			bw.Write(bytes.TrimSuffix(item.Bytes(), []byte("\n")))
+			n++
+		}
+		if n > 0 {
+			bw.WriteString("\n  ")
+		}
+		bw.WriteString("]\n}\n")
+		return bw.Flush()
+	}
+	if meta != nil && meta.comments {
+		if err := meta.writeComments(w); err != nil {
+			return err
+		}
+	}
+	for r := range results {
+		was := ""
+		if r.PreviousStatus != nil {
+			was = fmt.Sprintf(" (was %d)", *r.PreviousStatus)
+		}
+		status := strconv.Itoa(r.Status)
+		if format == "extended" {
+			status = "[" + status + "]"
+			if r.Body != nil {
+				status += fmt.Sprintf(" [%dB, %dW, %dL]", r.Body.Bytes, r.Body.Words, r.Body.Lines)
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s %s%s%s%s\n", r.Subdomain, status, displaySuffix(r, punycodeOnly), was, tagSuffix(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes path through write into a temporary file next to
+// it, synced and then renamed over path, so readers and crashes never see
+// a half-written file.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// writeURLs writes the URL of each of results that has one to path, one
+// per line, sorted and without duplicates.
+func writeURLs(path string, results []sublive.Result) error {
+	urls := []string{}
+	for _, r := range results {
+		if r.URL != "" {
+			urls = append(urls, r.URL)
+		}
+	}
+	sort.Strings(urls)
+	var b strings.Builder
+	for _, u := range slices.Compact(urls) {
+		b.WriteString(u + "\n")
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// hostsLines groups the names of results, aliases included, by the
+// address they answered on and returns one /etc/hosts line per address,
+// sorted by address, each naming its hosts in order. Results without an
+// address are left out.
+func hostsLines(results []sublive.Result) []string {
+	byAddr := map[netip.Addr][]string{}
+	for _, r := range results {
+		addr, err := netip.ParseAddr(r.IP)
+		if err != nil {
+			continue
+		}
+		byAddr[addr] = append(byAddr[addr], r.Subdomain)
+		byAddr[addr] = append(byAddr[addr], r.Aliases...)
+	}
+	lines := make([]string, 0, len(byAddr))
+	for _, addr := range slices.SortedFunc(maps.Keys(byAddr), netip.Addr.Compare) {
+		names := byAddr[addr]
+		slices.Sort(names)
+		lines = append(lines, addr.String()+" "+strings.Join(slices.Compact(names), " "))
+	}
+	return lines
+}
+
+// writeHosts writes the hostsLines of results to path in /etc/hosts
+// format, after comment lines saying which run they are from so stale
+// entries are recognised.
+func writeHosts(path string, meta *runMeta, results []sublive.Result) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# sublive %s live hosts", sublive.Version)
+	if meta.Target != "" {
+		fmt.Fprintf(&b, " of %s", meta.Target)
+	}
+	fmt.Fprintf(&b, ", scan of %s\n", meta.Started.Format(time.RFC3339))
+	b.WriteString("# these addresses go stale: remove the entries when done testing\n")
+	for _, line := range hostsLines(results) {
+		b.WriteString(line + "\n")
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// printRoot prints the status, address, title and certificate of the root
+// domain results, the baseline of the rest.
+func printRoot(w io.Writer, results []sublive.Result) {
+	for _, r := range results {
+		if r.Source != sublive.SourceRoot {
+			continue
+		}
+		if r.IP == "" {
+			fmt.Fprintf(w, "  root %s: no DNS (%s)\n", r.Subdomain, sublive.ClassifyResult(r))
+			continue
+		}
+		status := "no HTTP answer"
+		if r.Status != 0 {
+			status = strconv.Itoa(r.Status)
+		}
+		fmt.Fprintf(w, "  root %s: %s %s", r.Subdomain, status, r.IP)
+		if r.Title != "" {
+			fmt.Fprintf(w, " %q", r.Title)
+		}
+		fmt.Fprintln(w)
+		if c := r.Cert; c != nil {
+			fmt.Fprintf(w, "    cert %s, issuer %s, expires %s\n", c.Subject, c.Issuer, c.NotAfter.Format(time.DateOnly))
+		}
+	}
+}
+
+// redirectKinds counts results by Result.RedirectClass, as in "upgrade
+// 12, apex 30, internal 2", or returns "" when none redirected.
+func redirectKinds(results []sublive.Result) string {
+	counts := map[string]int{}
+	for _, r := range results {
+		if r.RedirectClass != "" {
+			counts[r.RedirectClass]++
+		}
+	}
+	parts := []string{}
+	for _, class := range sublive.RedirectClasses {
+		if counts[class] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", class, counts[class]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printCounts prints the summary buckets of results. The live count is of
+// codes when set (-live-codes), and of 2xx otherwise.
+func printCounts(w io.Writer, results []sublive.Result, codes sublive.StatusRanges) {
+	counts := map[sublive.Class]int{}
+	outOfScope, partial, internal, tcpOpen, dangling, live, v6Skipped := 0, 0, 0, 0, 0, 0, 0
+	families := map[string]int{}
+	// inherited counts the probes -collapse-cname saved, by CNAME target
+	// representative
+	inherited := map[string]int{}
+	for _, r := range results {
+		families[r.Family]++
+		if r.Inherited {
+			inherited[r.InheritedFrom]++
+		}
+		if r.DanglingCloud != "" {
+			dangling++
+		}
+		if r.Status == 0 && r.BannerPort != 0 {
+			tcpOpen++
+			continue
+		}
+		if r.ScopePartial {
+			partial++
+		}
+		if r.Internal {
+			internal++
+			// internal names that were not probed only count here
+			if r.Status == 0 {
+				continue
+			}
+		}
+		if r.OutOfScope {
+			outOfScope++
+			continue
+		}
+		if r.IPv6Skipped {
+			v6Skipped++
+			continue
+		}
+		counts[sublive.ClassifyResult(r)]++
+		if codes.Contains(r.Status) && !demotedClass(sublive.ClassifyResult(r)) {
+			live++
+		}
+	}
+	if codes != nil {
+		fmt.Fprintf(w, "  live (-live-codes %s): %d\n", codes, live)
+	} else {
+		fmt.Fprintf(w, "  live (2xx): %d\n", counts[sublive.ClassLive])
+	}
+	if counts[sublive.ClassSoft404] > 0 {
+		fmt.Fprintf(w, "  soft-404 (2xx for random paths too): %d\n", counts[sublive.ClassSoft404])
+	}
+	if counts[sublive.ClassEdgeDefault] > 0 {
+		fmt.Fprintf(w, "  edge-default (2xx its address gave many names alike): %d\n", counts[sublive.ClassEdgeDefault])
+	}
+	fmt.Fprintf(w, "  redirects (3xx): %d\n", counts[sublive.ClassRedirect])
+	if kinds := redirectKinds(results); kinds != "" {
+		fmt.Fprintf(w, "  redirects followed: %s\n", kinds)
+	}
+	fmt.Fprintf(w, "  auth-gated (401/403): %d\n", counts[sublive.ClassAuth])
+	fmt.Fprintf(w, "  other 4xx: %d\n", counts[sublive.ClassClientError])
+	fmt.Fprintf(w, "  5xx: %d\n", counts[sublive.ClassServerError])
+	if counts[sublive.ClassOther] > 0 {
+		fmt.Fprintf(w, "  other: %d\n", counts[sublive.ClassOther])
+	}
+	if counts[sublive.ClassBadCert] > 0 {
+		fmt.Fprintf(w, "  bad certificate: %d\n", counts[sublive.ClassBadCert])
+	}
+	fmt.Fprintf(w, "  resolved, no HTTP: %d\n", counts[sublive.ClassNoHTTP])
+	fmt.Fprintf(w, "  dangling cloud records: %d\n", dangling)
+	fmt.Fprintf(w, "  no DNS: %d\n", counts[sublive.ClassNoDNS])
+	if tcpOpen > 0 {
+		fmt.Fprintf(w, "  tcp-open (non-HTTP service): %d\n", tcpOpen)
+	}
+	fmt.Fprintf(w, "  internal (private IPs): %d\n", internal)
+	fmt.Fprintf(w, "  address families: ipv4-only %d, ipv6-only %d, dual-stack %d\n", families[sublive.FamilyIPv4], families[sublive.FamilyIPv6], families[sublive.FamilyDual])
+	if v6Skipped > 0 {
+		fmt.Fprintf(w, "  ipv6-only, not probed (no IPv6 here): %d\n", v6Skipped)
+	}
+	if len(inherited) > 0 {
+		saved := 0
+		for _, n := range inherited {
+			saved += n
+		}
+		fmt.Fprintf(w, "  cname collapse: %d probes saved, answers inherited from %d names\n", saved, len(inherited))
+	}
+	if outOfScope > 0 || partial > 0 {
+		fmt.Fprintf(w, "  out of scope (DNS only): %d\n", outOfScope)
+		fmt.Fprintf(w, "  partly out of scope: %d\n", partial)
+	}
+}
+
+// printSummaryCounts prints the buckets, status codes, failure reasons and
+// sources of s, the summary
+// of a -low-memory scan, which keeps no results to break down further.
+// Unlike printCounts, every result counts in its class, also those that
+// were internal, out of scope or not probed.
+func printSummaryCounts(w io.Writer, s *resultSummary, codes sublive.StatusRanges) {
+	if codes != nil {
+		fmt.Fprintf(w, "  live (-live-codes %s): %d\n", codes, s.Live)
+	} else {
+		fmt.Fprintf(w, "  live (2xx): %d\n", s.Classes[sublive.ClassLive])
+	}
+	if n := s.Classes[sublive.ClassSoft404]; n > 0 {
+		fmt.Fprintf(w, "  soft-404 (2xx for random paths too): %d\n", n)
+	}
+	if n := s.Classes[sublive.ClassEdgeDefault]; n > 0 {
+		fmt.Fprintf(w, "  edge-default (2xx its address gave many names alike): %d\n", n)
+	}
+	fmt.Fprintf(w, "  redirects (3xx): %d\n", s.Classes[sublive.ClassRedirect])
+	fmt.Fprintf(w, "  auth-gated (401/403): %d\n", s.Classes[sublive.ClassAuth])
+	fmt.Fprintf(w, "  other 4xx: %d\n", s.Classes[sublive.ClassClientError])
+	fmt.Fprintf(w, "  5xx: %d\n", s.Classes[sublive.ClassServerError])
+	if n := s.Classes[sublive.ClassOther]; n > 0 {
+		fmt.Fprintf(w, "  other: %d\n", n)
+	}
+	if n := s.Classes[sublive.ClassBadCert]; n > 0 {
+		fmt.Fprintf(w, "  bad certificate: %d\n", n)
+	}
+	fmt.Fprintf(w, "  resolved, no HTTP: %d\n", s.Classes[sublive.ClassNoHTTP])
+	fmt.Fprintf(w, "  no DNS: %d\n", s.Classes[sublive.ClassNoDNS])
+	fmt.Fprintf(w, "  address families: ipv4-only %d, ipv6-only %d, dual-stack %d\n", s.Families[sublive.FamilyIPv4], s.Families[sublive.FamilyIPv6], s.Families[sublive.FamilyDual])
+	printStatusLine(w, statusOrder(s.StatusCodes), s.StatusCodes)
+	printReasons(w, s)
+	printSources(w, s)
+}
+
+// resultSummary is the "summary" of a JSON document: every result of the
+// run, also those left out of the output, counted by class and by
+// statusKey.
+type resultSummary struct {
+	Total int `json:"total"`
+	// Live counts the results that are live by LiveCodes, the definition
+	// in effect: -live-codes, or 2xx
+	Live        int                   `json:"live"`
+	LiveCodes   string                `json:"live_codes"`
+	Classes     map[sublive.Class]int `json:"classes"`
+	StatusCodes map[string]int        `json:"status_codes"`
+	// Families counts the results by address family
+	Families map[string]int `json:"families,omitempty"`
+	// Reasons counts the results without a response by failure reason
+	Reasons map[string]int `json:"reasons,omitempty"`
+	// Sources counts the results of every discovery source, and those
+	// of them that are live by -live-codes or sublive.IsLive
+	Sources map[string]*sourceCount `json:"sources,omitempty"`
+	// Net is the -profile-net breakdown
+	Net *netProfile `json:"net,omitempty"`
+	// Edges are the addresses -edge-threshold caught answering every name
+	// alike
+	Edges []sublive.EdgeIP `json:"edges,omitempty"`
+}
+
+// demotedClass reports whether class is one of the 2xx results that
+// count as not live: soft-404 and edge-default.
+func demotedClass(class sublive.Class) bool {
+	return class == sublive.ClassSoft404 || class == sublive.ClassEdgeDefault
+}
+
+func summarize(results []sublive.Result, codes sublive.StatusRanges) *resultSummary {
+	s := newResultSummary(codes)
+	for _, r := range results {
+		s.add(r, codes)
+	}
+	s.Net = profileNet(results)
+	return s
+}
+
+// newResultSummary returns an empty summary for the live codes in effect,
+// to be filled in result by result with add.
+func newResultSummary(codes sublive.StatusRanges) *resultSummary {
+	s := &resultSummary{Classes: map[sublive.Class]int{}, StatusCodes: map[string]int{}, Reasons: map[string]int{}, Sources: map[string]*sourceCount{}, LiveCodes: "200-299"}
+	if codes != nil {
+		s.LiveCodes = codes.String()
+	}
+	return s
+}
+
+// add counts r.
+func (s *resultSummary) add(r sublive.Result, codes sublive.StatusRanges) {
+	s.Total++
+	class := sublive.ClassifyResult(r)
+	s.Classes[class]++
+	if codes == nil && class == sublive.ClassLive || codes.Contains(r.Status) && !demotedClass(class) {
+		s.Live++
+	}
+	if r.Family != "" {
+		if s.Families == nil {
+			s.Families = map[string]int{}
+		}
+		s.Families[r.Family]++
+	}
+	s.StatusCodes[statusKey(r)]++
+	if r.Reason != "" {
+		s.Reasons[r.Reason]++
+	}
+	src := s.Sources[r.Source]
+	if src == nil {
+		src = &sourceCount{}
+		s.Sources[r.Source] = src
+	}
+	src.Probed++
+	if codes == nil && sublive.IsLive(r.Status) || codes.Contains(r.Status) {
+		src.Live++
+	}
+}
+
+// sourceCount is the line of one discovery source in resultSummary.
+type sourceCount struct {
+	Probed int `json:"probed"`
+	Live   int `json:"live"`
+}
+
+// statusKey is the status histogram key of r: its status code or, without
+// a response, "0/" and the failure reason ("0" when it has none).
+func statusKey(r sublive.Result) string {
+	if r.Status == 0 && r.Reason != "" {
+		return "0/" + r.Reason
+	}
+	return strconv.Itoa(r.Status)
+}
+
+// statusCounts counts results by statusKey and returns the keys in order:
+// status codes ascending, then the results without a response by failure
+// reason.
+func statusCounts(results []sublive.Result) ([]string, map[string]int) {
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[statusKey(r)]++
+	}
+	return statusOrder(counts), counts
+}
+
+// statusOrder returns the statusKey keys of counts in the order of
+// statusCounts.
+func statusOrder(counts map[string]int) []string {
+	rank := func(k string) (int, int) {
+		code, reason, _ := strings.Cut(k, "/")
+		n, _ := strconv.Atoi(code)
+		if n == 0 {
+			n = 1000
+		}
+		i := slices.Index(sublive.Reasons, reason)
+		if reason == "" {
+			i = len(sublive.Reasons)
+		}
+		return n, i
+	}
+	keys := slices.Collect(maps.Keys(counts))
+	slices.SortFunc(keys, func(a, b string) int {
+		an, ai := rank(a)
+		bn, bi := rank(b)
+		return cmp.Or(cmp.Compare(an, bn), cmp.Compare(ai, bi))
+	})
+	return keys
+}
+
+// printStatusCodes prints the exact status code counts of results, below
+// the buckets of printCounts.
+func printStatusCodes(w io.Writer, results []sublive.Result) {
+	keys, counts := statusCounts(results)
+	printStatusLine(w, keys, counts)
+}
+
+func printStatusLine(w io.Writer, keys []string, counts map[string]int) {
+	if len(keys) == 0 {
+		return
+	}
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s: %d", k, counts[k])
+	}
+	fmt.Fprintf(w, "  status codes: %s\n", strings.Join(parts, ", "))
+}
+
+// printReasons breaks the results of s without a response down by
+// failure reason, when there are any.
+func printReasons(w io.Writer, s *resultSummary) {
+	parts := []string{}
+	for _, reason := range sublive.Reasons {
+		if n := s.Reasons[reason]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, reason))
+		}
+	}
+	if len(parts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  failure reasons: %s\n", strings.Join(parts, ", "))
+}
+
+// printSources prints, per discovery source, how many of the names it
+// produced were probed and how many of them are live, from s.
+func printSources(w io.Writer, s *resultSummary) {
+	parts := []string{}
+	for _, src := range sublive.Sources {
+		if n := s.Sources[src]; n != nil {
+			parts = append(parts, fmt.Sprintf("%s %d/%d", src, n.Live, n.Probed))
+		}
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(w, "  live/probed by source: %s\n", strings.Join(parts, ", "))
+	}
+}
+
+// printNewHosts lists the results the -db history at path had no record
+// of, or only counts them on the first run recorded there.
+func printNewHosts(w io.Writer, path string, results []sublive.Result, seenBefore bool) {
+	var added []sublive.Result
+	for _, r := range results {
+		if r.New {
+			added = append(added, r)
+		}
+	}
+	if !seenBefore {
+		fmt.Fprintf(w, "\nNew since last run (%s): first run, %d hosts recorded\n", path, len(added))
+		return
+	}
+	fmt.Fprintf(w, "\nNew since last run (%s):\n", path)
+	for _, r := range added {
+		line := fmt.Sprintf("  + %s %d", r.Subdomain, r.Status)
+		if r.IP != "" {
+			line += " " + r.IP
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "  %d new hosts\n", len(added))
+}
+
+// printDangling lists the results tagged dangling-cloud, if any, with
+// the address and provider they point at.
+func printDangling(w io.Writer, results []sublive.Result) {
+	var lines []string
+	for _, r := range results {
+		if r.DanglingCloud != "" {
+			lines = append(lines, fmt.Sprintf("  ! %s -> %s (%s)", r.Subdomain, strings.Join(r.IPs, " "), r.DanglingCloud))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	sort.Strings(lines)
+	fmt.Fprintf(w, "\nDangling cloud records (cloud addresses refusing or timing out on 80 and 443, same answer on a second lookup):\n")
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+}
+
+// printValidation prints the -validate verdict counts.
+func printValidation(w io.Writer, results []sublive.Result) {
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Validation]++
+	}
+	fmt.Fprintf(w, "  DNS validation: %d confirmed, %d poisoned, %d unvalidated\n",
+		counts[sublive.ValidationConfirmed], counts[sublive.ValidationPoisoned], counts[sublive.ValidationUnvalidated])
+}
+
+// printRecords prints the -records of domain and flags missing SPF and
+// DMARC records. err is the lookup failure, if any; missing records are
+// only flagged without one.
+func printRecords(w io.Writer, domain string, types []string, records map[string][]string, err error) {
+	fmt.Fprintf(w, "\nDNS records for %s:\n", domain)
+	for _, t := range types {
+		if len(records[t]) == 0 {
+			fmt.Fprintf(w, "  %s: (none)\n", t)
+		}
+		for _, v := range records[t] {
+			fmt.Fprintf(w, "  %s: %s\n", t, v)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(w, "  [!] some lookups failed: %v\n", err)
+		return
+	}
+	auth := sublive.ParseMailAuth(records)
+	if slices.Contains(types, sublive.RecordTXT) && auth.SPF == "" {
+		fmt.Fprintf(w, "  [!] no SPF record\n")
+	}
+	if slices.Contains(types, sublive.RecordDMARC) {
+		switch auth.Policy {
+		case "":
+			if auth.DMARC == "" {
+				fmt.Fprintf(w, "  [!] no DMARC record: mail from %s can be spoofed\n", domain)
+			} else {
+				fmt.Fprintf(w, "  [!] DMARC record without a policy (p=)\n")
+			}
+		case "none":
+			fmt.Fprintf(w, "  [!] DMARC policy is p=none (monitoring only)\n")
+		}
+	}
+}
+
+// printMatches prints how many results the -match and -filter options
+// kept and dropped; match tells whether -match patterns were given.
+func printMatches(w io.Writer, results []sublive.Result, match bool) {
+	kept := 0
+	for _, r := range results {
+		if sublive.KeepMatched(r, match) {
+			kept++
+		}
+	}
+	fmt.Fprintf(w, "  body match: %d kept, %d dropped\n", kept, len(results)-kept)
+}
+
+// printProtocols prints how many hosts answered over each HTTP version.
+func printProtocols(w io.Writer, results []sublive.Result) {
+	counts := map[string]int{}
+	for _, r := range results {
+		if r.Proto != "" {
+			counts[r.Proto]++
+		}
+	}
+	fmt.Fprintf(w, "  protocols: %d HTTP/3, %d HTTP/2, %d HTTP/1.x\n", counts["HTTP/3.0"], counts["HTTP/2.0"], counts["HTTP/1.1"]+counts["HTTP/1.0"])
+}
+
+// safeFileName turns a domain into a file name that cannot leave its
+// directory: anything outside [a-z0-9._-] becomes "_" and leading dots are
+// dropped.
+func safeFileName(domain string) string {
+	b := []byte(strings.ToLower(domain))
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	name := strings.TrimLeft(string(b), ".")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// domainCounts is one entry of the -o-dir summary.
+type domainCounts struct {
+	File   string                `json:"file"`
+	Total  int                   `json:"total"`
+	Counts map[sublive.Class]int `json:"counts"`
+}
+
+// writeDomainFiles writes results into dir, one file per root domain in
+// format, plus _summary.json with the per-domain counts. Results without a
+// domain go to _other. Existing files are replaced, as with -o.
+func writeDomainFiles(dir string, meta *runMeta, results []sublive.Result, format string, punycodeOnly bool) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	ext := ".txt"
+	if format == "json" {
+		ext = ".json"
+	}
+	byDomain := map[string][]sublive.Result{}
+	for _, r := range results {
+		byDomain[r.Domain] = append(byDomain[r.Domain], r)
+	}
+	summary := map[string]domainCounts{}
+	for domain, rs := range byDomain {
+		name := "_other"
+		if domain != "" {
+			name = safeFileName(domain)
+		}
+		file := name + ext
+		if err := writeResultsFile(filepath.Join(dir, file), meta, domain, nil, rs, format, punycodeOnly); err != nil {
+			return err
+		}
+		dc := domainCounts{File: file, Total: len(rs), Counts: map[sublive.Class]int{}}
+		for _, c := range sublive.Classes {
+			dc.Counts[c] = 0
+		}
+		for _, r := range rs {
+			dc.Counts[sublive.ClassifyResult(r)]++
+		}
+		key := domain
+		if key == "" {
+			key = "_other"
+		}
+		summary[key] = dc
+	}
+	f, err := os.Create(filepath.Join(dir, "_summary.json"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Domains map[string]domainCounts `json:"domains"`
+	}{summary})
+}
+
+// printDepths prints how many results are at each deep mode depth and
+// how many of them are live, from 0 to depth or to the deepest result if
+// that is further: results resumed from a run with a larger -depth can be
+// deeper than this one's.
+func printDepths(w io.Writer, results []sublive.Result, depth int) {
+	deepest := max(depth, 0)
+	for _, r := range results {
+		deepest = max(deepest, r.Depth)
+	}
+	byDepth := make([]int, deepest+1)
+	liveByDepth := make([]int, deepest+1)
+	for _, r := range results {
+		if r.Depth < 0 {
+			continue
+		}
+		byDepth[r.Depth]++
+		if sublive.IsLive(r.Status) {
+			liveByDepth[r.Depth]++
+		}
+	}
+	for d := range byDepth {
+		fmt.Fprintf(w, "  depth %d: %d candidates, %d live\n", d, byDepth[d], liveByDepth[d])
+	}
+}
+
+// printTopASNs prints the n autonomous systems with the most hosts.
+func printTopASNs(w io.Writer, results []sublive.Result, n int) {
+	counts := map[int]int{}
+	names := map[int]string{}
+	for _, r := range results {
+		if r.ASN != 0 {
+			counts[r.ASN]++
+			names[r.ASN] = r.ASName
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+	asns := make([]int, 0, len(counts))
+	for a := range counts {
+		asns = append(asns, a)
+	}
+	sort.Slice(asns, func(i, j int) bool {
+		if counts[asns[i]] != counts[asns[j]] {
+			return counts[asns[i]] > counts[asns[j]]
+		}
+		return asns[i] < asns[j]
+	})
+	if len(asns) > n {
+		asns = asns[:n]
+	}
+	fmt.Fprintf(w, "\nTop ASNs by host count:\n")
+	for _, a := range asns {
+		fmt.Fprintf(w, "  AS%d %s: %d\n", a, names[a], counts[a])
+	}
+}
+
+// printCDNCounts prints how many live hosts each CDN serves.
+func printCDNCounts(w io.Writer, results []sublive.Result) {
+	counts := map[string]int{}
+	for _, r := range results {
+		if r.CDN != "" && sublive.IsLive(r.Status) {
+			counts[r.CDN]++
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+	names := make([]string, 0, len(counts))
+	for n := range counts {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "  behind a CDN:")
+	for _, n := range names {
+		fmt.Fprintf(w, " %s=%d", n, counts[n])
+	}
+	fmt.Fprintln(w)
+}
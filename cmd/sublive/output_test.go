@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+func TestHostsLines(t *testing.T) {
+	results := []sublive.Result{
+		{Subdomain: "www.example.com", IP: "203.0.113.7"},
+		{Subdomain: "admin.example.com", IP: "203.0.113.7", Aliases: []string{"dev.example.com", "www.example.com"}},
+		{Subdomain: "v6.example.com", IP: "2001:db8::1"},
+		{Subdomain: "api.example.com", IP: "198.51.100.2"},
+		{Subdomain: "gone.example.com"},
+		{Subdomain: "odd.example.com", IP: "not-an-ip"},
+	}
+	want := []string{
+		"198.51.100.2 api.example.com",
+		"203.0.113.7 admin.example.com dev.example.com www.example.com",
+		"2001:db8::1 v6.example.com",
+	}
+	if got := hostsLines(results); !slices.Equal(got, want) {
+		t.Errorf("hostsLines =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := hostsLines(nil); len(got) != 0 {
+		t.Errorf("hostsLines(nil) = %q", got)
+	}
+}
+
+func TestWriteHosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.txt")
+	meta := &runMeta{Target: "example.com", Started: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	results := []sublive.Result{{Subdomain: "b.example.com", IP: "192.0.2.1"}, {Subdomain: "a.example.com", IP: "192.0.2.1"}}
+	if err := writeHosts(path, meta, results); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "# ") || !strings.Contains(lines[0], "of example.com, scan of 2026-03-01T12:00:00Z") || !strings.HasPrefix(lines[1], "# ") {
+		t.Errorf("header %q", lines)
+	}
+	if got := lines[len(lines)-1]; got != "192.0.2.1 a.example.com b.example.com" {
+		t.Errorf("entry %q", got)
+	}
+}
+
+func TestPrintDepths(t *testing.T) {
+	// resumed from a -depth 3 run into one of -depth 1
+	results := []sublive.Result{
+		{Subdomain: "www.example.com", Status: 200},
+		{Subdomain: "api.example.com", Status: 404},
+		{Subdomain: "api-dev.example.com", Depth: 1, Status: 200},
+		{Subdomain: "api-dev-v2.example.com", Depth: 3, Status: 200},
+	}
+	var b strings.Builder
+	printDepths(&b, results, 1)
+	want := "  depth 0: 2 candidates, 1 live\n  depth 1: 1 candidates, 1 live\n  depth 2: 0 candidates, 0 live\n  depth 3: 1 candidates, 1 live\n"
+	if b.String() != want {
+		t.Errorf("printDepths =\n%s\nwant\n%s", b.String(), want)
+	}
+	b.Reset()
+	printDepths(&b, nil, 1)
+	if b.String() != "  depth 0: 0 candidates, 0 live\n  depth 1: 0 candidates, 0 live\n" {
+		t.Errorf("printDepths(nil, 1) = %q", b.String())
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// The .partial stream of -o is flushed every partialFlushEvery results and
+// every partialFlushInterval, so a crash loses little.
+const (
+	partialFlushEvery    = 100
+	partialFlushInterval = 5 * time.Second
+)
+
+// partialWriter streams the results of a running scan, one JSON object per
+// line and the first per name, to the .partial file next to the -o file,
+// which ReadResults, -recheck and diff take as they are. It only matters
+// when the run dies before the -o file is written: a normal end, Ctrl-C
+// included, removes it. A nil partialWriter does nothing.
+type partialWriter struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+	// seen is nil when the names are not remembered, with -low-memory
+	seen map[string]bool
+	// unflushed counts the results added since the last flush
+	unflushed int
+	stop      chan struct{}
+}
+
+// openPartial creates the .partial file of the -o file path and starts its
+// flush timer.
+func openPartial(path string) (*partialWriter, error) {
+	path += ".partial"
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	pw := &partialWriter{path: path, f: f, w: w, enc: json.NewEncoder(w), seen: map[string]bool{}, stop: make(chan struct{})}
+	go func() {
+		t := time.NewTicker(partialFlushInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				pw.flush()
+			case <-pw.stop:
+				return
+			}
+		}
+	}()
+	return pw, nil
+}
+
+// add writes r unless a result for its name was written already.
+func (pw *partialWriter) add(r sublive.Result) {
+	if pw == nil {
+		return
+	}
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.f == nil || pw.seen[r.Subdomain] {
+		return
+	}
+	if pw.seen != nil {
+		pw.seen[r.Subdomain] = true
+	}
+	if err := pw.enc.Encode(r); err != nil {
+		logger.Warn("writing the .partial output failed", "file", pw.path, "error", err)
+		return
+	}
+	if pw.unflushed++; pw.unflushed >= partialFlushEvery {
+		pw.flushLocked()
+	}
+}
+
+func (pw *partialWriter) flush() {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.flushLocked()
+}
+
+func (pw *partialWriter) flushLocked() {
+	if pw.f == nil {
+		return
+	}
+	pw.unflushed = 0
+	if err := pw.w.Flush(); err != nil {
+		logger.Warn("writing the .partial output failed", "file", pw.path, "error", err)
+	}
+}
+
+// close flushes, syncs and closes the file, then removes it unless keep.
+func (pw *partialWriter) close(keep bool) {
+	if pw == nil {
+		return
+	}
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.f == nil {
+		return
+	}
+	close(pw.stop)
+	pw.flushLocked()
+	pw.f.Sync()
+	pw.f.Close()
+	pw.f = nil
+	if !keep {
+		os.Remove(pw.path)
+	} else {
+		logger.Warn("partial results kept", "file", pw.path)
+	}
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// seedEnv is what the input of a probe-style command may use to come up
+// with its names.
+type seedEnv struct {
+	resolvers []string
+	workers   int
+	timeout   time.Duration
+}
+
+// seedReader returns the seeds of a probe-style command, along with the
+// target recorded in the run metadata.
+type seedReader func(env seedEnv) (seeds []sublive.Candidate, target string, err error)
+
+// seedInput defines the input flags of a probe-style command on fs and
+// returns the seedReader to call once fs is parsed.
+type seedInput func(fs *flag.FlagSet) seedReader
+
+func runProbe(args []string) {
+	probeCommand("probe", "usage: sublive probe [flags] < hosts.txt\n\nCheck HTTP liveness of already-known names; no wordlist or domain is needed.\n\n", args,
+		func(fs *flag.FlagSet) seedReader {
+			list := fs.String("l", "", "file with one name or URL per line (default stdin)")
+			return func(seedEnv) ([]sublive.Candidate, string, error) {
+				seeds, rejected, err := readTargets(*list)
+				if err != nil {
+					return nil, "", err
+				}
+				if rejected > 0 {
+					logger.Warn("skipped invalid names", "count", rejected)
+				}
+				return seeds, *list, nil
+			}
+		})
+}
+
+// readTargets reads the input of probe like readNames, where a line may
+// also be an http or https URL, whose scheme, port and path are probed as
+// given.
+func readTargets(path string) (seeds []sublive.Candidate, rejected int, err error) {
+	var raw []string
+	if path != "" {
+		raw, err = sublive.LoadWordlist(path)
+	} else {
+		fi, serr := os.Stdin.Stat()
+		if serr == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			return nil, 0, fmt.Errorf("no input: pipe names to stdin or use -l file")
+		}
+		raw, err = sublive.ReadWordlist(os.Stdin)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, line := range raw {
+		var u *url.URL
+		if strings.Contains(line, "://") {
+			if u, err = url.Parse(line); err != nil || u.Scheme != "http" && u.Scheme != "https" || u.User != nil || u.Hostname() == "" {
+				rejected++
+				continue
+			}
+			line = u.Hostname()
+		}
+		name, err := sublive.ToASCII(line)
+		if err != nil || !sublive.ValidHostname(name) {
+			rejected++
+			continue
+		}
+		if u != nil {
+			// the fragment is never sent and the host is probed by its ASCII name
+			u.Fragment, u.RawFragment = "", ""
+			if port := u.Port(); port != "" {
+				u.Host = net.JoinHostPort(name, port)
+			} else {
+				u.Host = name
+			}
+		}
+		seeds = append(seeds, sublive.Candidate{Name: name, Source: sublive.SourceInput, URL: u})
+	}
+	return seeds, rejected, nil
+}
+
+// probeCommand runs a probe-style command: the HTTP pipeline of probe
+// with every probe flag, fed by input.
+func probeCommand(name, usage string, args []string, input seedInput) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	readSeeds := input(fs)
+	concurrency := fs.Int("c", 80, "number of concurrent workers")
+	timeout := fs.Duration("timeout", 0, "overall timeout of the HTTP attempts per name (default 8s, or the sum of the phase timeouts plus 1s once one is set)")
+	connectTimeout := fs.Duration("connect-timeout", 0, "timeout of each TCP connect (default 3s)")
+	tlsTimeout := fs.Duration("tls-timeout", 0, "timeout of each TLS handshake (default 3s)")
+	responseTimeout := fs.Duration("response-timeout", 0, "time to wait for the response headers once a request is sent (default 5s)")
+	userAgent := fs.String("ua", "", "User-Agent header sent with probes (default Go's, Go-http-client/1.1)")
+	outfile := fs.String("o", "", "output file path (optional)")
+	urlFile := fs.String("ou", "", "also write one URL per live host (scheme and port that answered) to this file, for nuclei, aquatone and the like")
+	hostsFile := fs.String("o-hosts", "", "also write the live hosts to this file in /etc/hosts format, one line per address listing every name that answered on it")
+	execHookCmd := fs.String("exec-hook", "", "run this command for every batch of results passing the output filters, with the results as JSON lines on its stdin")
+	execHookBatch := fs.Int("exec-hook-batch", 100, "results per -exec-hook run")
+	execHookTimeout := fs.Duration("exec-hook-timeout", 30*time.Second, "time limit for one -exec-hook run")
+	esURL := fs.String("es-url", "", "bulk-index the results written into Elasticsearch or OpenSearch at this URL, e.g. https://localhost:9200")
+	esIndex := fs.String("es-index", "sublive", "-es-url: index the results go to")
+	esUser := fs.String("es-user", "", "-es-url: user:password for basic auth (default $SUBLIVE_ES_USER)")
+	esAPIKey := fs.String("es-api-key", "", "-es-url: API key, sent as \"Authorization: ApiKey\" (default $SUBLIVE_ES_API_KEY)")
+	esBatch := fs.Int("es-batch", 500, "-es-url: documents per _bulk request")
+	esCreateTemplate := fs.Bool("es-create-template", false, "-es-url: create or replace an index template mapping the fields of the documents first")
+	checkpointEvery := fs.String("checkpoint-every", "", "write the results so far to numbered checkpoints next to the -o file and print an interim summary, every duration (10m) or number of results (50000)")
+	checkpointKeep := fs.Int("checkpoint-keep", 3, "-checkpoint-every: checkpoints left on disk, the older ones are removed (0 keeps all)")
+	resumePath := fs.String("resume", "", "start from a checkpoint, or the output of an unfinished run: its results are kept and their hosts not probed again")
+	manifestPath := fs.String("manifest", "", "write a JSON manifest of the run to this file at the end: version, flags, input file hashes, resolvers, times and counts")
+	screenshotDir := fs.String("screenshot", "", "after the scan, save screenshots of live, redirecting and auth-gated hosts into this directory with an index.html gallery (needs Chrome or Chromium)")
+	screenshotWorkers := fs.Int("screenshot-workers", defaultScreenshotWorkers, "pages -screenshot loads at a time")
+	screenshotTimeout := fs.Duration("screenshot-timeout", defaultScreenshotTimeout, "time limit for loading and capturing one page")
+	format := fs.String("format", "text", "output format: text, json or extended (text with body size, word and line counts)")
+	jsonOut := fs.Bool("json", false, "shorthand for -format json")
+	liveOnly := fs.Bool("x", false, "output only live (2xx) names")
+	interestingRedirects := fs.Bool("interesting-redirects", false, "with -x, output only names that redirect to another name of their domain or off it")
+	familyFlag := fs.String("family", "", "output only names with addresses of this family, 4 or 6 (dual-stack names have both)")
+	bothFamilies := fs.Bool("probe-both-families", false, "probe dual-stack names over IPv4 and IPv6 apart too and record the status of each")
+	deterministic := fs.Bool("deterministic", false, "make output byte-identical across runs that get the same answers: no times or durations, every list sorted")
+	includeAuth := fs.Bool("include-auth", false, "with -x, also output auth-gated names (401/403)")
+	liveCodesFlag := fs.String("live-codes", "", "status codes and ranges that count as live for -x and the summary, e.g. 200-299,301,302,401,403")
+	resolvedToo := fs.Bool("resolved", false, "like -x, but also output names that resolve without answering HTTP")
+	punycodeOnly := fs.Bool("punycode-only", false, "print only the ASCII (xn--) form of internationalized names")
+	verbose := fs.Bool("v", false, "verbose - log progress and statuses to stderr (info level)")
+	logPath := fs.String("log", "", "append log records (errors, backoff, progress) to this file")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn or error (default info for -log; without -log it sets the stderr level)")
+	logJSON := fs.Bool("log-json", false, "write the -log file as JSON lines")
+	resolvers := &listFlag{split: true}
+	tcpDNS := fs.Bool("tcp-dns", false, "send all DNS queries over TCP (truncated or failed UDP answers are retried over TCP anyway)")
+	dnsRetries := fs.Int("dns-retries", sublive.DefaultDNSRetries, "times a name whose lookup got REFUSED or SERVFAIL is queued again for the next resolver before it counts as failed (0 for none)")
+	ptr := fs.Bool("ptr", false, "look up the reverse DNS (PTR) names of resolved IPs")
+	ptrGrace := fs.Duration("ptr-grace", 5*time.Second, "with -ptr, how long to wait for lookups still running once the scan is done")
+	validate := fs.Bool("validate", false, "re-resolve names against trusted resolvers and mark ones they don't know as poisoned (not probed)")
+	trusted := &listFlag{split: true}
+	fs.Var(trusted, "trusted-resolvers", "resolvers for -validate, comma-separated or repeated (implies -validate; default 1.1.1.1,8.8.8.8,9.9.9.9)")
+	fs.Var(resolvers, "r", "DNS resolvers to use, comma-separated or repeated (ip or ip:port)")
+	sourceIPs := &listFlag{split: true}
+	fs.Var(sourceIPs, "source-ips", "local addresses to send from, comma-separated or repeated: every name is probed from the next in turn, DNS included")
+	sourceIface := fs.String("interface", "", "send from the addresses of this network interface, like -source-ips")
+	resolverFile := fs.String("rL", "", "file of DNS resolvers, one per line; they are health-checked first and degrading ones are evicted during the scan")
+	resolverLatency := fs.Duration("resolver-latency", time.Second, "with -rL, drop resolvers slower than this in the health check")
+	profileNetFlag := fs.Bool("profile-net", false, "time the DNS lookup, connect, TLS handshake and first byte of every probe and print percentiles and the slowest hosts in the summary")
+	resolverStats := fs.Bool("resolver-stats", false, "print per-resolver query counts and error rates in the summary (needs -r or -rL)")
+	secondPass := fs.Bool("second-pass", false, "re-probe hosts that timed out or failed DNS once the queue drains, with 5 workers and doubled timeouts")
+	noBackoff := fs.Bool("no-backoff", false, "keep probing at full speed when a host starts answering 429 or resetting connections")
+	jitter := fs.String("jitter", "", "random delay before each probe (not DNS): a duration or a range such as 50-250ms")
+	probePath := fs.String("path", "", "path requested on every name instead of /")
+	probePaths := fs.String("paths", "", "comma-separated paths requested in turn on every name until one answers other than 404, e.g. /,/robots.txt,/login")
+	cacheBust := fs.Bool("cache-bust", false, "add a random query parameter to every probe request, so caches can't answer with a stale page")
+	t := fs.Int("t", 2, "recursion: 1 also probes deep mode permutations of live names within the registrable domain of each; 2 and 3 probe the input only")
+	maxDepth := fs.Int("depth", 1, "-t 1 recursion depth: permutations of permutations are explored up to N levels")
+	order := fs.String("order", sublive.OrderAsIs, "order the input names are probed in: smart (common labels such as www, mail and api first), asis or random")
+	perHost := fs.Int("per-host", 0, "at most N concurrent probes per resolved IP, e.g. for targets behind one load balancer (0 = no cap)")
+	tlsVerify := fs.Bool("tls-verify", false, "verify TLS certificates; hosts failing verification are reported as bad-cert")
+	tlsMin := fs.String("tls-min", "", "lowest TLS version to offer: 1.0, 1.1, 1.2 or 1.3 (default 1.2)")
+	clientCert := fs.String("client-cert", "", "PEM client certificate to present for mTLS (needs -client-key)")
+	clientKey := fs.String("client-key", "", "PEM private key of -client-cert")
+	sni := fs.String("sni", "", "TLS server name to send to every probed host in place of its own (the Host header keeps the probed name)")
+	sniFromHost := fs.Bool("sni-from-host", false, "send each probed host its own name as TLS server name (the default)")
+	http2 := fs.Bool("http2", false, "negotiate HTTP/2 over TLS (-http2=false, the default, keeps every probe on HTTP/1.1)")
+	http3 := fs.Bool("http3", false, "try HTTP/3 (QUIC, UDP 443) for hosts that gave no HTTP answer over TCP")
+	http3Only := fs.Bool("http3-only", false, "probe over HTTP/3 only, skipping TCP")
+	http3Timeout := fs.Duration("http3-timeout", 0, "timeout of the HTTP/3 attempt (default -timeout)")
+	noKeepAlive := fs.Bool("no-keepalive", false, "disable HTTP connection reuse (most candidates are distinct hosts)")
+	noPreflight := fs.Bool("no-preflight", false, "skip the TCP connect pre-check of ports 80/443 before HTTP probing")
+	probeInternal := fs.Bool("probe-internal", false, "also probe names that only resolve to private, loopback or link-local addresses")
+	scopeFile := fs.String("scope-file", "", "file of in-scope CIDRs, one per line (see -scope)")
+	scopeList := &listFlag{split: true}
+	fs.Var(scopeList, "scope", "in-scope CIDRs, comma-separated or repeated; names resolving only outside them are not probed over HTTP")
+	cloudFiles := &listFlag{split: true}
+	fs.Var(cloudFiles, "cloud-ranges", "published AWS ip-ranges.json, GCP cloud.json or Azure ServiceTags JSON files replacing that provider's built-in ranges, comma-separated or repeated")
+	headers := &listFlag{}
+	fs.Var(headers, "H", "extra request header \"Name: value\" (repeatable)")
+	matchStrings := &listFlag{}
+	fs.Var(matchStrings, "match-string", "output only hosts whose response body contains this string (repeatable; any of them will do)")
+	matchRegex := &listFlag{}
+	fs.Var(matchRegex, "match-regex", "like -match-string, with a regular expression (RE2 syntax)")
+	filterStrings := &listFlag{}
+	fs.Var(filterStrings, "filter-string", "drop hosts whose response body contains this string (repeatable)")
+	filterRegex := &listFlag{}
+	fs.Var(filterRegex, "filter-regex", "like -filter-string, with a regular expression (RE2 syntax)")
+	filterSize := fs.String("fs", "", "drop hosts whose response body has one of these sizes in bytes, comma-separated values and ranges such as 0,4242,100-200")
+	filterWords := fs.String("fw", "", "like -fs, for the number of words in the body")
+	filterLines := fs.String("fl", "", "like -fs, for the number of lines in the body")
+	bodyPreview := fs.Int("body-preview", 0, "keep the first N bytes of every text response body as \"preview\" in JSON output (0 = off)")
+	previewBinary := fs.Bool("body-preview-binary", false, "with -body-preview, also keep binary bodies, base64-encoded as \"preview_base64\"")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on /metrics at this address (e.g. :9090) while scanning")
+	quiet := fs.Bool("q", false, "quiet: write no results to stdout, only the summary (-o still gets them)")
+	noSummary := fs.Bool("no-summary", false, "print no summary")
+	metadata := fs.Bool("metadata", false, "start text output with comment lines giving the version, command line, input and start and end time (JSON output always has them)")
+	group := fs.Bool("group", false, "output one result per endpoint: names with the same status, IPs, body hash and title are listed as aliases of the shortest")
+	findingsOnly := fs.Bool("findings", false, "write only results with finding tags (takeover-candidate, dangling-cloud, expired-cert, internal-ip, interesting-name), grouped by tag in text output; -x and the body filters don't apply")
+	interesting := fs.String("interesting", sublive.DefaultInteresting, "regular expression for the interesting-name finding, matched against the name left of the domain (empty turns it off)")
+	soft404 := fs.Bool("soft404", false, "request a random path of every 2xx host and count hosts answering it like the root as soft-404 instead of live")
+	keepSoft404 := fs.Bool("keep-soft404", false, "-soft404: mark soft-404 hosts but keep them in the live bucket and -x output")
+	cnames := fs.Bool("cnames", false, "look up the CNAME chain of every name outside deep mode too, for the external dependencies, CDN detection and takeover-candidate tags")
+	collapseCNAME := fs.Bool("collapse-cname", false, "probe one name per CNAME target first and, when it is a catch-all (with -soft404) or redirects to the apex, give the other names behind that target its answer, marked inherited, instead of probing them")
+	noCollapse := fs.Bool("no-collapse", false, "probe every name even with -collapse-cname, e.g. one set in the config file")
+	edgeThreshold := fs.Int("edge-threshold", 25, "count the 2xx answers of an address that gave the same status and body to this many names already as edge-default instead of live")
+	noEdgeDefault := fs.Bool("no-edge-default", false, "keep every 2xx live, however many names an address answered alike (turns -edge-threshold off)")
+	fs.Parse(args)
+	if err := setupLogging(*logPath, *logLevel, *logJSON, *verbose); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if !slices.Contains(sublive.Orders, *order) {
+		fmt.Fprintf(os.Stderr, "-order: %q is not smart, asis or random\n", *order)
+		os.Exit(1)
+	}
+	if *maxDepth < 0 {
+		fmt.Fprintln(os.Stderr, "-depth must be >= 0")
+		os.Exit(1)
+	}
+	if *edgeThreshold < 1 {
+		fmt.Fprintln(os.Stderr, "-edge-threshold must be >= 1")
+		os.Exit(1)
+	}
+
+	if *jsonOut {
+		*format = "json"
+	}
+	if (*http3 || *http3Only) && !sublive.HTTP3Supported {
+		if *http3Only {
+			fmt.Fprintln(os.Stderr, "-http3-only: this build has no HTTP/3 support (build with -tags http3)")
+			os.Exit(1)
+		}
+		logger.Warn("-http3 ignored: this build has no HTTP/3 support (build with -tags http3)")
+		*http3 = false
+	}
+	jitterMin, jitterMax, err := parseJitter(*jitter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-jitter: %v\n", err)
+		os.Exit(1)
+	}
+	var liveCodes sublive.StatusRanges
+	if *liveCodesFlag != "" {
+		if liveCodes, err = sublive.ParseStatusRanges(*liveCodesFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "-live-codes: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	counts, err := parseCountFilters(*filterSize, *filterWords, *filterLines)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	scope, err := loadScope(scopeList.values, *scopeFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scope: %v\n", err)
+		os.Exit(1)
+	}
+	cloud, err := sublive.LoadCloudRanges(cloudFiles.values...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-cloud-ranges: %v\n", err)
+		os.Exit(1)
+	}
+	interestingRe, err := interestingPattern(*interesting)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	reqHeaders, err := parseHeaders(headers.values)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	addrs := make([]string, 0, len(resolvers.values))
+	for _, r := range resolvers.values {
+		addrs = append(addrs, resolverAddr(r))
+	}
+	if *resolverFile != "" {
+		alive, err := checkResolverFile(*resolverFile, *resolverLatency)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		addrs = append(addrs, alive...)
+	}
+	warnSearchDomains(addrs)
+	srcAddrs, err := sourceAddrs(sourceIPs.values, *sourceIface)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var resolverTracker *sublive.ResolverSet
+	if *resolverFile != "" || *resolverStats {
+		if resolverTracker, err = resolverSet(addrs, *resolverStats); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	var mf *manifest
+	if *manifestPath != "" {
+		set := map[string]string{}
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = "flag" })
+		if mf, err = newManifest(fs, set, "", addrs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	timeouts := probeTimeouts(*timeout, *connectTimeout, *tlsTimeout, *responseTimeout)
+	resumed, err := loadResume(*resumePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	start := time.Now()
+	seeds, target, err := readSeeds(seedEnv{resolvers: addrs, workers: *concurrency, timeout: timeouts.Request})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+	checkpoints, err := newCheckpointer(*checkpointEvery, *checkpointKeep, *outfile, target, start, liveCodes, newStreams(os.Stderr, *outfile, *format, *quiet, *noSummary).summary)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// the input gives no domain: names belong to their registrable one,
+	// which redirects are classified and deep mode permutes within
+	for i := range seeds {
+		if seeds[i].Domain == "" {
+			seeds[i].Domain, _ = sublive.RegistrableDomain(seeds[i].Name)
+		}
+	}
+	deep := *t == 1 && *maxDepth > 0
+
+	warnFDLimit(*concurrency)
+	scanner := &sublive.Scanner{
+		Seeds:             seeds,
+		Resumed:           resumed,
+		Workers:           *concurrency,
+		Timeout:           timeouts.Request,
+		ConnectTimeout:    timeouts.Connect,
+		TLSTimeout:        timeouts.TLS,
+		ResponseTimeout:   timeouts.Response,
+		Resolvers:         addrs,
+		SourceAddrs:       srcAddrs,
+		Headers:           reqHeaders,
+		UserAgent:         *userAgent,
+		Scope:             scope,
+		Cloud:             cloud,
+		Interesting:       interestingRe,
+		ProbeInternal:     *probeInternal,
+		Preflight:         !*noPreflight,
+		DisableKeepAlives: *noKeepAlive,
+		HTTP2:             *http2,
+		BodyCounts:        *format == "extended" || !counts.empty(),
+		BodyPreview:       *bodyPreview,
+		PreviewBinary:     *previewBinary,
+		Fingerprint:       *group,
+		Soft404:           *soft404,
+		KeepSoft404:       *keepSoft404,
+		CollapseCNAME:     *collapseCNAME && !*noCollapse,
+		CNAMEChains:       *cnames,
+		HTTP3:             *http3,
+		HTTP3Only:         *http3Only,
+		HTTP3Timeout:      *http3Timeout,
+		PerHost:           *perHost,
+		JitterMin:         jitterMin,
+		JitterMax:         jitterMax,
+		SecondPass:        *secondPass,
+		NoBackoff:         *noBackoff,
+		TCPDNS:            *tcpDNS,
+		DNSRetries:        cmp.Or(*dnsRetries, -1),
+		PTR:               *ptr,
+		PTRGrace:          *ptrGrace,
+		Validate:          *validate || len(trusted.values) > 0,
+		OnBackoff:         logBackoff,
+		Order:             *order,
+	}
+	if deep {
+		scanner.Deep, scanner.Depth = true, *maxDepth
+		scanner.Permutations, _ = sublive.CompilePermPatterns(sublive.DefaultPermPatterns)
+	}
+	if err := tlsSettings(scanner, *tlsVerify, *tlsMin, *clientCert, *clientKey, *sni, *sniFromHost); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := bodySettings(scanner, matchStrings.values, matchRegex.values, filterStrings.values, filterRegex.values); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, r := range trusted.values {
+		scanner.TrustedResolvers = append(scanner.TrustedResolvers, resolverAddr(r))
+	}
+	scanner.OnDNSRetry = logDNSRetry
+	scanner.Logger = logger
+	scanner.ResolverSet = resolverTracker
+	scanner.LiveCodes = liveCodes
+	// -max-live counts the hosts -x writes, resolved-only names aside
+	scanner.Live = newLiveSet(liveCodes, *includeAuth, false).keep
+	scanner.ProfileNet = *profileNetFlag
+	if scanner.Paths, err = parsePaths(*probePath, *probePaths); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	scanner.CacheBust = *cacheBust
+	if !*noEdgeDefault {
+		scanner.EdgeThreshold = *edgeThreshold
+	}
+	family, err := parseFamily(*familyFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	scanner.ProbeBothFamilies = *bothFamilies
+	checkIPv6(scanner)
+	if *perHost > 0 {
+		scanner.OnIPLoad = logIPLoad
+	}
+	if *metricsAddr != "" {
+		scanner.Metrics = sublive.NewMetrics()
+		mctx, stop := context.WithCancel(context.Background())
+		defer stop()
+		if err := serveMetrics(mctx, *metricsAddr, scanner.Metrics); err != nil {
+			fmt.Fprintf(os.Stderr, "-metrics-addr: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// the output filters, for the results written and -exec-hook
+	prepare := func(subs []sublive.Result) []sublive.Result {
+		out := subs
+		if *liveOnly || *resolvedToo {
+			out = newLiveSet(liveCodes, *includeAuth, *resolvedToo).filter(subs)
+			if *interestingRedirects {
+				out = filterInterestingRedirects(out)
+			}
+		}
+		out = filterMatched(out, scanner)
+		out = filterCounts(out, counts)
+		out = filterFamily(out, family)
+		if *findingsOnly {
+			out = filterFindings(subs)
+		}
+		return out
+	}
+	var hook *execHook
+	if *execHookCmd != "" {
+		if hook, err = newExecHook(*execHookCmd, *execHookBatch, *execHookTimeout, prepare); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		scanner.Hook = hook.add
+	}
+	es, err := newESExporter(*esURL, *esIndex, *esUser, *esAPIKey, *esBatch, *esCreateTemplate)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var partial *partialWriter
+	if *outfile != "" {
+		if partial, err = openPartial(*outfile); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	subs, err := gatherResults(context.Background(), scanner, partial.add, checkpoints)
+	if err != nil {
+		partial.close(false)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+	hook.flush()
+	if *deterministic {
+		makeDeterministic(subs)
+	}
+	meta := newRunMeta(target, start, *metadata).finish()
+	meta.Checkpoints = checkpoints.count()
+	if *deterministic {
+		meta.redact()
+	}
+	meta.summary = summarize(subs, liveCodes)
+	meta.summary.Edges = scanner.EdgeSaturated()
+	out := prepare(subs)
+
+	written := out
+	if *group {
+		written = sublive.GroupResults(out)
+	}
+	write := func(w io.Writer) error {
+		if *findingsOnly {
+			return writeFindings(w, meta, written, *format, *punycodeOnly)
+		}
+		return writeResults(w, meta, "", nil, written, *format, *punycodeOnly)
+	}
+	streams := newStreams(os.Stderr, *outfile, *format, *quiet, *noSummary)
+	if *outfile != "" {
+		err = writeFileAtomic(*outfile, write)
+	} else {
+		err = write(streams.results)
+	}
+	partial.close(err != nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+	if *urlFile != "" {
+		if err := writeURLs(*urlFile, newLiveSet(liveCodes, *includeAuth, false).filter(written)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write -ou output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *hostsFile != "" {
+		if err := writeHosts(*hostsFile, meta, newLiveSet(liveCodes, *includeAuth, false).filter(written)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write -o-hosts output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	es.export(slices.Values(out), meta)
+	if mf != nil {
+		if err := mf.finish(meta, scanner, false).write(*manifestPath); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write -manifest: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	sumOut := streams.summary
+	fmt.Fprintf(sumOut, "\nProbed %d names in %s:\n", len(subs), elapsedText(time.Since(start), *deterministic))
+	printCounts(sumOut, subs, liveCodes)
+	printStatusCodes(sumOut, subs)
+	printReasons(sumOut, meta.summary)
+	printFindingCounts(sumOut, subs)
+	printRateDeferred(sumOut, scanner)
+	printDNSRetries(sumOut, scanner)
+	printEdgeSaturated(sumOut, scanner)
+	if *verbose {
+		printSourceStats(sumOut, scanner)
+	}
+	if hook != nil {
+		hook.printSummary(sumOut, scanner.HookDropped())
+	}
+	checkpoints.printSummary(sumOut)
+	es.printSummary(sumOut)
+	if len(resumed) > 0 {
+		fmt.Fprintf(sumOut, "  resumed: %d results from %s\n", len(resumed), *resumePath)
+	}
+	if *resolverStats {
+		printResolverStats(sumOut, resolverTracker)
+	}
+	if *profileNetFlag {
+		printNetProfile(sumOut, profileNet(subs))
+	}
+	if *group {
+		fmt.Fprintf(sumOut, "  grouped: %d results written as %d endpoints\n", len(out), len(written))
+	}
+	if *screenshotDir != "" {
+		takeScreenshots(sumOut, meta, *screenshotDir, written, *screenshotWorkers, *screenshotTimeout)
+	}
+	if *secondPass {
+		fmt.Fprintf(sumOut, "  recovered by second pass: %d\n", scanner.Recovered())
+	}
+	if scanner.Validate {
+		printValidation(sumOut, subs)
+	}
+	if *http2 || *http3 || *http3Only {
+		printProtocols(sumOut, subs)
+	}
+	if len(scanner.Match) > 0 || len(scanner.Filter) > 0 {
+		printMatches(sumOut, subs, len(scanner.Match) > 0)
+	}
+	printDangling(sumOut, subs)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rishavand1/sublive"
+)
+
+// readNames reads hostnames from path, or from stdin when path is empty,
+// converting them to ASCII and dropping duplicates. rejected counts invalid
+// entries.
+func readNames(path string) (names []string, rejected int, err error) {
+	var raw []string
+	if path != "" {
+		raw, err = sublive.LoadWordlist(path)
+	} else {
+		fi, serr := os.Stdin.Stat()
+		if serr == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			return nil, 0, fmt.Errorf("no input: pipe names to stdin or use -l file")
+		}
+		raw, err = sublive.ReadWordlist(os.Stdin)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	ascii, rejected := sublive.NormalizeWords(raw)
+	for _, n := range ascii {
+		if !sublive.ValidHostname(n) {
+			rejected++
+			continue
+		}
+		names = append(names, n)
+	}
+	return names, rejected, nil
+}
+
+func runResolve(args []string) {
+	fs := flag.NewFlagSet("resolve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: sublive resolve [flags] < names.txt\n\nResolve names (DNS only) and print \"name ip[,ip...]\".\n\n")
+		fs.PrintDefaults()
+	}
+	list := fs.String("l", "", "file with one name per line (default stdin)")
+	concurrency := fs.Int("c", 50, "number of concurrent lookups")
+	outfile := fs.String("o", "", "output file path (optional)")
+	jsonOut := fs.Bool("json", false, "write lookups as a JSON array")
+	onlyResolved := fs.Bool("x", false, "print only names that resolved")
+	resolvers := &listFlag{split: true}
+	fs.Var(resolvers, "r", "DNS resolvers to use, comma-separated or repeated (ip or ip:port)")
+	fs.Parse(args)
+
+	names, rejected, err := readNames(*list)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resolve: %v\n", err)
+		os.Exit(1)
+	}
+	if rejected > 0 {
+		logger.Warn("skipped invalid names", "count", rejected)
+	}
+	addrs := make([]string, 0, len(resolvers.values))
+	for _, r := range resolvers.values {
+		addrs = append(addrs, resolverAddr(r))
+	}
+
+	lookups := []sublive.Lookup{}
+	for l := range sublive.Resolve(context.Background(), names, addrs, *concurrency) {
+		if *onlyResolved && len(l.IPs) == 0 {
+			continue
+		}
+		lookups = append(lookups, l)
+	}
+	sort.Slice(lookups, func(i, j int) bool { return lookups[i].Name < lookups[j].Name })
+
+	var w io.Writer = os.Stdout
+	if *outfile != "" {
+		f, err := os.Create(*outfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(lookups)
+		return
+	}
+	for _, l := range lookups {
+		ips := "-"
+		if len(l.IPs) > 0 {
+			ips = strings.Join(l.IPs, ",")
+		}
+		fmt.Fprintf(w, "%s %s\n", l.Name, ips)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// checkResolverFile health-checks the resolvers listed in path, one per
+// line, and returns the ones that passed. The survivors are reported, and
+// every drop is logged at debug level with its reason.
+func checkResolverFile(path string, maxLatency time.Duration) ([]string, error) {
+	lines, err := readTargetFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("-rL: %v", err)
+	}
+	servers := make([]string, 0, len(lines))
+	for _, l := range lines {
+		servers = append(servers, resolverAddr(l))
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("-rL: no resolvers in %s", path)
+	}
+	alive, failed := sublive.CheckResolvers(context.Background(), servers, sublive.ResolverCheck{MaxLatency: maxLatency})
+	for _, f := range failed {
+		logger.Debug("dropped resolver", "server", f.Server, "reason", f.Reason)
+	}
+	if len(alive) == 0 {
+		return nil, fmt.Errorf("-rL: none of the %d resolvers in %s passed the health check", len(servers), path)
+	}
+	if len(failed) > 0 {
+		logger.Warn("dropped unhealthy resolvers", "file", path, "healthy", len(alive), "dropped", len(failed))
+	} else {
+		logger.Info("all resolvers healthy", "file", path, "healthy", len(alive))
+	}
+	return alive, nil
+}
+
+// resolverSet returns the ResolverSet that tracks addrs for -rL and
+// -resolver-stats, telling the operator about every eviction. stats
+// needs explicit resolvers to count.
+func resolverSet(addrs []string, stats bool) (*sublive.ResolverSet, error) {
+	if len(addrs) == 0 {
+		if stats {
+			return nil, fmt.Errorf("-resolver-stats needs resolvers from -r or -rL")
+		}
+		return nil, nil
+	}
+	set := sublive.NewResolverSet(addrs)
+	set.OnEvict = func(server string, rate float64) {
+		logger.Warn("evicted degrading resolver", "server", server, "error_rate", fmt.Sprintf("%.0f%%", 100*rate), "healthy", len(set.Servers()))
+	}
+	return set, nil
+}
+
+// printResolverStats lists the queries and error rate of every resolver
+// of set, for -resolver-stats.
+func printResolverStats(w io.Writer, set *sublive.ResolverSet) {
+	stats := set.Stats()
+	fmt.Fprintf(w, "  resolvers: %d of %d healthy\n", len(set.Servers()), len(stats))
+	for _, st := range stats {
+		rate := 0.0
+		if st.Queries > 0 {
+			rate = 100 * float64(st.Errors) / float64(st.Queries)
+		}
+		evicted := ""
+		if st.Evicted {
+			evicted = "  evicted"
+		}
+		fmt.Fprintf(w, "    %-21s %6d queries %6d errors (%.1f%%)%s\n", st.Server, st.Queries, st.Errors, rate, evicted)
+	}
+}
+
+// warnSearchDomains warns when the run uses the system resolver, addrs
+// being empty, and resolv.conf has search domains. Lookups are sent fully
+// qualified, so the domains are never appended, but they mark a network
+// whose resolver may answer from internal zones the public DNS doesn't
+// have; -r or -rL pick resolvers that answer like the internet does.
+func warnSearchDomains(addrs []string) {
+	if len(addrs) > 0 {
+		return
+	}
+	if domains := sublive.SystemSearchDomains(); len(domains) > 0 {
+		logger.Warn("system resolver has search domains, answers may come from internal zones; use -r or -rL", "search", strings.Join(domains, " "))
+	}
+}
@@ -0,0 +1,1943 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/rishavand1/sublive"
+)
+
+// small default wordlist. Users should supply more via pipe to stdin or file.
+var defaultWords = []string{
+	"www", "mail", "ftp", "api", "dev", "test", "stage", "admin", "portal", "beta",
+	"shop", "cdn", "m", "mobile", "secure", "webmail",
+}
+
+func loadWordlistFromStdin() ([]string, error) {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// If data is being piped
+	if (fi.Mode() & os.ModeCharDevice) == 0 {
+		return sublive.ReadWordlist(os.Stdin)
+	}
+	return nil, nil
+}
+
+// resolverAddr adds the default DNS port to a resolver given without one.
+func resolverAddr(r string) string {
+	if _, _, err := net.SplitHostPort(r); err == nil {
+		return r
+	}
+	return net.JoinHostPort(strings.Trim(r, "[]"), "53")
+}
+
+// logIPLoad logs the busiest addresses under -per-host.
+func logIPLoad(load []sublive.IPLoad) {
+	if len(load) == 0 {
+		return
+	}
+	parts := make([]string, len(load))
+	for i, l := range load {
+		parts[i] = fmt.Sprintf("%s active=%d waiting=%d", l.IP, l.Active, l.Waiting)
+	}
+	logger.Info("busiest IPs", "ips", strings.Join(parts, ", "))
+}
+
+// warnFDLimit warns when the open file limit looks too low for workers. Each
+// worker can hold a DNS socket, two pre-check connections and a probe
+// connection, and the idle pool keeps up to two more per worker.
+func warnFDLimit(workers int) {
+	limit, ok := openFileLimit()
+	need := uint64(workers)*6 + 64
+	if ok && limit < need {
+		logger.Warn("open file limit too low; raise it with ulimit -n or lower -c", "limit", limit, "workers", workers, "need", need)
+	}
+}
+
+// logDNSRetry notes a UDP query repeated over TCP.
+func logDNSRetry(server string, err error) {
+	logger.Info("retrying DNS over TCP", "server", server, "error", err)
+}
+
+// logBackoff tells the operator why the scan just slowed down.
+func logBackoff(b sublive.Backoff) {
+	logger.Warn("backing off after throttled responses (429 or connection reset); affected names will be retried",
+		"ip", b.IP, "throttled", b.Count, "duration", b.Pause, "retry_after", b.RetryAfter)
+}
+
+// parsePorts parses a comma-separated list of TCP ports.
+func parsePorts(list string) ([]int, error) {
+	ports := []int{}
+	for _, f := range strings.Split(list, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q", f)
+		}
+		ports = append(ports, n)
+	}
+	return ports, nil
+}
+
+// probeTimeouts returns the effective -timeout and phase timeouts and logs
+// them. Zero or negative phases fall back to their defaults.
+func probeTimeouts(request, connect, tls, response time.Duration) sublive.ProbeTimeouts {
+	t := sublive.ProbeTimeouts{Connect: connect, TLS: tls, Response: response, Request: request}.WithDefaults()
+	logger.Info("timeouts", "connect", t.Connect, "tls", t.TLS, "response", t.Response, "request", t.Request)
+	return t
+}
+
+// checkDomain returns the ASCII form of the -u domain, or why it can't be
+// scanned: not a valid name, or a public suffix that anyone registers
+// names under.
+func checkDomain(domain string) (string, error) {
+	ascii, err := sublive.ToASCII(domain)
+	if err != nil {
+		return "", err
+	}
+	if sublive.IsPublicSuffix(ascii) {
+		return "", fmt.Errorf("it is a public suffix, give a domain registered under it (e.g. example.%s)", ascii)
+	}
+	return ascii, nil
+}
+
+// parseJitter parses a -jitter value: a single duration for a fixed delay
+// or a min-max range such as 50-250ms or 1s-2s. A bare minimum takes the
+// unit of the maximum.
+func parseJitter(v string) (min, max time.Duration, err error) {
+	if v == "" {
+		return 0, 0, nil
+	}
+	lo, hi, isRange := strings.Cut(v, "-")
+	if !isRange {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return 0, 0, fmt.Errorf("invalid duration %q", v)
+		}
+		return d, d, nil
+	}
+	if _, err := strconv.ParseFloat(lo, 64); err == nil {
+		lo += strings.TrimLeft(hi, "0123456789.")
+	}
+	min, err1 := time.ParseDuration(lo)
+	max, err2 := time.ParseDuration(hi)
+	if err1 != nil || err2 != nil || min < 0 || max < min {
+		return 0, 0, fmt.Errorf("invalid range %q, expected min-max such as 50-250ms", v)
+	}
+	return min, max, nil
+}
+
+// parsePaths returns the paths of -path or -paths, nil for the default /.
+func parsePaths(path, paths string) ([]string, error) {
+	if path != "" && paths != "" {
+		return nil, fmt.Errorf("-path and -paths are exclusive")
+	}
+	flagName, list := "-paths", strings.Split(paths, ",")
+	if path != "" {
+		flagName, list = "-path", []string{path}
+	} else if paths == "" {
+		return nil, nil
+	}
+	out := make([]string, 0, len(list))
+	for _, p := range list {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("%s: %q doesn't start with /", flagName, p)
+		}
+		out = append(out, p)
+	}
+	return sublive.UniqStrings(out), nil
+}
+
+// countFilter is a -fs, -fw or -fl list of values and ranges, each as
+// its lowest and highest count.
+type countFilter [][2]int
+
+func (f countFilter) has(n int) bool {
+	for _, r := range f {
+		if n >= r[0] && n <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// countFilters are the -fs, -fw and -fl lists.
+type countFilters struct {
+	size, words, lines countFilter
+}
+
+func (f countFilters) empty() bool {
+	return len(f.size) == 0 && len(f.words) == 0 && len(f.lines) == 0
+}
+
+// drop reports whether r has a body whose counts match one of the lists.
+func (f countFilters) drop(r sublive.Result) bool {
+	return r.Body != nil && (f.size.has(r.Body.Bytes) || f.words.has(r.Body.Words) || f.lines.has(r.Body.Lines))
+}
+
+// parseCountFilters parses -fs, -fw and -fl values such as
+// "0,4242,100-200"; the error names the offending flag.
+func parseCountFilters(size, words, lines string) (countFilters, error) {
+	var f countFilters
+	for _, l := range []struct {
+		flag string
+		v    string
+		dst  *countFilter
+	}{{"-fs", size, &f.size}, {"-fw", words, &f.words}, {"-fl", lines, &f.lines}} {
+		for _, item := range strings.Split(l.v, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			lo, hi, isRange := strings.Cut(item, "-")
+			if !isRange {
+				hi = lo
+			}
+			min, err1 := strconv.Atoi(lo)
+			max, err2 := strconv.Atoi(hi)
+			if err1 != nil || err2 != nil || min < 0 || max < min {
+				return countFilters{}, fmt.Errorf("%s: invalid value %q, expected a count or a range such as 100-200", l.flag, item)
+			}
+			*l.dst = append(*l.dst, [2]int{min, max})
+		}
+	}
+	return f, nil
+}
+
+// filterCounts returns the results of subs not dropped by the -fs, -fw
+// and -fl lists.
+func filterCounts(subs []sublive.Result, f countFilters) []sublive.Result {
+	if f.empty() {
+		return subs
+	}
+	out := []sublive.Result{}
+	for _, r := range subs {
+		if !f.drop(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// tlsVersions maps -tls-min values to TLS versions.
+var tlsVersions = map[string]uint16{"1.0": tls.VersionTLS10, "1.1": tls.VersionTLS11, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+
+// tlsSettings applies -tls-verify, -tls-min, -client-cert/-client-key and
+// -sni/-sni-from-host to scanner; the error names the offending flag.
+func tlsSettings(scanner *sublive.Scanner, verify bool, minVersion, certFile, keyFile, sni string, sniFromHost bool) error {
+	scanner.TLSVerify = verify
+	if sni != "" && sniFromHost {
+		return errors.New("-sni and -sni-from-host are mutually exclusive")
+	}
+	if sni != "" {
+		name, err := sublive.ToASCII(sni)
+		if err != nil || !sublive.ValidHostname(name) {
+			return fmt.Errorf("-sni: invalid server name %q", sni)
+		}
+		scanner.SNI = name
+	}
+	if minVersion != "" {
+		v, ok := tlsVersions[minVersion]
+		if !ok {
+			return fmt.Errorf("-tls-min: unknown version %q, expected 1.0, 1.1, 1.2 or 1.3", minVersion)
+		}
+		scanner.TLSMinVersion = v
+	}
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("-client-cert and -client-key must be given together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("-client-cert: %v", err)
+		}
+		scanner.ClientCertificates = []tls.Certificate{cert}
+	}
+	return nil
+}
+
+// parseRecordTypes parses a -records list such as "mx,ns,txt".
+func parseRecordTypes(v string) ([]string, error) {
+	var types []string
+	for _, t := range strings.Split(v, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || slices.Contains(types, t) {
+			continue
+		}
+		if !slices.Contains(sublive.RecordTypes, t) {
+			return nil, fmt.Errorf("unknown record type %q, expected %s", t, strings.Join(sublive.RecordTypes, ", "))
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// parseHeaders turns "Name: value" strings into a header set.
+func parseHeaders(in []string) (http.Header, error) {
+	h := http.Header{}
+	for _, line := range in {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", line)
+		}
+		h.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	return h, nil
+}
+
+func runScan(args []string) {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: sublive scan -u example.com [flags]\n\nBrute-force and probe subdomains of a domain.\n\n")
+		fs.PrintDefaults()
+	}
+	domain := fs.String("u", "", "target root domain (e.g. example.com)")
+	verbose := fs.Bool("v", false, "verbose - log progress and statuses to stderr (info level)")
+	logPath := fs.String("log", "", "append log records (errors, backoff, progress) to this file")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn or error (default info for -log; without -log it sets the stderr level)")
+	logJSON := fs.Bool("log-json", false, "write the -log file as JSON lines")
+	t := fs.Int("t", 2, "recursion / speed: 1=deep+slow, 2=medium, 3=fast")
+	outfile := fs.String("o", "", "output file path (optional)")
+	urlFile := fs.String("ou", "", "also write one URL per live host (scheme and port that answered) to this file, for nuclei, aquatone and the like")
+	hostsFile := fs.String("o-hosts", "", "also write the live hosts to this file in /etc/hosts format, one line per address listing every name that answered on it")
+	screenshotDir := fs.String("screenshot", "", "after the scan, save screenshots of live, redirecting and auth-gated hosts into this directory with an index.html gallery (needs Chrome or Chromium)")
+	screenshotWorkers := fs.Int("screenshot-workers", defaultScreenshotWorkers, "pages -screenshot loads at a time")
+	screenshotTimeout := fs.Duration("screenshot-timeout", defaultScreenshotTimeout, "time limit for loading and capturing one page")
+	outDir := fs.String("o-dir", "", "also write one output file per root domain into this directory, plus _summary.json")
+	execHookCmd := fs.String("exec-hook", "", "run this command for every batch of results passing the output filters, with the results as JSON lines on its stdin")
+	execHookBatch := fs.Int("exec-hook-batch", 100, "results per -exec-hook run")
+	execHookTimeout := fs.Duration("exec-hook-timeout", 30*time.Second, "time limit for one -exec-hook run")
+	esURL := fs.String("es-url", "", "bulk-index the results written into Elasticsearch or OpenSearch at this URL, e.g. https://localhost:9200")
+	esIndex := fs.String("es-index", "sublive", "-es-url: index the results go to")
+	esUser := fs.String("es-user", "", "-es-url: user:password for basic auth (default $SUBLIVE_ES_USER)")
+	esAPIKey := fs.String("es-api-key", "", "-es-url: API key, sent as \"Authorization: ApiKey\" (default $SUBLIVE_ES_API_KEY)")
+	esBatch := fs.Int("es-batch", 500, "-es-url: documents per _bulk request")
+	esCreateTemplate := fs.Bool("es-create-template", false, "-es-url: create or replace an index template mapping the fields of the documents first")
+	manifestPath := fs.String("manifest", "", "write a JSON manifest of the run to this file at the end, a partial one on interrupt: version, flags, input file hashes, resolvers, times and counts")
+	sortLive := fs.Bool("x", false, "output only live (2xx) subdomains (with status code). When set, only live entries are printed to output")
+	deterministic := fs.Bool("deterministic", false, "make output byte-identical across runs that get the same answers: no times or durations, every list sorted")
+	includeAuth := fs.Bool("include-auth", false, "with -x, also output auth-gated hosts (401/403)")
+	liveCodesFlag := fs.String("live-codes", "", "status codes and ranges that count as live for -x, the summary, -max-live and the -monitor webhook, e.g. 200-299,301,302,401,403")
+	resolvedToo := fs.Bool("resolved", false, "like -x, but also output names that resolve without answering HTTP (candidates for other-port probing)")
+	wordlistPath := fs.String("w", "", "path to a wordlist file (optional). If provided it is used instead of stdin/defaults")
+	punycodeOnly := fs.Bool("punycode-only", false, "print only the ASCII (xn--) form of internationalized names")
+	maxDepth := fs.Int("depth", 1, "deep mode (-t 1) recursion depth: permutations of permutations are explored up to N levels, 0 disables recursion")
+	altNumbers := fs.Bool("alt-numbers", false, "deep mode: generate numbered variants (web1, web02, api-3) of live hosts")
+	mine := fs.Bool("mine", false, "deep mode: split live names into tokens on -, . and digits and combine tokens seen in -mine-min live names with the other tokens and the wordlist")
+	mineMin := fs.Int("mine-min", sublive.DefaultMineMin, "-mine: distinct live names a token must appear in before it is combined")
+	minedMax := fs.Int("mined-max", sublive.DefaultMinedMax, "-mine: most mined names queued per scan")
+	altLimit := fs.Int("alt-limit", 9, "highest number tried by -alt-numbers for each live host")
+	altMisses := fs.Int("alt-misses", 3, "-alt-numbers keeps counting past a numbered hit until this many consecutive misses")
+	noHarvest := fs.Bool("no-harvest", false, "do not harvest hostnames from redirect Location headers (strictly wordlist-driven results)")
+	scrape := fs.Bool("scrape", false, "scan headers and bodies of live responses for referenced hosts in the target domain")
+	scrapeMax := fs.Int64("scrape-max-bytes", 256<<10, "maximum body bytes read per response by -scrape and the -match/-filter options")
+	knownFiles := &listFlag{}
+	fs.Var(knownFiles, "known-file", "file of names found earlier (plain names, massdns simple output, amass or subfinder JSON lines) probed ahead of the wordlist (repeatable)")
+	ct := fs.Bool("ct", false, "seed candidates from certificate transparency logs (crt.sh)")
+	ctOnly := fs.Bool("ct-only", false, "probe only certificate transparency names, skipping the wordlist (implies -ct)")
+	axfr := fs.Bool("axfr", false, "try a zone transfer from each nameserver of the domain and add the names it returns")
+	axfrOnly := fs.Bool("axfr-only", false, "probe only names from a zone transfer, skipping the wordlist (implies -axfr)")
+	ctTimeout := fs.Duration("ct-timeout", 30*time.Second, "timeout for the crt.sh query")
+	jsonOut := fs.Bool("json", false, "shorthand for -format json")
+	permPath := fs.String("perm-file", "", "deep mode permutation templates, one per line using %s or {sub} (default: {sub}-stage, {sub}-dev, api.{sub})")
+	concurrency := fs.Int("c", 0, "number of concurrent workers (default depends on -t)")
+	timeout := fs.Duration("timeout", 0, "overall timeout of the HTTP attempts per candidate (default 8s, or the sum of the phase timeouts plus 1s once one is set)")
+	connectTimeout := fs.Duration("connect-timeout", 0, "timeout of each TCP connect (default 3s)")
+	tlsTimeout := fs.Duration("tls-timeout", 0, "timeout of each TLS handshake (default 3s)")
+	responseTimeout := fs.Duration("response-timeout", 0, "time to wait for the response headers once a request is sent (default 5s)")
+	userAgent := fs.String("ua", "", "User-Agent header sent with probes (default Go's, Go-http-client/1.1)")
+	format := fs.String("format", "text", "output format: text, json or extended (text with body size, word and line counts)")
+	resolvers := &listFlag{split: true}
+	tcpDNS := fs.Bool("tcp-dns", false, "send all DNS queries over TCP (truncated or failed UDP answers are retried over TCP anyway)")
+	dnsRetries := fs.Int("dns-retries", sublive.DefaultDNSRetries, "times a name whose lookup got REFUSED or SERVFAIL is queued again for the next resolver before it counts as failed (0 for none)")
+	records := fs.String("records", "", "DNS record types to collect for the root domain, comma-separated: mx, ns, txt, dmarc (txt implies dmarc)")
+	recordsAllSubs := fs.Bool("records-all-subs", false, "with -records, also collect them for every resolved subdomain")
+	ptr := fs.Bool("ptr", false, "look up the reverse DNS (PTR) names of resolved IPs; with -t 1 in-domain ones are probed too")
+	ptrGrace := fs.Duration("ptr-grace", 5*time.Second, "with -ptr, how long to wait for lookups still running once the scan is done")
+	fastDNS := fs.Bool("fast-dns", false, "resolve the whole candidate list up front with raw UDP queries and probe only names that resolve")
+	fastDNSRate := fs.Int("fast-dns-rate", 0, "with -fast-dns, max queries per second to each resolver (0 = no limit)")
+	validate := fs.Bool("validate", false, "re-resolve names against trusted resolvers and mark ones they don't know as poisoned (not probed)")
+	trusted := &listFlag{split: true}
+	fs.Var(trusted, "trusted-resolvers", "resolvers for -validate, comma-separated or repeated (implies -validate; default 1.1.1.1,8.8.8.8,9.9.9.9)")
+	fs.Var(resolvers, "r", "DNS resolvers to use, comma-separated or repeated (ip or ip:port)")
+	sourceIPs := &listFlag{split: true}
+	fs.Var(sourceIPs, "source-ips", "local addresses to send from, comma-separated or repeated: every name is probed from the next in turn, DNS included")
+	sourceIface := fs.String("interface", "", "send from the addresses of this network interface, like -source-ips")
+	resolverFile := fs.String("rL", "", "file of DNS resolvers, one per line; they are health-checked first and degrading ones are evicted during the scan")
+	resolverLatency := fs.Duration("resolver-latency", time.Second, "with -rL, drop resolvers slower than this in the health check")
+	profileNetFlag := fs.Bool("profile-net", false, "time the DNS lookup, connect, TLS handshake and first byte of every probe and print percentiles and the slowest hosts in the summary")
+	resolverStats := fs.Bool("resolver-stats", false, "print per-resolver query counts and error rates in the summary (needs -r or -rL)")
+	headers := &listFlag{}
+	fs.Var(headers, "H", "extra request header \"Name: value\" (repeatable)")
+	matchStrings := &listFlag{}
+	fs.Var(matchStrings, "match-string", "output only hosts whose response body contains this string (repeatable; any of them will do)")
+	matchRegex := &listFlag{}
+	fs.Var(matchRegex, "match-regex", "like -match-string, with a regular expression (RE2 syntax)")
+	filterStrings := &listFlag{}
+	fs.Var(filterStrings, "filter-string", "drop hosts whose response body contains this string (repeatable)")
+	filterRegex := &listFlag{}
+	fs.Var(filterRegex, "filter-regex", "like -filter-string, with a regular expression (RE2 syntax)")
+	filterSize := fs.String("fs", "", "drop hosts whose response body has one of these sizes in bytes, comma-separated values and ranges such as 0,4242,100-200")
+	filterWords := fs.String("fw", "", "like -fs, for the number of words in the body")
+	filterLines := fs.String("fl", "", "like -fs, for the number of lines in the body")
+	bodyPreview := fs.Int("body-preview", 0, "keep the first N bytes of every text response body as \"preview\" in JSON output (0 = off)")
+	previewBinary := fs.Bool("body-preview-binary", false, "with -body-preview, also keep binary bodies, base64-encoded as \"preview_base64\"")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on /metrics at this address (e.g. :9090) while scanning")
+	checkpointEvery := fs.String("checkpoint-every", "", "write the results so far to numbered checkpoints next to the -o file and print an interim summary, every duration (10m) or number of results (50000)")
+	checkpointKeep := fs.Int("checkpoint-keep", 3, "-checkpoint-every: checkpoints left on disk, the older ones are removed (0 keeps all)")
+	resumePath := fs.String("resume", "", "start from a checkpoint, or the output of an unfinished scan: its results are kept and their names not probed again")
+	lowMemory := fs.Bool("low-memory", false, "keep the results in a temporary file instead of memory, sorted by an external merge, and print only the summary counts: for candidate lists of millions of names")
+	tuiMode := fs.Bool("tui", false, "show the results in a live terminal UI with keys to filter, pause, toggle deep-mode permutations and save a snapshot (needs a terminal)")
+	quiet := fs.Bool("q", false, "quiet: write no results to stdout, only the summary (-o still gets them); with -monitor, print the cycle lines but not the changes")
+	noSummary := fs.Bool("no-summary", false, "print no summary, nor the sections after it")
+	metadata := fs.Bool("metadata", false, "start text output with comment lines giving the version, command line, target and start and end time (JSON output always has them)")
+	group := fs.Bool("group", false, "output one result per endpoint: names with the same status, IPs, body hash and title are listed as aliases of the shortest")
+	findingsOnly := fs.Bool("findings", false, "write only results with finding tags (takeover-candidate, dangling-cloud, expired-cert, internal-ip, interesting-name), grouped by tag in text output; -x and the body filters don't apply")
+	interesting := fs.String("interesting", sublive.DefaultInteresting, "regular expression for the interesting-name finding, matched against the name left of the domain (empty turns it off)")
+	soft404 := fs.Bool("soft404", false, "request a random path of every 2xx host and count hosts answering it like the root as soft-404 instead of live")
+	keepSoft404 := fs.Bool("keep-soft404", false, "-soft404: mark soft-404 hosts but keep them in the live bucket and -x output")
+	cnames := fs.Bool("cnames", false, "look up the CNAME chain of every name outside deep mode too, for the external dependencies, CDN detection and takeover-candidate tags")
+	collapseCNAME := fs.Bool("collapse-cname", false, "probe one name per CNAME target first and, when it is a catch-all (with -soft404) or redirects to the apex, give the other names behind that target its answer, marked inherited, instead of probing them")
+	noCollapse := fs.Bool("no-collapse", false, "probe every name even with -collapse-cname, e.g. one set in the config file")
+	edgeThreshold := fs.Int("edge-threshold", 25, "count the 2xx answers of an address that gave the same status and body to this many names already as edge-default instead of live")
+	noEdgeDefault := fs.Bool("no-edge-default", false, "keep every 2xx live, however many names an address answered alike (turns -edge-threshold off)")
+	excludes := &listFlag{split: true}
+	fs.Var(excludes, "exclude", "names never to probe, comma-separated or repeated; plain names also exclude their subdomains, globs like *.internal.example.com match the full name")
+	monitorMode := fs.Bool("monitor", false, "keep scanning every -interval and print only the changes between cycles")
+	interval := fs.Duration("interval", 6*time.Hour, "time between -monitor cycles")
+	statePath := fs.String("state", "", "-monitor: file the last cycle's results are kept in, so changes are tracked across restarts")
+	webhook := fs.String("webhook", "", "-monitor: URL that receives a JSON POST when new live hosts appear")
+	dnsCache := fs.Duration("dns-cache", time.Hour, "-monitor: reuse resolved addresses for this long across cycles (0 disables)")
+	geoPath := fs.String("geoip", "", "MaxMind database (e.g. GeoLite2-City.mmdb) used to add country, city and organization of resolved IPs")
+	asn := fs.Bool("asn", false, "look up the autonomous system of each resolved IP (Team Cymru DNS, or -asn-file)")
+	asnFile := fs.String("asn-file", "", "offline IP to ASN table in iptoasn.com TSV format used by -asn instead of DNS")
+	excludeCDN := fs.Bool("exclude-cdn", false, "with -x, leave out hosts served by a CDN")
+	interestingRedirects := fs.Bool("interesting-redirects", false, "with -x, output only hosts that redirect to another name of the domain or off it")
+	familyFlag := fs.String("family", "", "output only hosts with addresses of this family, 4 or 6 (dual-stack hosts have both)")
+	bothFamilies := fs.Bool("probe-both-families", false, "probe dual-stack hosts over IPv4 and IPv6 apart too and record the status of each")
+	cdnRanges := fs.String("cdn-ranges", "", "file of \"provider cidr\" lines replacing the built-in CDN address ranges")
+	cloudFiles := &listFlag{split: true}
+	fs.Var(cloudFiles, "cloud-ranges", "published AWS ip-ranges.json, GCP cloud.json or Azure ServiceTags JSON files replacing that provider's built-in ranges, comma-separated or repeated")
+	banner := fs.Bool("banner", false, "for hosts that fail HTTP, connect to -banner-ports and record the service greeting")
+	bannerPorts := fs.String("banner-ports", "", "comma-separated ports tried by -banner (default 21,22,25,110,143,587,3306)")
+	autoScale := fs.Bool("auto-scale", false, "adjust the worker count between -min-workers and -max-workers from the timeout/reset rate (replaces -c)")
+	minWorkers := fs.Int("min-workers", 10, "-auto-scale: starting and lowest worker count")
+	maxWorkers := fs.Int("max-workers", 300, "-auto-scale: highest worker count")
+	maxLive := fs.Int("max-live", 0, "stop once N live hosts were found; probes in flight still finish")
+	maxRequests := fs.Int64("max-requests", 0, "stop the scan after this many HTTP requests, redirects and retries included (exit status 3)")
+	maxBytesFlag := fs.String("max-bytes", "", "stop the scan after receiving this much, e.g. 500MB (exit status 3)")
+	maxTime := fs.Duration("max-time", 0, "stop the scan after this long and report what was found so far (exit status 3); per cycle with -monitor")
+	secondPass := fs.Bool("second-pass", false, "re-probe hosts that timed out or failed DNS once the queue drains, with 5 workers and doubled timeouts (default on with -t 1)")
+	noBackoff := fs.Bool("no-backoff", false, "keep probing at full speed when a host starts answering 429 or resetting connections")
+	jitter := fs.String("jitter", "", "random delay before each probe (not DNS): a duration or a range such as 50-250ms")
+	probePath := fs.String("path", "", "path requested on every host instead of /")
+	probePaths := fs.String("paths", "", "comma-separated paths requested in turn on every host until one answers other than 404, e.g. /,/robots.txt,/login")
+	cacheBust := fs.Bool("cache-bust", false, "add a random query parameter to every probe request, so caches can't answer with a stale page")
+	order := fs.String("order", sublive.OrderAsIs, "order the input names are probed in: smart (common labels such as www, mail and api first), asis or random")
+	perHost := fs.Int("per-host", 0, "at most N concurrent probes per resolved IP, e.g. for targets behind one load balancer (0 = no cap)")
+	tlsVerify := fs.Bool("tls-verify", false, "verify TLS certificates; hosts failing verification are reported as bad-cert")
+	tlsMin := fs.String("tls-min", "", "lowest TLS version to offer: 1.0, 1.1, 1.2 or 1.3 (default 1.2)")
+	clientCert := fs.String("client-cert", "", "PEM client certificate to present for mTLS (needs -client-key)")
+	clientKey := fs.String("client-key", "", "PEM private key of -client-cert")
+	sni := fs.String("sni", "", "TLS server name to send to every probed host in place of its own (the Host header keeps the probed name)")
+	sniFromHost := fs.Bool("sni-from-host", false, "send each probed host its own name as TLS server name (the default)")
+	http2 := fs.Bool("http2", false, "negotiate HTTP/2 over TLS (-http2=false, the default, keeps every probe on HTTP/1.1)")
+	http3 := fs.Bool("http3", false, "try HTTP/3 (QUIC, UDP 443) for hosts that gave no HTTP answer over TCP")
+	http3Only := fs.Bool("http3-only", false, "probe over HTTP/3 only, skipping TCP")
+	http3Timeout := fs.Duration("http3-timeout", 0, "timeout of the HTTP/3 attempt (default -timeout)")
+	noKeepAlive := fs.Bool("no-keepalive", false, "disable HTTP connection reuse (most candidates are distinct hosts)")
+	noPreflight := fs.Bool("no-preflight", false, "skip the TCP connect pre-check of ports 80/443 before HTTP probing")
+	probeInternal := fs.Bool("probe-internal", false, "also probe names that only resolve to private, loopback or link-local addresses")
+	scopeFile := fs.String("scope-file", "", "file of in-scope CIDRs, one per line (see -scope)")
+	recheckPath := fs.String("recheck", "", "re-probe the hosts of a previous result file (JSON or text) instead of generating candidates; -u is optional")
+	recheckFilter := fs.String("recheck-filter", "all", "-recheck: which previous hosts to re-probe: live, dead or all")
+	noRoot := fs.Bool("no-root", false, "don't probe the domain itself and its www name first")
+	force := fs.Bool("force", false, "scan even when the domain has no address and no nameservers, or DNS looks broken")
+	dbPath := fs.String("db", "", "results history file kept across runs: hosts not seen by earlier runs are listed after the summary and marked \"new\" in JSON (see sublive history)")
+	diffPath := fs.String("diff", "", "compare this run with a previous result file (JSON or text) and print the changes after the summary")
+	scopeList := &listFlag{split: true}
+	fs.Var(scopeList, "scope", "in-scope CIDRs, comma-separated or repeated; names resolving only outside them are not probed over HTTP")
+	configPath := fs.String("config", "", "config file with default options (default ~/.config/sublive/config.yaml)")
+	configDump := fs.Bool("config-dump", false, "print the effective configuration (defaults, config file, flags) and exit")
+	fs.Parse(args)
+	if err := setupLogging(*logPath, *logLevel, *logJSON, *verbose); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// flags given on the command line win over the config file
+	sources := map[string]string{}
+	fs.Visit(func(f *flag.Flag) { sources[f.Name] = "flag" })
+	usedConfig, err := loadAndApplyConfig(fs, *configPath, sources)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		os.Exit(1)
+	}
+	if sources["second-pass"] == "" {
+		*secondPass = *t == 1
+	}
+	if !slices.Contains(sublive.Orders, *order) {
+		fmt.Fprintf(os.Stderr, "-order: %q is not smart, asis or random\n", *order)
+		os.Exit(1)
+	}
+	if sources["max-live"] != "" && *maxLive < 1 {
+		fmt.Fprintln(os.Stderr, "-max-live must be at least 1")
+		os.Exit(1)
+	}
+	if *tuiMode {
+		if err := checkTUI(*monitorMode); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *lowMemory {
+		if err := checkLowMemory(fs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *checkpointEvery != "" && (*monitorMode || *tuiMode) {
+		fmt.Fprintln(os.Stderr, "-checkpoint-every can't be combined with -monitor or -tui")
+		os.Exit(1)
+	}
+	if *configDump {
+		dumpConfig(os.Stdout, fs, usedConfig, sources)
+		os.Exit(0)
+	}
+	if *jsonOut {
+		*format = "json"
+	}
+	if *format != "text" && *format != "json" && *format != "extended" {
+		fmt.Fprintf(os.Stderr, "unknown -format %q (want text, json or extended)\n", *format)
+		os.Exit(1)
+	}
+	reqHeaders, err := parseHeaders(headers.values)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	resolverAddrs := make([]string, 0, len(resolvers.values))
+	for _, r := range resolvers.values {
+		resolverAddrs = append(resolverAddrs, resolverAddr(r))
+	}
+	if *resolverFile != "" {
+		alive, err := checkResolverFile(*resolverFile, *resolverLatency)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		resolverAddrs = append(resolverAddrs, alive...)
+	}
+	warnSearchDomains(resolverAddrs)
+	srcAddrs, err := sourceAddrs(sourceIPs.values, *sourceIface)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var resolverTracker *sublive.ResolverSet
+	if *resolverFile != "" || *resolverStats {
+		if resolverTracker, err = resolverSet(resolverAddrs, *resolverStats); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	var mf *manifest
+	if *manifestPath != "" {
+		if mf, err = newManifest(fs, sources, usedConfig, resolverAddrs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *maxDepth < 0 {
+		fmt.Fprintln(os.Stderr, "-depth must be >= 0")
+		os.Exit(1)
+	}
+	if *edgeThreshold < 1 {
+		fmt.Fprintln(os.Stderr, "-edge-threshold must be >= 1")
+		os.Exit(1)
+	}
+	if *altLimit < 0 || *altMisses < 1 {
+		fmt.Fprintln(os.Stderr, "-alt-limit must be >= 0 and -alt-misses >= 1")
+		os.Exit(1)
+	}
+	if *mineMin < 1 || *minedMax < 1 {
+		fmt.Fprintln(os.Stderr, "-mine-min and -mined-max must be >= 1")
+		os.Exit(1)
+	}
+
+	if *domain == "" && *recheckPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	// load the previous results up front so a bad path fails before the scan
+	var previous []sublive.Result
+	if *diffPath != "" {
+		previous, err = sublive.LoadResults(*diffPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// likewise the history, so a locked or broken file fails before the scan
+	var history *sublive.History
+	if *dbPath != "" {
+		if *monitorMode {
+			fmt.Fprintln(os.Stderr, "-db: not supported with -monitor (use -state)")
+			os.Exit(1)
+		}
+		history, err = sublive.OpenHistory(*dbPath, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-db: %v\n", err)
+			os.Exit(1)
+		}
+		defer history.Close()
+	}
+
+	if *domain != "" {
+		asciiDomain, err := checkDomain(*domain)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid domain '%s': %v\n", *domain, err)
+			os.Exit(1)
+		}
+		*domain = asciiDomain
+	}
+	var geo *sublive.GeoDB
+	if *geoPath != "" {
+		geo, err = sublive.OpenGeoDB(*geoPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer geo.Close()
+	}
+	var asnTable *sublive.ASNTable
+	if *asnFile != "" {
+		*asn = true
+		asnTable, err = sublive.LoadASNTable(*asnFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "asn: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	cdn := sublive.NewCDNDetector()
+	if *cdnRanges != "" {
+		cdn, err = sublive.LoadCDNRanges(*cdnRanges)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cdn: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	cloud, err := sublive.LoadCloudRanges(cloudFiles.values...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-cloud-ranges: %v\n", err)
+		os.Exit(1)
+	}
+	scope, err := loadScope(scopeList.values, *scopeFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scope: %v\n", err)
+		os.Exit(1)
+	}
+	if (*http3 || *http3Only) && !sublive.HTTP3Supported {
+		if *http3Only {
+			fmt.Fprintln(os.Stderr, "-http3-only: this build has no HTTP/3 support (build with -tags http3)")
+			os.Exit(1)
+		}
+		logger.Warn("-http3 ignored: this build has no HTTP/3 support (build with -tags http3)")
+		*http3 = false
+	}
+	var liveCodes sublive.StatusRanges
+	if *liveCodesFlag != "" {
+		if liveCodes, err = sublive.ParseStatusRanges(*liveCodesFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "-live-codes: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	jitterMin, jitterMax, err := parseJitter(*jitter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-jitter: %v\n", err)
+		os.Exit(1)
+	}
+	counts, err := parseCountFilters(*filterSize, *filterWords, *filterLines)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	recordTypes, err := parseRecordTypes(*records)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-records: %v\n", err)
+		os.Exit(1)
+	}
+	var ports []int
+	if *bannerPorts != "" {
+		if ports, err = parsePorts(*bannerPorts); err != nil {
+			fmt.Fprintf(os.Stderr, "-banner-ports: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var rechecked map[string]sublive.Result
+	var recheckSeeds []sublive.Candidate
+	if *recheckPath != "" {
+		recheckSeeds, rechecked, err = loadRecheck(*recheckPath, *recheckFilter, *domain)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "recheck: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	resumed, err := loadResume(*resumePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	checkpoints, err := newCheckpointer(*checkpointEvery, *checkpointKeep, *outfile, *domain, start, liveCodes, newStreams(os.Stderr, *outfile, *format, *quiet, *noSummary).summary)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *recheckPath != "" {
+		logger.Info("rechecking", "version", sublive.Version, "hosts", len(recheckSeeds), "file", *recheckPath)
+	} else {
+		logger.Info("scanning", "version", sublive.Version, "domain", *domain)
+		if err := checkRoot(*domain, resolverAddrs, *force); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	// determine wordlist source: -w file > stdin > defaults
+	var words []string
+	if *ctOnly || *axfrOnly || *recheckPath != "" {
+		// no wordlist at all
+	} else if *wordlistPath != "" {
+		w, err := sublive.LoadWordlist(*wordlistPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open wordlist '%s': %v\n", *wordlistPath, err)
+			os.Exit(1)
+		}
+		words = w
+		logger.Info("loaded wordlist", "words", len(words), "file", *wordlistPath)
+	} else if piped, _ := loadWordlistFromStdin(); piped != nil && len(piped) > 0 {
+		words = piped
+		logger.Info("loaded wordlist", "words", len(words), "file", "stdin")
+	} else {
+		switch *t {
+		case 1:
+			words = append(defaultWords, "app", "gateway", "auth", "accounts", "login", "payments", "images", "static", "docs", "status", "internal", "ops", "graphql", "socket", "router", "db")
+		case 2:
+			words = append(defaultWords, "app", "auth", "login", "api", "static", "cdn")
+		case 3:
+			words = defaultWords
+		default:
+			words = defaultWords
+		}
+	}
+
+	// convert wordlist entries to ASCII; invalid IDN labels are dropped here
+	// so workers only ever see names that are valid on the wire
+	words, rejected := sublive.NormalizeWords(words)
+	if rejected > 0 {
+		logger.Info("skipped invalid or mixed-script wordlist entries", "count", rejected)
+	}
+
+	// generate initial candidate subdomains
+	candidates := sublive.Candidates(words, *domain)
+	candidates = append(candidates, recheckSeeds...)
+
+	if len(knownFiles.values) > 0 && *recheckPath == "" {
+		if candidates, err = addKnownSeeds(candidates, *domain, knownFiles.values); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if (*ct || *ctOnly) && *recheckPath == "" {
+		candidates = addCTSeeds(candidates, *domain, *ctTimeout)
+	}
+	var transfer *sublive.ZoneTransfer
+	axfrTried := (*axfr || *axfrOnly) && *recheckPath == ""
+	if axfrTried {
+		axfrScanner := &sublive.Scanner{Resolvers: resolverAddrs, TCPDNS: *tcpDNS, SourceAddrs: srcAddrs, OnDNSRetry: logDNSRetry}
+		candidates, transfer = addAXFRSeeds(candidates, *domain, axfrScanner)
+	}
+
+	// depth 0 turns deep mode off entirely
+	deep := (*t == 1) && *maxDepth > 0
+
+	permLines := sublive.DefaultPermPatterns
+	if *permPath != "" {
+		p, err := sublive.LoadWordlist(*permPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open permutation file '%s': %v\n", *permPath, err)
+			os.Exit(1)
+		}
+		permLines = p
+	}
+	perms, badPerms := sublive.CompilePermPatterns(permLines)
+	if len(badPerms) > 0 {
+		logger.Info("skipped invalid permutation patterns", "count", len(badPerms), "patterns", strings.Join(badPerms, ", "))
+	}
+	if deep {
+		logger.Info("using permutation patterns", "count", len(perms))
+	}
+
+	// set concurrency
+	workers := 30
+	switch *t {
+	case 1:
+		workers = 30
+	case 2:
+		workers = 80
+	case 3:
+		workers = runtime.NumCPU() * 40
+	}
+	if *concurrency > 0 {
+		workers = *concurrency
+	}
+
+	if *autoScale {
+		if *minWorkers < 1 || *maxWorkers < *minWorkers {
+			fmt.Fprintln(os.Stderr, "-min-workers must be >= 1 and -max-workers >= -min-workers")
+			os.Exit(1)
+		}
+		workers = *maxWorkers
+	}
+	if *autoScale {
+		logger.Info("starting", "workers", fmt.Sprintf("auto(%d-%d)", *minWorkers, *maxWorkers), "deep", deep, "candidates", len(candidates))
+	} else {
+		logger.Info("starting", "workers", workers, "deep", deep, "candidates", len(candidates))
+	}
+	warnFDLimit(workers)
+
+	timeouts := probeTimeouts(*timeout, *connectTimeout, *tlsTimeout, *responseTimeout)
+	var domains []string
+	if *domain != "" {
+		domains = []string{*domain}
+	}
+	scanner := &sublive.Scanner{
+		Domains:         domains,
+		Seeds:           candidates,
+		ProbeRoot:       !*noRoot && *recheckPath == "",
+		Workers:         workers,
+		Timeout:         timeouts.Request,
+		ConnectTimeout:  timeouts.Connect,
+		TLSTimeout:      timeouts.TLS,
+		ResponseTimeout: timeouts.Response,
+		Resolvers:       resolverAddrs,
+		SourceAddrs:     srcAddrs,
+		Headers:         reqHeaders,
+		UserAgent:       *userAgent,
+		Exclude:         excludes.values,
+		Deep:            deep,
+		Depth:           *maxDepth,
+		Permutations:    perms,
+		Mine:            *mine,
+		MineMin:         *mineMin,
+		MinedMax:        *minedMax,
+		AltNumbers:      *altNumbers,
+		AltLimit:        *altLimit,
+		AltMisses:       *altMisses,
+		Harvest:         !*noHarvest,
+		Scrape:          *scrape,
+		BodyMaxBytes:    *scrapeMax,
+	}
+	// Permutations must stay non-nil so an all-invalid -perm-file doesn't
+	// silently fall back to the defaults
+	if scanner.Permutations == nil {
+		scanner.Permutations = []sublive.PermPattern{}
+	}
+	scanner.HostCache = sublive.NewHostCache(*dnsCache)
+	scanner.GeoIP = geo
+	scanner.CDN = cdn
+	scanner.Cloud = cloud
+	scanner.Interesting, err = interestingPattern(*interesting)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	scanner.Scope = scope
+	scanner.ProbeInternal = *probeInternal
+	scanner.Preflight = !*noPreflight
+	scanner.DisableKeepAlives = *noKeepAlive
+	scanner.HTTP2 = *http2
+	if err := tlsSettings(scanner, *tlsVerify, *tlsMin, *clientCert, *clientKey, *sni, *sniFromHost); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := bodySettings(scanner, matchStrings.values, matchRegex.values, filterStrings.values, filterRegex.values); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	scanner.BodyCounts = *format == "extended" || !counts.empty()
+	scanner.BodyPreview, scanner.PreviewBinary = *bodyPreview, *previewBinary
+	scanner.Fingerprint = *group
+	scanner.Soft404, scanner.KeepSoft404 = *soft404, *keepSoft404
+	scanner.CollapseCNAME = *collapseCNAME && !*noCollapse
+	scanner.CNAMEChains = *cnames
+	if !*noEdgeDefault {
+		scanner.EdgeThreshold = *edgeThreshold
+	}
+	scanner.LowMemory = *lowMemory
+	scanner.Resumed = resumed
+	scanner.HTTP3, scanner.HTTP3Only, scanner.HTTP3Timeout = *http3, *http3Only, *http3Timeout
+	scanner.PerHost = *perHost
+	scanner.JitterMin, scanner.JitterMax = jitterMin, jitterMax
+	scanner.SecondPass = *secondPass
+	scanner.NoBackoff = *noBackoff
+	scanner.TCPDNS = *tcpDNS
+	// -dns-retries 0 turns them off, which the Scanner spells -1
+	scanner.DNSRetries = cmp.Or(*dnsRetries, -1)
+	scanner.FastDNS, scanner.FastDNSRate = *fastDNS, *fastDNSRate
+	scanner.PTR, scanner.PTRGrace = *ptr, *ptrGrace
+	if *recordsAllSubs {
+		scanner.Records = recordTypes
+	}
+	scanner.OnDNSRetry = logDNSRetry
+	scanner.Logger = logger
+	scanner.ResolverSet = resolverTracker
+	scanner.LiveCodes = liveCodes
+	// -max-live counts the hosts -x writes, resolved-only names aside
+	scanner.Live = newLiveSet(liveCodes, *includeAuth, false).keep
+	scanner.ProfileNet = *profileNetFlag
+	scanner.Validate = *validate || len(trusted.values) > 0
+	for _, r := range trusted.values {
+		scanner.TrustedResolvers = append(scanner.TrustedResolvers, resolverAddr(r))
+	}
+	scanner.OnBackoff = logBackoff
+	scanner.MaxLive = *maxLive
+	if scanner.Paths, err = parsePaths(*probePath, *probePaths); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	scanner.CacheBust = *cacheBust
+	family, err := parseFamily(*familyFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	scanner.ProbeBothFamilies = *bothFamilies
+	checkIPv6(scanner)
+	scanner.MaxRequests = *maxRequests
+	if *maxBytesFlag != "" {
+		if scanner.MaxBytes, err = parseByteSize(*maxBytesFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "-max-bytes: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	scanner.Order = *order
+	if *perHost > 0 {
+		scanner.OnIPLoad = logIPLoad
+	}
+	if *autoScale {
+		scanner.AutoScale = true
+		scanner.MinWorkers, scanner.MaxWorkers = *minWorkers, *maxWorkers
+		scanner.OnScale = func(from, to int, rate float64) {
+			logger.Info("workers scaled", "from", from, "to", to, "failure_rate", fmt.Sprintf("%.1f%%", rate*100))
+		}
+	}
+	scanner.Banner = *banner
+	scanner.BannerPorts = ports
+	if *metricsAddr != "" {
+		scanner.Metrics = sublive.NewMetrics()
+		mctx, stop := context.WithCancel(context.Background())
+		defer stop()
+		if err := serveMetrics(mctx, *metricsAddr, scanner.Metrics); err != nil {
+			fmt.Fprintf(os.Stderr, "-metrics-addr: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// the output filters, for the results written and -exec-hook
+	prepare := func(subs []sublive.Result) []sublive.Result {
+		outResults := subs
+		if *sortLive || *resolvedToo {
+			outResults = newLiveSet(liveCodes, *includeAuth, *resolvedToo).filter(subs)
+			if *excludeCDN {
+				outResults = filterNoCDN(outResults)
+			}
+			if *interestingRedirects {
+				outResults = filterInterestingRedirects(outResults)
+			}
+		}
+		outResults = filterMatched(outResults, scanner)
+		outResults = filterCounts(outResults, counts)
+		outResults = filterFamily(outResults, family)
+		if *findingsOnly {
+			outResults = filterFindings(subs)
+		}
+		return outResults
+	}
+	var hook *execHook
+	if *execHookCmd != "" {
+		if hook, err = newExecHook(*execHookCmd, *execHookBatch, *execHookTimeout, prepare); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		scanner.Hook = hook.add
+	}
+	es, err := newESExporter(*esURL, *esIndex, *esUser, *esAPIKey, *esBatch, *esCreateTemplate)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *monitorMode {
+		m := &monitor{
+			scanner:      scanner,
+			domain:       *domain,
+			words:        words,
+			seeds:        recheckSeeds,
+			ct:           (*ct || *ctOnly) && *recheckPath == "",
+			ctTimeout:    *ctTimeout,
+			interval:     *interval,
+			statePath:    *statePath,
+			webhook:      *webhook,
+			outfile:      *outfile,
+			format:       *format,
+			punycodeOnly: *punycodeOnly,
+			prepare:      prepare,
+			maxTime:      *maxTime,
+			metadata:     *metadata,
+			quiet:        *quiet,
+			manifest:     mf,
+			manifestPath: *manifestPath,
+			hook:         hook,
+			es:           es,
+		}
+		m.run()
+		return
+	}
+
+	var partial *partialWriter
+	if *outfile != "" {
+		if partial, err = openPartial(*outfile); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	ctx, interrupt := context.WithCancelCause(context.Background())
+	defer interrupt(nil)
+	stopOnInterrupt(interrupt, func() {
+		partial.close(true)
+		// the settings only: the counts never came in
+		if mf != nil {
+			mf.runMeta, mf.Partial = *newRunMeta(*domain, start, false).finish(), true
+			mf.write(*manifestPath)
+		}
+	})
+	if *maxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *maxTime)
+		defer cancel()
+	}
+	var subs []sublive.Result
+	var sp *spool
+	switch {
+	case *tuiMode:
+		subs, err = runTUI(ctx, interrupt, scanner, *domain, *metadata, start, partial.add)
+	case *lowMemory:
+		if sp, err = newSpool(); err == nil {
+			defer sp.close()
+			// the scanner sends every name once, so the .partial file
+			// needn't remember them
+			if partial != nil {
+				partial.seen = nil
+			}
+			err = spoolResults(ctx, scanner, sp, partial.add)
+		}
+	default:
+		subs, err = gatherResults(ctx, scanner, partial.add, checkpoints)
+	}
+	if err != nil {
+		partial.close(false)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	hook.flush()
+	truncated := ctx.Err() != nil
+	interrupted := errors.Is(context.Cause(ctx), errInterrupted)
+	target := *domain
+	if target == "" {
+		target = *recheckPath
+	}
+	if *deterministic {
+		makeDeterministic(subs)
+	}
+	meta := newRunMeta(target, start, *metadata).finish()
+	meta.Checkpoints = checkpoints.count()
+	if *deterministic {
+		meta.redact()
+	}
+	if sp != nil {
+		meta.summary = newResultSummary(liveCodes)
+		for r := range sp.sorted(nil) {
+			meta.summary.add(r, liveCodes)
+		}
+		if err := sp.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "reading back the -low-memory results failed: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		meta.summary = summarize(subs, liveCodes)
+	}
+	meta.summary.Edges = scanner.EdgeSaturated()
+	if previous != nil {
+		sublive.CarryFirstSeen(previous, subs)
+	}
+	historyBefore := false
+	if history != nil {
+		historyBefore, err = history.Record(subs, start)
+		if err != nil {
+			logger.Warn("results not added to the history", "file", *dbPath, "error", err)
+		}
+	}
+	// the records of every root domain; DMARC only makes sense there
+	var rootRecords map[string]map[string][]string
+	var recordDomains []string
+	recordsErr := map[string]error{}
+	rootTypes := recordTypes
+	if slices.Contains(rootTypes, sublive.RecordTXT) && !slices.Contains(rootTypes, sublive.RecordDMARC) {
+		rootTypes = append(slices.Clone(rootTypes), sublive.RecordDMARC)
+	}
+	if len(rootTypes) > 0 {
+		recordDomains = rootDomains(scanner.Domains, scanner.Seeds)
+		rootRecords = make(map[string]map[string][]string, len(recordDomains))
+		for _, d := range recordDomains {
+			rctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			rootRecords[d], recordsErr[d] = scanner.LookupRecords(rctx, d, rootTypes)
+			cancel()
+		}
+	}
+	if *asn {
+		annotateASNs(subs, asnTable, resolverAddrs)
+	}
+	found := make(map[string]struct{}, len(subs))
+	for i, r := range subs {
+		found[r.Subdomain] = struct{}{}
+		if old, ok := rechecked[r.Subdomain]; ok {
+			status := old.Status
+			subs[i].PreviousStatus = &status
+		}
+	}
+
+	outResults := prepare(subs)
+	// -low-memory results get the same treatment as they are read back
+	spooled, spoolWritten := func(batch []sublive.Result) []sublive.Result {
+		if *deterministic {
+			makeDeterministic(batch)
+		}
+		for i, r := range batch {
+			if old, ok := rechecked[r.Subdomain]; ok {
+				status := old.Status
+				batch[i].PreviousStatus = &status
+			}
+		}
+		return prepare(batch)
+	}, 0
+	// write output
+	out := newStreams(os.Stdout, *outfile, *format, *quiet, *noSummary)
+	sumOut := out.summary
+	// grouping only changes what is written; -o-dir, -diff and the
+	// summary see every name
+	written := outResults
+	if *group {
+		written = sublive.GroupResults(outResults)
+	}
+	write := func(w io.Writer) error {
+		if *findingsOnly {
+			return writeFindings(w, meta, written, *format, *punycodeOnly)
+		}
+		if sp != nil {
+			results := sp.sorted(func(batch []sublive.Result) []sublive.Result {
+				batch = spooled(batch)
+				spoolWritten += len(batch)
+				return batch
+			})
+			return cmp.Or(writeResultsSeq(w, meta, *domain, rootRecords, results, *format, *punycodeOnly), sp.Err())
+		}
+		return writeResults(w, meta, *domain, rootRecords, written, *format, *punycodeOnly)
+	}
+	if *outfile != "" {
+		err = writeFileAtomic(*outfile, write)
+	} else {
+		err = write(out.results)
+	}
+	// the .partial stream is only needed when the -o file couldn't be written
+	partial.close(err != nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+	if *outfile != "" {
+		logger.Info("wrote results", "results", len(written)+spoolWritten, "file", *outfile)
+	}
+	if *urlFile != "" {
+		if err := writeURLs(*urlFile, newLiveSet(liveCodes, *includeAuth, false).filter(written)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write -ou output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *hostsFile != "" {
+		if err := writeHosts(*hostsFile, meta, newLiveSet(liveCodes, *includeAuth, false).filter(written)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write -o-hosts output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *outDir != "" {
+		if err := writeDomainFiles(*outDir, meta, outResults, *format, *punycodeOnly); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write -o-dir output: %v\n", err)
+			os.Exit(1)
+		}
+		logger.Info("wrote per-domain results", "dir", *outDir)
+	}
+	if sp != nil {
+		es.export(sp.sorted(spooled), meta)
+	} else {
+		es.export(slices.Values(outResults), meta)
+	}
+
+	if mf != nil {
+		if err := mf.finish(meta, scanner, truncated || scanner.Skipped() > 0).write(*manifestPath); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write -manifest: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	elapsed := time.Since(start)
+	fmt.Fprintf(sumOut, "\nSummary for %s (t=%d) in %s:\n", target, *t, elapsedText(elapsed, *deterministic))
+	if interrupted {
+		fmt.Fprintf(sumOut, "  INTERRUPTED: %d candidates not probed\n", scanner.Skipped())
+	} else if truncated {
+		fmt.Fprintf(sumOut, "  TRUNCATED: -max-time %s reached, %d candidates not probed\n", *maxTime, scanner.Skipped())
+	} else if scanner.BudgetExhausted() {
+		fmt.Fprintf(sumOut, "  BUDGET EXHAUSTED: %d candidates not probed\n", scanner.Skipped())
+	} else if *maxLive > 0 && scanner.Skipped() > 0 {
+		fmt.Fprintf(sumOut, "  stopped early: %d live hosts found (-max-live), %d candidates not probed\n", *maxLive, scanner.Skipped())
+	}
+	printBudget(sumOut, scanner)
+	printRateDeferred(sumOut, scanner)
+	printDNSRetries(sumOut, scanner)
+	printEdgeSaturated(sumOut, scanner)
+	if *verbose {
+		printSourceStats(sumOut, scanner)
+	}
+	if hook != nil {
+		hook.printSummary(sumOut, scanner.HookDropped())
+	}
+	checkpoints.printSummary(sumOut)
+	es.printSummary(sumOut)
+	if len(resumed) > 0 {
+		fmt.Fprintf(sumOut, "  resumed: %d results from %s\n", len(resumed), *resumePath)
+	}
+	if sp != nil {
+		// a -low-memory scan kept nothing for the sections below
+		printSummaryCounts(sumOut, meta.summary, liveCodes)
+		if *secondPass {
+			fmt.Fprintf(sumOut, "  recovered by second pass: %d\n", scanner.Recovered())
+		}
+		sp.close()
+		exitStopped(truncated || scanner.BudgetExhausted(), interrupted, nil)
+		return
+	}
+	printRoot(sumOut, subs)
+	printCounts(sumOut, subs, liveCodes)
+	printStatusCodes(sumOut, subs)
+	printReasons(sumOut, meta.summary)
+	printFindingCounts(sumOut, subs)
+	printSources(sumOut, meta.summary)
+	if *resolverStats {
+		printResolverStats(sumOut, resolverTracker)
+	}
+	if *profileNetFlag {
+		printNetProfile(sumOut, profileNet(subs))
+	}
+	if *group {
+		fmt.Fprintf(sumOut, "  grouped: %d results written as %d endpoints\n", len(outResults), len(written))
+	}
+	if *screenshotDir != "" {
+		takeScreenshots(sumOut, meta, *screenshotDir, written, *screenshotWorkers, *screenshotTimeout)
+	}
+	if *secondPass {
+		fmt.Fprintf(sumOut, "  recovered by second pass: %d\n", scanner.Recovered())
+	}
+	if scanner.Validate {
+		printValidation(sumOut, subs)
+	}
+	if *http2 || *http3 || *http3Only {
+		printProtocols(sumOut, subs)
+	}
+	if len(scanner.Match) > 0 || len(scanner.Filter) > 0 {
+		printMatches(sumOut, subs, len(scanner.Match) > 0)
+	}
+	if axfrTried {
+		if transfer != nil {
+			fmt.Fprintf(sumOut, "  AXFR: succeeded on %s (%s), %d names\n", transfer.Server, transfer.Addr, len(transfer.Names))
+		} else {
+			fmt.Fprintf(sumOut, "  AXFR: refused or failed on every nameserver\n")
+		}
+	}
+	if deep {
+		printDepths(sumOut, subs, *maxDepth)
+	}
+	deps := []string{}
+	for _, r := range subs {
+		for _, c := range r.CNAMEs {
+			if r.Domain != "" && !sublive.InDomain(c, r.Domain) {
+				deps = append(deps, fmt.Sprintf("%s -> %s", r.Subdomain, c))
+			}
+		}
+	}
+	for _, d := range recordDomains {
+		printRecords(sumOut, d, rootTypes, rootRecords[d], recordsErr[d])
+	}
+	printCDNCounts(sumOut, subs)
+	if *asn {
+		printTopASNs(sumOut, subs, 10)
+	}
+	if deep && *altNumbers {
+		numeric := 0
+		for _, r := range subs {
+			if r.Source == sublive.SourceNumeric && sublive.IsLive(r.Status) {
+				numeric++
+			}
+		}
+		fmt.Fprintf(sumOut, "  found via numeric alteration: %d\n", numeric)
+	}
+	if deep && *mine {
+		tried, found := 0, 0
+		for _, r := range subs {
+			if r.Source == sublive.SourceMined {
+				tried++
+				if sublive.IsLive(r.Status) {
+					found++
+				}
+			}
+		}
+		fmt.Fprintf(sumOut, "  found via mined tokens: %d of %d tried\n", found, tried)
+	}
+	if !deep && *scrape {
+		refs := []string{}
+		for _, r := range subs {
+			for _, h := range r.Referenced {
+				if _, ok := found[h]; !ok {
+					refs = append(refs, fmt.Sprintf("%s (from %s)", h, r.Subdomain))
+				}
+			}
+		}
+		if len(refs) > 0 {
+			sort.Strings(refs)
+			fmt.Fprintf(sumOut, "\nReferenced hosts (not scanned, from -scrape):\n")
+			for _, h := range refs {
+				fmt.Fprintf(sumOut, "  %s\n", h)
+			}
+		}
+	}
+	if len(deps) > 0 {
+		sort.Strings(deps)
+		fmt.Fprintf(sumOut, "\nExternal dependencies (CNAME targets outside %s):\n", target)
+		for _, d := range deps {
+			fmt.Fprintf(sumOut, "  %s\n", d)
+		}
+	}
+	printDangling(sumOut, subs)
+	if *diffPath != "" {
+		fmt.Fprintf(sumOut, "\nChanges since %s:\n", *diffPath)
+		writeChanges(sumOut, *diffPath, "", filterChanges(sublive.Diff(previous, subs), previous, subs, prepare), "text")
+	}
+	if history != nil {
+		printNewHosts(sumOut, *dbPath, subs, historyBefore)
+	}
+	exitStopped(truncated || scanner.BudgetExhausted(), interrupted, history)
+}
+
+// exitStopped exits a scan that stopped early, with status 130 when it
+// was interrupted and 3 otherwise, closing history first since deferred
+// calls don't run on os.Exit. It returns for a scan that ran to the end.
+func exitStopped(stopped, interrupted bool, history *sublive.History) {
+	if !stopped {
+		return
+	}
+	if history != nil {
+		history.Close()
+	}
+	if interrupted {
+		os.Exit(130)
+	}
+	os.Exit(3)
+}
+
+// errInterrupted is the cancel cause of a scan stopped by Ctrl-C or by
+// quitting the TUI.
+var errInterrupted = errors.New("interrupted")
+
+// stopOnInterrupt cancels the scan with errInterrupted on the first
+// SIGINT or SIGTERM, so the results so far still go through the normal
+// output path; the second one calls quit and exits at once.
+func stopOnInterrupt(cancel context.CancelCauseFunc, quit func()) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		logger.Warn("interrupted: writing the results so far (interrupt again to quit now)")
+		cancel(errInterrupted)
+		<-sigs
+		quit()
+		os.Exit(130)
+	}()
+}
+
+// checkRoot makes sure domain exists before its wordlist is scanned. A
+// domain without addresses and nameservers is most likely a typo, and DNS
+// that can't resolve even sublive.CanaryName would only make every name
+// look unreachable; both stop the scan unless force. A name that exists
+// without records of its own, such as an empty parent of other names, is
+// only noted.
+func checkRoot(domain string, resolvers []string, force bool) error {
+	c := sublive.CheckRoot(context.Background(), domain, resolvers, 5*time.Second)
+	var problem string
+	switch {
+	case !c.Missing():
+		if len(c.IPs) == 0 {
+			logger.Warn("the root domain has nameservers but no address; scanning its subdomains", "domain", domain, "ns", strings.Join(c.NS, ","))
+		}
+		return nil
+	case c.Network != nil:
+		problem = fmt.Sprintf("DNS resolution is not working: %s has no address or nameservers and %s doesn't resolve either (%v); check the network and the resolvers (-r, -rL, /etc/resolv.conf)", domain, sublive.CanaryName, c.Network)
+	case c.NXDOMAIN:
+		problem = fmt.Sprintf("%s does not exist (NXDOMAIN) and has no nameservers; is the domain misspelt?", domain)
+	case c.Err != nil:
+		problem = fmt.Sprintf("%s could not be resolved: %v", domain, c.Err)
+	default:
+		logger.Warn("the root domain exists but has no address or nameservers of its own; scanning its subdomains", "domain", domain)
+		return nil
+	}
+	if !force {
+		return fmt.Errorf("%s\nuse -force to scan it anyway", problem)
+	}
+	logger.Warn("-force: scanning anyway", "problem", problem)
+	return nil
+}
+
+// addKnownSeeds puts the names of the -known-file files under domain
+// ahead of candidates, dropping them from candidates. A file that can't be
+// read is an error.
+func addKnownSeeds(candidates []sublive.Candidate, domain string, files []string) ([]sublive.Candidate, error) {
+	var known []sublive.Candidate
+	inList := map[string]struct{}{}
+	rejected, outside := 0, 0
+	for _, path := range files {
+		names, bad, err := sublive.LoadKnownNames(path)
+		if err != nil {
+			return nil, fmt.Errorf("-known-file: %v", err)
+		}
+		rejected += bad
+		for _, n := range names {
+			if !sublive.InDomain(n, domain) {
+				outside++
+				continue
+			}
+			if _, ok := inList[n]; ok {
+				continue
+			}
+			inList[n] = struct{}{}
+			known = append(known, sublive.Candidate{Name: n, Domain: domain, Source: sublive.SourceKnown})
+		}
+	}
+	if outside > 0 {
+		logger.Warn("skipped known names outside the domain", "count", outside, "domain", domain)
+	}
+	if rejected > 0 {
+		logger.Warn("skipped invalid known names", "count", rejected)
+	}
+	for _, c := range candidates {
+		if _, ok := inList[c.Name]; !ok {
+			known = append(known, c)
+		}
+	}
+	logger.Info("added known candidates", "known", len(inList), "files", len(files))
+	return known, nil
+}
+
+// addCTSeeds appends the certificate transparency names of domain that are not
+// already candidates. A failed lookup is reported and leaves candidates as is.
+func addCTSeeds(candidates []sublive.Candidate, domain string, timeout time.Duration) []sublive.Candidate {
+	names, err := sublive.FetchCT(context.Background(), domain, timeout)
+	if err != nil {
+		logger.Warn("certificate transparency lookup failed, continuing without it", "domain", domain, "error", err)
+	}
+	inList := make(map[string]struct{}, len(candidates))
+	for _, c := range candidates {
+		inList[c.Name] = struct{}{}
+	}
+	added := 0
+	for _, n := range names {
+		if _, ok := inList[n]; ok {
+			continue
+		}
+		candidates = append(candidates, sublive.Candidate{Name: n, Domain: domain, Source: sublive.SourceCT})
+		added++
+	}
+	logger.Info("added certificate transparency candidates", "wordlist", len(candidates)-added, "ct", added, "ct_names", len(names))
+	return candidates
+}
+
+// addAXFRSeeds appends the names of a zone transfer of domain through the
+// DNS settings of s that are not already candidates and returns the
+// successful transfer, or nil. Failed attempts are normal, as most servers
+// refuse, and only logged at info level.
+func addAXFRSeeds(candidates []sublive.Candidate, domain string, s *sublive.Scanner) ([]sublive.Candidate, *sublive.ZoneTransfer) {
+	attempts, err := s.TransferZone(context.Background(), domain, 10*time.Second)
+	if err != nil {
+		logger.Info("AXFR: nameserver lookup failed", "domain", domain, "error", err)
+	}
+	var transfer *sublive.ZoneTransfer
+	for i, a := range attempts {
+		if a.Err != nil {
+			logger.Info("AXFR failed", "server", a.Server, "ip", a.Addr, "error", a.Err)
+			continue
+		}
+		transfer = &attempts[i]
+	}
+	if transfer == nil {
+		return candidates, nil
+	}
+	inList := make(map[string]struct{}, len(candidates))
+	for _, c := range candidates {
+		inList[c.Name] = struct{}{}
+	}
+	added := 0
+	for _, n := range transfer.Names {
+		if _, ok := inList[n]; ok {
+			continue
+		}
+		candidates = append(candidates, sublive.Candidate{Name: n, Domain: domain, Source: sublive.SourceAXFR})
+		added++
+	}
+	logger.Info("AXFR succeeded", "server", transfer.Server, "ip", transfer.Addr, "names", len(transfer.Names), "new", added)
+	return candidates, transfer
+}
+
+// gatherResults runs scanner to completion and returns one result per
+// subdomain, sorted by name. Each result is logged at info level and
+// passed to each, when not nil, as it comes in; cp, when not nil, writes
+// the checkpoints of the results so far.
+func gatherResults(ctx context.Context, scanner *sublive.Scanner, each func(sublive.Result), cp *checkpointer) ([]sublive.Result, error) {
+	start := time.Now()
+	results, err := scanner.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]sublive.Result)
+	for r := range results {
+		logChecked(r)
+		if each != nil {
+			each(r)
+		}
+		if _, ok := found[r.Subdomain]; !ok {
+			found[r.Subdomain] = r
+			cp.add(found)
+		}
+	}
+	cp.wait()
+	subs := make([]sublive.Result, 0, len(found))
+	for _, r := range found {
+		subs = append(subs, r)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Subdomain < subs[j].Subdomain })
+	logger.Info("scan finished", "results", len(subs), "skipped", scanner.Skipped(), "duration", time.Since(start).Round(time.Millisecond))
+	return subs, nil
+}
+
+// spoolResults is gatherResults for -low-memory: the results go to sp
+// instead of memory, to be read back sorted, and repeats of a name are
+// only dropped then.
+func spoolResults(ctx context.Context, scanner *sublive.Scanner, sp *spool, each func(sublive.Result)) error {
+	start := time.Now()
+	results, err := scanner.Run(ctx)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for r := range results {
+		logChecked(r)
+		if each != nil {
+			each(r)
+		}
+		if err == nil {
+			err = sp.add(r)
+		}
+		n++
+	}
+	logger.Info("scan finished", "results", n, "skipped", scanner.Skipped(), "duration", time.Since(start).Round(time.Millisecond))
+	return err
+}
+
+// logChecked logs one result at info level.
+func logChecked(r sublive.Result) {
+	attrs := []any{"subdomain", r.Subdomain, "status", r.Status, "ip", r.IP}
+	if r.Geo != nil {
+		attrs = append(attrs, "geo", geoText(r.Geo))
+	}
+	if r.Reason != "" {
+		attrs = append(attrs, "reason", r.Reason, "error", r.Error)
+	}
+	logger.Info("checked", attrs...)
+}
+
+// filterNoCDN returns the results of subs not served by a CDN.
+func filterNoCDN(subs []sublive.Result) []sublive.Result {
+	out := []sublive.Result{}
+	for _, r := range subs {
+		if r.CDN == "" {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// filterInterestingRedirects returns the results of subs whose redirects
+// lead to another name under the domain or off it, the ones worth
+// following up, leaving out upgrades and redirects to the apex.
+func filterInterestingRedirects(subs []sublive.Result) []sublive.Result {
+	out := []sublive.Result{}
+	for _, r := range subs {
+		if r.RedirectClass == sublive.RedirectInternal || r.RedirectClass == sublive.RedirectExternal {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// parseFamily checks a -family value, "" for both families.
+func parseFamily(v string) (string, error) {
+	switch v {
+	case "":
+		return "", nil
+	case "4":
+		return sublive.FamilyIPv4, nil
+	case "6":
+		return sublive.FamilyIPv6, nil
+	}
+	return "", fmt.Errorf("-family: %q is not 4 or 6", v)
+}
+
+// filterFamily returns the results of subs with addresses of family,
+// dual-stack ones included, or subs itself when family is "".
+func filterFamily(subs []sublive.Result, family string) []sublive.Result {
+	if family == "" {
+		return subs
+	}
+	out := []sublive.Result{}
+	for _, r := range subs {
+		if r.Family == family || r.Family == sublive.FamilyDual {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// checkIPv6 turns on scanner.SkipIPv6, with a warning, when the machine
+// has no IPv6 route, so IPv6-only names aren't all reported unreachable.
+func checkIPv6(scanner *sublive.Scanner) {
+	if !sublive.HasIPv6() {
+		logger.Warn("no IPv6 connectivity: names with only IPv6 addresses are not probed and dual-stack ones only over IPv4")
+		scanner.SkipIPv6 = true
+	}
+}
+
+// bodySettings compiles the -match and -filter options into scanner's body
+// patterns; the error names the offending flag.
+func bodySettings(scanner *sublive.Scanner, matchStrings, matchRegex, filterStrings, filterRegex []string) error {
+	for _, s := range matchStrings {
+		scanner.Match = append(scanner.Match, sublive.LiteralPattern(s))
+	}
+	for _, s := range filterStrings {
+		scanner.Filter = append(scanner.Filter, sublive.LiteralPattern(s))
+	}
+	for _, expr := range matchRegex {
+		p, err := sublive.RegexpPattern(expr)
+		if err != nil {
+			return fmt.Errorf("-match-regex: %v", err)
+		}
+		scanner.Match = append(scanner.Match, p)
+	}
+	for _, expr := range filterRegex {
+		p, err := sublive.RegexpPattern(expr)
+		if err != nil {
+			return fmt.Errorf("-filter-regex: %v", err)
+		}
+		scanner.Filter = append(scanner.Filter, p)
+	}
+	return nil
+}
+
+// filterMatched returns the results of subs that pass scanner's -match
+// and -filter options.
+func filterMatched(subs []sublive.Result, scanner *sublive.Scanner) []sublive.Result {
+	if len(scanner.Match) == 0 && len(scanner.Filter) == 0 {
+		return subs
+	}
+	out := []sublive.Result{}
+	for _, r := range subs {
+		if sublive.KeepMatched(r, len(scanner.Match) > 0) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// rootDomains returns the domains of a scan, those it was given and then
+// those of its seeds (such as the results of -recheck), each once.
+func rootDomains(domains []string, seeds []sublive.Candidate) []string {
+	var out []string
+	seen := map[string]bool{"": true}
+	for _, d := range domains {
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	for _, c := range seeds {
+		if !seen[c.Domain] {
+			seen[c.Domain] = true
+			out = append(out, c.Domain)
+		}
+	}
+	return out
+}
+
+// liveSet is what -x keeps: the results in classes or, with -live-codes,
+// whose status is one of codes.
+type liveSet struct {
+	classes []sublive.Class
+	codes   sublive.StatusRanges
+}
+
+// newLiveSet returns the liveSet of -x: 2xx, or codes when -live-codes is
+// set, plus 401/403 with includeAuth and names that resolved without
+// answering HTTP (bad certificates included) with resolved, out of scope
+// ones aside since they were never probed. Soft 404s are left out either
+// way.
+func newLiveSet(codes sublive.StatusRanges, includeAuth, resolved bool) liveSet {
+	l := liveSet{codes: codes}
+	if codes == nil {
+		l.classes = append(l.classes, sublive.ClassLive)
+		if includeAuth {
+			l.classes = append(l.classes, sublive.ClassAuth)
+		}
+	} else if includeAuth {
+		l.codes = codes.With(401, 403)
+	}
+	if resolved {
+		l.classes = append(l.classes, sublive.ClassNoHTTP, sublive.ClassBadCert)
+	}
+	return l
+}
+
+func (l liveSet) keep(r sublive.Result) bool {
+	class := sublive.ClassifyResult(r)
+	if slices.Contains(l.classes, class) {
+		return !r.OutOfScope
+	}
+	return l.codes != nil && r.Status != 0 && !demotedClass(class) && l.codes.Contains(r.Status)
+}
+
+// filter returns the results of subs l keeps.
+func (l liveSet) filter(subs []sublive.Result) []sublive.Result {
+	out := []sublive.Result{}
+	for _, r := range subs {
+		if l.keep(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// filterClasses returns the results of subs in one of classes.
+func filterClasses(subs []sublive.Result, classes []sublive.Class) []sublive.Result {
+	out := []sublive.Result{}
+	for _, r := range subs {
+		if slices.Contains(classes, sublive.ClassifyResult(r)) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// loadRecheck reads a previous result file and returns the hosts selected by
+// filter (live, dead or all) as candidates, along with the previous results
+// keyed by subdomain. Hosts get domain as their root when they belong to it,
+// otherwise the domain recorded in the file.
+func loadRecheck(path, filter, domain string) ([]sublive.Candidate, map[string]sublive.Result, error) {
+	if filter != "live" && filter != "dead" && filter != "all" {
+		return nil, nil, fmt.Errorf("unknown -recheck-filter %q (want live, dead or all)", filter)
+	}
+	prev, err := sublive.LoadResults(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	seeds := []sublive.Candidate{}
+	byName := make(map[string]sublive.Result, len(prev))
+	for _, r := range prev {
+		live := sublive.IsLive(r.Status)
+		if filter == "live" && !live || filter == "dead" && live {
+			continue
+		}
+		name, err := sublive.ToASCII(r.Subdomain)
+		if err != nil {
+			continue
+		}
+		root := r.Domain
+		if domain != "" && sublive.InDomain(name, domain) {
+			root = domain
+		} else if root == "" {
+			// text result files don't record the domain
+			root, _ = sublive.RegistrableDomain(name)
+		}
+		r.Subdomain = name
+		byName[name] = r
+		seeds = append(seeds, sublive.Candidate{Name: name, Domain: root, Source: sublive.SourceInput})
+	}
+	return seeds, byName, nil
+}
+
+// annotateASNs looks up the autonomous system of every unique IP in subs
+// once and copies it onto the results.
+func annotateASNs(subs []sublive.Result, table *sublive.ASNTable, resolvers []string) {
+	ips := make([]string, 0, len(subs))
+	for _, r := range subs {
+		ips = append(ips, r.IP)
+	}
+	asns := sublive.LookupASNs(context.Background(), ips, table, resolvers, 0)
+	for i, r := range subs {
+		if info, ok := asns[r.IP]; ok {
+			subs[i].ASN, subs[i].ASName = info.Number, info.Name
+		}
+	}
+}
+
+// loadScope parses the -scope CIDRs and those in path. It returns nil when
+// neither is given.
+func loadScope(cidrs []string, path string) (*sublive.Scope, error) {
+	if path != "" {
+		lines, err := sublive.LoadWordlist(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range lines {
+			if !strings.HasPrefix(l, "#") {
+				cidrs = append(cidrs, l)
+			}
+		}
+	}
+	if len(cidrs) == 0 {
+		return nil, nil
+	}
+	return sublive.ParseScope(cidrs)
+}
+
+// byteUnits are the size units of -max-bytes, in powers of 1024.
+var byteUnits = []string{"B", "KB", "MB", "GB", "TB"}
+
+// parseByteSize parses a -max-bytes value: a number of bytes with an
+// optional unit such as 500MB or 1.5GB (K, M, G and T, with or without B
+// or iB, are powers of 1024).
+func parseByteSize(v string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	num := strings.TrimRightFunc(s, unicode.IsLetter)
+	unit := strings.TrimSuffix(strings.TrimSuffix(s[len(num):], "B"), "I")
+	exp := strings.Index(" KMGT", cmp.Or(unit, " "))
+	f, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if exp < 0 || len(unit) > 1 || err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 500MB)", v)
+	}
+	return int64(f * math.Pow(1024, float64(exp))), nil
+}
+
+// formatBytes formats n with the largest unit of byteUnits that keeps it
+// at 1 or more, as in 12.3MB.
+func formatBytes(n int64) string {
+	f, exp := float64(n), 0
+	for f >= 1024 && exp < len(byteUnits)-1 {
+		f /= 1024
+		exp++
+	}
+	if exp == 0 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.1f%s", f, byteUnits[exp])
+}
+
+// printBudget reports the consumption of the -max-requests and -max-bytes
+// budgets of the last run of scanner.
+func printBudget(w io.Writer, scanner *sublive.Scanner) {
+	requests, bytes := scanner.Usage()
+	parts := []string{}
+	if scanner.MaxRequests > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d requests", requests, scanner.MaxRequests))
+	}
+	if scanner.MaxBytes > 0 {
+		parts = append(parts, fmt.Sprintf("%s/%s received", formatBytes(bytes), formatBytes(scanner.MaxBytes)))
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(w, "  budget: %s\n", strings.Join(parts, ", "))
+	}
+}
+
+// printRateDeferred reports the probes held back because their address
+// asked with Retry-After to wait.
+func printRateDeferred(w io.Writer, scanner *sublive.Scanner) {
+	if n := scanner.RateDeferred(); n > 0 {
+		fmt.Fprintf(w, "  deferred by Retry-After: %d probes\n", n)
+	}
+}
+
+// printEdgeSaturated names the addresses -edge-threshold caught, the five
+// that demoted the most results first, and counts the results demoted.
+func printEdgeSaturated(w io.Writer, scanner *sublive.Scanner) {
+	edges := scanner.EdgeSaturated()
+	if len(edges) == 0 {
+		return
+	}
+	demoted := 0
+	var parts []string
+	for i, e := range edges {
+		demoted += e.Demoted
+		if i < 5 {
+			parts = append(parts, fmt.Sprintf("%s (%d for %d names)", e.IP, e.Status, e.Names))
+		}
+	}
+	if len(edges) > 5 {
+		parts = append(parts, fmt.Sprintf("%d more", len(edges)-5))
+	}
+	fmt.Fprintf(w, "  saturated edges: %d results demoted to edge-default, from %s\n", demoted, strings.Join(parts, ", "))
+}
+
+// printDNSRetries reports the lookups tried again after REFUSED or
+// SERVFAIL and the names they rescued, a measure of the resolvers.
+func printDNSRetries(w io.Writer, scanner *sublive.Scanner) {
+	if n := scanner.DNSRetried(); n > 0 {
+		fmt.Fprintf(w, "  DNS retries after REFUSED/SERVFAIL: %d, rescuing %d names\n", n, scanner.DNSRescued())
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestCheckDomain(t *testing.T) {
+	tests := []struct {
+		domain, want string
+	}{
+		{"example.com", "example.com"},
+		{"Example.CO.UK", "example.co.uk"},
+		{"foo.com.au", "foo.com.au"},
+		{"bücher.de", "xn--bcher-kva.de"},
+		{"co.uk", ""},
+		{"com.au", ""},
+		{"github.io", ""},
+		{"com", ""},
+	}
+	for _, tt := range tests {
+		got, err := checkDomain(tt.domain)
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("checkDomain(%q) = %q, %v, want %q", tt.domain, got, err, tt.want)
+		}
+	}
+}
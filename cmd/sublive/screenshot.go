@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/rishavand1/sublive"
+)
+
+// Screenshot defaults: defaultScreenshotWorkers pages load at a time, each
+// bounded by defaultScreenshotTimeout.
+const (
+	defaultScreenshotWorkers = 4
+	defaultScreenshotTimeout = 20 * time.Second
+)
+
+// errNoBrowser is returned by screenshots when no Chrome or Chromium
+// executable is found.
+var errNoBrowser = errors.New("no Chrome or Chromium found for screenshots (set CHROME_PATH or install one)")
+
+// browserNames are the executables screenshots looks for in PATH, after
+// $CHROME_PATH.
+var browserNames = []string{
+	"headless-shell", "chromium", "chromium-browser", "google-chrome",
+	"google-chrome-stable", "chrome",
+	"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+	"/Applications/Chromium.app/Contents/MacOS/Chromium",
+}
+
+// shot is the screenshot of one result.
+type shot struct {
+	Result sublive.Result
+	// File is the name of the PNG in the screenshot directory, empty when
+	// Err is set.
+	File string
+	Err  error
+}
+
+// findBrowser returns the path of a Chrome or Chromium executable, or "".
+func findBrowser() string {
+	if p := os.Getenv("CHROME_PATH"); p != "" {
+		return p
+	}
+	for _, name := range browserNames {
+		if p, err := exec.LookPath(name); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// shotFile returns the file name screenshots saves the page of r as,
+// "<subdomain>_<port>.png", or "" when r has no URL.
+func shotFile(r sublive.Result) string {
+	u, err := url.Parse(r.URL)
+	if err != nil || r.URL == "" {
+		return ""
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return r.Subdomain + "_" + port + ".png"
+}
+
+// screenshots loads the URL of every result that has one in a headless
+// Chrome, at most workers pages at a time (defaultScreenshotWorkers when
+// 0) and each bounded by timeout (defaultScreenshotTimeout when 0), and
+// saves the visible page in dir under shotFile. Certificate errors are
+// ignored. The browser resolves names itself, so -r and -scope don't
+// apply. The
+// shots are in the order of results; err is only set when the browser
+// can't be used at all, errNoBrowser when none is installed.
+func screenshots(ctx context.Context, results []sublive.Result, dir string, workers int, timeout time.Duration) ([]shot, error) {
+	path := findBrowser()
+	if path == "" {
+		return nil, errNoBrowser
+	}
+	if workers <= 0 {
+		workers = defaultScreenshotWorkers
+	}
+	if timeout <= 0 {
+		timeout = defaultScreenshotTimeout
+	}
+	shots := []shot{}
+	for _, r := range results {
+		if file := shotFile(r); file != "" {
+			shots = append(shots, shot{Result: r, File: file})
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil || len(shots) == 0 {
+		return shots, err
+	}
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.ExecPath(path),
+		chromedp.WindowSize(1280, 800),
+		chromedp.Flag("ignore-certificate-errors", true),
+	)
+	// Chrome refuses to start its sandbox as root
+	if os.Geteuid() == 0 {
+		opts = append(opts, chromedp.NoSandbox)
+	}
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, opts...)
+	defer cancelAlloc()
+	browser, cancelBrowser := chromedp.NewContext(allocCtx)
+	defer cancelBrowser()
+	if err := chromedp.Run(browser); err != nil {
+		return nil, fmt.Errorf("starting %s: %w", path, err)
+	}
+
+	jobs := make(chan *shot)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range jobs {
+				if s.Err = capture(browser, s.Result.URL, filepath.Join(dir, s.File), timeout); s.Err != nil {
+					s.File = ""
+				}
+			}
+		}()
+	}
+	for i := range shots {
+		if ctx.Err() != nil {
+			shots[i].File, shots[i].Err = "", ctx.Err()
+			continue
+		}
+		jobs <- &shots[i]
+	}
+	close(jobs)
+	wg.Wait()
+	return shots, nil
+}
+
+// capture loads rawURL in a new tab of browser and writes the screenshot
+// to file.
+func capture(browser context.Context, rawURL, file string, timeout time.Duration) error {
+	tab, cancel := chromedp.NewContext(browser)
+	defer cancel()
+	tctx, cancelTimeout := context.WithTimeout(tab, timeout)
+	defer cancelTimeout()
+	var png []byte
+	if err := chromedp.Run(tctx, chromedp.Navigate(rawURL), chromedp.CaptureScreenshot(&png)); err != nil {
+		return err
+	}
+	return os.WriteFile(file, png, 0o644)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"slices"
+
+	"github.com/rishavand1/sublive"
+)
+
+// sourceAddrs returns the addresses of -source-ips ips and -interface
+// iface together, without repeats, once each was bound to: a run from an
+// address that isn't there should fail before it starts. The link-local
+// IPv6 addresses of iface are left out, they only reach its own link.
+func sourceAddrs(ips []string, iface string) ([]string, error) {
+	var out []string
+	for _, a := range ips {
+		if net.ParseIP(a) == nil {
+			return nil, fmt.Errorf("-source-ips: %q is not an IP address", a)
+		}
+		out = append(out, a)
+	}
+	if iface != "" {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, fmt.Errorf("-interface: %v", err)
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("-interface %s: %v", iface, err)
+		}
+		n := len(out)
+		for _, a := range addrs {
+			if ipn, ok := a.(*net.IPNet); ok && !ipn.IP.IsLinkLocalUnicast() {
+				out = append(out, ipn.IP.String())
+			}
+		}
+		if len(out) == n {
+			return nil, fmt.Errorf("-interface %s has no address to send from", iface)
+		}
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if err := sublive.CheckSourceAddrs(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// printSourceStats reports, with -v, the traffic from every source
+// address, to check it is spread evenly.
+func printSourceStats(w io.Writer, scanner *sublive.Scanner) {
+	stats := scanner.SourceStats()
+	if len(stats) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  source addresses: %d\n", len(stats))
+	for _, st := range stats {
+		fmt.Fprintf(w, "    %-39s %7d names %8d requests %8d DNS queries\n", st.Addr, st.Names, st.Requests, st.DNSQueries)
+	}
+}
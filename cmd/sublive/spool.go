@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rishavand1/sublive"
+)
+
+// spoolRun is how many results a -low-memory spool holds and sorts in
+// memory before writing them out as one run, and spoolBatch how many of
+// the merged results it hands on at a time.
+var spoolRun = 20000
+
+const spoolBatch = 1000
+
+// lowMemoryConflicts are the scan flags that need every result in memory
+// once the scan is done, which -low-memory doesn't keep.
+var lowMemoryConflicts = []string{"tui", "monitor", "group", "findings", "o-dir", "ou", "o-hosts", "diff", "db", "screenshot", "asn", "profile-net", "checkpoint-every"}
+
+// checkLowMemory rejects -low-memory together with one of
+// lowMemoryConflicts, given on the command line or in the config file.
+func checkLowMemory(fs *flag.FlagSet) error {
+	for _, name := range lowMemoryConflicts {
+		if f := fs.Lookup(name); f.Value.String() != f.DefValue {
+			return fmt.Errorf("-low-memory can't be combined with -%s, which needs every result in memory", name)
+		}
+	}
+	return nil
+}
+
+// spool keeps the results of a -low-memory scan in a temporary file
+// instead of in memory: they are sorted by name in runs of spoolRun, one
+// JSON object per line, and merged back in name order by sorted, an
+// external merge sort. Memory stays at one run while scanning and a
+// buffered reader per run while merging.
+type spool struct {
+	f   *os.File
+	w   *bufio.Writer
+	off int64
+	buf []sublive.Result
+	// runs are the [start, end) offsets of the sorted runs in f
+	runs [][2]int64
+	err  error
+}
+
+// newSpool creates the temporary file of a spool. On Unix it is removed
+// right away and lives on while open, so no exit leaves it behind;
+// elsewhere close removes it.
+func newSpool() (*spool, error) {
+	f, err := os.CreateTemp("", "sublive-spool-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	return &spool{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// add spools r.
+func (s *spool) add(r sublive.Result) error {
+	s.buf = append(s.buf, r)
+	if len(s.buf) < spoolRun {
+		return nil
+	}
+	return s.flush()
+}
+
+// flush writes the results held as one sorted run. Results of one name
+// stay in the order they came in.
+func (s *spool) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(s.buf, func(a, b sublive.Result) int { return strings.Compare(a.Subdomain, b.Subdomain) })
+	start := s.off
+	for _, r := range s.buf {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		n, err := s.w.Write(append(line, '\n'))
+		s.off += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	s.runs = append(s.runs, [2]int64{start, s.off})
+	s.buf = s.buf[:0]
+	return s.w.Flush()
+}
+
+// sorted returns the spooled results in name order, the first of every
+// name only, passed through prepare spoolBatch at a time; prepare may
+// change or drop results and is nil for none. A failure to read the spool
+// back ends the sequence after the results merged so far, and is reported
+// by Err.
+func (s *spool) sorted(prepare func([]sublive.Result) []sublive.Result) iter.Seq[sublive.Result] {
+	return func(yield func(sublive.Result) bool) {
+		if s.err = s.flush(); s.err != nil {
+			return
+		}
+		h := &runHeap{}
+		for i, run := range s.runs {
+			dec := json.NewDecoder(bufio.NewReader(io.NewSectionReader(s.f, run[0], run[1]-run[0])))
+			if s.err = h.push(dec, i); s.err != nil {
+				return
+			}
+		}
+		last := ""
+		batch := make([]sublive.Result, 0, spoolBatch)
+		flush := func() bool {
+			if prepare != nil {
+				batch = prepare(batch)
+			}
+			for _, r := range batch {
+				if !yield(r) {
+					return false
+				}
+			}
+			batch = batch[:0]
+			return true
+		}
+		for h.Len() > 0 {
+			next := (*h)[0]
+			r := next.r
+			heap.Pop(h)
+			if s.err = h.push(next.dec, next.run); s.err != nil {
+				flush()
+				return
+			}
+			if r.Subdomain == last && last != "" {
+				continue
+			}
+			last = r.Subdomain
+			if batch = append(batch, r); len(batch) == spoolBatch && !flush() {
+				return
+			}
+		}
+		flush()
+	}
+}
+
+// Err returns the error that ended the last sorted sequence early.
+func (s *spool) Err() error {
+	return s.err
+}
+
+// close removes the temporary file.
+func (s *spool) close() {
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
+
+// runHead is the next result of one run of a spool.
+type runHead struct {
+	r   sublive.Result
+	dec *json.Decoder
+	run int
+}
+
+// runHeap orders the runs of a spool by their next result: by name and,
+// for the same name, by run, the earlier one having come in first.
+type runHeap []runHead
+
+// push reads the next result of run from dec onto the heap, unless the
+// run is done.
+func (h *runHeap) push(dec *json.Decoder, run int) error {
+	var r sublive.Result
+	if err := dec.Decode(&r); errors.Is(err, io.EOF) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	heap.Push(h, runHead{r, dec, run})
+	return nil
+}
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].r.Subdomain != h[j].r.Subdomain {
+		return h[i].r.Subdomain < h[j].r.Subdomain
+	}
+	return h[i].run < h[j].run
+}
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)   { *h = append(*h, x.(runHead)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
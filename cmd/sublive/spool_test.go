@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rishavand1/sublive"
+)
+
+// spooled sorts rs through a new spool that writes a run every run
+// results and returns the names and statuses that come back, with the
+// spool, still open.
+func spooled(t *testing.T, run int, rs []sublive.Result, prepare func([]sublive.Result) []sublive.Result) ([]string, *spool) {
+	t.Helper()
+	size := spoolRun
+	spoolRun = run
+	t.Cleanup(func() { spoolRun = size })
+	sp, err := newSpool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sp.close)
+	for _, r := range rs {
+		if err := sp.add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for r := range sp.sorted(prepare) {
+		got = append(got, fmt.Sprintf("%s/%d", r.Subdomain, r.Status))
+	}
+	return got, sp
+}
+
+// results returns a result per "name/status" of list, in .example.com.
+func results(list string) []sublive.Result {
+	var rs []sublive.Result
+	for _, f := range strings.Fields(list) {
+		name, status, _ := strings.Cut(f, "/")
+		n, _ := strconv.Atoi(status)
+		rs = append(rs, sublive.Result{Subdomain: name + ".example.com", Domain: "example.com", Status: n})
+	}
+	return rs
+}
+
+func TestSpoolSorted(t *testing.T) {
+	live := func(rs []sublive.Result) []sublive.Result {
+		var out []sublive.Result
+		for _, r := range rs {
+			if r.Status == 200 {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+	tests := []struct {
+		name    string
+		run     int
+		in      string
+		prepare func([]sublive.Result) []sublive.Result
+		runs    int
+		want    string
+	}{
+		{"one run", 10, "c/200 a/200 b/404", nil, 1, "a/200 b/404 c/200"},
+		{"exact runs", 2, "b/200 a/200 d/200 c/200", nil, 2, "a/200 b/200 c/200 d/200"},
+		{"partial last run", 2, "e/200 b/200 a/200 d/200 c/200", nil, 3, "a/200 b/200 c/200 d/200 e/200"},
+		// the first result of a name wins, within a run and across runs
+		{"duplicate in a run", 3, "a/200 a/404 b/200", nil, 1, "a/200 b/200"},
+		{"duplicate across runs", 2, "a/200 b/200 c/404 a/404 b/500", nil, 3, "a/200 b/200 c/404"},
+		{"later run first", 2, "z/200 y/200 a/404 b/200 a/500", nil, 3, "a/404 b/200 y/200 z/200"},
+		// prepare sees the first of a name only, dropping it drops the name
+		{"prepare", 2, "a/404 b/200 a/200 c/200", live, 2, "b/200 c/200"},
+		{"empty", 2, "", nil, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, sp := spooled(t, tt.run, results(tt.in), tt.prepare)
+			if strings.Join(got, " ") != strings.ReplaceAll(tt.want, "/", ".example.com/") {
+				t.Errorf("got %v, want %s", got, tt.want)
+			}
+			if len(sp.runs) != tt.runs || sp.Err() != nil {
+				t.Errorf("%d runs (%v), want %d", len(sp.runs), sp.Err(), tt.runs)
+			}
+			// a second pass gives the same
+			var again []string
+			for r := range sp.sorted(tt.prepare) {
+				again = append(again, fmt.Sprintf("%s/%d", r.Subdomain, r.Status))
+			}
+			if strings.Join(again, " ") != strings.Join(got, " ") {
+				t.Errorf("second pass %v, want %v", again, got)
+			}
+		})
+	}
+}
+
+func TestSpoolTruncated(t *testing.T) {
+	_, sp := spooled(t, 2, results("a/200 b/200 c/200 d/200"), nil)
+	// cut the second run off in its second line
+	line, err := io.ReadAll(io.NewSectionReader(sp.f, sp.runs[1][0], sp.runs[1][1]-sp.runs[1][0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _, _ := strings.Cut(string(line), "\n")
+	if err := sp.f.Truncate(sp.runs[1][0] + int64(len(first)) + 5); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for r := range sp.sorted(nil) {
+		got = append(got, r.Subdomain)
+	}
+	if !errors.Is(sp.Err(), io.ErrUnexpectedEOF) {
+		t.Errorf("Err() = %v, want %v", sp.Err(), io.ErrUnexpectedEOF)
+	}
+	// the results merged before d fails to be read are handed on; c, taken
+	// off the heap as it failed, is not
+	if strings.Join(got, " ") != "a.example.com b.example.com" {
+		t.Errorf("got %v before the error", got)
+	}
+}
+
+// heapPeak samples the heap in use until the returned function is called,
+// which returns the most seen.
+func heapPeak() func() uint64 {
+	var peak uint64
+	sample := func() {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		peak = max(peak, m.HeapInuse)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tick := time.NewTicker(10 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				sample()
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		wg.Wait()
+		sample()
+		return peak
+	}
+}
+
+// BenchmarkSpool spools 100,000 results of synthetic names, or as many as
+// SUBLIVE_BENCH_NAMES says, in the scattered order a scan gives them, and
+// reads them back sorted, reporting the peak heap in use of a pass.
+//
+//	SUBLIVE_BENCH_NAMES=5000000 go test -run '^$' -bench Spool -benchtime 1x ./cmd/sublive
+func BenchmarkSpool(b *testing.B) {
+	n := 100000
+	if v := os.Getenv("SUBLIVE_BENCH_NAMES"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil {
+			b.Fatalf("SUBLIVE_BENCH_NAMES: %v", err)
+		}
+	}
+	checked := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.ReportAllocs()
+	var peak uint64
+	for b.Loop() {
+		runtime.GC()
+		stop := heapPeak()
+		sp, err := newSpool()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := range n {
+			// an odd multiplier is a permutation of the uint32s
+			name := fmt.Sprintf("h%08x.example.com", uint32(i)*2654435761)
+			r := sublive.Result{Subdomain: name, Domain: "example.com", CheckedAt: checked, Reason: sublive.ReasonNXDOMAIN, Error: "lookup " + name + " on 192.0.2.53:53: no such host"}
+			if i%10 == 0 {
+				r = sublive.Result{Subdomain: name, Domain: "example.com", Status: 200, CheckedAt: checked, Proto: "HTTP/1.1", URL: "https://" + name, IP: "192.0.2.1", IPs: []string{"192.0.2.1", "192.0.2.2"}, Title: "Welcome"}
+			}
+			if err := sp.add(r); err != nil {
+				b.Fatal(err)
+			}
+		}
+		got, last := 0, ""
+		for r := range sp.sorted(nil) {
+			if r.Subdomain <= last {
+				b.Fatalf("%s after %s", r.Subdomain, last)
+			}
+			got, last = got+1, r.Subdomain
+		}
+		if sp.Err() != nil || got != n {
+			b.Fatalf("%d of %d results back: %v", got, n, sp.Err())
+		}
+		sp.close()
+		peak = max(peak, stop())
+	}
+	b.ReportMetric(float64(peak)/1e6, "peak-heap-MB")
+}
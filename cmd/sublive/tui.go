@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+
+	"github.com/rishavand1/sublive"
+)
+
+// tuiFilters are the class filters of the TUI, selected by key; the first
+// one shows everything.
+var tuiFilters = []struct {
+	key, name string
+	classes   []sublive.Class
+}{
+	{"a", "all", nil},
+	{"l", "live", []sublive.Class{sublive.ClassLive}},
+	{"r", "redirect", []sublive.Class{sublive.ClassRedirect}},
+	{"u", "auth", []sublive.Class{sublive.ClassAuth}},
+	{"4", "4xx", []sublive.Class{sublive.ClassClientError}},
+	{"5", "5xx", []sublive.Class{sublive.ClassServerError}},
+	{"n", "no response", []sublive.Class{sublive.ClassBadCert, sublive.ClassNoHTTP, sublive.ClassNoDNS}},
+}
+
+// checkTUI refuses -tui where it can't work: with -monitor, which never
+// gets to the final output, or without a terminal on stdin and stdout.
+func checkTUI(monitor bool) error {
+	if monitor {
+		return errors.New("-tui: can't be combined with -monitor")
+	}
+	tty := func(f *os.File) bool {
+		return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+	}
+	if !tty(os.Stdin) || !tty(os.Stdout) {
+		return errors.New("-tui: needs an interactive terminal on stdin and stdout; drop it when piping, redirecting or running unattended (-o and -v still show the results)")
+	}
+	return nil
+}
+
+type (
+	tuiResult sublive.Result
+	tuiTick   struct{}
+	tuiDone   struct{ err error }
+)
+
+// tuiModel is the bubbletea model of -tui: the results so far by name,
+// with the scan progress from Scanner.Metrics above them.
+type tuiModel struct {
+	scanner  *sublive.Scanner
+	domain   string
+	metadata bool
+	start    time.Time
+	// end is when the scan finished, zero while it runs
+	end  time.Time
+	deep bool
+	// results is sorted by subdomain, one entry per name
+	results []sublive.Result
+	filter  int
+	offset  int
+	height  int
+	paused  bool
+	noPerms bool
+	done    bool
+	status  string
+}
+
+func tuiTicker() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return tuiTick{} })
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return tuiTicker()
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tuiResult:
+		r := sublive.Result(msg)
+		i, found := slices.BinarySearchFunc(m.results, r.Subdomain, func(e sublive.Result, name string) int {
+			return strings.Compare(e.Subdomain, name)
+		})
+		if found {
+			m.results[i] = r
+		} else {
+			m.results = slices.Insert(m.results, i, r)
+		}
+	case tuiTick:
+		if !m.done {
+			return m, tuiTicker()
+		}
+	case tuiDone:
+		m.done, m.end = true, time.Now()
+		m.status = "scan finished, q writes the output"
+		if msg.err != nil {
+			m.status = "scan failed: " + msg.err.Error()
+		}
+	case tea.KeyMsg:
+		return m, m.key(msg.String())
+	}
+	return m, nil
+}
+
+// key handles a key press.
+func (m *tuiModel) key(k string) tea.Cmd {
+	for i, f := range tuiFilters {
+		if k == f.key {
+			m.filter, m.offset = i, 0
+			return nil
+		}
+	}
+	rows := m.rows()
+	switch k {
+	case "q", "ctrl+c":
+		return tea.Quit
+	case "p":
+		if m.done {
+			break
+		}
+		m.paused = !m.paused
+		if m.paused {
+			m.scanner.Pause()
+			m.status = "paused, probes in flight still finish"
+		} else {
+			m.scanner.Resume()
+			m.status = "resumed"
+		}
+	case "d":
+		if !m.deep {
+			m.status = "deep mode is off (-t 1 turns it on)"
+			break
+		}
+		m.noPerms = !m.noPerms
+		m.scanner.SetPermutations(!m.noPerms)
+		m.status = "permutations of live hosts on"
+		if m.noPerms {
+			m.status = "permutations of live hosts off"
+		}
+	case "s":
+		m.status = m.snapshot()
+	case "up", "k":
+		m.offset--
+	case "down", "j":
+		m.offset++
+	case "pgup":
+		m.offset -= rows
+	case "pgdown", " ":
+		m.offset += rows
+	case "home", "g":
+		m.offset = 0
+	case "end", "G":
+		m.offset = len(m.results)
+	}
+	return nil
+}
+
+// snapshot writes the results so far as JSON to a file named after the
+// target and the time, and returns the status line saying so.
+func (m *tuiModel) snapshot() string {
+	name := m.domain
+	if name == "" {
+		name = "results"
+	}
+	path := fmt.Sprintf("sublive-%s-%s.json", name, time.Now().UTC().Format("20060102T150405Z"))
+	meta := newRunMeta(m.domain, m.start, m.metadata)
+	if err := writeResultsFile(path, meta, m.domain, nil, m.results, "json", false); err != nil {
+		return "snapshot failed: " + err.Error()
+	}
+	return fmt.Sprintf("%d results written to %s", len(m.results), path)
+}
+
+// visible returns the results that pass the filter.
+func (m *tuiModel) visible() []sublive.Result {
+	classes := tuiFilters[m.filter].classes
+	if classes == nil {
+		return m.results
+	}
+	var out []sublive.Result
+	for _, r := range m.results {
+		if slices.Contains(classes, sublive.ClassifyResult(r)) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// rows is how many table rows fit under the header and above the key
+// help.
+func (m *tuiModel) rows() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-7, 1)
+}
+
+func (m *tuiModel) View() string {
+	var b strings.Builder
+	state := "running"
+	switch {
+	case m.done:
+		state = "finished"
+	case m.paused:
+		state = "paused"
+	}
+	target := m.domain
+	if target == "" {
+		target = "-recheck"
+	}
+	fmt.Fprintf(&b, "sublive %s: %s, %s", sublive.Version, target, state)
+	if m.deep {
+		fmt.Fprintf(&b, ", permutations %s", map[bool]string{false: "on", true: "off"}[m.noPerms])
+	}
+	b.WriteString("\n")
+
+	// the queue grows as deep mode finds names, so the ETA is for what is
+	// known so far
+	elapsed := time.Since(m.start)
+	if m.done {
+		elapsed = m.end.Sub(m.start)
+	}
+	enq, proc := m.scanner.Metrics.Enqueued(), m.scanner.Metrics.Processed()
+	rate := float64(proc) / elapsed.Seconds()
+	eta := "-"
+	if left := enq - proc; rate > 0 && left > 0 && !m.done {
+		eta = time.Duration(float64(left) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+	pct := 0.0
+	if enq > 0 {
+		pct = 100 * float64(proc) / float64(enq)
+	}
+	fmt.Fprintf(&b, "%d/%d probed (%.0f%%), %.1f/s, ETA %s, elapsed %s\n", proc, enq, pct, rate, eta, elapsed.Round(time.Second))
+
+	rows := m.visible()
+	var keys []string
+	for i, f := range tuiFilters {
+		k := fmt.Sprintf("[%s] %s", f.key, f.name)
+		if i == m.filter {
+			k = strings.ToUpper(k)
+		}
+		keys = append(keys, k)
+	}
+	fmt.Fprintf(&b, "filter: %s (%d of %d)\n\n", strings.Join(keys, " "), len(rows), len(m.results))
+
+	n := m.rows()
+	m.offset = max(min(m.offset, len(rows)-n), 0)
+	width := len("SUBDOMAIN")
+	for _, r := range rows[m.offset:min(m.offset+n, len(rows))] {
+		width = max(width, len(r.Subdomain))
+	}
+	fmt.Fprintf(&b, "%-6s  %-*s  %-15s  %s\n", "STATUS", width, "SUBDOMAIN", "IP", "CLASS")
+	for i := m.offset; i < min(m.offset+n, len(rows)); i++ {
+		r := rows[i]
+		status := "-"
+		if r.Status != 0 {
+			status = fmt.Sprint(r.Status)
+		}
+		fmt.Fprintf(&b, "%-6s  %-*s  %-15s  %s\n", status, width, r.Subdomain, r.IP, sublive.ClassifyResult(r))
+	}
+	for i := len(rows) - m.offset; i < n; i++ {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "[p] pause  [d] permutations  [s] snapshot  [up/down] scroll  [q] quit  %s", m.status)
+	return b.String()
+}
+
+// runTUI runs the scan under the -tui screen and returns its results like
+// gatherResults, passing each one to each as well. Quitting before the
+// scan is done cancels ctx with errInterrupted, as Ctrl-C does in normal
+// mode, and waits for the probes in flight. While the screen is up only
+// -log receives log records.
+func runTUI(ctx context.Context, interrupt context.CancelCauseFunc, scanner *sublive.Scanner, domain string, metadata bool, start time.Time, each func(sublive.Result)) ([]sublive.Result, error) {
+	if scanner.Metrics == nil {
+		scanner.Metrics = sublive.NewMetrics()
+	}
+	console := logger
+	quiet := slog.New(slog.DiscardHandler)
+	if logFile != nil {
+		quiet = slog.New(logFile)
+	}
+	logger, scanner.Logger = quiet, quiet
+
+	m := &tuiModel{scanner: scanner, domain: domain, metadata: metadata, start: start, deep: scanner.Deep}
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	type gathered struct {
+		subs []sublive.Result
+		err  error
+	}
+	done := make(chan gathered, 1)
+	go func() {
+		subs, err := gatherResults(ctx, scanner, func(r sublive.Result) {
+			each(r)
+			p.Send(tuiResult(r))
+		}, nil)
+		p.Send(tuiDone{err})
+		done <- gathered{subs, err}
+	}()
+	_, uiErr := p.Run()
+	if uiErr != nil && !errors.Is(uiErr, tea.ErrInterrupted) {
+		console.Warn("-tui failed", "error", uiErr)
+	}
+
+	var g gathered
+	select {
+	case g = <-done:
+	default:
+		console.Warn("interrupted: writing the results so far")
+		interrupt(errInterrupted)
+		g = <-done
+	}
+	logger, scanner.Logger = console, console
+	return g.subs, g.err
+}
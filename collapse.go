@@ -0,0 +1,84 @@
+package sublive
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// cnameGroups collapses the names whose CNAME chains end at the same
+// target, with Scanner.CollapseCNAME: the first of them to be probed
+// represents the target, the others are parked by the collector until its
+// result is in and then inherit it when it says nothing about the name
+// itself (see inheritable), or are probed as usual.
+type cnameGroups struct {
+	mu sync.Mutex
+	m  map[string]*cnameGroup
+}
+
+// cnameGroup is one CNAME target.
+type cnameGroup struct {
+	// rep is the name probed for the target
+	rep string
+	// settled is set once the result of rep is in, and result is that
+	// result when the other names may inherit it; the collector reads
+	// settled without the lock
+	settled atomic.Bool
+	result  *Result
+}
+
+func newCNAMEGroups() *cnameGroups {
+	return &cnameGroups{m: make(map[string]*cnameGroup)}
+}
+
+// join adds name, whose CNAME chain ends at target, to the group of
+// target. It returns the group when name is its representative, to be
+// probed and settled, or with wait set when the representative is still
+// being probed, and otherwise the result for name to inherit, nil when
+// name is to be probed like any other.
+func (gs *cnameGroups) join(target, name string) (g *cnameGroup, from *Result, wait bool) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	g = gs.m[target]
+	switch {
+	case g == nil:
+		g = &cnameGroup{rep: name}
+		gs.m[target] = g
+	case g.rep == name:
+	case !g.settled.Load():
+		return g, nil, true
+	default:
+		return nil, g.result, false
+	}
+	return g, nil, false
+}
+
+// settle records r, the result of the representative of g.
+func (gs *cnameGroups) settle(g *cnameGroup, r Result) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	g.result = nil
+	if inheritable(r) {
+		g.result = &r
+	}
+	g.settled.Store(true)
+}
+
+// inheritable reports whether r, the result of a representative, is the
+// answer of the CNAME target rather than of the name: a catch-all page
+// (Result.Soft404) or a redirect to the apex, with no Scanner.Match
+// pattern found. Any other answer, a unique page, may differ per name.
+func inheritable(r Result) bool {
+	return r.Status != 0 && !r.throttled && !r.cancelled && (r.Soft404 || r.RedirectClass == RedirectApex) && len(r.Matched) == 0
+}
+
+// inherit gives r the answer of rep, the representative of its CNAME
+// target, instead of probing it.
+func (r *Result) inherit(rep Result) {
+	scheme, _, _ := strings.Cut(rep.URL, "://")
+	r.Status, r.Proto, r.URL = rep.Status, rep.Proto, scheme+"://"+r.Subdomain
+	r.RedirectClass, r.RedirectTarget = rep.RedirectClass, rep.RedirectTarget
+	r.Soft404, r.Soft404Kept = rep.Soft404, rep.Soft404Kept
+	r.Title, r.BodyHash, r.CDN = rep.Title, rep.BodyHash, rep.CDN
+	r.Inherited, r.InheritedFrom = true, rep.Subdomain
+}
@@ -0,0 +1,51 @@
+package sublive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// crtshURL is the certificate transparency search endpoint; %s is the
+// query-escaped "%.domain" pattern.
+const crtshURL = "https://crt.sh/?q=%s&output=json"
+
+// FetchCT returns the names under domain found in certificate transparency
+// logs via crt.sh. Wildcard identities have their "*." stripped.
+func FetchCT(ctx context.Context, domain string, timeout time.Duration) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf(crtshURL, url.QueryEscape("%."+domain)), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crt.sh returned %s", resp.Status)
+	}
+	var entries []struct {
+		NameValue  string `json:"name_value"`
+		CommonName string `json:"common_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("decoding crt.sh response: %v", err)
+	}
+	out := []string{}
+	for _, e := range entries {
+		for _, n := range append(strings.Split(e.NameValue, "\n"), e.CommonName) {
+			n = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(n)), "*.")
+			if InDomain(n, domain) && ValidHostname(n) {
+				out = append(out, n)
+			}
+		}
+	}
+	return UniqStrings(out), nil
+}
@@ -0,0 +1,198 @@
+package sublive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangeKind says how a subdomain differs between two result sets.
+type ChangeKind string
+
+const (
+	// ChangeAdded is a subdomain present only in the current set.
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved is a subdomain present only in the previous set.
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeStatus is a subdomain whose HTTP status changed, e.g. 200 -> 403.
+	ChangeStatus ChangeKind = "status"
+	// ChangeIP is a subdomain that now resolves to a different address.
+	ChangeIP ChangeKind = "ip"
+)
+
+// Change is one difference reported by Diff. A subdomain whose status and
+// IP both changed yields one ChangeStatus and one ChangeIP. FirstSeen and
+// LastSeen are when the subdomain was first and last observed, from the
+// Result timestamps; zero when the result sets have none, as in the plain
+// text format.
+type Change struct {
+	Subdomain string     `json:"subdomain"`
+	Kind      ChangeKind `json:"kind"`
+	OldStatus int        `json:"old_status,omitempty"`
+	NewStatus int        `json:"new_status,omitempty"`
+	OldIP     string     `json:"old_ip,omitempty"`
+	NewIP     string     `json:"new_ip,omitempty"`
+	FirstSeen time.Time  `json:"first_seen,omitzero"`
+	LastSeen  time.Time  `json:"last_seen,omitzero"`
+}
+
+// firstSeen is r.FirstSeen, or r.CheckedAt for a result seen only once.
+func firstSeen(r Result) time.Time {
+	if r.FirstSeen.IsZero() {
+		return r.CheckedAt
+	}
+	return r.FirstSeen
+}
+
+// CarryFirstSeen sets the FirstSeen of every result in cur: that of the
+// same subdomain in prev when there is one, else its CheckedAt.
+func CarryFirstSeen(prev, cur []Result) {
+	old := make(map[string]time.Time, len(prev))
+	for _, r := range prev {
+		old[r.Subdomain] = firstSeen(r)
+	}
+	for i := range cur {
+		if t := old[cur[i].Subdomain]; !t.IsZero() {
+			cur[i].FirstSeen = t
+		} else {
+			cur[i].FirstSeen = firstSeen(cur[i])
+		}
+	}
+}
+
+// Diff compares two result sets keyed by subdomain and returns the changes
+// sorted by subdomain. IPs are only compared when both sides have one, so a
+// previous set without addresses (the plain text format) reports status
+// changes only.
+func Diff(prev, cur []Result) []Change {
+	old := make(map[string]Result, len(prev))
+	for _, r := range prev {
+		old[r.Subdomain] = r
+	}
+	now := make(map[string]Result, len(cur))
+	for _, r := range cur {
+		now[r.Subdomain] = r
+	}
+
+	changes := []Change{}
+	for name, r := range now {
+		o, ok := old[name]
+		if !ok {
+			changes = append(changes, Change{Subdomain: name, Kind: ChangeAdded, NewStatus: r.Status, NewIP: r.IP, FirstSeen: firstSeen(r), LastSeen: r.CheckedAt})
+			continue
+		}
+		first := firstSeen(o)
+		if first.IsZero() {
+			first = firstSeen(r)
+		}
+		if o.Status != r.Status {
+			changes = append(changes, Change{Subdomain: name, Kind: ChangeStatus, OldStatus: o.Status, NewStatus: r.Status, FirstSeen: first, LastSeen: r.CheckedAt})
+		}
+		if o.IP != "" && r.IP != "" && o.IP != r.IP {
+			changes = append(changes, Change{Subdomain: name, Kind: ChangeIP, OldIP: o.IP, NewIP: r.IP, FirstSeen: first, LastSeen: r.CheckedAt})
+		}
+	}
+	for name, o := range old {
+		if _, ok := now[name]; !ok {
+			changes = append(changes, Change{Subdomain: name, Kind: ChangeRemoved, OldStatus: o.Status, OldIP: o.IP, FirstSeen: firstSeen(o), LastSeen: o.CheckedAt})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Subdomain != changes[j].Subdomain {
+			return changes[i].Subdomain < changes[j].Subdomain
+		}
+		return changes[i].Kind < changes[j].Kind
+	})
+	return changes
+}
+
+// ReadResults reads a result set written by the sublive command: either the
+// JSON document ({"results": [...]}, or a bare array of results), one JSON
+// result per line as in the .partial stream of -o, or plain
+// "host status" lines, the status possibly in brackets as in the extended
+// format, with anything after the status ignored. Text lines
+// that don't start with a hostname, such as a captured summary, are skipped.
+func ReadResults(r io.Reader) ([]Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+		return []Result{}, nil
+	case trimmed[0] == '{' && bytes.HasPrefix(trimmed, []byte(`{"subdomain"`)):
+		return readResultLines(trimmed)
+	case trimmed[0] == '{':
+		var doc struct {
+			Results []Result `json:"results"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, err
+		}
+		return doc.Results, nil
+	case trimmed[0] == '[':
+		var results []Result
+		if err := json.Unmarshal(trimmed, &results); err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+
+	results := []Result{}
+	s := bufio.NewScanner(bytes.NewReader(trimmed))
+	for n := 1; s.Scan(); n++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || !strings.Contains(fields[0], ".") || !ValidHostname(fields[0]) {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected \"host status\"", n)
+		}
+		status, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(fields[1], "["), "]"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid status %q", n, fields[1])
+		}
+		results = append(results, Result{Subdomain: fields[0], Unicode: DisplayName(fields[0]), Status: status})
+	}
+	return results, s.Err()
+}
+
+// readResultLines reads one JSON result per line. The last line may be cut
+// short by a run that died while writing it and is then dropped.
+func readResultLines(data []byte) ([]Result, error) {
+	lines := bytes.Split(data, []byte("\n"))
+	results := make([]Result, 0, len(lines))
+	for i, line := range lines {
+		var r Result
+		if err := json.Unmarshal(line, &r); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// LoadResults reads a result file (see ReadResults).
+func LoadResults(path string) ([]Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	results, err := ReadResults(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return results, nil
+}
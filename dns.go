@@ -0,0 +1,269 @@
+package sublive
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxCNAMEChain caps how many CNAME hops are followed for a single name.
+const maxCNAMEChain = 10
+
+// DefaultDNSRetries is how many times a lookup answered REFUSED or
+// SERVFAIL is tried again when Scanner.DNSRetries is 0.
+const DefaultDNSRetries = 2
+
+// systemNameservers returns the nameservers from /etc/resolv.conf as
+// host:port pairs, or nil when none are configured.
+func systemNameservers() []string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	out := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) >= 2 && f[0] == "nameserver" {
+			out = append(out, net.JoinHostPort(f[1], "53"))
+		}
+	}
+	return out
+}
+
+// SystemNameservers returns the nameservers of /etc/resolv.conf, which a
+// Scanner without Nameservers or a ResolverSet queries.
+func SystemNameservers() []string {
+	return systemNameservers()
+}
+
+// SystemSearchDomains returns the search list of /etc/resolv.conf, from
+// its last search or domain line, or nil when there is none. Lookups are
+// always sent fully qualified (see fqdn), so the list is never applied to
+// them.
+func SystemSearchDomains() []string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) >= 2 && (f[0] == "search" || f[0] == "domain") {
+			out = nil
+			for _, d := range f[1:] {
+				if d = strings.TrimSuffix(d, "."); d != "" {
+					out = append(out, d)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// fqdn returns name with a trailing dot, so the resolver takes it as
+// fully qualified and never tries it under the search domains of
+// resolv.conf first: a name that doesn't exist would otherwise resolve
+// as name.corp.example, some internal host, and be reported live.
+// Addresses and names that have the dot already are returned as they are.
+func fqdn(name string) string {
+	if name == "" || strings.HasSuffix(name, ".") || net.ParseIP(name) != nil {
+		return name
+	}
+	return name + "."
+}
+
+// unqualified drops the dot fqdn added from the name of a *net.DNSError,
+// so errors read as before and match from run to run.
+func unqualified(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		dnsErr.Name = strings.TrimSuffix(dnsErr.Name, ".")
+	}
+	return err
+}
+
+// exchange sends an A query for name to servers in turn and returns the
+// first response, with the parser positioned at the answer section. A
+// truncated answer is asked again over TCP; tcp uses TCP from the start.
+func exchange(ctx context.Context, servers []string, name string, tcp bool) (*dnsmessage.Parser, dnsmessage.Header, error) {
+	q, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, dnsmessage.Header{}, err
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: uint16(time.Now().UnixNano()), RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: q, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET})
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, dnsmessage.Header{}, err
+	}
+	var lastErr error
+	for _, srv := range servers {
+		qctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		resp, err := dnsRoundTrip(qctx, srv, msg, tcp, nil)
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		p := &dnsmessage.Parser{}
+		h, err := p.Start(resp)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		p.SkipAllQuestions()
+		return p, h, nil
+	}
+	return nil, dnsmessage.Header{}, lastErr
+}
+
+// queryCNAMEs sends an A query for name and returns the CNAME records from
+// the answer section keyed by owner name.
+func queryCNAMEs(ctx context.Context, servers []string, name string, tcp bool) (map[string]string, error) {
+	p, _, err := exchange(ctx, servers, name, tcp)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			break
+		}
+		if h.Type != dnsmessage.TypeCNAME {
+			p.SkipAnswer()
+			continue
+		}
+		c, err := p.CNAMEResource()
+		if err != nil {
+			break
+		}
+		owner := strings.ToLower(strings.TrimSuffix(h.Name.String(), "."))
+		out[owner] = strings.ToLower(strings.TrimSuffix(c.CNAME.String(), "."))
+	}
+	return out, nil
+}
+
+// lookupCNAMEChain returns the CNAME targets of name in resolution order.
+// Circular chains stop at the first repeated name and the chain is capped
+// at maxCNAMEChain hops. tcp sends the queries over TCP.
+func lookupCNAMEChain(ctx context.Context, servers []string, name string, tcp bool) []string {
+	if len(servers) == 0 {
+		return nil
+	}
+	chain := []string{}
+	visited := map[string]bool{name: true}
+	cur := name
+	for len(chain) < maxCNAMEChain {
+		answers, err := queryCNAMEs(ctx, servers, cur, tcp)
+		if err != nil {
+			break
+		}
+		progressed := false
+		for len(chain) < maxCNAMEChain {
+			next, ok := answers[cur]
+			if !ok {
+				break
+			}
+			if visited[next] {
+				return chain
+			}
+			visited[next] = true
+			chain = append(chain, next)
+			cur = next
+			progressed = true
+		}
+		// the resolver may stop short of the end of a long chain, so ask
+		// again for the last target until nothing new comes back
+		if !progressed {
+			break
+		}
+	}
+	return chain
+}
+
+// newResolver returns a resolver that sends queries round-robin to servers
+// (host:port), or the default system resolver when servers is empty.
+func newResolver(servers []string) *net.Resolver {
+	return newDNSResolver(servers, false, nil)
+}
+
+// newDNSResolver is newResolver with the transport options of a Scanner:
+// truncated or failed UDP queries are repeated over TCP to the same server,
+// reported to onRetry when set, and tcp sends every query over TCP.
+func newDNSResolver(servers []string, tcp bool, onRetry func(server string, err error)) *net.Resolver {
+	if len(servers) == 0 {
+		return net.DefaultResolver
+	}
+	return newSetResolver(roundRobin(servers), tcp, onRetry)
+}
+
+// newSetResolver is newDNSResolver over the servers of set, which counts
+// every query.
+func newSetResolver(set *ResolverSet, tcp bool, onRetry func(server string, err error)) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			st := set.pick()
+			return &dnsConn{ctx: ctx, server: st.server, forceTCP: tcp || strings.HasPrefix(network, "tcp"), onRetry: onRetry, set: set, stat: st}, nil
+		},
+	}
+}
+
+// HostCache remembers successful address lookups for a while so repeated
+// scans of the same names, such as monitoring cycles, don't resolve stable
+// names again. Failed lookups are never cached, so a name that starts to
+// resolve is seen on the next scan. A HostCache is safe for concurrent use
+// and may be shared by several Scanners.
+type HostCache struct {
+	ttl time.Duration
+	mu  sync.Mutex
+	m   map[string]hostEntry
+}
+
+type hostEntry struct {
+	ips     []string
+	expires time.Time
+}
+
+// NewHostCache returns a cache keeping addresses for ttl. A ttl <= 0 returns
+// nil, which disables caching.
+func NewHostCache(ttl time.Duration) *HostCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &HostCache{ttl: ttl, m: make(map[string]hostEntry)}
+}
+
+func (c *HostCache) get(name string) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.m[name]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.m, name)
+		return nil, false
+	}
+	return e.ips, true
+}
+
+func (c *HostCache) put(name string, ips []string) {
+	if c == nil || len(ips) == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.m[name] = hostEntry{ips: ips, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+}
@@ -0,0 +1,230 @@
+package sublive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestFQDN(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"api.example.com", "api.example.com."},
+		{"api.example.com.", "api.example.com."},
+		{"intranet", "intranet."},
+		{"192.0.2.1", "192.0.2.1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := fqdn(tt.name); got != tt.want {
+			t.Errorf("fqdn(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	err := unqualified(&net.DNSError{Err: "no such host", Name: "gone.example.com.", Server: "192.0.2.53:53", IsNotFound: true})
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || dnsErr.Name != "gone.example.com" || !dnsErr.IsNotFound {
+		t.Errorf("unqualified: %v", err)
+	}
+	if err := unqualified(nil); err != nil {
+		t.Errorf("unqualified(nil) = %v", err)
+	}
+}
+
+func TestRunFQDN(t *testing.T) {
+	// every lookup of the default resolver, CNAME chains and records
+	// included, asks for the name itself: a search domain appended to
+	// one would show up as a name outside example.com
+	ns := serveDNS(t, map[string][]string{"live.example.com": {"192.0.2.30"}})
+	prb := &fakeProber{pages: map[string]fakePage{"live.example.com": {status: 200}}}
+	s := &Scanner{Domains: []string{"example.com"}, Words: []string{"live", "gone", "intranet"}, Resolvers: []string{ns.addr}, CNAMEChains: true, Records: []string{"txt"}, NoBackoff: true, Prober: prb}
+	got := runScan(t, s)
+	if r := got["live.example.com"]; r.Status != 200 || r.IP != "192.0.2.30" {
+		t.Errorf("live.example.com: status %d ip %q (%s)", r.Status, r.IP, r.Error)
+	}
+	// errors name the candidate as it was given
+	if r := got["gone.example.com"]; !strings.Contains(r.Error, "lookup gone.example.com on ") {
+		t.Errorf("gone.example.com: error %q", r.Error)
+	}
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	for name := range ns.asked {
+		if !InDomain(name, "example.com") {
+			t.Errorf("queried %s", name)
+		}
+	}
+	for _, name := range []string{"live.example.com", "gone.example.com", "intranet.example.com"} {
+		if ns.asked[name] == 0 {
+			t.Errorf("%s never queried", name)
+		}
+	}
+}
+
+// truncatingDNS is a miekg/dns server on one port over UDP and TCP. Over
+// TCP it gives every name of answers all its addresses; over UDP it
+// answers with the TC bit and the first address only, and not at all for
+// the names of silent. It counts the queries of each network.
+type truncatingDNS struct {
+	addr    string
+	answers map[string][]string
+	silent  map[string]bool
+
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+func serveTruncatingDNS(t *testing.T, answers map[string][]string, silent ...string) *truncatingDNS {
+	f := &truncatingDNS{answers: answers, silent: map[string]bool{}, queries: map[string]int{}}
+	for _, n := range silent {
+		f.silent[n] = true
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		t.Skipf("no TCP on the UDP port: %v", err)
+	}
+	f.addr = pc.LocalAddr().String()
+	for _, srv := range []*dns.Server{{PacketConn: pc, Handler: f}, {Listener: l, Handler: f}} {
+		started := make(chan struct{})
+		srv.NotifyStartedFunc = func() { close(started) }
+		go srv.ActivateAndServe()
+		<-started
+		t.Cleanup(func() { srv.Shutdown() })
+	}
+	return f
+}
+
+func (f *truncatingDNS) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	network := w.LocalAddr().Network()
+	name := strings.TrimSuffix(req.Question[0].Name, ".")
+	f.mu.Lock()
+	f.queries[network]++
+	f.mu.Unlock()
+	if network == "udp" && f.silent[name] {
+		return
+	}
+	m := new(dns.Msg)
+	m.SetReply(req)
+	ips, ok := f.answers[name]
+	if !ok {
+		m.Rcode = dns.RcodeNameError
+	}
+	if req.Question[0].Qtype != dns.TypeA {
+		ips = nil
+	}
+	if network == "udp" && len(ips) > 1 {
+		m.Truncated = true
+		ips = ips[:1]
+	}
+	for _, ip := range ips {
+		m.Answer = append(m.Answer, &dns.A{Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.ParseIP(ip)})
+	}
+	w.WriteMsg(m)
+}
+
+func (f *truncatingDNS) count(network string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queries[network]
+}
+
+// manyIPs returns n addresses of 192.0.2.0/24.
+func manyIPs(n int) []string {
+	var ips []string
+	for i := range n {
+		ips = append(ips, fmt.Sprintf("192.0.2.%d", i+1))
+	}
+	return ips
+}
+
+func TestDNSRoundTrip(t *testing.T) {
+	many := manyIPs(40)
+	answers := map[string][]string{"big.example.com": many, "small.example.com": {"192.0.2.99"}, "silent.example.com": {"192.0.2.98", "192.0.2.97"}}
+	tests := []struct {
+		name     string
+		host     string
+		forceTCP bool
+		// udp and tcp are the queries each network gets, retry the error
+		// the TCP retry is reported with
+		udp, tcp int
+		retry    error
+	}{
+		{"truncated", "big.example.com", false, 1, 1, errTruncated},
+		{"small", "small.example.com", false, 1, 0, nil},
+		{"udp fails", "silent.example.com", false, 1, 1, os.ErrDeadlineExceeded},
+		{"force tcp", "big.example.com", true, 0, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serveTruncatingDNS(t, answers, "silent.example.com")
+			req := new(dns.Msg)
+			req.SetQuestion(tt.host+".", dns.TypeA)
+			msg, err := req.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var retries []error
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			b, err := dnsRoundTrip(ctx, srv.addr, msg, tt.forceTCP, func(server string, err error) {
+				if server != srv.addr {
+					t.Errorf("retry reported for %s", server)
+				}
+				retries = append(retries, err)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resp dns.Msg
+			if err := resp.Unpack(b); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Truncated || len(resp.Answer) != len(answers[tt.host]) {
+				t.Errorf("truncated %v with %d answers, want %d", resp.Truncated, len(resp.Answer), len(answers[tt.host]))
+			}
+			if srv.count("udp") != tt.udp || srv.count("tcp") != tt.tcp {
+				t.Errorf("%d UDP and %d TCP queries, want %d and %d", srv.count("udp"), srv.count("tcp"), tt.udp, tt.tcp)
+			}
+			switch {
+			case tt.retry == nil && len(retries) > 0:
+				t.Errorf("retries reported: %v", retries)
+			case tt.retry != nil && (len(retries) != 1 || !errors.Is(retries[0], tt.retry)):
+				t.Errorf("retries reported %v, want %v", retries, tt.retry)
+			}
+		})
+	}
+}
+
+func TestDNSResolverTruncated(t *testing.T) {
+	many := manyIPs(40)
+	srv := serveTruncatingDNS(t, map[string][]string{"big.example.com": many})
+	for _, tcp := range []bool{false, true} {
+		var retries atomic.Int32
+		r := newDNSResolver([]string{srv.addr}, tcp, func(string, error) { retries.Add(1) })
+		udp := srv.count("udp")
+		ips, err := r.LookupHost(context.Background(), "big.example.com.")
+		if err != nil || len(ips) != len(many) {
+			t.Errorf("tcp %v: %d addresses (%v), want %d", tcp, len(ips), err, len(many))
+		}
+		if tcp && (srv.count("udp") != udp || retries.Load() != 0) {
+			t.Errorf("-tcp-dns sent %d UDP queries and %d retries", srv.count("udp")-udp, retries.Load())
+		}
+		if !tcp && retries.Load() == 0 {
+			t.Error("the truncated answer was not retried over TCP")
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package sublive
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// errTruncated is reported to OnDNSRetry for a UDP answer with the TC bit
+// set.
+var errTruncated = errors.New("truncated UDP response")
+
+// dnsRoundTrip sends the DNS message msg to server and returns the answer.
+// The query goes over UDP first, with half of the time left, and is repeated
+// over TCP to the same server when the answer is truncated or UDP fails.
+// With forceTCP only TCP is used. onRetry, when set, is told about every
+// repeat.
+func dnsRoundTrip(ctx context.Context, server string, msg []byte, forceTCP bool, onRetry func(server string, err error)) ([]byte, error) {
+	if src := sourceFrom(ctx); src != nil {
+		src.queries.Add(1)
+	}
+	if !forceTCP {
+		resp, err := udpRoundTrip(ctx, server, msg)
+		if err == nil && len(resp) > 2 && resp[2]&0x02 == 0 {
+			return resp, nil
+		}
+		if err == nil {
+			err = errTruncated
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if onRetry != nil {
+			onRetry(server, err)
+		}
+	}
+	return tcpRoundTrip(ctx, server, msg)
+}
+
+func udpRoundTrip(ctx context.Context, server string, msg []byte) ([]byte, error) {
+	if dl, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Now().Add(time.Until(dl)/2))
+		defer cancel()
+	}
+	d := sourceDialer(ctx, "udp", server)
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// skip late answers to an earlier query on a reused port
+		if n >= 2 && buf[0] == msg[0] && buf[1] == msg[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+func tcpRoundTrip(ctx context.Context, server string, msg []byte) ([]byte, error) {
+	d := sourceDialer(ctx, "tcp", server)
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	req := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(msg)), uint16(len(msg)))
+	if _, err := conn.Write(append(req, msg...)); err != nil {
+		return nil, err
+	}
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// dnsConn is what the custom resolver's Dial returns. It is not a
+// net.PacketConn, so the Go resolver frames messages as on TCP and writes
+// whole queries, which dnsRoundTrip then sends over UDP or TCP. That keeps
+// the TCP retry of a truncated answer on the same server.
+type dnsConn struct {
+	ctx      context.Context
+	server   string
+	forceTCP bool
+	onRetry  func(server string, err error)
+	// set counts the queries to server under stat
+	set      *ResolverSet
+	stat     *resolverStat
+	deadline time.Time
+	in, out  []byte
+}
+
+func (c *dnsConn) Write(b []byte) (int, error) {
+	c.in = append(c.in, b...)
+	for len(c.in) >= 2 {
+		n := int(binary.BigEndian.Uint16(c.in))
+		if len(c.in) < 2+n {
+			break
+		}
+		msg := c.in[2 : 2+n]
+		c.in = c.in[2+n:]
+		ctx := c.ctx
+		if !c.deadline.IsZero() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, c.deadline)
+			defer cancel()
+		}
+		resp, err := dnsRoundTrip(ctx, c.server, msg, c.forceTCP, c.onRetry)
+		c.set.record(c.stat, resp, err)
+		if err != nil {
+			return 0, err
+		}
+		c.out = binary.BigEndian.AppendUint16(c.out, uint16(len(resp)))
+		c.out = append(c.out, resp...)
+	}
+	return len(b), nil
+}
+
+func (c *dnsConn) Read(b []byte) (int, error) {
+	if len(c.out) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+func (c *dnsConn) Close() error                       { return nil }
+func (c *dnsConn) LocalAddr() net.Addr                { return dnsAddr("") }
+func (c *dnsConn) RemoteAddr() net.Addr               { return dnsAddr(c.server) }
+func (c *dnsConn) SetDeadline(t time.Time) error      { c.deadline = t; return nil }
+func (c *dnsConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dnsConn) SetWriteDeadline(t time.Time) error { c.deadline = t; return nil }
+
+// dnsAddr is the address of a dnsConn.
+type dnsAddr string
+
+func (a dnsAddr) Network() string { return "dns" }
+func (a dnsAddr) String() string  { return string(a) }
@@ -0,0 +1,86 @@
+package sublive
+
+import (
+	"cmp"
+	"slices"
+)
+
+// EdgeIP is an address Scanner.EdgeThreshold found giving every name the
+// same page: the status and Result.BodyHash it answered with, how many
+// names got that answer and how many of them were marked
+// Result.EdgeDefault.
+type EdgeIP struct {
+	IP       string `json:"ip"`
+	Status   int    `json:"status"`
+	BodyHash string `json:"body_hash"`
+	Names    int    `json:"names"`
+	Demoted  int    `json:"demoted"`
+}
+
+// edgeKey is one answer of one address.
+type edgeKey struct {
+	ip     string
+	status int
+	hash   string
+}
+
+// edgeTracker is Scanner.EdgeThreshold. It is used by the collector only.
+// A nil edgeTracker marks nothing.
+type edgeTracker struct {
+	threshold int
+	// names holds, for each answer, the first threshold names that got
+	// it, and more counts the names after them
+	names map[edgeKey]map[string]struct{}
+	more  map[edgeKey]int
+}
+
+func newEdgeTracker(threshold int) *edgeTracker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &edgeTracker{threshold: threshold, names: map[edgeKey]map[string]struct{}{}, more: map[edgeKey]int{}}
+}
+
+// observe counts the answer of r and marks r Result.EdgeDefault when
+// threshold other names got it from the same address before. Root names
+// and answers that already say nothing about the name (Soft404) are left
+// alone, and a name seen before, for another path, keeps its class.
+func (t *edgeTracker) observe(r *Result) {
+	if t == nil || r.IP == "" || r.BodyHash == "" || r.Source == SourceRoot || r.Soft404 || Classify(r.Status) != ClassLive {
+		return
+	}
+	k := edgeKey{r.IP, r.Status, r.BodyHash}
+	seen := t.names[k]
+	if seen == nil {
+		seen = map[string]struct{}{}
+		t.names[k] = seen
+	}
+	if _, ok := seen[r.Subdomain]; ok {
+		return
+	}
+	// a resumed result was marked in the earlier run
+	if len(seen) < t.threshold && !r.EdgeDefault {
+		seen[r.Subdomain] = struct{}{}
+		return
+	}
+	r.EdgeDefault = true
+	r.Class = ClassifyResult(*r)
+	t.more[k]++
+}
+
+// EdgeSaturated returns the addresses of the last Run that EdgeThreshold
+// caught, the most demoted results first. It is valid once the result
+// channel is closed.
+func (s *Scanner) EdgeSaturated() []EdgeIP {
+	if s.edges == nil {
+		return nil
+	}
+	var out []EdgeIP
+	for k, n := range s.edges.more {
+		out = append(out, EdgeIP{IP: k.ip, Status: k.status, BodyHash: k.hash, Names: len(s.edges.names[k]) + n, Demoted: n})
+	}
+	slices.SortFunc(out, func(a, b EdgeIP) int {
+		return cmp.Or(b.Demoted-a.Demoted, cmp.Compare(a.IP, b.IP), a.Status-b.Status, cmp.Compare(a.BodyHash, b.BodyHash))
+	})
+	return out
+}
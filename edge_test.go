@@ -0,0 +1,88 @@
+package sublive
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestEdgeTracker(t *testing.T) {
+	tr := newEdgeTracker(2)
+	page := func(name, ip string, status int, hash string) *Result {
+		r := &Result{Subdomain: name, IP: ip, Status: status, BodyHash: hash}
+		r.Class = ClassifyResult(*r)
+		return r
+	}
+	tests := []struct {
+		r    *Result
+		want bool
+	}{
+		{page("a.example.com", "192.0.2.1", 200, "h1"), false},
+		{page("b.example.com", "192.0.2.1", 200, "h1"), false},
+		// the same name again, as a retry would give it, stays as it was
+		{page("a.example.com", "192.0.2.1", 200, "h1"), false},
+		{page("c.example.com", "192.0.2.1", 200, "h1"), true},
+		// another body, status or address is another answer
+		{page("d.example.com", "192.0.2.1", 200, "h2"), false},
+		{page("e.example.com", "192.0.2.1", 204, "h1"), false},
+		{page("f.example.com", "192.0.2.2", 200, "h1"), false},
+		{page("g.example.com", "192.0.2.1", 200, "h1"), true},
+		// answers that say nothing about the name are not counted
+		{page("x.example.com", "192.0.2.1", 404, "h1"), false},
+		{&Result{Subdomain: "example.com", IP: "192.0.2.1", Status: 200, BodyHash: "h1", Source: SourceRoot}, false},
+		{&Result{Subdomain: "s.example.com", IP: "192.0.2.1", Status: 200, BodyHash: "h1", Soft404: true}, false},
+		{page("n.example.com", "192.0.2.1", 200, ""), false},
+	}
+	for _, tt := range tests {
+		tr.observe(tt.r)
+		if tt.r.EdgeDefault != tt.want {
+			t.Errorf("%s %s %d %s: edge default %v, want %v", tt.r.Subdomain, tt.r.IP, tt.r.Status, tt.r.BodyHash, tt.r.EdgeDefault, tt.want)
+		}
+		if tt.want && tt.r.Class != ClassEdgeDefault {
+			t.Errorf("%s: class %s", tt.r.Subdomain, tt.r.Class)
+		}
+	}
+	s := &Scanner{edges: tr}
+	want := []EdgeIP{{IP: "192.0.2.1", Status: 200, BodyHash: "h1", Names: 4, Demoted: 2}}
+	if got := s.EdgeSaturated(); !slices.Equal(got, want) {
+		t.Errorf("EdgeSaturated = %+v, want %+v", got, want)
+	}
+	var nilTracker *edgeTracker
+	r := page("a.example.com", "192.0.2.1", 200, "h1")
+	nilTracker.observe(r)
+	if r.EdgeDefault || newEdgeTracker(0) != nil {
+		t.Error("a tracker without a threshold marked a result")
+	}
+}
+
+func TestRunEdge(t *testing.T) {
+	// every name but own gets the edge's page from one address
+	var words, names []string
+	pages := map[string]fakePage{}
+	for i := range 6 {
+		name := fmt.Sprintf("h%d.example.com", i)
+		words, names = append(words, fmt.Sprintf("h%d", i)), append(names, name)
+		pages[name] = fakePage{status: 200, body: "<title>Welcome</title>"}
+	}
+	words, names = append(words, "own"), append(names, "own.example.com")
+	pages["own.example.com"] = fakePage{status: 200, body: "<title>Own app</title>"}
+	s := &Scanner{Domains: []string{"example.com"}, Words: words, EdgeThreshold: 3, Workers: 1, NoBackoff: true, Resolver: &fakeResolver{answers: resolves("192.0.2.50", names...)}, Prober: &fakeProber{pages: pages}}
+	got := runScan(t, s)
+	demoted := 0
+	for _, r := range got {
+		if r.EdgeDefault {
+			demoted++
+			// the raw answer is kept for a look offline
+			if r.Status != 200 || r.BodyHash == "" || r.Class != ClassEdgeDefault || s.countsLive(r) {
+				t.Errorf("%s: status %d hash %q class %s", r.Subdomain, r.Status, r.BodyHash, r.Class)
+			}
+		}
+	}
+	if r := got["own.example.com"]; r.EdgeDefault || r.Class != ClassLive {
+		t.Errorf("own.example.com: edge default %v class %s", r.EdgeDefault, r.Class)
+	}
+	edges := s.EdgeSaturated()
+	if demoted != 3 || len(edges) != 1 || edges[0].IP != "192.0.2.50" || edges[0].Names != 6 || edges[0].Demoted != 3 {
+		t.Errorf("%d demoted, saturated %+v", demoted, edges)
+	}
+}
@@ -0,0 +1,611 @@
+package sublive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeResolver answers from a table; names missing from it don't exist.
+// It records every name it was asked for.
+type fakeResolver struct {
+	answers map[string]ResolveResult
+	errs    map[string]error
+
+	mu    sync.Mutex
+	asked []string
+}
+
+func (f *fakeResolver) Resolve(ctx context.Context, host string) (ResolveResult, error) {
+	f.mu.Lock()
+	f.asked = append(f.asked, host)
+	f.mu.Unlock()
+	res, ok := f.answers[host]
+	if err := f.errs[host]; err != nil {
+		return res, err
+	}
+	if !ok || len(res.IPs) == 0 {
+		return res, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return res, nil
+}
+
+// fakePage is the answer of a host to fakeProber.
+// The answer comes from ip, the first address of the target when empty,
+// after delay and once wait, when set, is closed.
+type fakePage struct {
+	status int
+	body   string
+	header http.Header
+	ip     string
+	delay  time.Duration
+	wait   <-chan struct{}
+}
+
+// fakeProber answers every target with the page of its host over the
+// first scheme; hosts missing from pages fail with their error in errs,
+// or refuse the connection. It counts the probes of every host.
+type fakeProber struct {
+	pages map[string]fakePage
+	errs  map[string]error
+
+	mu     sync.Mutex
+	probed map[string]int
+}
+
+func (f *fakeProber) Probe(ctx context.Context, target ProbeTarget) (ProbeResult, error) {
+	f.mu.Lock()
+	if f.probed == nil {
+		f.probed = map[string]int{}
+	}
+	f.probed[target.Host]++
+	f.mu.Unlock()
+	var pr ProbeResult
+	page, ok := f.pages[target.Host]
+	if !ok || len(target.Schemes) == 0 {
+		err := f.errs[target.Host]
+		if err == nil {
+			err = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		}
+		for _, scheme := range target.Schemes {
+			pr.Attempts = append(pr.Attempts, newAttempt(scheme, 0, err, 0))
+			pr.Errors = append(pr.Errors, err)
+		}
+		return pr, err
+	}
+	select {
+	case <-time.After(page.delay):
+	case <-ctx.Done():
+		return pr, ctx.Err()
+	}
+	if page.wait != nil {
+		select {
+		case <-page.wait:
+		case <-ctx.Done():
+			return pr, ctx.Err()
+		}
+	}
+	header := page.header
+	if header == nil {
+		header = http.Header{}
+	}
+	scheme := target.Schemes[0]
+	pr.Response = &http.Response{
+		StatusCode: page.status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(page.body)),
+	}
+	pr.Scheme, pr.Path, pr.IP = scheme, target.paths()[0], page.ip
+	if pr.IP == "" {
+		pr.IP = target.IPs[0]
+	}
+	pr.Attempts = []ProbeAttempt{newAttempt(scheme, page.status, nil, 0)}
+	pr.Errors = []error{nil}
+	return pr, nil
+}
+
+// probes returns how many times host was probed.
+func (f *fakeProber) probes(host string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.probed[host]
+}
+
+// resolves returns a ResolveResult of ip for every name.
+func resolves(ip string, names ...string) map[string]ResolveResult {
+	m := make(map[string]ResolveResult, len(names))
+	for _, n := range names {
+		m[n] = ResolveResult{IPs: []string{ip}}
+	}
+	return m
+}
+
+// serveAll returns a client whose every connection goes to a test server
+// running h, whatever the host, redirects followed the way the default
+// client does, for when a check needs real HTTP.
+func serveAll(t *testing.T, h http.Handler) *http.Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	addr := srv.Listener.Addr().String()
+	var d net.Dialer
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, network, addr)
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: checkRedirect,
+		Timeout:       5 * time.Second,
+	}
+}
+
+// fakeDNS is a UDP nameserver answering A queries from a table of names,
+// without the trailing dot: a name with no addresses has no A record, and
+// names missing from it don't exist. It counts the queries of every name.
+type fakeDNS struct {
+	addr    string
+	answers map[string][]string
+
+	mu    sync.Mutex
+	asked map[string]int
+}
+
+// serveDNS starts a fakeDNS on a local port until the end of the test.
+func serveDNS(t testing.TB, answers map[string][]string) *fakeDNS {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	// room for the bursts of the mass resolver
+	conn.(*net.UDPConn).SetReadBuffer(8 << 20)
+	f := &fakeDNS{addr: conn.LocalAddr().String(), answers: answers, asked: map[string]int{}}
+	for range 4 {
+		go func() {
+			buf := make([]byte, 512)
+			for {
+				n, from, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				if rsp := f.answer(buf[:n]); rsp != nil {
+					conn.WriteTo(rsp, from)
+				}
+			}
+		}()
+	}
+	return f
+}
+
+func (f *fakeDNS) answer(req []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(req)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	name := strings.ToLower(strings.TrimSuffix(q.Name.String(), "."))
+	f.mu.Lock()
+	f.asked[name]++
+	f.mu.Unlock()
+	ips, ok := f.answers[name]
+	rh := dnsmessage.Header{ID: h.ID, Response: true, RecursionDesired: h.RecursionDesired, RecursionAvailable: true}
+	if !ok {
+		rh.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, rh)
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	for _, ip := range ips {
+		if q.Type == dnsmessage.TypeA {
+			a := netip.MustParseAddr(ip).As4()
+			b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: a})
+		}
+	}
+	rsp, _ := b.Finish()
+	return rsp
+}
+
+// queries returns how many times name was asked for.
+func (f *fakeDNS) queries(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.asked[name]
+}
+
+// runScan runs s to the end and returns its results by name, failing the
+// test when a name is reported twice.
+func runScan(t *testing.T, s *Scanner) map[string]Result {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	ch, err := s.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	got := map[string]Result{}
+	for r := range ch {
+		if _, ok := got[r.Subdomain]; ok {
+			t.Errorf("%s reported twice", r.Subdomain)
+		}
+		got[r.Subdomain] = r
+	}
+	if ctx.Err() != nil {
+		t.Fatal("scan did not finish")
+	}
+	return got
+}
+
+func TestRunClassifies(t *testing.T) {
+	tests := []struct {
+		word   string
+		page   *fakePage
+		dns    bool
+		status int
+		class  Class
+	}{
+		{"ok", &fakePage{status: 200}, true, 200, ClassLive},
+		{"created", &fakePage{status: 204}, true, 204, ClassLive},
+		{"moved", &fakePage{status: 301}, true, 301, ClassRedirect},
+		{"temp", &fakePage{status: 307}, true, 307, ClassRedirect},
+		{"login", &fakePage{status: 401}, true, 401, ClassAuth},
+		{"forbidden", &fakePage{status: 403}, true, 403, ClassAuth},
+		{"missing", &fakePage{status: 404}, true, 404, ClassClientError},
+		{"broken", &fakePage{status: 502}, true, 502, ClassServerError},
+		{"odd", &fakePage{status: 999}, true, 999, ClassOther},
+		{"closed", nil, true, 0, ClassNoHTTP},
+		{"gone", nil, false, 0, ClassNoDNS},
+	}
+	res := &fakeResolver{answers: map[string]ResolveResult{}}
+	prb := &fakeProber{pages: map[string]fakePage{}}
+	var words []string
+	for _, tt := range tests {
+		name := tt.word + ".example.com"
+		words = append(words, tt.word)
+		if tt.dns {
+			res.answers[name] = ResolveResult{IPs: []string{"192.0.2.10"}}
+		}
+		if tt.page != nil {
+			prb.pages[name] = *tt.page
+		}
+	}
+	got := runScan(t, &Scanner{Domains: []string{"example.com"}, Words: words, Resolver: res, Prober: prb, NoBackoff: true})
+	if len(got) != len(tests) {
+		t.Errorf("got %d results, want %d", len(got), len(tests))
+	}
+	for _, tt := range tests {
+		r, ok := got[tt.word+".example.com"]
+		if !ok {
+			t.Errorf("%s: no result", tt.word)
+			continue
+		}
+		if r.Status != tt.status || r.Class != tt.class {
+			t.Errorf("%s: status %d class %s, want %d %s", tt.word, r.Status, r.Class, tt.status, tt.class)
+		}
+		if r.Source != SourceWordlist || r.Domain != "example.com" {
+			t.Errorf("%s: source %q domain %q", tt.word, r.Source, r.Domain)
+		}
+	}
+	if r := got["closed.example.com"]; r.Reason != ReasonRefused || r.IP != "192.0.2.10" {
+		t.Errorf("closed: reason %q ip %q, want %s with its address", r.Reason, r.IP, ReasonRefused)
+	}
+	if r := got["gone.example.com"]; r.Reason != ReasonNXDOMAIN || r.IP != "" {
+		t.Errorf("gone: reason %q ip %q, want %s without address", r.Reason, r.IP, ReasonNXDOMAIN)
+	}
+	if n := prb.probes("gone.example.com"); n != 0 {
+		t.Errorf("a name that didn't resolve was probed %d times", n)
+	}
+}
+
+func TestRunDedups(t *testing.T) {
+	names := []string{"www.example.com", "api.example.com", "api-dev.example.com", "dev-api.example.com", "api2.example.com"}
+	tests := []struct {
+		name  string
+		scan  *Scanner
+		probe []string
+	}{
+		{
+			name:  "repeated words",
+			scan:  &Scanner{Words: []string{"www", "api", "WWW", "api", "www"}},
+			probe: []string{"www.example.com", "api.example.com"},
+		},
+		{
+			name: "seeds overlapping words",
+			scan: &Scanner{Words: []string{"api"}, Seeds: []Candidate{
+				{Name: "api.example.com", Domain: "example.com", Source: SourceCT},
+				{Name: "www.example.com", Domain: "example.com", Source: SourceCT},
+				{Name: "www.example.com", Domain: "example.com", Source: SourceCT},
+			}},
+			probe: []string{"api.example.com", "www.example.com"},
+		},
+		{
+			// api-dev is a word, a permutation of api and in its CNAME chain
+			name:  "deep mode paths",
+			scan:  &Scanner{Words: []string{"api", "api-dev"}, Deep: true, Depth: 2, Permutations: mustPerms(t, "{sub}-dev")},
+			probe: []string{"api.example.com", "api-dev.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prb := &fakeProber{pages: map[string]fakePage{}}
+			for _, n := range names {
+				prb.pages[n] = fakePage{status: 200}
+			}
+			s := tt.scan
+			res := &fakeResolver{answers: resolves("192.0.2.20", names...)}
+			res.answers["api.example.com"] = ResolveResult{IPs: []string{"192.0.2.20"}, CNAMEs: []string{"api-dev.example.com"}}
+			s.Domains, s.Resolver, s.Prober, s.Workers = []string{"example.com"}, res, prb, 8
+			got := runScan(t, s)
+			for _, n := range tt.probe {
+				if _, ok := got[n]; !ok {
+					t.Errorf("no result for %s", n)
+				}
+				if c := prb.probes(n); c != 1 {
+					t.Errorf("%s probed %d times, want once", n, c)
+				}
+			}
+		})
+	}
+}
+
+func TestRunNeverTwice(t *testing.T) {
+	// every web<n> is live, so each one's numbered siblings, permutations
+	// and CNAME target overlap with those of the others and with the seeds
+	res := &fakeResolver{answers: map[string]ResolveResult{}}
+	prb := &fakeProber{pages: map[string]fakePage{}}
+	var seeds []Candidate
+	for i := range 10 {
+		for _, n := range []string{fmt.Sprintf("web%d.example.com", i), fmt.Sprintf("web%d-dev.example.com", i), fmt.Sprintf("web%02d.example.com", i)} {
+			res.answers[n] = ResolveResult{IPs: []string{"192.0.2.25"}, CNAMEs: []string{"lb.example.com"}}
+			prb.pages[n] = fakePage{status: 200}
+			seeds = append(seeds, Candidate{Name: n, Domain: "example.com", Source: SourceCT})
+		}
+	}
+	res.answers["lb.example.com"] = ResolveResult{IPs: []string{"192.0.2.25"}}
+	prb.pages["lb.example.com"] = fakePage{status: 200}
+	s := &Scanner{Domains: []string{"example.com"}, Words: []string{"web1", "web2", "lb"}, Seeds: seeds, Deep: true, Depth: 3, AltNumbers: true, AltLimit: 9, AltMisses: 3, Permutations: mustPerms(t, "{sub}-dev"), Workers: 16, Resolver: res, Prober: prb}
+	got := runScan(t, s)
+	if len(got) < len(seeds) {
+		t.Errorf("%d results for %d seeds", len(got), len(seeds))
+	}
+	prb.mu.Lock()
+	defer prb.mu.Unlock()
+	for n, c := range prb.probed {
+		if c != 1 {
+			t.Errorf("%s probed %d times", n, c)
+		}
+	}
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	asked := map[string]int{}
+	for _, n := range res.asked {
+		if asked[n]++; asked[n] == 2 {
+			t.Errorf("%s resolved twice", n)
+		}
+	}
+}
+
+func TestRunDeepPublicSuffix(t *testing.T) {
+	// a probe-style seed gets its registrable domain: the permutations
+	// stay under example.co.uk rather than treating example as a label
+	domain, err := RegistrableDomain("admin.example.co.uk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"admin.example.co.uk", "admin-dev.example.co.uk", "admin-dev.co.uk"}
+	prb := &fakeProber{pages: map[string]fakePage{"admin.example.co.uk": {status: 200}, "admin-dev.example.co.uk": {status: 200}}}
+	s := &Scanner{Seeds: []Candidate{{Name: "admin.example.co.uk", Domain: domain, Source: SourceInput}}, Deep: true, Depth: 1, Permutations: mustPerms(t, "{sub}-dev"), Resolver: &fakeResolver{answers: resolves("192.0.2.16", names...)}, Prober: prb}
+	got := runScan(t, s)
+	if r, ok := got["admin-dev.example.co.uk"]; !ok || r.Domain != "example.co.uk" || r.Source != SourcePermutation {
+		t.Errorf("admin-dev.example.co.uk: %+v", r)
+	}
+	if prb.probes("admin-dev.co.uk") != 0 {
+		t.Error("permuted above the registrable domain")
+	}
+}
+
+func TestRunRoot(t *testing.T) {
+	names := []string{"example.com", "www.example.com", "api.example.com"}
+	ct := func(names ...string) []Candidate {
+		var cs []Candidate
+		for _, n := range names {
+			cs = append(cs, Candidate{Name: n, Domain: "example.com", Source: SourceCT})
+		}
+		return cs
+	}
+	tests := []struct {
+		name  string
+		words []string
+		seeds []Candidate
+		// want are the sources of the names probed, each once
+		want map[string]string
+	}{
+		{"empty and www words", []string{"", "www", "api", "www", ""}, nil, map[string]string{"example.com": SourceRoot, "www.example.com": SourceWordlist, "api.example.com": SourceWordlist}},
+		{"root and www seeds", []string{"api"}, ct("example.com", "www.example.com"), map[string]string{"example.com": SourceRoot, "www.example.com": SourceCT, "api.example.com": SourceWordlist}},
+		// -ct-only and -axfr-only have no wordlist: no www unless found
+		{"no wordlist", nil, ct("api.example.com"), map[string]string{"example.com": SourceRoot, "api.example.com": SourceCT}},
+		{"no wordlist, www found", nil, ct("api.example.com", "www.example.com"), map[string]string{"example.com": SourceRoot, "www.example.com": SourceCT, "api.example.com": SourceCT}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prb := &fakeProber{pages: map[string]fakePage{}}
+			for _, n := range names {
+				prb.pages[n] = fakePage{status: 200}
+			}
+			// deep mode must not permute the root as if it were a label; the
+			// loopback address keeps the certificate fetch of the root short
+			s := &Scanner{Domains: []string{"example.com"}, Words: tt.words, Seeds: tt.seeds, ProbeRoot: true, Deep: true, Depth: 1, Permutations: mustPerms(t, "{sub}-dev"), ProbeInternal: true, Resolver: &fakeResolver{answers: resolves("127.0.0.1", names...)}, Prober: prb}
+			got := runScan(t, s)
+			for _, n := range names {
+				want := 0
+				if _, ok := tt.want[n]; ok {
+					want = 1
+				}
+				if c := prb.probes(n); c != want {
+					t.Errorf("%s probed %d times, want %d", n, c, want)
+				}
+				if r, ok := got[n]; ok && r.Source != tt.want[n] {
+					t.Errorf("%s source %q, want %q", n, r.Source, tt.want[n])
+				}
+			}
+			if _, ok := got["example-dev.example.com"]; ok {
+				t.Error("the root was permuted")
+			}
+		})
+	}
+}
+
+func TestRunDeep(t *testing.T) {
+	res := &fakeResolver{answers: resolves("192.0.2.30", "app.example.com", "app-dev.example.com", "app-dev-dev.example.com", "app-dev-dev-dev.example.com")}
+	prb := &fakeProber{pages: map[string]fakePage{"app.example.com": {status: 200}, "app-dev.example.com": {status: 200}, "app-dev-dev.example.com": {status: 302}, "app-dev-dev-dev.example.com": {status: 200}}}
+	for _, tt := range []struct {
+		depth int
+		want  map[string]int
+	}{
+		{0, map[string]int{"app.example.com": 0}},
+		{1, map[string]int{"app.example.com": 0, "app-dev.example.com": 1}},
+		{3, map[string]int{"app.example.com": 0, "app-dev.example.com": 1, "app-dev-dev.example.com": 2, "app-dev-dev-dev.example.com": 3}},
+	} {
+		s := &Scanner{Domains: []string{"example.com"}, Words: []string{"app"}, Deep: true, Depth: tt.depth, Permutations: mustPerms(t, "{sub}-dev"), Resolver: res, Prober: prb}
+		got := runScan(t, s)
+		if len(got) != len(tt.want) {
+			t.Errorf("depth %d: %d results, want %d", tt.depth, len(got), len(tt.want))
+		}
+		for name, depth := range tt.want {
+			r, ok := got[name]
+			switch {
+			case !ok:
+				t.Errorf("depth %d: no result for %s", tt.depth, name)
+			case r.Depth != depth:
+				t.Errorf("depth %d: %s at depth %d, want %d", tt.depth, name, r.Depth, depth)
+			case depth > 0 && r.Source != SourcePermutation:
+				t.Errorf("depth %d: %s from %q, want %s", tt.depth, name, r.Source, SourcePermutation)
+			}
+		}
+	}
+}
+
+func TestRunCNAME(t *testing.T) {
+	res := &fakeResolver{
+		answers: map[string]ResolveResult{
+			"shop.example.com":    {IPs: []string{"192.0.2.40"}, CNAMEs: []string{"shop-lb.example.com", "shop.edge.example.net"}},
+			"shop-lb.example.com": {IPs: []string{"192.0.2.40"}, CNAMEs: []string{"shop.edge.example.net"}},
+			"old.example.com":     {CNAMEs: []string{"old-app.herokuapp.example.org"}},
+		},
+	}
+	prb := &fakeProber{pages: map[string]fakePage{"shop.example.com": {status: 200}, "shop-lb.example.com": {status: 200}}}
+	tests := []struct {
+		name   string
+		deep   bool
+		cnames []string
+		class  Class
+		source string
+	}{
+		{"shop.example.com", false, []string{"shop-lb.example.com", "shop.edge.example.net"}, ClassLive, SourceWordlist},
+		// a dangling CNAME keeps its chain
+		{"old.example.com", false, []string{"old-app.herokuapp.example.org"}, ClassNoDNS, SourceWordlist},
+		// in deep mode the in-domain names of the chain are scanned, the
+		// others aren't
+		{"shop-lb.example.com", true, []string{"shop.edge.example.net"}, ClassLive, SourceCNAME},
+	}
+	for _, deep := range []bool{false, true} {
+		got := runScan(t, &Scanner{Domains: []string{"example.com"}, Words: []string{"shop", "old"}, Deep: deep, Permutations: []PermPattern{}, Resolver: res, Prober: prb})
+		if _, ok := got["shop.edge.example.net"]; ok {
+			t.Errorf("deep %v: out-of-domain CNAME target scanned", deep)
+		}
+		for _, tt := range tests {
+			r, ok := got[tt.name]
+			switch {
+			case tt.deep && !deep:
+				if ok {
+					t.Errorf("deep %v: %s scanned", deep, tt.name)
+				}
+			case !ok:
+				t.Errorf("deep %v: no result for %s", deep, tt.name)
+			case !slices.Equal(r.CNAMEs, tt.cnames) || r.Class != tt.class || r.Source != tt.source:
+				t.Errorf("deep %v: %s: cnames %v class %s source %s, want %v %s %s", deep, tt.name, r.CNAMEs, r.Class, r.Source, tt.cnames, tt.class, tt.source)
+			}
+		}
+	}
+}
+
+func TestRunWildcard(t *testing.T) {
+	names := []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"}
+	// a wildcard record behind one CDN name, answering every host and
+	// path with the same page, but for a real app on d
+	res := &fakeResolver{answers: map[string]ResolveResult{}}
+	for _, n := range names {
+		res.answers[n] = ResolveResult{IPs: []string{"192.0.2.50"}, CNAMEs: []string{"catchall.cdn.example.net"}}
+	}
+	res.answers["d.example.com"] = ResolveResult{IPs: []string{"192.0.2.51"}}
+	client := serveAll(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "d.example.com" && r.URL.Path == "/" {
+			io.WriteString(w, "<html><title>Dashboard</title>real app</html>")
+			return
+		}
+		if r.Host == "d.example.com" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "<html><title>Parked</title>this domain is parked</html>")
+	}))
+	tests := []struct {
+		name     string
+		collapse bool
+	}{
+		{"soft-404", false},
+		{"collapsed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runScan(t, &Scanner{Domains: []string{"example.com"}, Words: []string{"a", "b", "c", "d"}, Soft404: true, CollapseCNAME: tt.collapse, Client: client, Resolver: res, NoBackoff: true})
+			inherited := 0
+			for _, n := range names[:3] {
+				r := got[n]
+				if r.Status != 200 || !r.Soft404 || r.Class != ClassSoft404 {
+					t.Errorf("%s: status %d soft404 %v class %s, want a soft-404 200", n, r.Status, r.Soft404, r.Class)
+				}
+				if r.Inherited {
+					inherited++
+				}
+			}
+			if want := map[bool]int{false: 0, true: 2}[tt.collapse]; inherited != want {
+				t.Errorf("%d names inherited the catch-all answer, want %d", inherited, want)
+			}
+			if r := got["d.example.com"]; r.Soft404 || r.Class != ClassLive {
+				t.Errorf("d: soft404 %v class %s, want live", r.Soft404, r.Class)
+			}
+		})
+	}
+}
+
+// mustPerms compiles permutation patterns.
+func mustPerms(t *testing.T, lines ...string) []PermPattern {
+	t.Helper()
+	pats, rejected := CompilePermPatterns(lines)
+	if len(rejected) > 0 {
+		t.Fatalf("rejected patterns %v", rejected)
+	}
+	return pats
+}
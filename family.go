@@ -0,0 +1,95 @@
+package sublive
+
+import (
+	"context"
+	"net"
+	"net/netip"
+)
+
+// Address families of Result.Family.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+	// FamilyDual is a name with addresses of both families.
+	FamilyDual = "dual"
+)
+
+// Families lists the address families, in the order the CLI prints them.
+var Families = []string{FamilyIPv4, FamilyIPv6, FamilyDual}
+
+// AddressFamily returns the family of ips: FamilyIPv4 or FamilyIPv6 when
+// they are all of one, FamilyDual when there are both and "" for none.
+func AddressFamily(ips []string) string {
+	v4, v6 := splitFamilies(ips)
+	switch {
+	case len(v4) > 0 && len(v6) > 0:
+		return FamilyDual
+	case len(v4) > 0:
+		return FamilyIPv4
+	case len(v6) > 0:
+		return FamilyIPv6
+	}
+	return ""
+}
+
+// splitFamilies returns the IPv4 and the IPv6 addresses of ips, in order.
+// IPv4-mapped IPv6 addresses count as IPv4.
+func splitFamilies(ips []string) (v4, v6 []string) {
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			continue
+		}
+		if addr.Unmap().Is4() {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	return v4, v6
+}
+
+// ipv6Probe is a public IPv6 address whose route HasIPv6 looks up.
+const ipv6Probe = "[2001:4860:4860::8888]:53"
+
+// HasIPv6 reports whether this machine has a route to IPv6 addresses on the
+// internet, without sending anything: connecting a UDP socket only
+// consults the routing table.
+func HasIPv6() bool {
+	conn, err := (&net.Dialer{}).DialContext(context.Background(), "udp6", ipv6Probe)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// familyStatus probes a dual-stack name over each family on its own for
+// Scanner.ProbeBothFamilies and returns the status each got, 0 for none.
+// The family of used, the address the probe of check answered from, keeps
+// that status without another request.
+func (p *probe) familyStatus(ctx context.Context, pin *pinned, pt ProbeTarget, used string, status int) map[string]int {
+	v4, v6 := splitFamilies(pt.IPs)
+	out := map[string]int{}
+	for _, fam := range []struct {
+		name string
+		ips  []string
+	}{{FamilyIPv4, v4}, {FamilyIPv6, v6}} {
+		if used != "" && AddressFamily([]string{used}) == fam.name {
+			out[fam.name] = status
+			continue
+		}
+		fpin := &pinned{host: pin.host, ips: fam.ips, sni: pin.sni}
+		fctx := context.WithValue(context.WithValue(ctx, pinnedKey{}, fpin), harvestKey{}, &redirectHarvest{})
+		target := pt
+		target.IPs = fam.ips
+		pr, _ := p.prober.Probe(fctx, target)
+		if pr.Response != nil {
+			out[fam.name] = pr.Response.StatusCode
+			pr.Response.Body.Close()
+		} else {
+			out[fam.name] = 0
+		}
+	}
+	return out
+}
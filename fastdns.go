@@ -0,0 +1,384 @@
+package sublive
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Fast DNS parameters: queries share massSockets UDP sockets, at most
+// massInflight are outstanding, and each is tried massTries times with
+// massTimeout per try, moving to the next resolver every time.
+const (
+	massSockets  = 8
+	massInflight = 2000
+	massTries    = 3
+	massTimeout  = 2 * time.Second
+)
+
+// errMassTimeout is the error of a name no resolver answered for, and
+// errMassRefused and errMassServfail those of a name the last resolver
+// tried answered with REFUSED (or another error code) or SERVFAIL.
+var (
+	errMassTimeout  = errors.New("no answer from any resolver")
+	errMassRefused  = errors.New("REFUSED by the resolvers")
+	errMassServfail = errors.New("SERVFAIL from the resolvers")
+)
+
+// massAnswer is the outcome of one mass lookup. nxdomain is set when a
+// resolver said the name doesn't exist; err when no usable answer came.
+type massAnswer struct {
+	ips      []string
+	cnames   []string
+	nxdomain bool
+	err      error
+	// retried counts the tries after a REFUSED or SERVFAIL answer
+	retried int
+}
+
+// massResolver resolves many names over a few shared UDP sockets, the way
+// massdns does: answers are matched to queries by ID, the number in flight
+// is capped, every resolver has its own rate limit, and queries that time
+// out or get SERVFAIL or REFUSED are retried on the next resolver.
+type massResolver struct {
+	servers  []*massServer
+	socks    []*massSocket
+	inflight chan struct{}
+}
+
+// massServer is one resolver with its rate limit: queries are spaced at
+// least interval apart.
+type massServer struct {
+	addr     *net.UDPAddr
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+// wait blocks until the server may be sent the next query.
+func (s *massServer) wait(ctx context.Context) bool {
+	if s.interval <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	now := time.Now()
+	at := s.next
+	if at.Before(now) {
+		at = now
+	}
+	s.next = at.Add(s.interval)
+	s.mu.Unlock()
+	return sleep(ctx, time.Until(at))
+}
+
+// massSocket is an unconnected UDP socket, bound to src when that is set,
+// with the queries waiting for an answer on it, by ID.
+type massSocket struct {
+	conn    *net.UDPConn
+	src     *sourceAddr
+	mu      sync.Mutex
+	id      uint16
+	pending map[uint16]chan []byte
+}
+
+func (s *massSocket) register() (uint16, chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		s.id++
+		if _, used := s.pending[s.id]; !used {
+			break
+		}
+	}
+	ch := make(chan []byte, 1)
+	s.pending[s.id] = ch
+	return s.id, ch
+}
+
+func (s *massSocket) unregister(id uint16) {
+	s.mu.Lock()
+	delete(s.pending, id)
+	s.mu.Unlock()
+}
+
+// read delivers answers until the socket is closed. Unknown IDs are late
+// answers to queries that already timed out.
+func (s *massSocket) read() {
+	buf := make([]byte, 65535)
+	for {
+		n, err := s.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n < 12 {
+			continue
+		}
+		id := uint16(buf[0])<<8 | uint16(buf[1])
+		s.mu.Lock()
+		ch := s.pending[id]
+		delete(s.pending, id)
+		s.mu.Unlock()
+		if ch != nil {
+			ch <- append([]byte(nil), buf[:n]...)
+		}
+	}
+}
+
+// newMassResolver opens the sockets for servers (host:port). rate is the
+// query limit per second and resolver; 0 means unlimited. With srcs the
+// sockets are spread over its addresses.
+func newMassResolver(servers []string, rate int, srcs *sources) (*massResolver, error) {
+	m := &massResolver{inflight: make(chan struct{}, massInflight)}
+	for _, srv := range servers {
+		addr, err := net.ResolveUDPAddr("udp", srv)
+		if err != nil {
+			return nil, err
+		}
+		ms := &massServer{addr: addr}
+		if rate > 0 {
+			ms.interval = time.Second / time.Duration(rate)
+		}
+		m.servers = append(m.servers, ms)
+	}
+	if len(m.servers) == 0 {
+		return nil, errors.New("sublive: no resolvers for fast DNS")
+	}
+	// with source addresses the sockets are bound to those that can
+	// reach every server, in turn
+	var bind []*sourceAddr
+	if srcs != nil {
+		for _, src := range srcs.addrs {
+			if !slices.ContainsFunc(m.servers, func(ms *massServer) bool { return !sameFamily(ms.addr.IP, src.ip) }) {
+				bind = append(bind, src)
+			}
+		}
+		if len(bind) == 0 {
+			return nil, errors.New("sublive: no source address of the family of every fast DNS resolver")
+		}
+	}
+	for i := 0; i < massSockets; i++ {
+		var src *sourceAddr
+		var local *net.UDPAddr
+		if len(bind) > 0 {
+			src = bind[i%len(bind)]
+			local = &net.UDPAddr{IP: src.ip}
+		}
+		conn, err := net.ListenUDP("udp", local)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		// the default buffer drops answers to bursts of massInflight queries
+		conn.SetReadBuffer(4 << 20)
+		s := &massSocket{conn: conn, src: src, pending: map[uint16]chan []byte{}}
+		m.socks = append(m.socks, s)
+		go s.read()
+	}
+	return m, nil
+}
+
+func (m *massResolver) close() {
+	for _, s := range m.socks {
+		s.conn.Close()
+	}
+}
+
+// resolve looks up every name and calls done with each answer, from
+// several goroutines. It returns when all names are done or ctx ended;
+// names not even tried by then get no call.
+func (m *massResolver) resolve(ctx context.Context, names []string, done func(name string, a massAnswer)) {
+	var wg sync.WaitGroup
+	for i, name := range names {
+		select {
+		case m.inflight <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-m.inflight }()
+			a := m.lookup(ctx, name, m.socks[i%len(m.socks)], i)
+			if ctx.Err() == nil {
+				done(name, a)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+}
+
+// lookup sends an A query for name, starting at resolver start.
+func (m *massResolver) lookup(ctx context.Context, name string, sock *massSocket, start int) massAnswer {
+	q, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return massAnswer{err: err}
+	}
+	a := massAnswer{err: errMassTimeout}
+	retried := 0
+	for try := 0; try < massTries; try++ {
+		if try > 0 && (a.err == errMassRefused || a.err == errMassServfail) {
+			retried++
+		}
+		srv := m.servers[(start+try)%len(m.servers)]
+		if !srv.wait(ctx) {
+			return massAnswer{err: ctx.Err()}
+		}
+		id, ch := sock.register()
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+		b.StartQuestions()
+		b.Question(dnsmessage.Question{Name: q, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET})
+		msg, err := b.Finish()
+		if err != nil {
+			sock.unregister(id)
+			return massAnswer{err: err}
+		}
+		if _, err := sock.conn.WriteToUDP(msg, srv.addr); err != nil {
+			sock.unregister(id)
+			a.err = err
+			continue
+		}
+		if sock.src != nil {
+			sock.src.queries.Add(1)
+		}
+		t := time.NewTimer(massTimeout)
+		select {
+		case resp := <-ch:
+			t.Stop()
+			if got, ok := parseMassAnswer(resp, q); ok {
+				got.retried = retried
+				return got
+			}
+			// SERVFAIL, REFUSED or garbage: ask the next resolver
+			if len(resp) > 3 && resp[3]&0x0f == byte(dnsmessage.RCodeServerFailure) {
+				a.err = errMassServfail
+			} else if len(resp) > 3 && resp[3]&0x0f != 0 {
+				a.err = errMassRefused
+			}
+		case <-t.C:
+			sock.unregister(id)
+			a.err = errMassTimeout
+		case <-ctx.Done():
+			t.Stop()
+			sock.unregister(id)
+			return massAnswer{err: ctx.Err()}
+		}
+	}
+	a.retried = retried
+	return a
+}
+
+// parseMassAnswer reads the addresses and CNAME chain of an answer. ok is
+// false for answers worth retrying elsewhere.
+func parseMassAnswer(resp []byte, q dnsmessage.Name) (massAnswer, bool) {
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil || h.Truncated {
+		return massAnswer{}, false
+	}
+	question, err := p.Question()
+	if err != nil || !strings.EqualFold(question.Name.String(), q.String()) {
+		return massAnswer{}, false
+	}
+	switch h.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		// the chain up to the missing name is kept for dangling CNAMEs
+	default:
+		return massAnswer{}, false
+	}
+	p.SkipAllQuestions()
+	a := massAnswer{nxdomain: h.RCode == dnsmessage.RCodeNameError}
+	for {
+		rh, err := p.AnswerHeader()
+		if err != nil {
+			break
+		}
+		switch rh.Type {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return a, true
+			}
+			a.ips = append(a.ips, net.IP(r.A[:]).String())
+		case dnsmessage.TypeCNAME:
+			r, err := p.CNAMEResource()
+			if err != nil {
+				return a, true
+			}
+			if len(a.cnames) < maxCNAMEChain {
+				a.cnames = append(a.cnames, strings.ToLower(strings.TrimSuffix(r.CNAME.String(), ".")))
+			}
+		default:
+			p.SkipAnswer()
+		}
+	}
+	return a, true
+}
+
+// massResolve resolves cands with m, closing it when done, and returns the
+// ones that resolved, with their addresses filled in, and results for the
+// rest. Names every try of which was REFUSED or SERVFAIL are returned
+// without addresses instead, while Scanner.DNSRetries allows, for the
+// workers to look up again. left counts candidates not tried because ctx
+// ended.
+func (s *Scanner) massResolve(ctx context.Context, m *massResolver, hosts *HostCache, cands []Candidate) (resolved []Candidate, failed []Result, left int) {
+	defer m.close()
+	byName := make(map[string]Candidate, len(cands))
+	names := make([]string, 0, len(cands))
+	for _, c := range cands {
+		if _, dup := byName[c.Name]; dup || !ValidHostname(c.Name) || s.excluded(c.Name) {
+			continue
+		}
+		byName[c.Name] = c
+		names = append(names, c.Name)
+	}
+	var mu sync.Mutex
+	m.resolve(ctx, names, func(name string, a massAnswer) {
+		c := byName[name]
+		mu.Lock()
+		defer mu.Unlock()
+		atomic.AddInt64(&s.dnsRetried, int64(a.retried))
+		if len(a.ips) > 0 {
+			if a.retried > 0 {
+				atomic.AddInt64(&s.dnsRescued, 1)
+			}
+			hosts.put(name, a.ips)
+			c.ips = a.ips
+			resolved = append(resolved, c)
+			return
+		}
+		if (a.err == errMassRefused || a.err == errMassServfail) && s.dnsRetries() > 0 {
+			atomic.AddInt64(&s.dnsRetried, 1)
+			c.dnsRetry = 1
+			resolved = append(resolved, c)
+			return
+		}
+		r := Result{Subdomain: name, Unicode: DisplayName(name), Domain: c.Domain, Depth: c.Depth, Source: c.Source, CNAMEs: a.cnames, Class: ClassNoDNS, CheckedAt: time.Now().UTC()}
+		r.dnsFailed = a.err != nil
+		switch {
+		case a.err == errMassTimeout:
+			r.Reason, r.Error = ReasonTimeout, a.err.Error()
+		case a.err == errMassRefused:
+			r.Reason, r.Error = ReasonDNSRefused, a.err.Error()
+		case a.err == errMassServfail:
+			r.Reason, r.Error = ReasonServfail, a.err.Error()
+		case a.err != nil:
+			r.setFailure(a.err)
+		default:
+			r.Reason, r.Error = ReasonNXDOMAIN, "no such host"
+		}
+		failed = append(failed, r)
+	})
+	return resolved, failed, len(names) - len(resolved) - len(failed)
+}
@@ -0,0 +1,62 @@
+package sublive
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Finding tags of Result.Findings, most severe first.
+const (
+	// FindingTakeover marks a name whose CNAME chain ends outside its
+	// domain at a name that doesn't resolve, the classic dangling CNAME.
+	FindingTakeover = "takeover-candidate"
+	// FindingDanglingCloud marks a Result.DanglingCloud record.
+	FindingDanglingCloud = "dangling-cloud"
+	// FindingExpiredCert marks an HTTPS certificate that failed
+	// Scanner.TLSVerify for being expired or not yet valid.
+	FindingExpiredCert = "expired-cert"
+	// FindingInternalIP marks a public name resolving to a private
+	// address (Result.Internal).
+	FindingInternalIP = "internal-ip"
+	// FindingInterestingName marks a name matching Scanner.Interesting.
+	FindingInterestingName = "interesting-name"
+)
+
+// Findings lists every finding tag in severity order.
+var Findings = []string{FindingTakeover, FindingDanglingCloud, FindingExpiredCert, FindingInternalIP, FindingInterestingName}
+
+// DefaultInteresting is a pattern for names that tend to be worth a look:
+// admin panels, remote access, CI and monitoring.
+const DefaultInteresting = `admin|vpn|jenkins|grafana|kibana|gitlab|jira|confluence|sonar|vault|internal|staging|backup|debug`
+
+// FindingsOf returns the finding tags of r in severity order, or nil.
+// Each comes from the feature that collects its data, so a tag is only
+// possible with that feature on: CNAME chains need explicit resolvers,
+// expired certificates Scanner.TLSVerify and dangling cloud records
+// Scanner.Cloud. interesting, when not nil, is matched against the part
+// of the name left of its domain.
+func FindingsOf(r Result, interesting *regexp.Regexp) []string {
+	var out []string
+	if n := len(r.CNAMEs); n > 0 && r.IP == "" && r.Reason == ReasonNXDOMAIN && (r.Domain == "" || !InDomain(r.CNAMEs[n-1], r.Domain)) {
+		out = append(out, FindingTakeover)
+	}
+	if r.DanglingCloud != "" {
+		out = append(out, FindingDanglingCloud)
+	}
+	if strings.Contains(r.TLSError, "expired") {
+		out = append(out, FindingExpiredCert)
+	}
+	if r.Internal {
+		out = append(out, FindingInternalIP)
+	}
+	if interesting != nil {
+		label := r.Subdomain
+		if r.Domain != "" && r.Subdomain != r.Domain {
+			label = strings.TrimSuffix(r.Subdomain, "."+r.Domain)
+		}
+		if r.Subdomain != r.Domain && interesting.MatchString(label) {
+			out = append(out, FindingInterestingName)
+		}
+	}
+	return out
+}
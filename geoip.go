@@ -0,0 +1,72 @@
+package sublive
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoInfo is the location of an address as far as the database knows it.
+type GeoInfo struct {
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+	Org     string `json:"org,omitempty"`
+}
+
+// GeoDB looks up addresses in a MaxMind database (GeoLite2/GeoIP2 City,
+// Country or ASN). Answers are cached per IP since many subdomains share
+// addresses. A GeoDB is safe for concurrent use.
+type GeoDB struct {
+	db    *maxminddb.Reader
+	mu    sync.Mutex
+	cache map[string]GeoInfo
+}
+
+// OpenGeoDB opens the database at path. A missing or corrupt file is an
+// error.
+func OpenGeoDB(path string) (*GeoDB, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: %v", err)
+	}
+	return &GeoDB{db: db, cache: make(map[string]GeoInfo)}, nil
+}
+
+// Close releases the database.
+func (g *GeoDB) Close() error {
+	return g.db.Close()
+}
+
+// geoRecord holds the fields used from the City, Country and ASN layouts.
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// Lookup returns what the database knows about ip. Unknown or invalid
+// addresses and lookup errors give an empty GeoInfo.
+func (g *GeoDB) Lookup(ip string) GeoInfo {
+	g.mu.Lock()
+	info, ok := g.cache[ip]
+	g.mu.Unlock()
+	if ok {
+		return info
+	}
+	if addr := net.ParseIP(ip); addr != nil {
+		var rec geoRecord
+		if g.db.Lookup(addr, &rec) == nil {
+			info = GeoInfo{Country: rec.Country.ISOCode, City: rec.City.Names["en"], Org: rec.Organization}
+		}
+	}
+	g.mu.Lock()
+	g.cache[ip] = info
+	g.mu.Unlock()
+	return info
+}
@@ -0,0 +1,75 @@
+package sublive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxTitle caps the length of Result.Title in bytes.
+const maxTitle = 200
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// pageTitle returns the unescaped <title> of an HTML body with whitespace
+// collapsed, or "" when there is none.
+func pageTitle(body []byte) string {
+	m := titleRe.FindSubmatch(body)
+	if m == nil {
+		return ""
+	}
+	t := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	if len(t) > maxTitle {
+		t = sanitizePreview([]byte(t), maxTitle)
+	}
+	return t
+}
+
+// bodyHash identifies a body by the first 16 hex digits of its SHA-256.
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:8])
+}
+
+// GroupResults clusters results that are the same endpoint under several
+// names: same status, same set of addresses, same Result.BodyHash and
+// Result.Title. Each cluster is returned as one representative, the
+// shortest name, with the other names in Aliases, in the order of the
+// first name of each cluster. Results without a response or a BodyHash
+// (see Scanner.Fingerprint) stay on their own. results is not modified.
+func GroupResults(results []Result) []Result {
+	out := []Result{}
+	byKey := map[string]int{}
+	for _, r := range results {
+		if r.Status == 0 || r.BodyHash == "" || len(r.IPs) == 0 {
+			out = append(out, r)
+			continue
+		}
+		ips := slices.Clone(r.IPs)
+		slices.Sort(ips)
+		key := strings.Join([]string{strconv.Itoa(r.Status), strings.Join(ips, ","), r.BodyHash, r.Title}, "\x00")
+		i, ok := byKey[key]
+		if !ok {
+			byKey[key] = len(out)
+			r.Aliases = nil
+			out = append(out, r)
+			continue
+		}
+		rep := &out[i]
+		if len(r.Subdomain) < len(rep.Subdomain) {
+			aliases := append(rep.Aliases, rep.Subdomain)
+			*rep = r
+			rep.Aliases = aliases
+		} else {
+			rep.Aliases = append(rep.Aliases, r.Subdomain)
+		}
+	}
+	for i := range out {
+		slices.Sort(out[i].Aliases)
+	}
+	return out
+}
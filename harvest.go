@@ -0,0 +1,148 @@
+package sublive
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type harvestKey struct{}
+
+// redirectHarvest collects the redirects followed by one probe. It is
+// carried in the request context so the shared client's CheckRedirect can
+// find it.
+type redirectHarvest struct {
+	// chain is the URL of every redirect followed, in order
+	chain []*url.URL
+	// hosts are only collected with harvest
+	harvest bool
+	hosts   []string
+}
+
+// checkRedirect follows up to 10 redirects like the default policy,
+// records every URL it follows and, with harvest, the host of every
+// absolute Location pointing at another host.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	h, ok := req.Context().Value(harvestKey{}).(*redirectHarvest)
+	if !ok || req.Response == nil {
+		return nil
+	}
+	h.chain = append(h.chain, req.URL)
+	if !h.harvest {
+		return nil
+	}
+	u, err := url.Parse(req.Response.Header.Get("Location"))
+	if err != nil || !u.IsAbs() {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != "" && host != strings.ToLower(via[len(via)-1].URL.Hostname()) {
+		h.hosts = append(h.hosts, host)
+	}
+	return nil
+}
+
+// Redirect classes of Result.RedirectClass.
+const (
+	// RedirectUpgrade only moves the host from http to https.
+	RedirectUpgrade = "upgrade"
+	// RedirectApex goes to the root domain or its www name.
+	RedirectApex = "apex"
+	// RedirectInternal goes to another name under the root domain.
+	RedirectInternal = "internal"
+	// RedirectExternal leaves the root domain.
+	RedirectExternal = "external"
+)
+
+// RedirectClasses lists the redirect classes, in the order the CLI prints
+// them.
+var RedirectClasses = []string{RedirectUpgrade, RedirectApex, RedirectInternal, RedirectExternal}
+
+// classifyRedirects returns the class of the redirects chain followed
+// from scheme://host under domain, and the URL that decided it: the first
+// one on another host or, when the chain never leaves host, the first
+// https one after an http request. A chain that only changes the path is
+// not classified. Without a domain every other host is external.
+func classifyRedirects(host, domain, scheme string, chain []*url.URL) (class, target string) {
+	for _, u := range chain {
+		h := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+		switch {
+		case h == host:
+			continue
+		case h == domain || h == "www."+domain:
+			return RedirectApex, u.String()
+		case InDomain(h, domain):
+			return RedirectInternal, u.String()
+		default:
+			return RedirectExternal, u.String()
+		}
+	}
+	if scheme == "http" {
+		for _, u := range chain {
+			if u.Scheme == "https" {
+				return RedirectUpgrade, u.String()
+			}
+		}
+	}
+	return "", ""
+}
+
+// scrapeHeaders are the response headers that commonly reference sibling
+// hosts.
+var scrapeHeaders = []string{
+	"Content-Security-Policy", "Content-Security-Policy-Report-Only",
+	"Access-Control-Allow-Origin", "Link",
+}
+
+// scraper extracts hostnames under one domain from live responses. A body
+// already seen (by hash) is not scanned again so catch-all pages are only
+// processed once.
+type scraper struct {
+	domain string
+	re     *regexp.Regexp
+
+	mu   sync.Mutex
+	seen map[[sha256.Size]byte]struct{}
+}
+
+func newScraper(domain string) *scraper {
+	return &scraper{
+		domain: domain,
+		re:     regexp.MustCompile(`(?i)(?:[a-z0-9_](?:[a-z0-9_-]{0,61}[a-z0-9])?\.)+` + regexp.QuoteMeta(domain) + `\b`),
+		seen:   make(map[[sha256.Size]byte]struct{}),
+	}
+}
+
+// extract returns the unique in-domain hostnames referenced by a response
+// with header and (the start of) body, other than self.
+func (s *scraper) extract(header http.Header, body []byte, self string) []string {
+	found := []string{}
+	for _, h := range scrapeHeaders {
+		for _, v := range header.Values(h) {
+			found = append(found, s.re.FindAllString(v, -1)...)
+		}
+	}
+	sum := sha256.Sum256(body)
+	s.mu.Lock()
+	_, dup := s.seen[sum]
+	s.seen[sum] = struct{}{}
+	s.mu.Unlock()
+	if !dup {
+		found = append(found, s.re.FindAllString(string(body), -1)...)
+	}
+	out := []string{}
+	for _, h := range UniqStrings(found) {
+		h = strings.ToLower(h)
+		if h != self && InDomain(h, s.domain) && ValidHostname(h) {
+			out = append(out, h)
+		}
+	}
+	return UniqStrings(out)
+}
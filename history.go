@@ -0,0 +1,179 @@
+package sublive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrHistoryLocked is returned by OpenHistory when another process has the
+// history database open.
+var ErrHistoryLocked = errors.New("sublive: history database is in use by another process")
+
+// Each domain of a history is a bucket holding a hosts bucket, keyed by
+// subdomain, and a runs bucket, keyed by RFC 3339 run time.
+var (
+	historyHosts = []byte("hosts")
+	historyRuns  = []byte("runs")
+)
+
+// HistoryRecord is what a History keeps about one subdomain: when it was
+// first and last seen, how it answered last and every run it was seen in.
+type HistoryRecord struct {
+	Subdomain  string       `json:"subdomain"`
+	FirstSeen  time.Time    `json:"first_seen"`
+	LastSeen   time.Time    `json:"last_seen"`
+	LastStatus int          `json:"last_status"`
+	LastIP     string       `json:"last_ip,omitempty"`
+	Runs       []HistoryRun `json:"runs"`
+}
+
+// HistoryRun is how a subdomain answered in one run.
+type HistoryRun struct {
+	At     time.Time `json:"at"`
+	Status int       `json:"status"`
+	IP     string    `json:"ip,omitempty"`
+}
+
+// History is a results history kept across runs in a bbolt file, see
+// OpenHistory. Only one process can have it open at a time.
+type History struct {
+	db *bolt.DB
+}
+
+// OpenHistory opens the history at path, creating it when missing unless
+// readOnly is set. It fails with ErrHistoryLocked when another process holds the
+// file, and with an error naming path when the file is not a history.
+func OpenHistory(path string, readOnly bool) (*History, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, ErrHistoryLocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sublive: opening history %s: %w", path, err)
+	}
+	// every top-level bucket must be a domain, or this is someone else's
+	// bbolt file
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if b.Bucket(historyHosts) == nil || b.Bucket(historyRuns) == nil {
+				return fmt.Errorf("sublive: %s is not a sublive history (bucket %q)", path, name)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &History{db: db}, nil
+}
+
+// Close closes the history file.
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// Record adds the results of the run at at, grouped by Result.Domain.
+// Results that never resolved are left out: a history is of hosts, not of
+// wordlist misses. Every recorded result gets its FirstSeen from the
+// history and New set when the history had no record of it. seenBefore
+// reports whether an earlier run was recorded for any of the domains, so
+// callers can tell a first run, where everything is new, apart.
+func (h *History) Record(results []Result, at time.Time) (seenBefore bool, err error) {
+	at = at.UTC().Truncate(time.Second)
+	err = h.db.Update(func(tx *bolt.Tx) error {
+		counted := map[string]int{}
+		for i := range results {
+			r := &results[i]
+			if r.Domain == "" || (r.IP == "" && r.Status == 0) {
+				continue
+			}
+			d, err := tx.CreateBucketIfNotExists([]byte(strings.ToLower(r.Domain)))
+			if err != nil {
+				return err
+			}
+			hosts, err := d.CreateBucketIfNotExists(historyHosts)
+			if err != nil {
+				return err
+			}
+			runs, err := d.CreateBucketIfNotExists(historyRuns)
+			if err != nil {
+				return err
+			}
+			if _, ok := counted[r.Domain]; !ok {
+				if k, _ := runs.Cursor().First(); k != nil {
+					seenBefore = true
+				}
+			}
+			counted[r.Domain]++
+
+			var rec HistoryRecord
+			if v := hosts.Get([]byte(r.Subdomain)); v != nil {
+				if err := json.Unmarshal(v, &rec); err != nil {
+					return fmt.Errorf("sublive: history record of %s: %w", r.Subdomain, err)
+				}
+			} else {
+				rec = HistoryRecord{Subdomain: r.Subdomain, FirstSeen: at}
+				r.New = true
+			}
+			rec.LastSeen, rec.LastStatus, rec.LastIP = at, r.Status, r.IP
+			rec.Runs = append(rec.Runs, HistoryRun{At: at, Status: r.Status, IP: r.IP})
+			r.FirstSeen = rec.FirstSeen
+			v, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := hosts.Put([]byte(r.Subdomain), v); err != nil {
+				return err
+			}
+		}
+		for domain, n := range counted {
+			v, _ := json.Marshal(struct {
+				Hosts int `json:"hosts"`
+			}{n})
+			runs := tx.Bucket([]byte(strings.ToLower(domain))).Bucket(historyRuns)
+			if err := runs.Put([]byte(at.Format(time.RFC3339)), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return seenBefore, err
+}
+
+// Timeline returns the recorded runs of domain, oldest first (RFC 3339 UTC
+// keys sort by time), and its subdomains sorted by name. Both are empty
+// for a domain without history.
+func (h *History) Timeline(domain string) (runs []time.Time, records []HistoryRecord, err error) {
+	err = h.db.View(func(tx *bolt.Tx) error {
+		d := tx.Bucket([]byte(strings.ToLower(domain)))
+		if d == nil {
+			return nil
+		}
+		err := d.Bucket(historyRuns).ForEach(func(k, _ []byte) error {
+			t, err := time.Parse(time.RFC3339, string(k))
+			if err != nil {
+				return fmt.Errorf("sublive: history run %q: %w", k, err)
+			}
+			runs = append(runs, t)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return d.Bucket(historyHosts).ForEach(func(k, v []byte) error {
+			var rec HistoryRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return fmt.Errorf("sublive: history record of %s: %w", k, err)
+			}
+			records = append(records, rec)
+			return nil
+		})
+	})
+	return runs, records, err
+}
@@ -0,0 +1,74 @@
+package sublive
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// DefaultHookQueue is how many results wait for Scanner.Hook when
+// HookQueue is 0.
+const DefaultHookQueue = 1000
+
+// hooked returns out as it is without Scanner.Hook, and otherwise a
+// channel that passes its results on while a goroutine of their own hands
+// them to Hook through a bounded queue. A result that finds the queue full
+// is not given to Hook but still passed on, so a slow hook never holds up
+// the scan; HookDropped counts them. The returned channel closes once Hook
+// has seen every queued result, or once ctx has ended and the queue is
+// dropped.
+func (s *Scanner) hooked(ctx context.Context, out <-chan Result, log *slog.Logger) <-chan Result {
+	atomic.StoreInt64(&s.hookDropped, 0)
+	if s.Hook == nil {
+		return out
+	}
+	size := s.HookQueue
+	if size <= 0 {
+		size = DefaultHookQueue
+	}
+	queue := make(chan Result, size)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for r := range queue {
+			if ctx.Err() != nil {
+				atomic.AddInt64(&s.hookDropped, 1)
+				continue
+			}
+			s.callHook(r, log)
+		}
+	}()
+	passed := make(chan Result, 100)
+	go func() {
+		defer close(passed)
+		for r := range out {
+			select {
+			case queue <- r:
+			default:
+				atomic.AddInt64(&s.hookDropped, 1)
+			}
+			passed <- r
+		}
+		close(queue)
+		<-done
+	}()
+	return passed
+}
+
+// callHook calls Hook with r, logging a panic instead of letting it end
+// the program.
+func (s *Scanner) callHook(r Result, log *slog.Logger) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Error("result hook panicked", "subdomain", r.Subdomain, "panic", p)
+		}
+	}()
+	s.Hook(r)
+}
+
+// HookDropped returns how many results of the last Run were not given to
+// Hook because its queue was full. It is valid once the result channel is
+// closed.
+func (s *Scanner) HookDropped() int {
+	return int(atomic.LoadInt64(&s.hookDropped))
+}
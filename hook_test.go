@@ -0,0 +1,107 @@
+package sublive
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hookScanner returns a Scanner over n names of example.com that each
+// answer 200, calling hook.
+func hookScanner(n int, hook func(Result)) *Scanner {
+	var words, names []string
+	for i := range n {
+		words = append(words, fmt.Sprintf("h%d", i))
+		names = append(names, fmt.Sprintf("h%d.example.com", i))
+	}
+	pages := map[string]fakePage{}
+	for _, name := range names {
+		pages[name] = fakePage{status: 200}
+	}
+	return &Scanner{Domains: []string{"example.com"}, Words: words, NoBackoff: true, Hook: hook, Resolver: &fakeResolver{answers: resolves("192.0.2.40", names...)}, Prober: &fakeProber{pages: pages}}
+}
+
+func TestRunHook(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]int{}
+	s := hookScanner(50, func(r Result) {
+		mu.Lock()
+		seen[r.Subdomain]++
+		mu.Unlock()
+		if r.Subdomain == "h7.example.com" {
+			panic("hook bug")
+		}
+	})
+	got := runScan(t, s)
+	// the channel closes only once the hook is done with every result
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 50 || len(seen) != 50 || s.HookDropped() != 0 {
+		t.Errorf("%d results, %d hooked, %d dropped", len(got), len(seen), s.HookDropped())
+	}
+	for name, n := range seen {
+		if n != 1 {
+			t.Errorf("%s hooked %d times", name, n)
+		}
+	}
+}
+
+func TestRunHookBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	var hooked atomic.Int64
+	s := hookScanner(30, func(r Result) {
+		<-release
+		hooked.Add(1)
+	})
+	s.HookQueue = 2
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch, err := s.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a hook stuck on its first result must not hold up the others
+	for range 30 {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			t.Fatal("results held up by the hook")
+		}
+	}
+	close(release)
+	if _, open := <-ch; open {
+		t.Error("more than 30 results")
+	}
+	// the hook holds one result and the queue two: the rest are dropped
+	if n := hooked.Load(); n+int64(s.HookDropped()) != 30 || n < 1 || n > 3 {
+		t.Errorf("%d hooked and %d dropped of 30", n, s.HookDropped())
+	}
+}
+
+func TestRunHookCancel(t *testing.T) {
+	release := make(chan struct{})
+	var hooked atomic.Int64
+	s := hookScanner(10, func(r Result) {
+		<-release
+		hooked.Add(1)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := s.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		<-ch
+	}
+	// once the caller gave up, the queued results skip the hook
+	cancel()
+	close(release)
+	for range ch {
+	}
+	if n := hooked.Load(); n+int64(s.HookDropped()) != 10 || n > 1 {
+		t.Errorf("%d hooked and %d dropped of 10 after cancel", n, s.HookDropped())
+	}
+}
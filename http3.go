@@ -0,0 +1,77 @@
+//go:build http3
+
+package sublive
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP3Supported reports whether Scanner.HTTP3 works in this build; it
+// needs the http3 build tag.
+const HTTP3Supported = true
+
+// h3Get requests the first path of target over HTTP/3, dialling only the
+// addresses in ips, with the server name of the probe's pin in ctx.
+// Redirects are not followed. Every call has its own transport, so no QUIC
+// connection outlives the probe.
+func (p *probe) h3Get(ctx context.Context, target ProbeTarget, ips []string) (*http.Response, error) {
+	sub := target.Host
+	pin, _ := ctx.Value(pinnedKey{}).(*pinned)
+	rt := &http3.Transport{
+		TLSClientConfig: p.tlsConfig,
+		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil || !strings.EqualFold(host, sub) {
+				return nil, errors.New("sublive: HTTP/3 only dials the probed host")
+			}
+			if pin != nil && pin.sni != "" {
+				tlsCfg = tlsCfg.Clone()
+				tlsCfg.ServerName = pin.sni
+				pin.sniUsed.Store(true)
+			}
+			var lastErr error
+			for _, ip := range ips {
+				conn, err := quic.DialAddrEarly(ctx, net.JoinHostPort(ip, port), tlsCfg, cfg)
+				if err == nil {
+					return conn, nil
+				}
+				lastErr = err
+			}
+			return nil, lastErr
+		},
+	}
+	client := &http.Client{
+		Transport:     p.budget.wrap(rt),
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", p.url(target, "https", target.paths()[0]), nil)
+	p.setHeaders(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		rt.Close()
+		return nil, err
+	}
+	resp.Body = &h3Body{ReadCloser: resp.Body, rt: rt}
+	return resp, nil
+}
+
+// h3Body closes the probe's transport along with the body.
+type h3Body struct {
+	io.ReadCloser
+	rt *http3.Transport
+}
+
+func (b *h3Body) Close() error {
+	err := b.ReadCloser.Close()
+	b.rt.Close()
+	return err
+}
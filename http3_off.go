@@ -0,0 +1,17 @@
+//go:build !http3
+
+package sublive
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// HTTP3Supported reports whether Scanner.HTTP3 works in this build; it
+// needs the http3 build tag.
+const HTTP3Supported = false
+
+func (p *probe) h3Get(ctx context.Context, target ProbeTarget, ips []string) (*http.Response, error) {
+	return nil, errors.New("sublive: built without HTTP/3 support")
+}
@@ -0,0 +1,127 @@
+package sublive
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile converts user supplied names to the ASCII (xn--) form used for
+// DNS lookups and HTTP requests.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.ValidateLabels(true),
+	idna.StrictDomainName(true),
+	idna.Transitional(false),
+)
+
+// scriptTables are the scripts considered when checking a label for mixed
+// scripts. Common and Inherited characters (digits, hyphen, marks) are ignored.
+var scriptTables = map[string]*unicode.RangeTable{
+	"Latin": unicode.Latin, "Greek": unicode.Greek, "Cyrillic": unicode.Cyrillic,
+	"Armenian": unicode.Armenian, "Hebrew": unicode.Hebrew, "Arabic": unicode.Arabic,
+	"Devanagari": unicode.Devanagari, "Thai": unicode.Thai, "Georgian": unicode.Georgian,
+	"Han": unicode.Han, "Hiragana": unicode.Hiragana, "Katakana": unicode.Katakana,
+	"Hangul": unicode.Hangul, "Bopomofo": unicode.Bopomofo,
+}
+
+// cjkSets are script combinations that legitimately appear together in a
+// single label (Japanese, Chinese and Korean names commonly mix in Latin).
+var cjkSets = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Bopomofo"},
+	{"Latin", "Han", "Hangul"},
+}
+
+// mixedScript reports whether label mixes scripts in a way that is typical
+// of homograph spoofing rather than a real name.
+func mixedScript(label string) bool {
+	seen := map[string]bool{}
+	for _, r := range label {
+		if r < utf8.RuneSelf {
+			if unicode.IsLetter(r) {
+				seen["Latin"] = true
+			}
+			continue
+		}
+		for name, tbl := range scriptTables {
+			if unicode.Is(tbl, r) {
+				seen[name] = true
+				break
+			}
+		}
+	}
+	if len(seen) <= 1 {
+		return false
+	}
+	for _, set := range cjkSets {
+		ok := true
+		for name := range seen {
+			found := false
+			for _, s := range set {
+				if s == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// ToASCII converts a Unicode (or already ASCII) name to the form used on
+// the wire. Plain ASCII names are only lowercased so wordlists with entries
+// such as "_dmarc" keep working. Mixed-script and invalid IDN labels are
+// rejected, xn-- labels after decoding them.
+func ToASCII(name string) (string, error) {
+	name = strings.TrimSuffix(name, ".")
+	if isASCII(name) && !strings.Contains(strings.ToLower(name), "xn--") {
+		return strings.ToLower(name), nil
+	}
+	for _, label := range strings.Split(name, ".") {
+		// an xn-- label is checked as the name it stands for
+		u := label
+		if strings.HasPrefix(strings.ToLower(label), "xn--") {
+			if d, err := idna.Punycode.ToUnicode(strings.ToLower(label)); err == nil {
+				u = d
+			}
+		}
+		if mixedScript(u) {
+			return "", fmt.Errorf("mixed-script label %q", label)
+		}
+	}
+	return idnaProfile.ToASCII(name)
+}
+
+// DisplayName returns the Unicode form of an ASCII name, or "" when it has
+// no xn-- labels or cannot be decoded.
+func DisplayName(name string) string {
+	if !strings.Contains(name, "xn--") {
+		return ""
+	}
+	u, err := idna.Display.ToUnicode(name)
+	if err != nil || u == name {
+		return ""
+	}
+	return u
+}
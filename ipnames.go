@@ -0,0 +1,82 @@
+package sublive
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPNames holds the hostnames HarvestIPs recovered from one address.
+type IPNames struct {
+	IP string
+	// PTR are the reverse DNS names of IP, and Cert the subject common
+	// name and DNS SANs of the certificate it serves on port 443, with
+	// wildcard labels stripped. Both are lower-cased valid hostnames.
+	PTR, Cert []string
+}
+
+// HarvestIPs recovers hostnames from addresses when the starting point is
+// a netblock rather than a domain: the PTR names of every address and the
+// names in the certificate it presents on port 443, which is not
+// verified. At most workers addresses are handled at a time, and each
+// lookup and TLS handshake is bounded by timeout. resolvers are as in
+// Scanner.Resolvers. Addresses without any name are left out; the others
+// keep the order of ips.
+func HarvestIPs(ctx context.Context, ips []string, resolvers []string, workers int, timeout time.Duration) []IPNames {
+	resolver := newDNSResolver(resolvers, false, nil)
+	workers = max(workers, 1)
+	found := make([]IPNames, len(ips))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			found[i] = IPNames{IP: ip, PTR: lookupPTRNames(ctx, resolver, ip, timeout), Cert: certNames(ctx, ip, timeout)}
+		}()
+	}
+	wg.Wait()
+	return slices.DeleteFunc(found, func(n IPNames) bool { return len(n.PTR) == 0 && len(n.Cert) == 0 })
+}
+
+// lookupPTRNames returns the reverse DNS names of ip.
+func lookupPTRNames(ctx context.Context, resolver *net.Resolver, ip string, timeout time.Duration) []string {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	names, _ := resolver.LookupAddr(ctx, ip)
+	return hostnames(names)
+}
+
+// certNames returns the subject common name and DNS SANs of the
+// certificate ip presents on port 443, or nil without TLS there.
+func certNames(ctx context.Context, ip string, timeout time.Duration) []string {
+	cert := peerCert(ctx, ip, "", timeout)
+	if cert == nil {
+		return nil
+	}
+	return hostnames(append([]string{cert.Subject.CommonName}, cert.DNSNames...))
+}
+
+// hostnames returns the distinct valid hostnames of names, lower-cased,
+// without trailing dots and wildcard labels.
+func hostnames(names []string) []string {
+	var out []string
+	for _, n := range names {
+		n = strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(n, ".")), "*.")
+		if ValidHostname(n) && strings.Contains(n, ".") && net.ParseIP(n) == nil && !slices.Contains(out, n) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
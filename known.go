@@ -0,0 +1,58 @@
+package sublive
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadKnownNames reads names found earlier by other tools, one per line,
+// telling the formats apart line by line: plain names, massdns simple
+// output ("www.example.com. A 192.0.2.1", the first field), and JSON lines
+// of amass ("name") or subfinder ("host"). Names are converted to ASCII,
+// without trailing dots or duplicates; rejected counts the lines that gave
+// no valid hostname. Blank lines and # comments are skipped.
+func ReadKnownNames(r io.Reader) (names []string, rejected int, err error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var name string
+		if strings.HasPrefix(line, "{") {
+			var rec struct {
+				Name string `json:"name"`
+				Host string `json:"host"`
+			}
+			if json.Unmarshal([]byte(line), &rec) == nil {
+				name = rec.Name
+				if name == "" {
+					name = rec.Host
+				}
+			}
+		} else {
+			name = strings.Fields(line)[0]
+		}
+		a, err := ToASCII(name)
+		if err != nil || !ValidHostname(a) {
+			rejected++
+			continue
+		}
+		names = append(names, a)
+	}
+	return UniqStrings(names), rejected, s.Err()
+}
+
+// LoadKnownNames reads a file of known names (see ReadKnownNames).
+func LoadKnownNames(path string) (names []string, rejected int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return ReadKnownNames(f)
+}
@@ -0,0 +1,94 @@
+package sublive
+
+import (
+	"sort"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// IPLoad is the probe load on one address under Scanner.PerHost: Active
+// probes hold a slot, Waiting candidates are parked until one frees up.
+type IPLoad struct {
+	IP      string
+	Active  int
+	Waiting int
+}
+
+// ipLimiter caps concurrent probes per address. Entries exist only while
+// a slot is held, so the map stays as small as the set of busy addresses.
+type ipLimiter struct {
+	limit int64
+	mu    sync.Mutex
+	m     map[string]*ipSlot
+}
+
+type ipSlot struct {
+	sem    *semaphore.Weighted
+	active int
+}
+
+func newIPLimiter(limit int) *ipLimiter {
+	return &ipLimiter{limit: int64(limit), m: make(map[string]*ipSlot)}
+}
+
+// tryAcquire takes a slot for ip without blocking, so a worker never waits
+// on a saturated address while other candidates are queued.
+func (l *ipLimiter) tryAcquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.m[ip]
+	if s == nil {
+		s = &ipSlot{sem: semaphore.NewWeighted(l.limit)}
+		l.m[ip] = s
+	}
+	if !s.sem.TryAcquire(1) {
+		if s.active == 0 {
+			delete(l.m, ip)
+		}
+		return false
+	}
+	s.active++
+	return true
+}
+
+func (l *ipLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.m[ip]
+	s.sem.Release(1)
+	if s.active--; s.active == 0 {
+		delete(l.m, ip)
+	}
+}
+
+// load returns the n addresses with the most active and waiting probes.
+func (l *ipLimiter) load(parked map[string][]Candidate, n int) []IPLoad {
+	l.mu.Lock()
+	byIP := make(map[string]*IPLoad, len(l.m))
+	for ip, s := range l.m {
+		byIP[ip] = &IPLoad{IP: ip, Active: s.active}
+	}
+	l.mu.Unlock()
+	for ip, cs := range parked {
+		if byIP[ip] == nil {
+			byIP[ip] = &IPLoad{IP: ip}
+		}
+		byIP[ip].Waiting = len(cs)
+	}
+	out := make([]IPLoad, 0, len(byIP))
+	for _, v := range byIP {
+		out = append(out, *v)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Active+out[i].Waiting, out[j].Active+out[j].Waiting
+		if a != b {
+			return a > b
+		}
+		return out[i].IP < out[j].IP
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
@@ -0,0 +1,145 @@
+package sublive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BodyPattern is a test of response bodies for Scanner.Match and
+// Scanner.Filter: a literal string or a regular expression.
+type BodyPattern struct {
+	// Text is the string or expression the pattern was made from, as
+	// listed in Result.Matched and Result.Filtered.
+	Text string
+	re   *regexp.Regexp
+}
+
+// LiteralPattern returns a pattern matching bodies that contain s.
+func LiteralPattern(s string) BodyPattern {
+	return BodyPattern{Text: s, re: regexp.MustCompile(regexp.QuoteMeta(s))}
+}
+
+// RegexpPattern compiles expr (RE2 syntax, see regexp) into a pattern.
+func RegexpPattern(expr string) (BodyPattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return BodyPattern{}, err
+	}
+	return BodyPattern{Text: expr, re: re}, nil
+}
+
+// matchBody returns the Text of every pattern found in body, nil when none
+// is.
+func matchBody(patterns []BodyPattern, body []byte) []string {
+	var found []string
+	for _, p := range patterns {
+		if p.re != nil && p.re.Match(body) {
+			found = append(found, p.Text)
+		}
+	}
+	return found
+}
+
+// KeepMatched reports whether r passes the body tests it was probed with:
+// at least one Match pattern was found, when there were any, and no Filter
+// pattern. match tells whether Match patterns were used, since results
+// don't record that.
+func KeepMatched(r Result, match bool) bool {
+	return (!match || len(r.Matched) > 0) && len(r.Filtered) == 0
+}
+
+// readsBody reports whether responses need their body read for the body
+// options other than scraping.
+func (p *probe) readsBody() bool {
+	return len(p.match) > 0 || len(p.filter) > 0 || p.counts || p.preview > 0 || p.fingerprint || p.soft404
+}
+
+// inspectBody fills in the fields of r that the body options take from a
+// response with header and (the start of) body.
+func (p *probe) inspectBody(r *Result, header http.Header, body []byte) {
+	r.Matched = matchBody(p.match, body)
+	r.Filtered = matchBody(p.filter, body)
+	if p.counts {
+		c := countBody(body)
+		r.Body = &c
+	}
+	if p.fingerprint {
+		r.Title, r.BodyHash = pageTitle(body), bodyHash(body)
+	}
+	if p.preview > 0 {
+		if isTextual(header.Get("Content-Type"), body) {
+			r.Preview = sanitizePreview(body, p.preview)
+		} else if p.previewBinary {
+			r.PreviewBase64 = base64.StdEncoding.EncodeToString(body[:min(len(body), p.preview)])
+		}
+	}
+}
+
+// BodyCounts describes a response body as read, at most
+// Scanner.BodyMaxBytes of it.
+type BodyCounts struct {
+	// Bytes is the length, Words the number of whitespace-separated words
+	// and Lines the number of lines, a last one without a newline
+	// included.
+	Bytes int `json:"bytes"`
+	Words int `json:"words"`
+	Lines int `json:"lines"`
+}
+
+func countBody(body []byte) BodyCounts {
+	c := BodyCounts{Bytes: len(body), Words: len(bytes.Fields(body)), Lines: bytes.Count(body, []byte("\n"))}
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		c.Lines++
+	}
+	return c
+}
+
+// isTextual reports whether a body of Content-Type ct is text, sniffing
+// body when ct is missing.
+func isTextual(ct string, body []byte) bool {
+	if ct == "" {
+		ct = http.DetectContentType(body)
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"), strings.HasSuffix(mt, "+json"), strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+	switch mt {
+	case "application/json", "application/xml", "application/javascript", "application/x-javascript", "application/ecmascript", "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
+
+// sanitizePreview turns the first n bytes of body into a printable
+// snippet: valid UTF-8, cut before a rune that would not fit, with tabs and
+// line breaks as spaces and other control characters removed.
+func sanitizePreview(body []byte, n int) string {
+	if n >= len(body) {
+		n = len(body)
+	} else {
+		for i := 1; i < utf8.UTFMax && n > 0 && !utf8.RuneStart(body[n]); i++ {
+			n--
+		}
+	}
+	s := strings.ToValidUTF8(string(body[:n]), "\uFFFD")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+}
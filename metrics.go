@@ -0,0 +1,164 @@
+package sublive
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency
+// histogram.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics counts the progress of the scans it is set on as
+// Scanner.Metrics, for a Prometheus scrape through ServeHTTP. Counters
+// keep growing across scans, so one Metrics can follow every monitor
+// cycle. Everything is an atomic: the collector does the per-result
+// counting, workers only touch the in-flight gauge and the latency
+// histogram. A nil *Metrics counts nothing. Use NewMetrics.
+type Metrics struct {
+	enqueued  atomic.Int64
+	processed atomic.Int64
+	inFlight  atomic.Int64
+	workers   atomic.Int64
+	// classes and errors are built by NewMetrics and only read after, so
+	// the maps need no lock
+	classes map[Class]*atomic.Int64
+	// errors is keyed by stage ("dns" or "http") and Reason
+	errors map[[2]string]*atomic.Int64
+	// buckets counts requests up to each of latencyBuckets, not
+	// cumulatively; the last one is +Inf
+	buckets   []atomic.Int64
+	requests  atomic.Int64
+	latencyNs atomic.Int64
+}
+
+// NewMetrics returns zeroed metrics.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		classes: make(map[Class]*atomic.Int64, len(Classes)),
+		errors:  make(map[[2]string]*atomic.Int64, 2*len(Reasons)),
+		buckets: make([]atomic.Int64, len(latencyBuckets)+1),
+	}
+	for _, c := range Classes {
+		m.classes[c] = new(atomic.Int64)
+	}
+	for _, stage := range []string{"dns", "http"} {
+		for _, r := range Reasons {
+			m.errors[[2]string{stage, r}] = new(atomic.Int64)
+		}
+	}
+	return m
+}
+
+func (m *Metrics) enqueue() {
+	if m != nil {
+		m.enqueued.Add(1)
+	}
+}
+
+// result counts a finished result by class and failure reason; names
+// without an address failed at the DNS stage.
+func (m *Metrics) result(r Result) {
+	if m == nil {
+		return
+	}
+	m.processed.Add(1)
+	if n := m.classes[r.Class]; n != nil {
+		n.Add(1)
+	}
+	if r.Reason != "" {
+		stage := "http"
+		if r.IP == "" {
+			stage = "dns"
+		}
+		if n := m.errors[[2]string{stage, r.Reason}]; n != nil {
+			n.Add(1)
+		}
+	}
+}
+
+// request marks an HTTP request as started; calling the returned func
+// marks it done and records its latency.
+func (m *Metrics) request() func() {
+	if m == nil {
+		return func() {}
+	}
+	m.inFlight.Add(1)
+	start := time.Now()
+	return func() {
+		d := time.Since(start)
+		m.inFlight.Add(-1)
+		m.requests.Add(1)
+		m.latencyNs.Add(int64(d))
+		i := 0
+		for i < len(latencyBuckets) && d.Seconds() > latencyBuckets[i] {
+			i++
+		}
+		m.buckets[i].Add(1)
+	}
+}
+
+func (m *Metrics) worker(delta int64) {
+	if m != nil {
+		m.workers.Add(delta)
+	}
+}
+
+// Enqueued returns the number of candidates queued so far.
+func (m *Metrics) Enqueued() int64 {
+	return m.enqueued.Load()
+}
+
+// Processed returns the number of candidates with a final result so far.
+func (m *Metrics) Processed() int64 {
+	return m.processed.Load()
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	metric("sublive_candidates_enqueued_total", "counter", "Candidates queued for probing, deep-mode ones included.")
+	fmt.Fprintf(&b, "sublive_candidates_enqueued_total %d\n", m.enqueued.Load())
+	metric("sublive_candidates_processed_total", "counter", "Candidates with a final result.")
+	fmt.Fprintf(&b, "sublive_candidates_processed_total %d\n", m.processed.Load())
+	metric("sublive_results_total", "counter", "Results by classification bucket.")
+	for _, c := range Classes {
+		fmt.Fprintf(&b, "sublive_results_total{class=%q} %d\n", c, m.classes[c].Load())
+	}
+	metric("sublive_errors_total", "counter", "Results without a response by stage and failure reason.")
+	for _, stage := range []string{"dns", "http"} {
+		for _, r := range Reasons {
+			fmt.Fprintf(&b, "sublive_errors_total{stage=%q,reason=%q} %d\n", stage, r, m.errors[[2]string{stage, r}].Load())
+		}
+	}
+	metric("sublive_requests_in_flight", "gauge", "HTTP requests being made.")
+	fmt.Fprintf(&b, "sublive_requests_in_flight %d\n", m.inFlight.Load())
+	metric("sublive_workers", "gauge", "Probe workers running.")
+	fmt.Fprintf(&b, "sublive_workers %d\n", m.workers.Load())
+	metric("sublive_request_duration_seconds", "histogram", "Latency of HTTP requests, failed ones included.")
+	var cum int64
+	for i, le := range latencyBuckets {
+		cum += m.buckets[i].Load()
+		fmt.Fprintf(&b, "sublive_request_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), cum)
+	}
+	cum += m.buckets[len(latencyBuckets)].Load()
+	fmt.Fprintf(&b, "sublive_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", cum)
+	fmt.Fprintf(&b, "sublive_request_duration_seconds_sum %g\n", time.Duration(m.latencyNs.Load()).Seconds())
+	fmt.Fprintf(&b, "sublive_request_duration_seconds_count %d\n", m.requests.Load())
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
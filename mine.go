@@ -0,0 +1,109 @@
+package sublive
+
+import (
+	"slices"
+	"strings"
+)
+
+// Mining defaults: a token is combined once DefaultMineMin distinct live
+// names contain it, and at most DefaultMinedMax mined names are queued.
+const (
+	DefaultMineMin  = 2
+	DefaultMinedMax = 1000
+)
+
+// miner learns the tokens the live names of a deep scan are built from.
+// Once a token was seen in min distinct live names it is combined with
+// every other known token and wordlist entry, as "x-token" and
+// "token-x", into new candidates; tokens learnt later are combined with
+// the tokens already promoted. It runs in the collector, so it needs no
+// locking.
+type miner struct {
+	min, max int
+	// depth is the Scanner's Depth, which mined names don't go past
+	depth int
+	// queued counts the mined names enqueue accepted
+	queued int
+	// words are the wordlist entries of the seeds
+	words []string
+	// counts is the number of distinct live names each token was seen in;
+	// known lists the tokens in the order they were first seen
+	counts   map[string]int
+	known    []string
+	promoted []string
+}
+
+func newMiner(seeds []Candidate, minNames, maxQueued, depth int) *miner {
+	if minNames <= 0 {
+		minNames = DefaultMineMin
+	}
+	if maxQueued <= 0 {
+		maxQueued = DefaultMinedMax
+	}
+	m := &miner{min: minNames, max: maxQueued, depth: depth, counts: map[string]int{}}
+	for _, c := range seeds {
+		if c.Source == SourceWordlist && c.Domain != "" {
+			m.words = append(m.words, strings.TrimSuffix(c.Name, "."+c.Domain))
+		}
+	}
+	return m
+}
+
+// mineTokens splits prefix on '-', '.' and digits into its distinct
+// tokens of two characters or more: "gitlab-prod2.eu" gives gitlab, prod
+// and eu.
+func mineTokens(prefix string) []string {
+	fields := strings.FieldsFunc(prefix, func(c rune) bool {
+		return c == '-' || c == '.' || c >= '0' && c <= '9'
+	})
+	var out []string
+	for _, f := range fields {
+		if len(f) >= 2 && !slices.Contains(out, f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// observe learns the tokens of r when it is live and enqueues the
+// combinations that became possible, one level below r but at most at
+// the depth limit.
+func (m *miner) observe(r Result, enqueue func(Candidate) bool) {
+	if !IsLive(r.Status) || !InDomain(r.Subdomain, r.Domain) || r.Subdomain == r.Domain {
+		return
+	}
+	depth := min(r.Depth+1, m.depth)
+	pair := func(a, b string) {
+		for _, name := range []string{a + "-" + b, b + "-" + a} {
+			if m.queued >= m.max {
+				return
+			}
+			if enqueue(Candidate{Name: name + "." + r.Domain, Domain: r.Domain, Depth: depth, Source: SourceMined}) {
+				m.queued++
+			}
+		}
+	}
+	for _, tok := range mineTokens(strings.TrimSuffix(r.Subdomain, "."+r.Domain)) {
+		m.counts[tok]++
+		n := m.counts[tok]
+		if n == 1 {
+			m.known = append(m.known, tok)
+			for _, p := range m.promoted {
+				pair(tok, p)
+			}
+		}
+		if n == m.min {
+			m.promoted = append(m.promoted, tok)
+			for _, k := range m.known {
+				if k != tok {
+					pair(k, tok)
+				}
+			}
+			for _, w := range m.words {
+				if !slices.Contains(mineTokens(w), tok) {
+					pair(w, tok)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package sublive
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// NetTiming is how long the network phases of a probe took, with
+// Scanner.ProfileNet, in milliseconds. DNS is the lookup of the name and
+// the rest belong to the last HTTP request made: the TCP connect, the TLS
+// handshake and the wait from the request being written to the first byte
+// of the answer. A phase that didn't happen, such as the connect of a
+// reused connection or the lookup of a cached name, is zero.
+type NetTiming struct {
+	DNSMs     float64 `json:"dns_ms,omitempty"`
+	ConnectMs float64 `json:"connect_ms,omitempty"`
+	TLSMs     float64 `json:"tls_ms,omitempty"`
+	TTFBMs    float64 `json:"ttfb_ms,omitempty"`
+}
+
+// TotalMs is the sum of the phases.
+func (t NetTiming) TotalMs() float64 {
+	return t.DNSMs + t.ConnectMs + t.TLSMs + t.TTFBMs
+}
+
+// ms converts d to milliseconds, to the microsecond.
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// netTrace times the phases of one request through the hooks of
+// httptrace, which run on the transport's goroutines.
+type netTrace struct {
+	mu                     sync.Mutex
+	connectStart, tlsStart time.Time
+	wrote                  time.Time
+	timing                 NetTiming
+}
+
+// hook adds the timing hooks to trace.
+func (t *netTrace) hook(trace *httptrace.ClientTrace) {
+	trace.ConnectStart = func(string, string) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		// of the addresses raced, the first attempt counts
+		if t.connectStart.IsZero() {
+			t.connectStart = time.Now()
+		}
+	}
+	trace.ConnectDone = func(_, _ string, err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if err == nil && t.timing.ConnectMs == 0 {
+			t.timing.ConnectMs = ms(time.Since(t.connectStart))
+		}
+	}
+	trace.TLSHandshakeStart = func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.tlsStart = time.Now()
+	}
+	trace.TLSHandshakeDone = func(_ tls.ConnectionState, err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if err == nil {
+			t.timing.TLSMs = ms(time.Since(t.tlsStart))
+		}
+	}
+	trace.WroteRequest = func(httptrace.WroteRequestInfo) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.wrote = time.Now()
+	}
+	trace.GotFirstResponseByte = func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !t.wrote.IsZero() {
+			t.timing.TTFBMs = ms(time.Since(t.wrote))
+		}
+	}
+}
+
+// get returns the phases timed so far.
+func (t *netTrace) get() NetTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timing
+}
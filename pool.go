@@ -0,0 +1,192 @@
+package sublive
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Auto-scaling parameters: the failure rate is taken over the last
+// scaleWindow resolved names and checked every scaleEvery.
+const (
+	scaleWindow     = 100
+	scaleMinSamples = 20
+	scaleEvery      = 2 * time.Second
+	scaleHighRate   = 0.20
+	scaleLowRate    = 0.05
+)
+
+// pool runs the probe workers. Workers exit when jobs is closed, ctx is
+// done, or they receive from quit, which is how the pool shrinks.
+type pool struct {
+	ctx     context.Context
+	p       *probe
+	jobs    <-chan Candidate
+	results chan<- Result
+	quit    chan struct{}
+	wg      sync.WaitGroup
+	size    int
+}
+
+func (pl *pool) grow(n int) {
+	for i := 0; i < n; i++ {
+		pl.wg.Add(1)
+		pl.size++
+		go pl.p.worker(pl.ctx, pl.jobs, pl.results, pl.quit, &pl.wg)
+	}
+}
+
+// shrink asks n workers to exit after their current job. quit is buffered
+// to the maximum pool size, so this never blocks.
+func (pl *pool) shrink(n int) {
+	for i := 0; i < n; i++ {
+		pl.quit <- struct{}{}
+		pl.size--
+	}
+}
+
+// pauseGate blocks workers while it is shut. The zero value is open.
+type pauseGate struct {
+	mu sync.Mutex
+	// ch is closed on reopening; nil while open
+	ch chan struct{}
+}
+
+func (g *pauseGate) set(shut bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case shut && g.ch == nil:
+		g.ch = make(chan struct{})
+	case !shut && g.ch != nil:
+		close(g.ch)
+		g.ch = nil
+	}
+}
+
+// wait blocks while the gate is shut. It returns false when ctx ends
+// first.
+func (g *pauseGate) wait(ctx context.Context) bool {
+	g.mu.Lock()
+	ch := g.ch
+	g.mu.Unlock()
+	if ch == nil {
+		return true
+	}
+	select {
+	case <-ch:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// secondPass probes retries again with a fresh pool of SecondPassWorkers
+// workers and doubled timeouts, sending the new result for hosts that
+// answered this time and the original for the rest (also when ctx ends).
+// It returns the number of hosts recovered.
+func (s *Scanner) secondPass(ctx context.Context, p *probe, retries []Result, out chan<- Result) int {
+	workers := s.SecondPassWorkers
+	if workers <= 0 {
+		workers = 5
+	}
+	p2 := *p
+	p2.timeout *= 2
+	p2.preflight *= 2
+	// few workers can't overload an address, and a deferred result would
+	// have nowhere to be parked
+	p2.limiter, p2.holds = nil, nil
+	p2.collapse, p2.parkUnvalidated = nil, false
+	if s.Client == nil {
+		p2.client = newClient(s, &p2, workers)
+	}
+
+	jobs := make(chan Candidate)
+	results := make(chan Result, len(retries))
+	pl := &pool{ctx: ctx, p: &p2, jobs: jobs, results: results}
+	pl.grow(min(workers, len(retries)))
+	go func() {
+		defer close(jobs)
+		for _, r := range retries {
+			select {
+			case jobs <- r.candidate():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		pl.wg.Wait()
+		close(results)
+	}()
+
+	answered := make(map[string]bool, len(retries))
+	ptr := make(map[string][]string, len(retries))
+	for _, r := range retries {
+		ptr[r.Subdomain] = r.PTR
+	}
+	for r := range results {
+		if !r.cancelled && (r.Status != 0 || r.BannerPort != 0) {
+			answered[r.Subdomain] = true
+			// the second pass does no reverse lookups of its own
+			r.PTR = ptr[r.Subdomain]
+			out <- r
+		}
+	}
+	for _, r := range retries {
+		if !answered[r.Subdomain] {
+			out <- r
+		}
+	}
+	return len(answered)
+}
+
+// scaler keeps the rolling failure rate and decides pool size changes.
+type scaler struct {
+	min, max int
+	window   [scaleWindow]bool
+	next, n  int
+	onScale  func(from, to int, failureRate float64)
+}
+
+// observe records one result. Names that didn't resolve say nothing about
+// network pressure and are ignored.
+func (sc *scaler) observe(r Result) {
+	if r.IP == "" {
+		return
+	}
+	sc.window[sc.next] = r.netFailure
+	sc.next = (sc.next + 1) % scaleWindow
+	if sc.n < scaleWindow {
+		sc.n++
+	}
+}
+
+// adjust grows or shrinks pl according to the current failure rate. Growing
+// only happens while work is waiting in the queue.
+func (sc *scaler) adjust(pl *pool, queued int) {
+	if sc.n < scaleMinSamples {
+		return
+	}
+	fails := 0
+	for i := 0; i < sc.n; i++ {
+		if sc.window[i] {
+			fails++
+		}
+	}
+	rate := float64(fails) / float64(sc.n)
+	from := pl.size
+	switch {
+	case rate > scaleHighRate && pl.size > sc.min:
+		pl.shrink(pl.size - max(sc.min, pl.size*3/4))
+	case rate < scaleLowRate && pl.size < sc.max && queued > 0:
+		pl.grow(min(sc.max, pl.size+max(1, pl.size/4)) - pl.size)
+	default:
+		return
+	}
+	// start a fresh window so the next decision sees the new pool size
+	sc.n, sc.next = 0, 0
+	if sc.onScale != nil {
+		sc.onScale(from, pl.size, rate)
+	}
+}
@@ -0,0 +1,159 @@
+package sublive
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Reverse lookup parameters: at most ptrWorkers lookups run at a time, each
+// bounded by ptrTimeout, and results wait at most ptrGrace (the default of
+// Scanner.PTRGrace) for them once the scan is otherwise done.
+const (
+	ptrWorkers = 5
+	ptrTimeout = 5 * time.Second
+	ptrGrace   = 5 * time.Second
+)
+
+// ptrAnswer is the outcome of the reverse lookup of ip.
+type ptrAnswer struct {
+	ip    string
+	names []string
+}
+
+// ptrHeld is a result waiting for the reverse lookups of missing of its
+// addresses.
+type ptrHeld struct {
+	r       Result
+	missing int
+}
+
+// ptrLookup looks up the PTR names of resolved addresses for the collector,
+// in its own few goroutines, so slow or absent PTR records never hold a
+// probe worker. Every address is looked up once. Apart from the lookups
+// themselves it is only used by the collector goroutine.
+type ptrLookup struct {
+	resolver *net.Resolver
+	grace    time.Duration
+	sem      chan struct{}
+	done     chan ptrAnswer
+	quit     chan struct{}
+	// names caches the answer of every address looked up; waiting holds the
+	// results blocked on each address still being looked up
+	names   map[string][]string
+	waiting map[string][]*ptrHeld
+	held    int
+}
+
+func newPTRLookup(resolver *net.Resolver, grace time.Duration) *ptrLookup {
+	if grace <= 0 {
+		grace = ptrGrace
+	}
+	return &ptrLookup{
+		resolver: resolver,
+		grace:    grace,
+		sem:      make(chan struct{}, ptrWorkers),
+		done:     make(chan ptrAnswer),
+		quit:     make(chan struct{}),
+		names:    map[string][]string{},
+		waiting:  map[string][]*ptrHeld{},
+	}
+}
+
+// hold returns r with its PTR names when all of its addresses were looked
+// up already. Otherwise it starts the missing lookups, keeps r and returns
+// false; r comes back from answer or flush.
+func (pt *ptrLookup) hold(ctx context.Context, r Result) (Result, bool) {
+	if r.Validation == ValidationPoisoned {
+		return r, true
+	}
+	h := &ptrHeld{r: r}
+	for _, ip := range r.IPs {
+		if _, ok := pt.names[ip]; ok || slices.Contains(pt.waiting[ip], h) {
+			continue
+		}
+		if _, ok := pt.waiting[ip]; !ok {
+			go pt.lookup(ctx, ip)
+		}
+		pt.waiting[ip] = append(pt.waiting[ip], h)
+		h.missing++
+	}
+	if h.missing > 0 {
+		pt.held++
+		return Result{}, false
+	}
+	return pt.attach(r), true
+}
+
+// answer records a finished lookup and returns the results it completed.
+func (pt *ptrLookup) answer(a ptrAnswer) []Result {
+	pt.names[a.ip] = a.names
+	var ready []Result
+	for _, h := range pt.waiting[a.ip] {
+		if h.missing--; h.missing == 0 {
+			pt.held--
+			ready = append(ready, pt.attach(h.r))
+		}
+	}
+	delete(pt.waiting, a.ip)
+	return ready
+}
+
+// flush stops waiting for the lookups still running and returns every held
+// result with the names known so far.
+func (pt *ptrLookup) flush() []Result {
+	var ready []Result
+	for _, hs := range pt.waiting {
+		for _, h := range hs {
+			if h.missing > 0 {
+				h.missing = 0
+				ready = append(ready, pt.attach(h.r))
+			}
+		}
+	}
+	// the lookups stay registered so they are not started again
+	for ip := range pt.waiting {
+		pt.waiting[ip] = nil
+	}
+	pt.held = 0
+	return ready
+}
+
+// attach sets r.PTR to the names of its addresses.
+func (pt *ptrLookup) attach(r Result) Result {
+	for _, ip := range r.IPs {
+		for _, n := range pt.names[ip] {
+			if !slices.Contains(r.PTR, n) {
+				r.PTR = append(r.PTR, n)
+			}
+		}
+	}
+	return r
+}
+
+// lookup resolves ip and hands the answer to the collector, unless it has
+// returned meanwhile.
+func (pt *ptrLookup) lookup(ctx context.Context, ip string) {
+	select {
+	case pt.sem <- struct{}{}:
+	case <-pt.quit:
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, ptrTimeout)
+	names, _ := pt.resolver.LookupAddr(ctx, ip)
+	cancel()
+	<-pt.sem
+	a := ptrAnswer{ip: ip}
+	for _, n := range names {
+		n = strings.ToLower(strings.TrimSuffix(n, "."))
+		if ValidHostname(n) && !slices.Contains(a.names, n) {
+			a.names = append(a.names, n)
+		}
+	}
+	select {
+	case pt.done <- a:
+	case <-pt.quit:
+	}
+}
@@ -0,0 +1,154 @@
+package sublive
+
+import (
+	"container/heap"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// holdMax caps how long a Retry-After holds the candidates of an address
+// back, so a server asking for hours can't keep the scan from ending.
+const holdMax = 10 * time.Minute
+
+// RateLimit holds the rate limit headers of a response: the
+// X-RateLimit-*, X-Rate-Limit-* and IETF RateLimit-* (or structured
+// RateLimit) limit, remaining and reset, and Retry-After. Reset and
+// RetryAfter are in seconds from the response; Remaining is nil when the
+// server didn't say.
+type RateLimit struct {
+	Limit      int  `json:"limit,omitempty"`
+	Remaining  *int `json:"remaining,omitempty"`
+	Reset      int  `json:"reset,omitempty"`
+	RetryAfter int  `json:"retry_after,omitempty"`
+}
+
+// rateLimitPrefixes are the header families tried in turn for the limit,
+// remaining and reset fields.
+var rateLimitPrefixes = []string{"X-RateLimit-", "X-Rate-Limit-", "RateLimit-"}
+
+// parseRateLimit reads the rate limit headers of h, nil when there are
+// none.
+func parseRateLimit(h http.Header) *RateLimit {
+	var rl RateLimit
+	found := false
+	field := func(name string) (int, bool) {
+		for _, prefix := range rateLimitPrefixes {
+			if n, err := strconv.Atoi(strings.TrimSpace(h.Get(prefix + name))); err == nil && n >= 0 {
+				return n, true
+			}
+		}
+		return 0, false
+	}
+	// the structured form: RateLimit: limit=100, remaining=50, reset=30
+	structured := map[string]int{}
+	for _, item := range strings.Split(h.Get("RateLimit"), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if n, err := strconv.Atoi(v); ok && err == nil && n >= 0 {
+			structured[strings.ToLower(k)] = n
+		}
+	}
+	get := func(name string) (int, bool) {
+		if n, ok := field(name); ok {
+			return n, true
+		}
+		n, ok := structured[strings.ToLower(name)]
+		return n, ok
+	}
+	if n, ok := get("Limit"); ok {
+		rl.Limit, found = n, true
+	}
+	if n, ok := get("Remaining"); ok {
+		rl.Remaining, found = &n, true
+	}
+	if n, ok := get("Reset"); ok {
+		// X-RateLimit-Reset is often a Unix time rather than a delay
+		if n > 1_000_000_000 {
+			n = max(int(time.Until(time.Unix(int64(n), 0)).Seconds()), 0)
+		}
+		rl.Reset, found = n, true
+	}
+	if d := parseRetryAfter(h.Get("Retry-After")); d > 0 {
+		rl.RetryAfter, found = int(d.Round(time.Second)/time.Second), true
+	}
+	if !found {
+		return nil
+	}
+	return &rl
+}
+
+// ipHolds are the addresses that asked with Retry-After to be left alone
+// until a time. The collector sets them, workers check them before
+// probing.
+type ipHolds struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func newIPHolds() *ipHolds {
+	return &ipHolds{until: make(map[string]time.Time)}
+}
+
+// hold keeps ip back for d, at most holdMax, unless it is held longer
+// already.
+func (h *ipHolds) hold(ip string, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	until := time.Now().Add(min(d, holdMax))
+	if until.After(h.until[ip]) {
+		h.until[ip] = until
+	}
+}
+
+// held returns the latest time one of ips is held until, or the zero
+// time when they may be probed; expired entries are removed.
+func (h *ipHolds) held(ips []string) time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	var latest time.Time
+	for _, ip := range ips {
+		until, ok := h.until[ip]
+		if ok && !now.Before(until) {
+			delete(h.until, ip)
+		} else if until.After(latest) {
+			latest = until
+		}
+	}
+	return latest
+}
+
+// delayed is the collector's queue of candidates held back by a
+// Retry-After, ordered by the time they may go back to the queue.
+type delayed []delayedCandidate
+
+type delayedCandidate struct {
+	c   Candidate
+	due time.Time
+}
+
+func (d *delayed) push(c Candidate, due time.Time) {
+	heap.Push(d, delayedCandidate{c, due})
+}
+
+// ready pops the candidates that are due.
+func (d *delayed) ready(now time.Time) []Candidate {
+	var out []Candidate
+	for d.Len() > 0 && !(*d)[0].due.After(now) {
+		out = append(out, heap.Pop(d).(delayedCandidate).c)
+	}
+	return out
+}
+
+func (d delayed) Len() int           { return len(d) }
+func (d delayed) Less(i, j int) bool { return d[i].due.Before(d[j].due) }
+func (d delayed) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d *delayed) Push(x any)        { *d = append(*d, x.(delayedCandidate)) }
+func (d *delayed) Pop() any {
+	old := *d
+	x := old[len(old)-1]
+	*d = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,165 @@
+package sublive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Record types for Scanner.Records and Scanner.LookupRecords, also the keys
+// of Result.DNSRecords. RecordDMARC is the TXT record of _dmarc.<name>.
+const (
+	RecordMX    = "mx"
+	RecordNS    = "ns"
+	RecordTXT   = "txt"
+	RecordDMARC = "dmarc"
+)
+
+// RecordTypes lists the supported record types.
+var RecordTypes = []string{RecordMX, RecordNS, RecordTXT, RecordDMARC}
+
+// LookupRecords queries the given record types (see RecordTypes) of name
+// with the Scanner's resolver configuration. Values are "10 mail.example.com"
+// for MX, host names for NS and the text of each TXT record; DMARC keeps only
+// v=DMARC1 records. Types without records are left out. err is the first
+// failure other than the name or the records not existing; the map then
+// holds what the other lookups found.
+func (s *Scanner) LookupRecords(ctx context.Context, name string, types []string) (map[string][]string, error) {
+	servers := s.Resolvers
+	if len(servers) == 0 && s.TCPDNS {
+		servers = systemNameservers()
+	}
+	return lookupRecords(ctx, newDNSResolver(servers, s.TCPDNS, s.OnDNSRetry), name, types)
+}
+
+// checkRecordTypes reports the first of types that is not supported.
+func checkRecordTypes(types []string) error {
+	for _, t := range types {
+		if !slices.Contains(RecordTypes, t) {
+			return fmt.Errorf("sublive: unknown record type %q", t)
+		}
+	}
+	return nil
+}
+
+func lookupRecords(ctx context.Context, resolver *net.Resolver, name string, types []string) (map[string][]string, error) {
+	recs := map[string][]string{}
+	var first error
+	for _, t := range types {
+		var vals []string
+		var err error
+		switch t {
+		case RecordMX:
+			var mx []*net.MX
+			mx, err = resolver.LookupMX(ctx, fqdn(name))
+			for _, m := range mx {
+				vals = append(vals, fmt.Sprintf("%d %s", m.Pref, strings.TrimSuffix(m.Host, ".")))
+			}
+		case RecordNS:
+			var ns []*net.NS
+			ns, err = resolver.LookupNS(ctx, fqdn(name))
+			for _, n := range ns {
+				vals = append(vals, strings.TrimSuffix(n.Host, "."))
+			}
+		case RecordTXT:
+			vals, err = resolver.LookupTXT(ctx, fqdn(name))
+		case RecordDMARC:
+			var txt []string
+			txt, err = resolver.LookupTXT(ctx, fqdn("_dmarc."+name))
+			for _, v := range txt {
+				if hasTag(v, "v=DMARC1") {
+					vals = append(vals, v)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("sublive: unknown record type %q", t)
+		}
+		var dnsErr *net.DNSError
+		if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) && first == nil {
+			first = err
+		}
+		if len(vals) > 0 {
+			recs[t] = vals
+		}
+	}
+	return recs, first
+}
+
+// MailAuth is what the records of a domain say about mail authentication.
+type MailAuth struct {
+	// SPF is the v=spf1 TXT record and DMARC the DMARC record, empty when
+	// missing.
+	SPF   string
+	DMARC string
+	// Policy is the p= tag of DMARC ("none", "quarantine" or "reject").
+	Policy string
+}
+
+// ParseMailAuth finds the SPF and DMARC records among records, as returned
+// by LookupRecords with RecordTXT and RecordDMARC.
+func ParseMailAuth(records map[string][]string) MailAuth {
+	var a MailAuth
+	for _, v := range records[RecordTXT] {
+		if hasTag(v, "v=spf1") {
+			a.SPF = v
+			break
+		}
+	}
+	if len(records[RecordDMARC]) > 0 {
+		a.DMARC = records[RecordDMARC][0]
+		for _, tag := range strings.Split(a.DMARC, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(tag), "=")
+			if strings.EqualFold(strings.TrimSpace(k), "p") {
+				a.Policy = strings.ToLower(strings.TrimSpace(v))
+			}
+		}
+	}
+	return a
+}
+
+// hasTag reports whether the TXT record v starts with the version tag, e.g.
+// "v=spf1", case-insensitively.
+func hasTag(v, tag string) bool {
+	v = strings.TrimSpace(v)
+	if len(v) < len(tag) || !strings.EqualFold(v[:len(tag)], tag) {
+		return false
+	}
+	return len(v) == len(tag) || v[len(tag)] == ' ' || v[len(tag)] == ';'
+}
+
+// recordCache does the Scanner.Records lookups of the workers, once per
+// name, so parked and retried candidates don't repeat them. Failed lookups
+// are left out of the records.
+type recordCache struct {
+	resolver *net.Resolver
+	types    []string
+	mu       sync.Mutex
+	m        map[string]map[string][]string
+}
+
+func newRecordCache(resolver *net.Resolver, types []string) *recordCache {
+	return &recordCache{resolver: resolver, types: types, m: map[string]map[string][]string{}}
+}
+
+func (c *recordCache) get(ctx context.Context, name string) map[string][]string {
+	c.mu.Lock()
+	recs, ok := c.m[name]
+	c.mu.Unlock()
+	if ok {
+		return recs
+	}
+	recs, _ = lookupRecords(ctx, c.resolver, name, c.types)
+	if len(recs) == 0 {
+		recs = nil
+	}
+	if ctx.Err() == nil {
+		c.mu.Lock()
+		c.m[name] = recs
+		c.mu.Unlock()
+	}
+	return recs
+}
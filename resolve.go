@@ -0,0 +1,63 @@
+package sublive
+
+import (
+	"context"
+	"sync"
+)
+
+// Lookup is the DNS outcome for one name.
+type Lookup struct {
+	Name   string   `json:"name"`
+	IPs    []string `json:"ips,omitempty"`
+	CNAMEs []string `json:"cnames,omitempty"`
+	Err    string   `json:"error,omitempty"`
+}
+
+// Resolve looks up names with workers concurrent queries against resolvers
+// (host:port; empty means the system resolver). The channel receives one
+// Lookup per name and is closed when all are done or ctx is cancelled.
+func Resolve(ctx context.Context, names []string, resolvers []string, workers int) <-chan Lookup {
+	if workers <= 0 {
+		workers = 30
+	}
+	res := newResolver(resolvers)
+	nameservers := resolvers
+	if len(nameservers) == 0 {
+		nameservers = systemNameservers()
+	}
+	jobs := make(chan string)
+	out := make(chan Lookup, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				l := Lookup{Name: name}
+				ips, err := res.LookupHost(ctx, fqdn(name))
+				err = unqualified(err)
+				l.IPs = ips
+				if err != nil {
+					l.Err = err.Error()
+				}
+				l.CNAMEs = lookupCNAMEChain(ctx, nameservers, name, false)
+				out <- l
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, n := range names {
+			select {
+			case jobs <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,242 @@
+package sublive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Eviction of degrading resolvers: every resolverWindow queries a
+// resolver's error rate over them is looked at, and above
+// resolverMaxErrors it stops getting queries.
+const (
+	resolverWindow    = 50
+	resolverMaxErrors = 0.5
+)
+
+// ResolverSet spreads queries round-robin over DNS servers (host:port)
+// and counts each server's queries and errors. Timeouts, network errors,
+// SERVFAIL and REFUSED are errors; NXDOMAIN is an answer. A server whose
+// error rate over its last queries gets too high is evicted, unless it is
+// the last one left, and the rest share its queries. Set it as
+// Scanner.ResolverSet; it is safe for concurrent use.
+type ResolverSet struct {
+	// OnEvict, when set, is told about every eviction with the error rate
+	// that caused it. It may call the methods of the set.
+	OnEvict func(server string, errorRate float64)
+	evict   bool
+	stats   []*resolverStat
+	next    atomic.Uint32
+	mu      sync.RWMutex
+	// healthy are the stats of the servers still getting queries
+	healthy []*resolverStat
+}
+
+type resolverStat struct {
+	server          string
+	queries, errors atomic.Int64
+	// window counts the errors of the current resolverWindow queries,
+	// under the ResolverSet's lock
+	windowQueries, windowErrors int
+	evicted                     bool
+}
+
+// ResolverStat is the tally of one server of a ResolverSet.
+type ResolverStat struct {
+	Server  string `json:"server"`
+	Queries int64  `json:"queries"`
+	Errors  int64  `json:"errors"`
+	Evicted bool   `json:"evicted,omitempty"`
+}
+
+// NewResolverSet returns a set of servers that evicts degrading ones.
+func NewResolverSet(servers []string) *ResolverSet {
+	s := roundRobin(servers)
+	s.evict = true
+	return s
+}
+
+// roundRobin returns a set that only spreads and counts queries.
+func roundRobin(servers []string) *ResolverSet {
+	s := &ResolverSet{}
+	for _, srv := range servers {
+		st := &resolverStat{server: srv}
+		s.stats = append(s.stats, st)
+		s.healthy = append(s.healthy, st)
+	}
+	return s
+}
+
+// pick returns the next server to query.
+func (s *ResolverSet) pick() *resolverStat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.healthy[int(s.next.Add(1))%len(s.healthy)]
+}
+
+// record counts a query of st that ended with the answer resp or err.
+func (s *ResolverSet) record(st *resolverStat, resp []byte, err error) {
+	failed := err != nil
+	if !failed && len(resp) > 3 {
+		rcode := resp[3] & 0x0f
+		failed = rcode == 2 || rcode == 5
+	}
+	st.queries.Add(1)
+	if failed {
+		st.errors.Add(1)
+	}
+	if !s.evict {
+		return
+	}
+	if rate, evicted := s.count(st, failed); evicted && s.OnEvict != nil {
+		s.OnEvict(st.server, rate)
+	}
+}
+
+// count adds a query to the window of st and evicts st when the window
+// is full and too many of its queries failed.
+func (s *ResolverSet) count(st *resolverStat, failed bool) (rate float64, evicted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.windowQueries++
+	if failed {
+		st.windowErrors++
+	}
+	if st.windowQueries < resolverWindow {
+		return 0, false
+	}
+	rate = float64(st.windowErrors) / float64(st.windowQueries)
+	st.windowQueries, st.windowErrors = 0, 0
+	if rate <= resolverMaxErrors || st.evicted || len(s.healthy) == 1 {
+		return rate, false
+	}
+	st.evicted = true
+	s.healthy = slices.DeleteFunc(slices.Clone(s.healthy), func(h *resolverStat) bool { return h == st })
+	return rate, true
+}
+
+// Servers returns the servers still getting queries.
+func (s *ResolverSet) Servers() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]string, 0, len(s.healthy))
+	for _, st := range s.healthy {
+		out = append(out, st.server)
+	}
+	return out
+}
+
+// Stats returns the tally of every server, in the order they were given.
+func (s *ResolverSet) Stats() []ResolverStat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]ResolverStat, 0, len(s.stats))
+	for _, st := range s.stats {
+		out = append(out, ResolverStat{Server: st.server, Queries: st.queries.Load(), Errors: st.errors.Load(), Evicted: st.evicted})
+	}
+	return out
+}
+
+// ResolverCheck is the health check of CheckResolvers. Zero fields get
+// the defaults.
+type ResolverCheck struct {
+	// Good are names every resolver must resolve (default
+	// one.one.one.one and dns.google).
+	Good []string
+	// Bad is a name that doesn't exist, which a resolver must answer with
+	// NXDOMAIN (default a random label under example.com).
+	Bad string
+	// MaxLatency is the slowest answer to Good allowed (default 1s).
+	MaxLatency time.Duration
+	// Timeout bounds each query (default 3s) and Workers the servers
+	// checked at once (default 50).
+	Timeout time.Duration
+	Workers int
+}
+
+// ResolverFailure is why CheckResolvers dropped a server.
+type ResolverFailure struct {
+	Server string
+	Reason string
+}
+
+// CheckResolvers asks every one of servers for the Good and Bad names of
+// check, concurrently, and returns the servers that answered all of them
+// correctly and fast enough, in the order given, and why the others were
+// dropped: no answer, an answer to the Bad name (a lying resolver) or too
+// slow an answer.
+func CheckResolvers(ctx context.Context, servers []string, check ResolverCheck) (alive []string, failed []ResolverFailure) {
+	if len(check.Good) == 0 {
+		check.Good = []string{"one.one.one.one", "dns.google"}
+	}
+	if check.Bad == "" {
+		check.Bad = fmt.Sprintf("sublive-%016x.example.com", rand.Uint64())
+	}
+	if check.MaxLatency <= 0 {
+		check.MaxLatency = time.Second
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = 3 * time.Second
+	}
+	if check.Workers <= 0 {
+		check.Workers = 50
+	}
+	reasons := make([]string, len(servers))
+	sem := make(chan struct{}, check.Workers)
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			reasons[i] = checkResolver(ctx, srv, check)
+		}()
+	}
+	wg.Wait()
+	for i, srv := range servers {
+		if reasons[i] == "" {
+			alive = append(alive, srv)
+		} else {
+			failed = append(failed, ResolverFailure{srv, reasons[i]})
+		}
+	}
+	return alive, failed
+}
+
+// checkResolver returns why server fails check, or "".
+func checkResolver(ctx context.Context, server string, check ResolverCheck) string {
+	res := newDNSResolver([]string{server}, false, nil)
+	for _, name := range check.Good {
+		qctx, cancel := context.WithTimeout(ctx, check.Timeout)
+		start := time.Now()
+		ips, err := res.LookupHost(qctx, fqdn(name))
+		took := time.Since(start)
+		cancel()
+		switch {
+		case err != nil:
+			return fmt.Sprintf("no answer for %s: %v", name, err)
+		case len(ips) == 0:
+			return "no addresses for " + name
+		case took > check.MaxLatency:
+			return fmt.Sprintf("slow: %s took %s", name, took.Round(time.Millisecond))
+		}
+	}
+	qctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+	ips, err := res.LookupHost(qctx, fqdn(check.Bad))
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		return fmt.Sprintf("lies: %s resolved to %s", check.Bad, ips[0])
+	case !errors.As(err, &dnsErr) || !dnsErr.IsNotFound:
+		return fmt.Sprintf("no NXDOMAIN for %s: %v", check.Bad, err)
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package sublive
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// CanaryName is a name that always resolves, asked by CheckRoot to tell a
+// domain that doesn't exist from DNS that doesn't work at all.
+const CanaryName = "google.com"
+
+// RootCheck is what CheckRoot found out about a root domain before a scan.
+type RootCheck struct {
+	Domain string
+	// IPs are the addresses of the domain itself and NS its nameservers.
+	IPs []string
+	NS  []string
+	// NXDOMAIN is set when the resolvers say the name doesn't exist at
+	// all, rather than merely having no records of a type.
+	NXDOMAIN bool
+	// Err is a lookup that failed for another reason than the name or its
+	// records not existing, such as a timeout.
+	Err error
+	// Network is set when the domain had neither addresses nor
+	// nameservers and CanaryName couldn't be resolved either: DNS itself
+	// is broken, and a scan would only report every name unreachable.
+	Network error
+}
+
+// Missing reports whether the domain has neither addresses nor
+// nameservers, which usually means a typo.
+func (c RootCheck) Missing() bool {
+	return len(c.IPs) == 0 && len(c.NS) == 0
+}
+
+// CheckRoot resolves domain and its NS records through resolvers (as in
+// Scanner.Resolvers, empty for the system resolver), each lookup bounded
+// by timeout. When it has neither, CanaryName is asked too and a failure
+// is reported as RootCheck.Network.
+func CheckRoot(ctx context.Context, domain string, resolvers []string, timeout time.Duration) RootCheck {
+	c := RootCheck{Domain: domain}
+	r := newResolver(resolvers)
+	servers := resolvers
+	if len(servers) == 0 {
+		servers = systemNameservers()
+	}
+	lookup := func(f func(ctx context.Context) error) {
+		lctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		var dnsErr *net.DNSError
+		if err := unqualified(f(lctx)); err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			c.Err = err
+		}
+	}
+	lookup(func(ctx context.Context) (err error) {
+		c.IPs, err = r.LookupHost(ctx, fqdn(domain))
+		return err
+	})
+	lookup(func(ctx context.Context) error {
+		ns, err := r.LookupNS(ctx, fqdn(domain))
+		for _, n := range ns {
+			c.NS = append(c.NS, strings.TrimSuffix(n.Host, "."))
+		}
+		return err
+	})
+	if !c.Missing() {
+		return c
+	}
+	lookup(func(ctx context.Context) error {
+		_, h, err := exchange(ctx, servers, domain, false)
+		c.NXDOMAIN = err == nil && h.RCode == dnsmessage.RCodeNameError
+		return err
+	})
+	lookup(func(ctx context.Context) error {
+		p, h, err := exchange(ctx, servers, CanaryName, false)
+		switch {
+		case err != nil:
+			c.Network = err
+		case p == nil:
+			c.Network = errors.New("no nameservers configured")
+		case h.RCode != dnsmessage.RCodeSuccess:
+			c.Network = fmt.Errorf("%s: %s", CanaryName, h.RCode)
+		}
+		return nil
+	})
+	return c
+}
+
+// CertInfo is the leaf certificate a host presented.
+type CertInfo struct {
+	// Subject and Issuer are common names.
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	DNSNames []string  `json:"dns_names,omitempty"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+func newCertInfo(c *x509.Certificate) *CertInfo {
+	return &CertInfo{Subject: c.Subject.CommonName, Issuer: c.Issuer.CommonName, DNSNames: c.DNSNames, NotAfter: c.NotAfter}
+}
+
+// peerCert returns the leaf certificate ip presents on port 443 for
+// serverName (none sent when empty), or nil without TLS there.
+func peerCert(ctx context.Context, ip, serverName string, timeout time.Duration) *x509.Certificate {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	d := &tls.Dialer{Config: &tls.Config{ServerName: serverName, InsecureSkipVerify: true}}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, "443"))
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	return certs[0]
+}
@@ -0,0 +1,94 @@
+package sublive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// errOutOfScope is returned by the scoped dialer for addresses outside the
+// Scope.
+var errOutOfScope = errors.New("address out of scope")
+
+// Scope is a set of CIDR ranges a scan is authorized to probe over HTTP.
+type Scope struct {
+	v4, v6 *cidrNode
+}
+
+// ParseScope parses CIDRs such as 203.0.113.0/24 or 2001:db8::/32. A bare
+// address is taken as a single host. Any malformed entry is an error.
+func ParseScope(cidrs []string) (*Scope, error) {
+	s := &Scope{v4: &cidrNode{}, v6: &cidrNode{}}
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid scope entry %q", c)
+			}
+			if ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scope entry %q", c)
+		}
+		bits, _ := ipnet.Mask.Size()
+		if v4 := ipnet.IP.To4(); v4 != nil {
+			s.v4.insert(v4, bits, "in")
+		} else {
+			s.v6.insert(ipnet.IP.To16(), bits, "in")
+		}
+	}
+	return s, nil
+}
+
+// Contains reports whether ip is an address inside the scope.
+func (s *Scope) Contains(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return s.v4.lookup(v4) != ""
+	}
+	return s.v6.lookup(addr.To16()) != ""
+}
+
+// scopedDial returns a DialContext that only connects to in-scope addresses
+// of the target host, so redirects and DNS changes between resolution and
+// connect can't reach out-of-scope networks.
+func scopedDial(scope *Scope, resolver *net.Resolver, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips := []string{host}
+		if net.ParseIP(host) == nil {
+			if ips, err = resolver.LookupHost(ctx, fqdn(host)); err != nil {
+				return nil, err
+			}
+		}
+		lastErr := errOutOfScope
+		for _, ip := range ips {
+			if !scope.Contains(ip) {
+				continue
+			}
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, fmt.Errorf("dial %s: %w", addr, lastErr)
+	}
+}
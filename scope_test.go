@@ -0,0 +1,124 @@
+package sublive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		cidrs   []string
+		wantErr bool
+	}{
+		{[]string{"203.0.113.0/24", "2001:db8::/32"}, false},
+		{[]string{" 198.51.100.7 ", "", "2001:db8::1"}, false},
+		{[]string{"203.0.113.0/33"}, true},
+		{[]string{"2001:db8::/129"}, true},
+		{[]string{"203.0.113"}, true},
+		{[]string{"example.com"}, true},
+		{[]string{"203.0.113.0/24", "10.0.0.0/8x"}, true},
+	}
+	for _, tt := range tests {
+		_, err := ParseScope(tt.cidrs)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseScope(%q) error %v, want error %v", tt.cidrs, err, tt.wantErr)
+		}
+	}
+}
+
+func TestScopeContains(t *testing.T) {
+	s, err := ParseScope([]string{"203.0.113.0/24", "198.51.100.7", "10.0.0.0/8", "2001:db8::/32", "2001:db8:ffff::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"203.0.113.0", true},
+		{"203.0.113.255", true},
+		{"203.0.114.0", false},
+		{"198.51.100.7", true},
+		{"198.51.100.8", false},
+		{"10.20.30.40", true},
+		{"11.0.0.1", false},
+		{"::ffff:203.0.113.9", true},
+		{"2001:db8::1", true},
+		{"2001:db8:1234:5678::abcd", true},
+		{"2001:db9::1", false},
+		{"", false},
+		{"not-an-ip", false},
+	}
+	for _, tt := range tests {
+		if got := s.Contains(tt.ip); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestScopedDial(t *testing.T) {
+	s, _ := ParseScope([]string{"203.0.113.0/24"})
+	var dialled []string
+	dial := scopedDial(s, nil, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialled = append(dialled, addr)
+		return nil, errors.New("no network in tests")
+	})
+	if _, err := dial(context.Background(), "tcp", "198.51.100.1:443"); !errors.Is(err, errOutOfScope) {
+		t.Errorf("out-of-scope dial: %v, want %v", err, errOutOfScope)
+	}
+	if len(dialled) > 0 {
+		t.Errorf("out-of-scope address dialled: %q", dialled)
+	}
+	dial(context.Background(), "tcp", "203.0.113.5:443")
+	if len(dialled) != 1 || dialled[0] != "203.0.113.5:443" {
+		t.Errorf("in-scope dial went to %q", dialled)
+	}
+}
+
+func TestRunScope(t *testing.T) {
+	scope, _ := ParseScope([]string{"203.0.113.0/24"})
+	res := &fakeResolver{answers: map[string]ResolveResult{
+		"in.example.com":    {IPs: []string{"203.0.113.10"}},
+		"out.example.com":   {IPs: []string{"198.51.100.10"}},
+		"mixed.example.com": {IPs: []string{"198.51.100.11", "203.0.113.11"}},
+	}}
+	prb := &fakeProber{pages: map[string]fakePage{"in.example.com": {status: 200}, "out.example.com": {status: 200}, "mixed.example.com": {status: 200}}}
+	got := runScan(t, &Scanner{Domains: []string{"example.com"}, Words: []string{"in", "out", "mixed"}, Scope: scope, Resolver: res, Prober: prb})
+	tests := []struct {
+		name             string
+		outOfScope, part bool
+		status, probed   int
+	}{
+		{"in.example.com", false, false, 200, 1},
+		{"out.example.com", true, false, 0, 0},
+		{"mixed.example.com", false, true, 200, 1},
+	}
+	for _, tt := range tests {
+		r := got[tt.name]
+		if r.OutOfScope != tt.outOfScope || r.ScopePartial != tt.part || r.Status != tt.status {
+			t.Errorf("%s: out of scope %v partial %v status %d, want %v %v %d", tt.name, r.OutOfScope, r.ScopePartial, r.Status, tt.outOfScope, tt.part, tt.status)
+		}
+		if n := prb.probes(tt.name); n != tt.probed {
+			t.Errorf("%s probed %d times, want %d", tt.name, n, tt.probed)
+		}
+	}
+}
+
+func BenchmarkScopeContains(b *testing.B) {
+	var cidrs []string
+	for i := range 1000 {
+		cidrs = append(cidrs, fmt.Sprintf("10.%d.%d.0/24", i/256, i%256), fmt.Sprintf("2001:db8:%x::/48", i))
+	}
+	s, err := ParseScope(cidrs)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ips := []string{"10.3.200.17", "192.0.2.1", "2001:db8:2a::1", "2001:db9::1"}
+	b.ResetTimer()
+	for i := 0; b.Loop(); i++ {
+		s.Contains(ips[i%len(ips)])
+	}
+}
@@ -0,0 +1,68 @@
+package sublive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+)
+
+// soft404Slack is how far, as a fraction of the larger of them, the body
+// of a random path may differ in length from the root's and still count
+// as the same page, with soft404MinSlack bytes allowed for tiny bodies.
+// Catch-all pages often echo the path or a request id.
+const (
+	soft404Slack    = 0.02
+	soft404MinSlack = 32
+)
+
+// isSoft404 asks scheme://host for a random path that can't exist and
+// reports whether it answers with status and essentially root, the body
+// of the root response: a host that serves its front page, or the same
+// error page with 200, for everything. The request goes through the
+// probe's client and backoff gate with its own timeout, and is counted by
+// the metrics like the root request; a failed one reports false.
+func (p *probe) isSoft404(ctx context.Context, pin *pinned, scheme, host string, status int, root []byte) bool {
+	if p.gate != nil && !p.gate.wait(ctx) {
+		return false
+	}
+	reqCtx, cancel := context.WithTimeout(context.WithValue(ctx, pinnedKey{}, pin), p.timeout)
+	defer cancel()
+	token := fmt.Sprintf("%016x", rand.Uint64())
+	req, _ := http.NewRequestWithContext(reqCtx, "GET", scheme+"://"+host+"/"+token, nil)
+	p.setHeaders(req)
+	done := p.metrics.request()
+	rsp, err := p.client.Do(req)
+	done()
+	if err != nil {
+		if ctx.Err() == nil {
+			p.log.Debug("soft-404 check failed", "subdomain", host, "error", err)
+		}
+		return false
+	}
+	defer rsp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(rsp.Body, p.bodyMax))
+	body = bytes.ReplaceAll(body, []byte(token), nil)
+	same := rsp.StatusCode == status && sameBody(root, body)
+	p.log.Debug("soft-404 check", "subdomain", host, "status", rsp.StatusCode, "size", len(body), "soft_404", same)
+	return same
+}
+
+// sameBody reports whether a and b are the same page: equal, or HTML of
+// the same title with lengths within soft404Slack of each other. Bodies
+// without a title must be equal.
+func sameBody(a, b []byte) bool {
+	if bodyHash(a) == bodyHash(b) {
+		return true
+	}
+	if title := pageTitle(a); title == "" || title != pageTitle(b) {
+		return false
+	}
+	diff := len(a) - len(b)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= max(int(soft404Slack*float64(max(len(a), len(b)))), soft404MinSlack)
+}
@@ -0,0 +1,212 @@
+package sublive
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// SourceStat is the traffic sent from one of Scanner.SourceAddrs: the
+// names probed, HTTP requests and DNS queries.
+type SourceStat struct {
+	Addr       string `json:"addr"`
+	Names      int64  `json:"names"`
+	Requests   int64  `json:"requests"`
+	DNSQueries int64  `json:"dns_queries"`
+}
+
+// sourceAddr is one of Scanner.SourceAddrs, with its counters. A probe
+// carries the one it sends from in its context (see sources.with).
+type sourceAddr struct {
+	ip                       net.IP
+	set                      *sources
+	names, requests, queries atomic.Int64
+}
+
+// sources spreads the probes of a Run over Scanner.SourceAddrs, each name
+// going out from the next address in turn. A nil sources sends from the
+// default address.
+type sources struct {
+	addrs []*sourceAddr
+	next  atomic.Uint64
+}
+
+// sourceKey is the context key for the *sourceAddr of a probe.
+type sourceKey struct{}
+
+// newSources returns the sources of addrs, checked with
+// CheckSourceAddrs, or nil for no addresses.
+func newSources(addrs []string) (*sources, error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	if err := CheckSourceAddrs(addrs); err != nil {
+		return nil, err
+	}
+	s := &sources{}
+	for _, a := range addrs {
+		s.addrs = append(s.addrs, &sourceAddr{ip: net.ParseIP(a), set: s})
+	}
+	return s, nil
+}
+
+// CheckSourceAddrs returns an error for the first of addrs that is not a
+// local address TCP and UDP sockets can be bound to, as Run does for
+// Scanner.SourceAddrs, so a typo fails the scan instead of every probe.
+func CheckSourceAddrs(addrs []string) error {
+	for _, a := range addrs {
+		ip := net.ParseIP(a)
+		if ip == nil {
+			return fmt.Errorf("sublive: source address %q is not an IP address", a)
+		}
+		if err := bindable(ip); err != nil {
+			return fmt.Errorf("sublive: source address %s: %v", a, err)
+		}
+	}
+	return nil
+}
+
+// bindable binds a TCP listener and a UDP socket to ip and closes them.
+func bindable(ip net.IP) error {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: ip})
+	if err != nil {
+		return err
+	}
+	l.Close()
+	c, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// pick returns the next address.
+func (s *sources) pick() *sourceAddr {
+	return s.addrs[(s.next.Add(1)-1)%uint64(len(s.addrs))]
+}
+
+// with returns ctx for probing one name, from the next address.
+func (s *sources) with(ctx context.Context) context.Context {
+	if s == nil {
+		return ctx
+	}
+	src := s.pick()
+	src.names.Add(1)
+	return context.WithValue(ctx, sourceKey{}, src)
+}
+
+// sourceFrom returns the address ctx sends from, nil for the default.
+func sourceFrom(ctx context.Context) *sourceAddr {
+	src, _ := ctx.Value(sourceKey{}).(*sourceAddr)
+	return src
+}
+
+// sameFamily reports whether a and b are both IPv4 or both IPv6.
+func sameFamily(a, b net.IP) bool {
+	return (a.To4() != nil) == (b.To4() != nil)
+}
+
+// local returns the address to send to dst (host:port or a host) from:
+// this one, or when dst is an address of the other family the next of
+// that family, as an IPv4 source can't reach an IPv6 destination.
+func (src *sourceAddr) local(dst string) net.IP {
+	host, _, err := net.SplitHostPort(dst)
+	if err != nil {
+		host = dst
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || sameFamily(ip, src.ip) {
+		return src.ip
+	}
+	s := src.set
+	start := s.next.Load()
+	for i := range uint64(len(s.addrs)) {
+		if a := s.addrs[(start+i)%uint64(len(s.addrs))]; sameFamily(ip, a.ip) {
+			return a.ip
+		}
+	}
+	return src.ip
+}
+
+// dial returns the DialContext of d from src. A host given by name, such
+// as a redirect target, is resolved first, so each of its addresses is
+// dialled from a source of its family.
+func (src *sourceAddr) dial(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialIP := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dd := *d
+		dd.LocalAddr = &net.TCPAddr{IP: src.local(addr)}
+		return dd.DialContext(ctx, network, addr)
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialIP(ctx, network, addr)
+		}
+		ips, err := d.Resolver.LookupHost(ctx, fqdn(host))
+		if err != nil {
+			return nil, unqualified(err)
+		}
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialIP(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// sourceDialer returns a dialer for network ("tcp" or "udp") to dst that
+// binds to the address of ctx, if any.
+func sourceDialer(ctx context.Context, network, dst string) net.Dialer {
+	var d net.Dialer
+	if src := sourceFrom(ctx); src != nil {
+		if network == "udp" {
+			d.LocalAddr = &net.UDPAddr{IP: src.local(dst)}
+		} else {
+			d.LocalAddr = &net.TCPAddr{IP: src.local(dst)}
+		}
+	}
+	return d
+}
+
+// stats returns the counters of every address, in the order given.
+func (s *sources) stats() []SourceStat {
+	if s == nil {
+		return nil
+	}
+	out := make([]SourceStat, len(s.addrs))
+	for i, src := range s.addrs {
+		out[i] = SourceStat{Addr: src.ip.String(), Names: src.names.Load(), Requests: src.requests.Load(), DNSQueries: src.queries.Load()}
+	}
+	return out
+}
+
+// sourceTransport is the transport of the default client with
+// Scanner.SourceAddrs: one *http.Transport per address, so connections
+// are never reused across them, and a request goes through the one of
+// the address of its context, or of the next address when it has none.
+type sourceTransport struct {
+	sources    *sources
+	transports map[*sourceAddr]http.RoundTripper
+}
+
+func (t *sourceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	src := sourceFrom(req.Context())
+	if src == nil {
+		src = t.sources.pick()
+	}
+	src.requests.Add(1)
+	return t.transports[src].RoundTrip(req)
+}
+
+// SourceStats returns the traffic of the last Run from each of
+// SourceAddrs, nil without them. It is valid once the result channel is
+// closed.
+func (s *Scanner) SourceStats() []SourceStat {
+	return s.sources.stats()
+}
@@ -0,0 +1,109 @@
+package sublive
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestCheckSourceAddrs(t *testing.T) {
+	tests := []struct {
+		addrs []string
+		ok    bool
+	}{
+		{[]string{"127.0.0.1"}, true},
+		{[]string{"127.0.0.1", "host.example.com"}, false},
+		// TEST-NET-1 is never a local address
+		{[]string{"192.0.2.1"}, false},
+	}
+	for _, tt := range tests {
+		if err := CheckSourceAddrs(tt.addrs); (err == nil) != tt.ok {
+			t.Errorf("CheckSourceAddrs(%q) = %v, want ok %v", tt.addrs, err, tt.ok)
+		}
+	}
+	if s, err := newSources(nil); s != nil || err != nil {
+		t.Errorf("newSources(nil) = %v, %v", s, err)
+	}
+}
+
+func TestSourceLocal(t *testing.T) {
+	s := &sources{}
+	for _, a := range []string{"198.51.100.10", "2001:db8::10", "198.51.100.11"} {
+		s.addrs = append(s.addrs, &sourceAddr{ip: net.ParseIP(a), set: s})
+	}
+	v4, v6 := s.addrs[0], s.addrs[1]
+	tests := []struct {
+		src  *sourceAddr
+		dst  string
+		want string
+	}{
+		{v4, "192.0.2.1:443", "198.51.100.10"},
+		{v4, "example.com", "198.51.100.10"},
+		{v4, "[2001:db8::1]:443", "2001:db8::10"},
+		{v6, "2001:db8::1", "2001:db8::10"},
+		{v6, "192.0.2.1:80", "198.51.100.10"},
+	}
+	for _, tt := range tests {
+		if got := tt.src.local(tt.dst); got.String() != tt.want {
+			t.Errorf("%s to %s: from %s, want %s", tt.src.ip, tt.dst, got, tt.want)
+		}
+	}
+	// names go out from each address in turn
+	var picked []string
+	for range 4 {
+		picked = append(picked, sourceFrom(s.with(context.Background())).ip.String())
+	}
+	if want := "[198.51.100.10 2001:db8::10 198.51.100.11 198.51.100.10]"; fmt.Sprint(picked) != want {
+		t.Errorf("picked %v, want %s", picked, want)
+	}
+	if sourceFrom(context.Background()) != nil || (*sources)(nil).with(context.Background()) == nil {
+		t.Error("a context without a source")
+	}
+}
+
+func TestRunSourceAddrs(t *testing.T) {
+	var mu sync.Mutex
+	from := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		mu.Lock()
+		from[host]++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	answers := map[string][]string{}
+	var seeds []Candidate
+	for i := range 6 {
+		name := fmt.Sprintf("h%d.example.com", i)
+		answers[name] = []string{"127.0.0.1"}
+		target, _ := url.Parse("http://" + name + ":" + u.Port() + "/")
+		seeds = append(seeds, Candidate{Name: name, Domain: "example.com", Source: SourceInput, URL: target})
+	}
+	dns := serveDNS(t, answers)
+	addrs := []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"}
+	if err := CheckSourceAddrs(addrs); err != nil {
+		t.Skip(err)
+	}
+	s := &Scanner{Seeds: seeds, SourceAddrs: addrs, Resolvers: []string{dns.addr}, ProbeInternal: true, NoBackoff: true}
+	for name, r := range runScan(t, s) {
+		if r.Status != 200 {
+			t.Errorf("%s: status %d (%s)", name, r.Status, r.Error)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, st := range s.SourceStats() {
+		if st.Names != 2 || st.Requests != 2 || st.DNSQueries == 0 || from[st.Addr] != 2 {
+			t.Errorf("%s: %d names, %d requests, %d DNS queries, %d requests seen by the server", st.Addr, st.Names, st.Requests, st.DNSQueries, from[st.Addr])
+		}
+	}
+	if len(from) != len(addrs) {
+		t.Errorf("requests came from %v", from)
+	}
+}
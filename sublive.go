@@ -1,347 +1,2047 @@
-// sublive - fast CLI subdomain liveness scanner
-// Usage: go build -o sublive && ./sublive -u example.com -t 2 -v -x -o result.txt
-
-package main
+// Package sublive is a fast subdomain liveness scanner. A Scanner resolves
+// candidate names under one or more root domains, probes them over HTTP
+// and HTTPS, and streams a Result for every name it checked. In deep mode
+// live results seed further candidates (permutations, numbered siblings,
+// CNAME targets, redirect and scraped hostnames).
+//
+// The sublive command in cmd/sublive is a thin CLI around this package.
+package sublive
 
 import (
-	"bufio"
+	"cmp"
 	"context"
 	"crypto/tls"
-	"flag"
-	"fmt"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
 	"net"
 	"net/http"
-	"os"
-	"runtime"
-	"sort"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-var version = "0.4"
-
-// small default wordlist. Users should supply more via pipe to stdin or file.
-var defaultWords = []string{
-	"www", "mail", "ftp", "api", "dev", "test", "stage", "admin", "portal", "beta",
-	"shop", "cdn", "m", "mobile", "secure", "webmail",
-}
+// Version is the sublive release.
+const Version = "0.4"
 
+// Result is the outcome of probing one candidate.
 type Result struct {
-	Subdomain string
-	Status    int
-	IP        string
+	// Subdomain is the ASCII name that was probed.
+	Subdomain string `json:"subdomain"`
+	// Unicode is the Unicode form of Subdomain for internationalized names.
+	Unicode string `json:"unicode,omitempty"`
+	// Domain is the root domain the candidate belongs to.
+	Domain string `json:"domain"`
+	// Status is the HTTP status of the first scheme that answered (HTTP,
+	// then HTTPS), or 0 when neither did.
+	Status int `json:"status"`
+	// CheckedAt is when the probe finished, in UTC.
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+	// FirstSeen is when the subdomain was first observed, carried over
+	// from earlier result sets by CarryFirstSeen or History.Record.
+	// Scanner never sets it.
+	FirstSeen time.Time `json:"first_seen,omitzero"`
+	// New is set by History.Record on hosts the history had no record of.
+	New bool `json:"new,omitempty"`
+	// Proto is the protocol of that response, e.g. "HTTP/1.1" or
+	// "HTTP/2.0".
+	Proto string `json:"proto,omitempty"`
+	// URL is the base URL that answered, e.g. "https://admin.example.com"
+	// or, when a redirect on the same host moved to another port,
+	// "https://admin.example.com:8443"; empty without a response.
+	URL string `json:"url,omitempty"`
+	// Path is the path and query that answered in place of /, for a
+	// Candidate given as a URL or with Scanner.Paths.
+	Path string `json:"path,omitempty"`
+	// Reason says why there was no response, one of the Reason values
+	// (see FailureReason), and Error is the raw text of the last error
+	// behind it: the failed lookup, the TCP pre-check or the last HTTP
+	// attempt. Both are empty for names that were not probed, e.g.
+	// internal or out-of-scope ones.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// TLSError is the certificate verification failure of HTTPS with
+	// Scanner.TLSVerify, e.g. "x509: certificate signed by unknown
+	// authority".
+	TLSError string `json:"tls_error,omitempty"`
+	// Timing is how long the network phases of the probe took, with
+	// Scanner.ProfileNet.
+	Timing *NetTiming `json:"timing,omitempty"`
+	// Cert describes the certificate of the HTTPS answer of a SourceRoot
+	// result.
+	Cert *CertInfo `json:"cert,omitempty"`
+	// SNI is the TLS server name sent with Scanner.SNI, set when it differs
+	// from Subdomain and a TLS connection was attempted with it.
+	SNI string `json:"sni,omitempty"`
+	// IP is the address the HTTP connection was made to, or the first
+	// resolved address when none was made; empty when the name didn't
+	// resolve.
+	IP string `json:"ip,omitempty"`
+	// IPs are all resolved addresses.
+	IPs []string `json:"ips,omitempty"`
+	// Family says which address families IPs have, one of the Family
+	// values. FamilyStatus, with Scanner.ProbeBothFamilies, is the status a
+	// dual-stack name got over each family alone, 0 for none.
+	Family       string         `json:"family,omitempty"`
+	FamilyStatus map[string]int `json:"family_status,omitempty"`
+	// IPv6Skipped marks a name with only IPv6 addresses that was not
+	// probed because of Scanner.SkipIPv6.
+	IPv6Skipped bool `json:"ipv6_skipped,omitempty"`
+	// Class is the summary bucket of the result (see ClassifyResult).
+	Class Class `json:"class"`
+	// Validation is the verdict of Scanner.Validate on the addresses (one
+	// of the Validation* values), empty when the name wasn't validated.
+	Validation string `json:"validation,omitempty"`
+	// OutOfScope is set when Scanner.Scope is used and none of IPs is in
+	// it; such names are not probed over HTTP. ScopePartial marks names
+	// with addresses both inside and outside the scope, which are probed
+	// on the in-scope ones only.
+	OutOfScope   bool `json:"out_of_scope,omitempty"`
+	ScopePartial bool `json:"scope_partial,omitempty"`
+	// Conn is "refused" or "filtered" when the TCP pre-check found neither
+	// port 80 nor 443 accepting connections, and empty otherwise.
+	Conn string `json:"conn,omitempty"`
+	// BannerPort is the first non-HTTP port that accepted a connection when
+	// Scanner.Banner is set and HTTP failed, and Banner the sanitized
+	// greeting read from it (possibly empty).
+	BannerPort int    `json:"banner_port,omitempty"`
+	Banner     string `json:"banner,omitempty"`
+	// netFailure marks a probe that timed out or had its connection reset,
+	// as seen by auto-scaling
+	netFailure bool
+	// dnsFailed marks a lookup that failed other than with NXDOMAIN, e.g.
+	// a resolver timeout or SERVFAIL
+	dnsFailed bool
+	// RateLimit holds the rate limit headers of the response, nil when it
+	// had none.
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+	// throttled marks a 429 or reset connection, and retryAfter the
+	// Retry-After of a 429 or 503; attempt and dnsRetry are copied from
+	// the Candidate
+	throttled  bool
+	retryAfter time.Duration
+	attempt    int
+	dnsRetry   int
+	// url is the Candidate's URL, for retries
+	url *url.URL
+	// cancelled marks a probe the scan context ended during
+	cancelled bool
+	// deferred marks a candidate that was not probed because its address
+	// had PerHost probes running already or was held by a Retry-After
+	// until heldUntil, because its verdict from Scanner.Validate was still
+	// being looked up (validating), or whose CNAME target's representative
+	// was still being probed (cname is then its group); the collector
+	// parks it
+	deferred   bool
+	heldUntil  time.Time
+	validating bool
+	// limitIP is the address whose PerHost slot the probe held, the one
+	// the collector wakes parked candidates of; IP may have changed to the
+	// address that answered since
+	limitIP string
+	// cname is the CNAME group of a representative, or of a candidate
+	// waiting for it, with Scanner.CollapseCNAME
+	cname *cnameGroup
+	// Internal is set when the name resolves to a private, loopback or
+	// link-local address, which usually means leaked internal DNS.
+	Internal bool `json:"internal"`
+	// Depth, Source and Origin are copied from the Candidate.
+	Depth  int    `json:"depth"`
+	Source string `json:"source"`
+	Origin string `json:"origin,omitempty"`
+	// CNAMEs is the CNAME chain of Subdomain in resolution order.
+	CNAMEs []string `json:"cnames,omitempty"`
+	// Redirects holds hostnames taken from absolute Location headers
+	// seen while probing this subdomain.
+	Redirects []string `json:"redirects,omitempty"`
+	// RedirectClass is what the redirects followed from Subdomain do, one
+	// of RedirectClasses, and RedirectTarget the URL that decided it.
+	RedirectClass  string `json:"redirect_class,omitempty"`
+	RedirectTarget string `json:"redirect_target,omitempty"`
+	// Referenced holds in-domain hostnames found by Scrape in the
+	// response headers and body.
+	Referenced []string `json:"referenced,omitempty"`
+	// Matched and Filtered list the Text of the Scanner.Match and
+	// Scanner.Filter patterns found in the response body (see KeepMatched).
+	Matched  []string `json:"matched,omitempty"`
+	Filtered []string `json:"filtered,omitempty"`
+	// Body holds the size, word and line counts of the response body with
+	// Scanner.BodyCounts; nil when they were not counted.
+	Body *BodyCounts `json:"body,omitempty"`
+	// Preview is the start of a textual response body with
+	// Scanner.BodyPreview, and PreviewBase64 that of a binary one with
+	// Scanner.PreviewBinary.
+	Preview       string `json:"preview,omitempty"`
+	PreviewBase64 string `json:"preview_base64,omitempty"`
+	// Title is the HTML <title> of the response and BodyHash a hash of
+	// its body, with Scanner.Fingerprint; SourceRoot results always get
+	// Title.
+	Title    string `json:"title,omitempty"`
+	BodyHash string `json:"body_hash,omitempty"`
+	// Soft404 is set by Scanner.Soft404 when a random path of the host
+	// answered like its root, so the 2xx says nothing about the name.
+	// Soft404Kept marks such a result kept in the live bucket with
+	// Scanner.KeepSoft404 (see ClassifyResult).
+	Soft404     bool `json:"soft_404,omitempty"`
+	Soft404Kept bool `json:"soft_404_kept,omitempty"`
+	// EdgeDefault is set by Scanner.EdgeThreshold when the address had
+	// given this status and body to too many other names already, so the
+	// 2xx is the default page of an edge rather than the name's own. The
+	// answer is kept as it was, only the class changes (see
+	// ClassifyResult).
+	EdgeDefault bool `json:"edge_default,omitempty"`
+	// Inherited is set, with Scanner.CollapseCNAME, on a name that was not
+	// probed but given the answer of InheritedFrom, the name probed for
+	// the CNAME target they share: Status, Proto, the redirect class and
+	// target, Soft404, Title, BodyHash and CDN.
+	Inherited     bool   `json:"inherited,omitempty"`
+	InheritedFrom string `json:"inherited_from,omitempty"`
+	// Aliases are the other names of the endpoint when the result
+	// represents a cluster made by GroupResults. Scanner never sets it.
+	Aliases []string `json:"aliases,omitempty"`
+	// DNSRecords holds the records of Scanner.Records by type (see
+	// RecordTypes) when the name resolved.
+	DNSRecords map[string][]string `json:"dns_records,omitempty"`
+	// PTR holds the reverse DNS names of IPs when Scanner.PTR is set.
+	PTR []string `json:"ptr,omitempty"`
+	// Geo is the location of IP when the Scanner has a GeoIP database.
+	Geo *GeoInfo `json:"geo,omitempty"`
+	// DanglingCloud names the cloud provider ("aws", "gcp" or "azure")
+	// whose range the name resolves into when the Scanner has Cloud ranges,
+	// both ports 80 and 443 refused or timed out, and a second lookup gave
+	// the same addresses: a record left pointing at a released address.
+	DanglingCloud string `json:"dangling_cloud,omitempty"`
+	// Attempts holds every HTTP attempt of the probe in order, such as a
+	// refused port 80 before an HTTPS answer, while Status and Reason are
+	// those of the best one. Ports the TCP pre-check found closed are
+	// attempts without a request.
+	Attempts []ProbeAttempt `json:"attempts,omitempty"`
+	// Findings are the finding tags of the result (see FindingsOf), most
+	// severe first.
+	Findings []string `json:"findings,omitempty"`
+	// CDN names the CDN the host is served by ("cloudflare", "akamai", ...)
+	// when the Scanner has a CDNDetector and one was recognised.
+	CDN string `json:"cdn,omitempty"`
+	// ASN and ASName are the autonomous system of IP, filled in by
+	// callers with LookupASNs.
+	ASN    int    `json:"asn,omitempty"`
+	ASName string `json:"as_name,omitempty"`
+	// PreviousStatus is the status from an earlier result set when the
+	// subdomain was rechecked; nil otherwise. Scanner never sets it.
+	PreviousStatus *int `json:"previous_status,omitempty"`
 }
 
-func worker(ctx context.Context, domain string, jobs <-chan string, results chan<- Result, verbose bool, client *http.Client, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case sub, ok := <-jobs:
-			if !ok {
-				return
-			}
+// Scanner holds the options for a scan. The zero value is not usable: at
+// least Domains or Seeds must be set. Fields must not be changed while Run is active.
+type Scanner struct {
+	// Domains are the root domains to scan, in ASCII form (see ToASCII).
+	Domains []string
+	// Words are prefixed to every domain to form the initial candidates.
+	Words []string
+	// Seeds are extra fully qualified candidates, e.g. from FetchCT.
+	Seeds []Candidate
+	// ProbeRoot probes every domain of Domains itself, with SourceRoot,
+	// and its www name before any other candidate, as a baseline for the
+	// rest. Root results always get their Title and Cert. Without Words
+	// the www name is only probed when Seeds have it, so a scan of CT or
+	// zone transfer names alone gets no wordlist name.
+	ProbeRoot bool
 
-			// Resolve quickly
-			ips, _ := net.LookupHost(sub)
-			ip := ""
-			if len(ips) > 0 {
-				ip = ips[0]
-			}
+	// Workers is the number of concurrent probes (default 30).
+	Workers int
+	// AutoScale ignores Workers, starts with MinWorkers (default 10) and
+	// adjusts the worker count up to MaxWorkers (default 300) from the
+	// rolling rate of timeouts and connection resets: above 20% the pool
+	// shrinks, below 5% it grows while work is queued. OnScale, when set,
+	// is called after every change.
+	AutoScale  bool
+	MinWorkers int
+	MaxWorkers int
+	OnScale    func(from, to int, failureRate float64)
+	// PerHost caps concurrent probes per resolved address (0 means no cap).
+	// Candidates for a saturated address are parked without holding a
+	// worker and resume as its probes finish. OnIPLoad, when set, is called
+	// every 5s with the busiest addresses.
+	PerHost  int
+	OnIPLoad func([]IPLoad)
+	// SecondPass holds back names that looked unreachable because of a
+	// timeout, connection reset or failed lookup and probes them again once
+	// the main queue has drained, with SecondPassWorkers workers (default
+	// 5) and doubled timeouts. Recovered hosts are not expanded in deep
+	// mode; Recovered reports how many there were.
+	SecondPass        bool
+	SecondPassWorkers int
+	// NoBackoff disables the automatic backoff: by default a burst of 429
+	// responses or connection resets from one address pauses all probing
+	// (honoring Retry-After), then ramps back up, and the throttled
+	// candidates are probed again instead of being reported with the
+	// throttled status. OnBackoff, when set, is called for every pause.
+	// Besides, an address that answers 429 or 503 with a Retry-After is
+	// left alone until then, at most 10 minutes: its remaining candidates
+	// wait in a delayed queue, counted by RateDeferred.
+	NoBackoff bool
+	OnBackoff func(Backoff)
+	// MaxLive stops handing out candidates once that many live results were
+	// found (0 means no limit). Probes already running finish and are
+	// reported; the rest count as Skipped.
+	MaxLive int
+	// MaxRequests and MaxBytes are budgets for the whole scan: the HTTP
+	// requests sent, redirects, retries and the second pass included, and
+	// the bytes received, response headers approximately and the body parts
+	// read. When one is used up the scan ends as if ctx had, the candidates
+	// left count as Skipped and BudgetExhausted reports it. 0 means no
+	// limit. A custom Prober is not counted.
+	MaxRequests int64
+	MaxBytes    int64
+	// Live is what MaxLive counts: the results it reports true for. When
+	// nil they are those of ClassLive or, with LiveCodes set, those whose
+	// status is one of LiveCodes unless they were demoted to ClassSoft404
+	// or ClassEdgeDefault. See also Scanner.IsLive.
+	LiveCodes StatusRanges
+	Live      func(Result) bool
+	// JitterMin and JitterMax delay every probe by a random duration in
+	// that range, after resolution, so requests from the pool don't go out
+	// in evenly spaced bursts. Equal values give a fixed delay.
+	JitterMin time.Duration
+	JitterMax time.Duration
+	// Validate re-resolves every name that resolved against
+	// TrustedResolvers (nil means DefaultTrustedResolvers), at most 10 at
+	// a time, to catch resolvers that answer for names that don't exist.
+	// The lookups run beside the workers, with the names parked until
+	// their verdict is in. Names the trusted resolvers don't know are
+	// marked poisoned and not probed.
+	Validate         bool
+	TrustedResolvers []string
+	// FastDNS resolves all Words and Seeds up front with raw queries over a
+	// few shared UDP sockets, rotating through Resolvers (or the resolv.conf
+	// nameservers), and only hands names that resolved to the workers. It
+	// is much faster for huge wordlists; names generated in deep mode are
+	// still resolved by the workers. FastDNSRate caps the queries per
+	// second sent to each resolver (0 means no cap). Only A records are
+	// asked for.
+	FastDNS     bool
+	FastDNSRate int
+	// PTR looks up the reverse DNS names of every resolved address, once
+	// per address and a few at a time, and stores them in Result.PTR; in
+	// deep mode in-domain PTR names become candidates. Results wait for
+	// their lookups, but once nothing else is left at most PTRGrace
+	// (default 5s), after which they are sent without the missing names.
+	PTR      bool
+	PTRGrace time.Duration
+	// Records lists record types (see RecordTypes) looked up for every
+	// name that resolved, once per name, into Result.DNSRecords. Use
+	// LookupRecords for the root domains.
+	Records []string
+	// Timeout bounds the HTTP attempts for one candidate together, and
+	// ConnectTimeout, TLSTimeout and ResponseTimeout each TCP connect, TLS
+	// handshake and wait for the response headers; see ProbeTimeouts for
+	// the defaults. The phases don't apply to a custom Client.
+	Timeout         time.Duration
+	ConnectTimeout  time.Duration
+	TLSTimeout      time.Duration
+	ResponseTimeout time.Duration
+	// Resolvers are DNS servers (host:port) used for lookups. Empty means
+	// the system resolver and the nameservers from /etc/resolv.conf.
+	// Truncated or failed UDP answers from Resolvers are asked again over
+	// TCP to the same server, and OnDNSRetry, when set, is told why.
+	// TCPDNS sends every query over TCP, with the resolv.conf nameservers
+	// when Resolvers is empty.
+	Resolvers  []string
+	TCPDNS     bool
+	OnDNSRetry func(server string, err error)
+	// ResolverSet, when set, takes the lookups of the workers instead of
+	// Resolvers, rebalancing them when it evicts a degrading server. CNAME
+	// chains and FastDNS still use Resolvers, or the servers of the set
+	// when Resolvers is empty.
+	ResolverSet *ResolverSet
+	// DNSRetries is how many times a candidate whose lookup was answered
+	// REFUSED or SERVFAIL goes back to the queue, to be looked up again
+	// from the next resolver in turn, before its result is recorded with
+	// ReasonDNSRefused or ReasonServfail (0 means DefaultDNSRetries,
+	// negative none). DNSRetried and DNSRescued report on them.
+	DNSRetries int
+	// Resolver, when set, resolves the names the workers probe in place of
+	// DNS, and Prober fetches them in place of the HTTP client; fakes of
+	// both run a scan entirely offline. Names from the HostCache or FastDNS
+	// still get their CNAME chains from the resolvers, and Preflight,
+	// Banner and the soft-404 check still connect themselves.
+	Resolver Resolver
+	Prober   Prober
+	// HostCache, when set, is consulted before resolving a name and filled
+	// with successful lookups. Share one across runs to skip stable names.
+	HostCache *HostCache
+	// GeoIP, when set, adds the location of each resolved address.
+	GeoIP *GeoDB
+	// CDN, when set, tags results served by a known CDN.
+	CDN *CDNDetector
+	// Cloud, when set, tags names resolving into a cloud provider's ranges
+	// that nothing answers on (see Result.DanglingCloud), at the cost of a
+	// second lookup for each of them.
+	Cloud *CloudRanges
+	// Interesting, when set, tags names it matches with
+	// FindingInterestingName (see DefaultInteresting).
+	Interesting *regexp.Regexp
+	// Scope, when set, limits HTTP probing to names with an address in it
+	// (see Result.OutOfScope); the default client also refuses to connect
+	// outside it, including on redirects. A custom Client is not restricted.
+	Scope *Scope
+	// Preflight makes a quick TCP connect to ports 80 and 443 before the
+	// HTTP attempts and skips the schemes whose port doesn't accept, so dead
+	// hosts don't cost two full HTTP timeouts. PreflightTimeout bounds each
+	// connect (default 2s).
+	Preflight        bool
+	PreflightTimeout time.Duration
+	// Banner connects to BannerPorts (nil means DefaultBannerPorts) of
+	// hosts that did not answer HTTP and records the first greeting, so
+	// SSH- or mail-only hosts are not reported as unreachable.
+	Banner      bool
+	BannerPorts []int
+	// ProbeInternal probes names whose addresses are all internal (see
+	// Result.Internal); by default they are only resolved.
+	ProbeInternal bool
+	// ProbeBothFamilies probes dual-stack names over IPv4 and IPv6 apart,
+	// after the probe over all their addresses, into Result.FamilyStatus.
+	ProbeBothFamilies bool
+	// SkipIPv6 leaves IPv6 addresses out of probing, for machines without
+	// IPv6 connectivity (see HasIPv6): dual-stack names are probed over
+	// IPv4 only, and names with only IPv6 addresses are not probed but
+	// marked Result.IPv6Skipped.
+	SkipIPv6 bool
+	// Client is used for probing. When nil a client that skips TLS
+	// verification and records redirect hosts is built.
+	//
+	// TLSVerify makes that client verify certificates; a host whose
+	// certificate fails gets Result.TLSError and ClassBadCert instead of
+	// looking unreachable. TLSMinVersion is the lowest TLS version offered
+	// (e.g. tls.VersionTLS10; 0 means Go's default, TLS 1.2), and below TLS
+	// 1.2 the legacy cipher suites are offered too. ClientCertificates are
+	// presented to servers that ask for one.
+	Client             *http.Client
+	TLSVerify          bool
+	TLSMinVersion      uint16
+	ClientCertificates []tls.Certificate
+	// SNI, when set, is the TLS server name sent to the probed hosts in
+	// place of their own, e.g. to test domain fronting; the Host header
+	// still carries the probed name and redirect targets get their own
+	// names. The default client then reuses no connections. Empty means
+	// every host is sent its name.
+	SNI string
+	// DisableKeepAlives turns off connection reuse in the default client;
+	// most candidates are distinct hosts, so reuse rarely pays off.
+	DisableKeepAlives bool
+	// HTTP2 lets the default client negotiate HTTP/2 over TLS; without it
+	// every probe uses HTTP/1.1. Result.Proto records what was used.
+	HTTP2 bool
+	// HTTP3 tries HTTPS over QUIC (HTTP/3, UDP 443) for hosts that gave no
+	// HTTP answer over TCP, bounded by HTTP3Timeout (default Timeout);
+	// HTTP3Only skips TCP probing altogether. Redirects are not followed
+	// over HTTP/3. Both need a build with HTTP3Supported.
+	HTTP3        bool
+	HTTP3Only    bool
+	HTTP3Timeout time.Duration
+	// ProfileNet times the DNS lookup, TCP connect, TLS handshake and
+	// first byte of every probe into Result.Timing, at the cost of tracing
+	// every request.
+	ProfileNet bool
+	// Paths are requested in turn on every host until one answers other
+	// than 404, instead of just /; the one that answered is Result.Path.
+	// Every path is a request of its own, counted by MaxRequests and the
+	// metrics and held by the backoff. A Candidate with a URL asks its
+	// own path only.
+	Paths []string
+	// CacheBust adds a random query parameter to every probe request, so
+	// a cache in front of a host can't answer with a stale page.
+	CacheBust bool
+	// Headers are added to every probe request; UserAgent, when set,
+	// replaces Go's default User-Agent.
+	Headers   http.Header
+	UserAgent string
+	// Exclude lists names that are never probed, from any source. Plain
+	// entries exclude the name and its subdomains; entries containing
+	// wildcards are matched with path.Match against the full name.
+	Exclude []string
+	// Order is the order seeds are probed in: OrderAsIs (the default),
+	// OrderSmart or OrderRandom, see OrderCandidates. Names found during
+	// the scan are queued as they come.
+	Order string
+	// Logger, when set, receives a record for every failed lookup and
+	// failed request (timeouts, resets, TLS errors) at info level and for
+	// every answered request at debug level, with subdomain, ip, error and
+	// duration attributes.
+	Logger *slog.Logger
+	// Metrics, when set, is kept up to date with the progress of the scan
+	// (see NewMetrics).
+	Metrics *Metrics
 
-			// Try HTTP then HTTPS with per-request timeout
-			reqCtx, cancel := context.WithTimeout(ctx, 8*time.Second)
-			status := 0
-			// HTTP attempt
-			httpReq, _ := http.NewRequestWithContext(reqCtx, "GET", "http://"+sub, nil)
-			resp, err := client.Do(httpReq)
-			if err == nil && resp != nil {
-				status = resp.StatusCode
-				resp.Body.Close()
-			} else {
-				// HTTPS fallback
-				httpsReq, _ := http.NewRequestWithContext(reqCtx, "GET", "https://"+sub, nil)
-				resp2, err2 := client.Do(httpsReq)
-				if err2 == nil && resp2 != nil {
-					status = resp2.StatusCode
-					resp2.Body.Close()
-				}
-			}
-			cancel()
+	// Deep enables recursion: live results seed new candidates.
+	Deep bool
+	// Depth is the maximum permutation depth in deep mode.
+	Depth int
+	// CNAMEChains looks up the CNAME chain of every name into
+	// Result.CNAMEs outside deep mode too; Deep and CollapseCNAME do so
+	// anyway. Without any of them only a custom Resolver or FastDNS fill it
+	// in, from their own answers.
+	CNAMEChains bool
+	// Permutations are applied to the first label of live results in deep
+	// mode; nil means DefaultPermPatterns.
+	Permutations []PermPattern
+	// Mine splits the names of live results in deep mode into tokens on
+	// '-', '.' and digits; a token seen in MineMin distinct live names
+	// (DefaultMineMin when 0) is combined with the other tokens and the
+	// wordlist into candidates of SourceMined, at most MinedMax of them
+	// (DefaultMinedMax when 0).
+	Mine     bool
+	MineMin  int
+	MinedMax int
+	// AltNumbers generates numbered siblings of live hosts in deep mode.
+	// AltLimit is the highest number tried and AltMisses the number of
+	// consecutive misses after which a numbered run stops.
+	AltNumbers bool
+	AltLimit   int
+	AltMisses  int
+	// Harvest records hostnames from redirect Location headers and, in
+	// deep mode, scans the in-domain ones.
+	Harvest bool
+	// Scrape scans live responses for referenced in-domain hostnames.
+	Scrape bool
+	// Match and Filter are tested against the body of every response and
+	// the patterns found are listed in Result.Matched and Result.Filtered;
+	// which results to keep is up to the caller (see KeepMatched).
+	Match  []BodyPattern
+	Filter []BodyPattern
+	// BodyCounts fills in Result.Body for every response, e.g. to tell
+	// the default page of a wildcard from real apps by its size.
+	BodyCounts bool
+	// BodyPreview keeps up to that many bytes from the start of every
+	// textual response body in Result.Preview, as valid UTF-8 with
+	// control characters stripped (0 means none). Binary bodies are
+	// skipped unless PreviewBinary is set, which stores them in
+	// Result.PreviewBase64 instead.
+	BodyPreview   int
+	PreviewBinary bool
+	// Fingerprint stores the title and a hash of every response body in
+	// Result.Title and Result.BodyHash, for GroupResults.
+	Fingerprint bool
+	// Soft404 makes one more request to every 2xx host, for a random path
+	// that can't exist, and sets Result.Soft404 when it gets the same
+	// status and essentially the same body as the root, which moves the
+	// result from ClassLive to ClassSoft404 unless KeepSoft404 is set.
+	Soft404     bool
+	KeepSoft404 bool
+	// EdgeThreshold, when > 0, catches edges that give every Host the same
+	// page: once that many names got the same 2xx status and body from
+	// one address, the names after them answered so by it are marked
+	// Result.EdgeDefault, which moves them from ClassLive to
+	// ClassEdgeDefault; the first EdgeThreshold stay as they are. Bodies
+	// are compared by Result.BodyHash, so it implies Fingerprint.
+	// EdgeSaturated reports the addresses.
+	EdgeThreshold int
+	// CollapseCNAME probes one name for every CNAME target, the end of the
+	// chain, and holds back the other names behind it until that result
+	// is in. When it is a catch-all answer (Soft404, so that needs to be
+	// on as well) or a redirect to the apex, the others are not probed
+	// but marked Result.Inherited with that answer; otherwise they are
+	// probed as usual. Root names and URL candidates are always probed.
+	CollapseCNAME bool
+	// BodyMaxBytes is how much of a body is read, once per response, for
+	// Scrape, Match, Filter, BodyCounts, BodyPreview, Fingerprint and
+	// Soft404 (default 256 KiB).
+	BodyMaxBytes int64
+	// ScrapeMaxBytes is the former name of BodyMaxBytes, used when that
+	// is 0.
+	//
+	// Deprecated: use BodyMaxBytes.
+	ScrapeMaxBytes int64
+	// LowMemory shrinks the buffer between the workers and the collector
+	// from 10000 results, some 9 MB, to one per worker, for callers that
+	// keep memory down on huge candidate lists. Workers then wait on a
+	// slow collector sooner.
+	LowMemory bool
+	// Hook, when set, is called with every result of the scan, one at a
+	// time on a goroutine of its own, for processing such as pushing the
+	// results elsewhere. Results wait for it in a queue of HookQueue
+	// (default DefaultHookQueue); when it is full they are passed on
+	// without Hook, counted by HookDropped, so a slow Hook never holds up
+	// the scan. A panic in Hook is logged. The result channel closes once
+	// Hook has seen every queued result; after ctx ended, the results
+	// still queued are dropped instead.
+	Hook      func(Result)
+	HookQueue int
+	// Resumed are the results of an earlier, unfinished run of the same
+	// scan, such as a checkpoint read with ReadResults. Their names are
+	// queued ahead of the other candidates but not probed again: the
+	// result is sent on as it was, so it is counted, output and, in deep
+	// mode, expanded like a fresh one.
+	Resumed []Result
+	// SourceAddrs are local addresses to send from, to spread a scan over
+	// several egress addresses: every name is probed from the next of them
+	// in turn, its DNS queries and HTTP requests alike, with one HTTP
+	// transport per address. Without Resolvers or ResolverSet the servers
+	// of /etc/resolv.conf are then queried directly, and FastDNS spreads
+	// its sockets over them. Run fails when one can't be bound. Client,
+	// a custom Resolver and HTTP/3 attempts don't use them. SourceStats
+	// reports the traffic of each.
+	SourceAddrs []string
 
-			if verbose {
-				fmt.Printf("[+] checked %s -> %d %s\n", sub, status, ip)
-			}
+	// skipped, recovered, rateDeferred, hookDropped, dnsRetried and
+	// dnsRescued are reported by the methods of those names
+	skipped      int64
+	recovered    int64
+	rateDeferred int64
+	hookDropped  int64
+	dnsRetried   int64
+	dnsRescued   int64
+	// budget is the last Run's, nil without MaxRequests and MaxBytes
+	budget *budget
+	// edges is the last Run's, nil without EdgeThreshold, and sources
+	// without SourceAddrs
+	edges   *edgeTracker
+	sources *sources
+	// pause is held shut by Pause, and noPerms is set by
+	// SetPermutations(false)
+	pause   pauseGate
+	noPerms int32
+}
 
-			results <- Result{Subdomain: sub, Status: status, IP: ip}
+// Run starts the scan and returns a channel that receives a Result for every
+// candidate probed. The channel is closed when all candidates (including
+// those generated in deep mode) are done or ctx is cancelled, and only after
+// the last Result was sent, so ranging over it sees every result without
+// further synchronization. Callers must drain the channel.
+func (s *Scanner) Run(ctx context.Context) (<-chan Result, error) {
+	if len(s.Domains) == 0 && len(s.Seeds) == 0 {
+		return nil, errors.New("sublive: no domains or seeds to scan")
+	}
+	if err := checkRecordTypes(s.Records); err != nil {
+		return nil, err
+	}
+	if (s.HTTP3 || s.HTTP3Only) && !HTTP3Supported {
+		return nil, errors.New("sublive: HTTP/3 needs a build with the http3 tag")
+	}
+	workers := s.Workers
+	if workers <= 0 {
+		workers = 30
+	}
+	var sc *scaler
+	if s.AutoScale {
+		sc = &scaler{min: s.MinWorkers, max: s.MaxWorkers, onScale: s.OnScale}
+		if sc.min <= 0 {
+			sc.min = 10
+		}
+		if sc.max <= 0 {
+			sc.max = 300
 		}
+		sc.max = max(sc.max, sc.min)
+		workers = sc.min
+	}
+	perms := s.Permutations
+	if perms == nil {
+		perms, _ = CompilePermPatterns(DefaultPermPatterns)
 	}
-}
 
-func loadWordlistFromStdin() ([]string, error) {
-	fi, err := os.Stdin.Stat()
-	if err != nil {
+	seeds := []Candidate{}
+	for _, d := range s.Domains {
+		seeds = append(seeds, Candidates(s.Words, d)...)
+	}
+	seeds = append(seeds, s.Seeds...)
+	if err := OrderCandidates(seeds, s.Order); err != nil {
 		return nil, err
 	}
-	// If data is being piped
-	if (fi.Mode() & os.ModeCharDevice) == 0 {
-		out := []string{}
-		s := bufio.NewScanner(os.Stdin)
-		for s.Scan() {
-			line := strings.TrimSpace(s.Text())
-			if line != "" {
-				out = append(out, line)
+	var resumed map[string]Result
+	if len(s.Resumed) > 0 {
+		resumed = make(map[string]Result, len(s.Resumed))
+		var again []Candidate
+		for _, r := range s.Resumed {
+			if _, ok := resumed[r.Subdomain]; !ok {
+				resumed[r.Subdomain] = r
+				again = append(again, Candidate{Name: r.Subdomain, Domain: r.Domain, Depth: r.Depth, Source: r.Source, Origin: r.Origin})
 			}
 		}
-		return out, s.Err()
+		seeds = append(again, seeds...)
+	}
+	if s.ProbeRoot {
+		// enqueue drops the later duplicates of these
+		var roots []Candidate
+		for _, d := range s.Domains {
+			roots = append(roots, Candidate{Name: d, Domain: d, Source: SourceRoot})
+			// a www name among the seeds keeps its source
+			www := Candidate{Name: "www." + d, Domain: d, Source: SourceWordlist}
+			if i := slices.IndexFunc(seeds, func(c Candidate) bool { return c.Name == www.Name }); i >= 0 {
+				roots = append(roots, seeds[i])
+			} else if len(s.Words) > 0 {
+				roots = append(roots, www)
+			}
+		}
+		seeds = append(roots, seeds...)
 	}
-	return nil, nil
-}
 
-func loadWordlistFromFile(path string) ([]string, error) {
-	f, err := os.Open(path)
+	srcs, err := newSources(s.SourceAddrs)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	out := []string{}
-	s := bufio.NewScanner(f)
-	for s.Scan() {
-		line := strings.TrimSpace(s.Text())
-		if line != "" {
-			out = append(out, line)
+	s.sources = srcs
+	timeouts := s.Timeouts()
+	p := &probe{
+		timeout:      timeouts.Request,
+		timeouts:     timeouts,
+		client:       s.Client,
+		resolver:     newDNSResolver(s.Resolvers, s.TCPDNS, s.OnDNSRetry),
+		hosts:        s.HostCache,
+		geo:          s.GeoIP,
+		cdn:          s.CDN,
+		cloud:        s.Cloud,
+		interesting:  s.Interesting,
+		scope:        s.Scope,
+		pause:        &s.pause,
+		probeLocal:   s.ProbeInternal,
+		bothFamilies: s.ProbeBothFamilies,
+		skipIPv6:     s.SkipIPv6,
+		preflight:    s.PreflightTimeout,
+		nameservers:  s.Resolvers,
+		harvest:      s.Harvest,
+		headers:      s.Headers,
+		userAgent:    s.UserAgent,
+		cnames:       s.Deep || s.CollapseCNAME || s.CNAMEChains,
+		tcpDNS:       s.TCPDNS,
+		jitterMin:    s.JitterMin,
+		jitterMax:    s.JitterMax,
+		tlsConfig:    newTLSConfig(s),
+		http3:        s.HTTP3 || s.HTTP3Only,
+		http3Only:    s.HTTP3Only,
+		h3Timeout:    s.HTTP3Timeout,
+		sni:          strings.ToLower(strings.TrimSuffix(s.SNI, ".")),
+		profileNet:   s.ProfileNet,
+		paths:        s.Paths,
+		cacheBust:    s.CacheBust,
+		log:          s.Logger,
+		metrics:      s.Metrics,
+		resumed:      resumed,
+		sources:      srcs,
+	}
+	if p.log == nil {
+		p.log = slog.New(slog.DiscardHandler)
+	}
+	p.lookup, p.prober = s.Resolver, s.Prober
+	if p.lookup == nil {
+		p.lookup = p
+	}
+	if p.prober == nil {
+		p.prober = p
+	}
+	if p.h3Timeout <= 0 {
+		p.h3Timeout = p.timeout
+	}
+	if !s.Preflight {
+		p.preflight = 0
+	} else if p.preflight <= 0 {
+		p.preflight = 2 * time.Second
+	}
+	if s.ResolverSet != nil {
+		p.resolver = newSetResolver(s.ResolverSet, s.TCPDNS, s.OnDNSRetry)
+		if len(p.nameservers) == 0 {
+			p.nameservers = s.ResolverSet.Servers()
 		}
 	}
-	return out, s.Err()
-}
+	if len(p.nameservers) == 0 {
+		p.nameservers = systemNameservers()
+		// the system resolver can't send from the source addresses, so
+		// its servers are queried directly then
+		if s.TCPDNS || srcs != nil {
+			p.resolver = newDNSResolver(p.nameservers, s.TCPDNS, s.OnDNSRetry)
+		}
+	}
+	if p.client == nil {
+		poolMax := workers
+		if sc != nil {
+			poolMax = sc.max
+		}
+		p.client = newClient(s, p, poolMax)
+	}
+	if s.PerHost > 0 {
+		p.limiter = newIPLimiter(s.PerHost)
+	}
+	if s.CollapseCNAME {
+		p.collapse = newCNAMEGroups()
+	}
+	if s.Validate {
+		p.validator, p.parkUnvalidated = newValidator(s.TrustedResolvers), true
+	}
+	if len(s.Records) > 0 {
+		p.records = newRecordCache(p.resolver, s.Records)
+	}
+	var th *throttle
+	if !s.NoBackoff {
+		th = newThrottle(s.OnBackoff)
+		p.gate, p.holds = th.gate, th.holds
+	}
+	if s.Banner {
+		p.bannerPorts = s.BannerPorts
+		if p.bannerPorts == nil {
+			p.bannerPorts = DefaultBannerPorts
+		}
+	}
+	if s.Scrape {
+		p.scrapers = make(map[string]*scraper, len(s.Domains))
+		for _, d := range s.Domains {
+			p.scrapers[d] = newScraper(d)
+		}
+	}
+	p.match, p.filter = s.Match, s.Filter
+	p.counts = s.BodyCounts
+	p.preview, p.previewBinary = s.BodyPreview, s.PreviewBinary
+	p.fingerprint = s.Fingerprint || s.EdgeThreshold > 0
+	p.soft404, p.keepSoft404 = s.Soft404, s.KeepSoft404
+	p.bodyMax = s.BodyMaxBytes
+	if p.bodyMax <= 0 {
+		p.bodyMax = s.ScrapeMaxBytes
+	}
+	if p.bodyMax <= 0 {
+		p.bodyMax = 256 << 10
+	}
 
-func uniqStrings(in []string) []string {
-	m := make(map[string]struct{})
-	out := []string{}
-	for _, s := range in {
-		if s == "" {
-			continue
+	var pt *ptrLookup
+	if s.PTR {
+		pt = newPTRLookup(p.resolver, s.PTRGrace)
+	}
+
+	var mass *massResolver
+	if s.FastDNS {
+		servers := p.nameservers
+		var err error
+		if mass, err = newMassResolver(servers, s.FastDNSRate, srcs); err != nil {
+			return nil, err
 		}
-		if _, ok := m[s]; !ok {
-			m[s] = struct{}{}
-			out = append(out, s)
+	}
+
+	atomic.StoreInt64(&s.rateDeferred, 0)
+	atomic.StoreInt64(&s.dnsRetried, 0)
+	atomic.StoreInt64(&s.dnsRescued, 0)
+	s.edges = newEdgeTracker(s.EdgeThreshold)
+	// the budget's context below ends with every scan, the hook's only
+	// with the caller's
+	hookCtx := ctx
+	s.budget = nil
+	if s.MaxRequests > 0 || s.MaxBytes > 0 {
+		var stop context.CancelCauseFunc
+		ctx, stop = context.WithCancelCause(ctx)
+		s.budget = &budget{maxRequests: s.MaxRequests, maxBytes: s.MaxBytes, stop: stop}
+		p.client = &http.Client{Transport: s.budget.wrap(p.client.Transport), CheckRedirect: p.client.CheckRedirect, Jar: p.client.Jar, Timeout: p.client.Timeout}
+		p.budget = s.budget
+	}
+
+	jobs := make(chan Candidate)
+	buffered := 10000
+	if s.LowMemory {
+		buffered = workers
+		if sc != nil {
+			buffered = sc.max
 		}
 	}
-	return out
+	results := make(chan Result, buffered)
+	out := make(chan Result, 100)
+
+	pl := &pool{ctx: ctx, p: p, jobs: jobs, results: results}
+	if sc != nil {
+		pl.quit = make(chan struct{}, sc.max)
+	}
+	// the collector holds a slot in the wait group so results is not
+	// closed while it may still start workers
+	pl.wg.Add(1)
+	pl.grow(workers)
+	go func() {
+		pl.wg.Wait()
+		close(results)
+	}()
+
+	go func() {
+		defer close(out)
+		if b := s.budget; b != nil {
+			defer b.stop(nil)
+		}
+		// with FastDNS only names that resolved reach the workers
+		var unresolved []Result
+		massLeft := 0
+		if mass != nil {
+			seeds, unresolved, massLeft = s.massResolve(ctx, mass, p.hosts, seeds)
+		}
+		var held []Result
+		for _, r := range unresolved {
+			s.Metrics.enqueue()
+			s.Metrics.result(r)
+			if s.SecondPass && r.retryable() {
+				held = append(held, r)
+			} else {
+				out <- r
+			}
+		}
+		left, retries, stopped := s.collect(ctx, seeds, perms, jobs, results, out, pl, sc, th, p.limiter, pt, p.validator)
+		left += massLeft
+		retries = append(held, retries...)
+		pl.wg.Done()
+		// a scan that stopped early has no second pass
+		stopped = stopped || left > 0
+		// after cancellation, pass on whatever finished before it; probes
+		// cut short by it count as skipped
+		for r := range results {
+			if !r.deferred && !r.cancelled {
+				out <- r
+				left--
+			}
+		}
+		atomic.StoreInt64(&s.skipped, int64(left))
+		atomic.StoreInt64(&s.recovered, 0)
+		if len(retries) > 0 && !stopped {
+			atomic.StoreInt64(&s.recovered, int64(s.secondPass(ctx, p, retries, out)))
+		} else {
+			for _, r := range retries {
+				out <- r
+			}
+		}
+	}()
+	return s.hooked(hookCtx, out, p.log), nil
+}
+
+// newClient builds the default probing client. Every phase has its own
+// timeout so a slow host can't hold a worker or its file descriptors much
+// past Timeout, and the idle pool scales with the worker count. With
+// Scanner.SourceAddrs it has one transport per address.
+func newClient(s *Scanner, p *probe, workers int) *http.Client {
+	if p.sources == nil {
+		return &http.Client{Transport: newTransport(s, p, workers, nil), CheckRedirect: checkRedirect, Timeout: p.timeout}
+	}
+	st := &sourceTransport{sources: p.sources, transports: map[*sourceAddr]http.RoundTripper{}}
+	for _, src := range p.sources.addrs {
+		st.transports[src] = newTransport(s, p, workers, src)
+	}
+	return &http.Client{Transport: st, CheckRedirect: checkRedirect, Timeout: p.timeout}
 }
 
-func main() {
-	// flags
-	domain := flag.String("u", "", "target root domain (e.g. example.com)")
-	verbose := flag.Bool("v", false, "verbose - show progress and statuses")
-	t := flag.Int("t", 2, "recursion / speed: 1=deep+slow, 2=medium, 3=fast")
-	outfile := flag.String("o", "", "output file path (optional)")
-	sortLive := flag.Bool("x", false, "output only live subdomains (with status code). When set, only live entries are printed to output")
-	wordlistPath := flag.String("w", "", "path to a wordlist file (optional). If provided it is used instead of stdin/defaults")
-	flag.Parse()
+// newTransport builds a transport of the default client, dialling from
+// src, or the default address when that is nil.
+func newTransport(s *Scanner, p *probe, workers int, src *sourceAddr) *http.Transport {
+	// redirect targets are resolved by the dialer, through the same
+	// resolvers as the probed names
+	dialer := &net.Dialer{Timeout: p.timeouts.Connect, KeepAlive: 30 * time.Second, Resolver: p.resolver}
+	dial := dialer.DialContext
+	if src != nil {
+		dial = src.dial(dialer)
+	}
+	if s.Scope != nil {
+		dial = scopedDial(s.Scope, p.resolver, dial)
+	}
+	transport := &http.Transport{
+		DialContext:           pinnedDial(dial),
+		TLSClientConfig:       p.tlsConfig.Clone(),
+		TLSHandshakeTimeout:   p.timeouts.TLS,
+		ResponseHeaderTimeout: p.timeouts.Response,
+		MaxIdleConns:          workers * 2,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       30 * time.Second,
+		DisableKeepAlives:     s.DisableKeepAlives,
+	}
+	// a custom dialer already keeps HTTP/2 off; the empty map makes that
+	// explicit
+	if s.HTTP2 {
+		transport.ForceAttemptHTTP2 = true
+	} else {
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if s.SNI != "" {
+		transport.DialTLSContext = pinnedTLSDial(transport)
+		// the pool is keyed by host, not server name: a connection a
+		// redirect opened to a host under its own name would otherwise
+		// serve that host's probe, and the other way round
+		transport.DisableKeepAlives = true
+	}
+	return transport
+}
 
-	if *domain == "" {
-		fmt.Println("usage: sublive -u example.com [-t 1..3] [-v] [-x] [-o file] [-w wordlist_file]")
-		os.Exit(1)
+// newTLSConfig returns the TLS settings of the default clients.
+func newTLSConfig(s *Scanner) *tls.Config {
+	cfg := &tls.Config{
+		InsecureSkipVerify: !s.TLSVerify,
+		MinVersion:         s.TLSMinVersion,
+		Certificates:       s.ClientCertificates,
 	}
+	// ancient endpoints rarely speak the suites Go offers by default
+	if s.TLSMinVersion != 0 && s.TLSMinVersion < tls.VersionTLS12 {
+		for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			cfg.CipherSuites = append(cfg.CipherSuites, cs.ID)
+		}
+	}
+	return cfg
+}
 
-	start := time.Now()
-	if *verbose {
-		fmt.Printf("sublive v%s - scanning %s\n", version, *domain)
+// pinnedKey is the context key for the *pinned addresses of a probe.
+type pinnedKey struct{}
+
+// pinned holds the addresses check resolved for host, and the server name
+// to send it instead of its own, if any. sniUsed records that a TLS
+// connection was attempted with sni.
+type pinned struct {
+	host    string
+	ips     []string
+	sni     string
+	sniUsed atomic.Bool
+}
+
+// pinnedDial wraps dial so connections to the probed host go to the
+// addresses already resolved for it, in order, instead of resolving the
+// name a second time; the URL keeps the hostname, so Host and SNI are
+// unchanged. Other hosts, such as redirect targets, are dialled by name.
+func pinnedDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		pin, ok := ctx.Value(pinnedKey{}).(*pinned)
+		host, port, err := net.SplitHostPort(addr)
+		if !ok || err != nil || !strings.EqualFold(host, pin.host) {
+			return dial(ctx, network, addr)
+		}
+		var lastErr error
+		for _, ip := range pin.ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
 	}
+}
 
-	// determine wordlist source: -w file > stdin > defaults
-	var words []string
-	if *wordlistPath != "" {
-		w, err := loadWordlistFromFile(*wordlistPath)
+// pinnedTLSDial is the TLS dialer of the default client with Scanner.SNI:
+// the probed host is sent the pinned server name, other hosts their own.
+// The config is read from t at dial time, once the transport added its
+// ALPN protocols to it.
+func pinnedTLSDial(t *http.Transport) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to open wordlist '%s': %v\n", *wordlistPath, err)
-			os.Exit(1)
-		}
-		words = w
-		if *verbose { fmt.Printf("[+] loaded %d words from %s\n", len(words), *wordlistPath) }
-	} else if piped, _ := loadWordlistFromStdin(); piped != nil && len(piped) > 0 {
-		words = piped
-		if *verbose { fmt.Printf("[+] loaded %d words from stdin\n", len(words)) }
-	} else {
-		switch *t {
-		case 1:
-			words = append(defaultWords, "app", "gateway", "auth", "accounts", "login", "payments", "images", "static", "docs", "status", "internal", "ops", "graphql", "socket", "router", "db")
-		case 2:
-			words = append(defaultWords, "app", "auth", "login", "api", "static", "cdn")
-		case 3:
-			words = defaultWords
-		default:
-			words = defaultWords
+			return nil, err
 		}
+		cfg := t.TLSClientConfig.Clone()
+		cfg.ServerName = host
+		if pin, ok := ctx.Value(pinnedKey{}).(*pinned); ok && pin.sni != "" && strings.EqualFold(host, pin.host) {
+			cfg.ServerName = pin.sni
+			pin.sniUsed.Store(true)
+		}
+		conn, err := t.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		hctx, cancel := context.WithTimeout(ctx, t.TLSHandshakeTimeout)
+		defer cancel()
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(hctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
 	}
+}
 
-	words = uniqStrings(words)
+// baseURL returns the scheme://host[:port] that answered for sub: the
+// final request of resp when redirects stayed on sub, otherwise the first
+// one, made with scheme, which is also used for a response without its
+// request. Default ports are left out.
+func baseURL(scheme, sub string, resp *http.Response) string {
+	host := sub
+	if resp.Request != nil && strings.EqualFold(resp.Request.URL.Hostname(), sub) {
+		scheme, host = resp.Request.URL.Scheme, resp.Request.URL.Host
+	}
+	if h, port, err := net.SplitHostPort(host); err == nil && (scheme == "http" && port == "80" || scheme == "https" && port == "443") {
+		host = h
+	}
+	return scheme + "://" + strings.ToLower(host)
+}
 
-	// generate initial candidate subdomains
-	candidates := make([]string, 0, len(words))
-	for _, w := range words {
-		candidates = append(candidates, w+"."+*domain)
+// setHeaders adds the configured request headers and User-Agent.
+func (p *probe) setHeaders(req *http.Request) {
+	for k, v := range p.headers {
+		req.Header[k] = v
+	}
+	if p.userAgent != "" {
+		req.Header.Set("User-Agent", p.userAgent)
 	}
+}
 
-	deep := (*t == 1)
+// Skipped returns how many candidates the last Run did not probe because its
+// context ended first or MaxLive was reached. It is valid once the result
+// channel is closed.
+func (s *Scanner) Skipped() int {
+	return int(atomic.LoadInt64(&s.skipped))
+}
 
-	// set concurrency
-	workers := 30
-	switch *t {
-	case 1:
-		workers = 30
-	case 2:
-		workers = 80
-	case 3:
-		workers = runtime.NumCPU() * 40
+// Usage returns the requests sent and bytes received by the last Run
+// with MaxRequests or MaxBytes, zero without them. It is valid once the
+// result channel is closed.
+func (s *Scanner) Usage() (requests, bytes int64) {
+	if s.budget == nil {
+		return 0, 0
 	}
+	return s.budget.requests.Load(), s.budget.bytes.Load()
+}
 
-	if *verbose { fmt.Printf("[+] workers=%d deep=%v candidates=%d\n", workers, deep, len(candidates)) }
+// BudgetExhausted reports whether the last Run ended because MaxRequests or
+// MaxBytes was used up. It is valid once the result channel is closed.
+func (s *Scanner) BudgetExhausted() bool {
+	return s.budget != nil && s.budget.exhausted.Load()
+}
 
-	jobs := make(chan string, 10000)
-	results := make(chan Result, 10000)
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// Recovered returns how many hosts the second pass of the last Run reached
+// after they had looked unreachable. It is valid once the result channel is
+// closed.
+func (s *Scanner) Recovered() int {
+	return int(atomic.LoadInt64(&s.recovered))
+}
 
-	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	client := &http.Client{Transport: transport}
+// RateDeferred returns how many times a candidate of the last Run was
+// held back because its address had asked with Retry-After to wait. It
+// is valid once the result channel is closed.
+func (s *Scanner) RateDeferred() int {
+	return int(atomic.LoadInt64(&s.rateDeferred))
+}
 
-	var wg sync.WaitGroup
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go worker(ctx, *domain, jobs, results, *verbose, client, &wg)
+// DNSRetried returns how many lookups of the last Run were tried again
+// after a REFUSED or SERVFAIL answer (see DNSRetries). It is valid once
+// the result channel is closed.
+func (s *Scanner) DNSRetried() int {
+	return int(atomic.LoadInt64(&s.dnsRetried))
+}
+
+// DNSRescued returns how many names of the last Run resolved on a retry
+// after a REFUSED or SERVFAIL answer. It is valid once the result channel
+// is closed.
+func (s *Scanner) DNSRescued() int {
+	return int(atomic.LoadInt64(&s.dnsRescued))
+}
+
+// dnsRetries returns DNSRetries with its default applied.
+func (s *Scanner) dnsRetries() int {
+	switch {
+	case s.DNSRetries == 0:
+		return DefaultDNSRetries
+	case s.DNSRetries < 0:
+		return 0
 	}
+	return s.DNSRetries
+}
 
-	// producer: feed initial candidates
-	go func() {
-		for _, c := range candidates {
-			jobs <- c
+// countsLive reports whether MaxLive counts r, see Scanner.Live.
+func (s *Scanner) countsLive(r Result) bool {
+	switch class := ClassifyResult(r); {
+	case s.Live != nil:
+		return s.Live(r)
+	case s.LiveCodes != nil:
+		return r.Status != 0 && class != ClassSoft404 && class != ClassEdgeDefault && s.LiveCodes.Contains(r.Status)
+	default:
+		return class == ClassLive
+	}
+}
+
+// IsLive reports whether status is one of LiveCodes, or IsLive without
+// them.
+func (s *Scanner) IsLive(status int) bool {
+	if s.LiveCodes != nil {
+		return s.LiveCodes.Contains(status)
+	}
+	return IsLive(status)
+}
+
+// Pause stops the workers of a running scan from starting new probes until
+// Resume; probes already running finish. A cancelled context still ends the
+// scan.
+func (s *Scanner) Pause() {
+	s.pause.set(true)
+}
+
+// Resume lets the workers continue after Pause.
+func (s *Scanner) Resume() {
+	s.pause.set(false)
+}
+
+// SetPermutations turns the Permutations of live results off or back on
+// during a deep scan; the other deep mode sources are not affected.
+func (s *Scanner) SetPermutations(on bool) {
+	v := int32(1)
+	if on {
+		v = 0
+	}
+	atomic.StoreInt32(&s.noPerms, v)
+}
+
+// collect feeds jobs from an unbounded queue and reads results, appending
+// deep mode candidates to the queue. pending counts jobs that are queued or
+// in flight; when it reaches zero the tree is exhausted and jobs can be
+// closed, however deep the recursion went. It returns the number of jobs
+// still pending when ctx ended or dropped after MaxLive, with SecondPass
+// the results held back for it, and whether the scan stopped early, for
+// either reason, even with nothing left.
+func (s *Scanner) collect(ctx context.Context, seeds []Candidate, perms []PermPattern, jobs chan<- Candidate, results <-chan Result, out chan<- Result, pl *pool, sc *scaler, th *throttle, limiter *ipLimiter, pt *ptrLookup, v *validator) (left int, retries []Result, stopped bool) {
+	defer close(jobs)
+	dnsRetries := s.dnsRetries()
+	var tick, loadTick <-chan time.Time
+	if sc != nil {
+		t := time.NewTicker(scaleEvery)
+		defer t.Stop()
+		tick = t.C
+	}
+	if limiter != nil && s.OnIPLoad != nil {
+		t := time.NewTicker(5 * time.Second)
+		defer t.Stop()
+		loadTick = t.C
+	}
+	// seen holds every name ever enqueued so two parents producing the same
+	// candidate only get it scanned once
+	seen := make(map[string]struct{}, len(seeds))
+	queue := make([]Candidate, 0, len(seeds))
+	pending := 0
+	// enqueue is the single path for every candidate: it validates, dedups
+	// against everything seen so far, and accounts the job
+	// after MaxLive live results the queue is dropped and only the probes
+	// in flight are waited for
+	live, dropped := 0, 0
+	enqueue := func(c Candidate) bool {
+		if stopped || !ValidHostname(c.Name) || s.excluded(c.Name) {
+			return false
 		}
-		// Non-deep mode: no more jobs will be added, so close now
-		if !deep {
-			close(jobs)
+		if _, ok := seen[c.Name]; ok {
+			return false
 		}
-	}()
+		seen[c.Name] = struct{}{}
+		queue = append(queue, c)
+		pending++
+		s.Metrics.enqueue()
+		return true
+	}
+	for _, c := range seeds {
+		enqueue(c)
+	}
+	var mine *miner
+	if s.Deep && s.Mine {
+		mine = newMiner(seeds, s.MineMin, s.MinedMax, s.Depth)
+	}
 
-	// collector: read results and optionally add recursive permutations
-	found := make(map[string]Result)
-	var mu sync.Mutex
+	// parked holds candidates whose address was saturated, by address;
+	// they stay pending and go back to the queue as that address's probes
+	// finish
+	parked := map[string][]Candidate{}
+	parkedN := 0
+	// waiting holds, with CollapseCNAME, the candidates whose CNAME target
+	// had its representative in flight; they count in parkedN as well and
+	// go back to the queue together with its result
+	waiting := map[*cnameGroup][]Candidate{}
+	release := func(g *cnameGroup) {
+		queue = append(queue, waiting[g]...)
+		parkedN -= len(waiting[g])
+		delete(waiting, g)
+	}
+	// validating holds, with Validate, the candidates waiting for the
+	// verdict on their name, by name; they stay pending and go back to
+	// the queue once it is in
+	validating := map[string]Candidate{}
+	var verdicts <-chan string
+	if v != nil {
+		defer close(v.quit)
+		verdicts = v.done
+	}
+	// later holds, with the backoff, the candidates whose address asked
+	// with Retry-After to wait, until then; they stay pending and a timer
+	// puts them back in the queue
+	var later delayed
+	wake := time.NewTimer(time.Hour)
+	wake.Stop()
+	defer wake.Stop()
+	unpark := func(ip string) {
+		if w := parked[ip]; len(w) > 0 {
+			queue = append(queue, w[0])
+			parkedN--
+			if len(w) == 1 {
+				delete(parked, ip)
+			} else {
+				parked[ip] = w[1:]
+			}
+		}
+	}
 
-	go func() {
-		for r := range results {
-			mu.Lock()
-			if _, ok := found[r.Subdomain]; !ok {
-				found[r.Subdomain] = r
-			}
-			mu.Unlock()
-
-			// if deep and response non-zero, generate a few permutations and enqueue
-			if deep && r.Status != 0 {
-				parts := strings.Split(r.Subdomain, ".")
-				if len(parts) >= 3 {
-					sub := parts[0]
-					c1 := sub + "-stage." + *domain
-					c2 := sub + "-dev." + *domain
-					c3 := "api." + sub + "." + *domain
-					mu.Lock()
-					if _, ok := found[c1]; !ok {
-						jobs <- c1
-					}
-					if _, ok := found[c2]; !ok {
-						jobs <- c2
+	// emit passes on a finished result and, in deep mode, enqueues the
+	// candidates it seeds
+	emit := func(r Result) {
+		s.edges.observe(&r)
+		s.Metrics.result(r)
+		if s.SecondPass && r.retryable() {
+			retries = append(retries, r)
+		} else {
+			out <- r
+		}
+		if s.Deep {
+			s.expand(r, perms, enqueue)
+		}
+		if mine != nil {
+			mine.observe(r, enqueue)
+		}
+		if s.countsLive(r) {
+			live++
+		}
+		if s.MaxLive > 0 && live >= s.MaxLive && !stopped {
+			stopped = true
+			dropped += len(queue) + parkedN + later.Len() + len(validating)
+			pending -= len(queue) + parkedN + later.Len() + len(validating)
+			queue, parked, waiting, parkedN, later = nil, map[string][]Candidate{}, map[*cnameGroup][]Candidate{}, 0, nil
+			validating = map[string]Candidate{}
+		}
+	}
+
+	// with PTR, results wait for the reverse lookups of their addresses;
+	// once nothing else is pending they wait at most the grace period
+	var ptrDone <-chan ptrAnswer
+	var grace <-chan time.Time
+	if pt != nil {
+		defer close(pt.quit)
+		ptrDone = pt.done
+	}
+	for pending > 0 || (pt != nil && pt.held > 0) {
+		if pending > 0 {
+			grace = nil
+		} else if grace == nil {
+			grace = time.After(pt.grace)
+		}
+		var next Candidate
+		var send chan<- Candidate
+		if len(queue) > 0 {
+			send = jobs
+			next = queue[0]
+		}
+		var due <-chan time.Time
+		if later.Len() > 0 {
+			wake.Reset(time.Until(later[0].due))
+			due = wake.C
+		}
+		select {
+		case <-ctx.Done():
+			if pt != nil {
+				for _, r := range pt.flush() {
+					out <- r
+				}
+			}
+			return pending + dropped, retries, true
+		case a := <-ptrDone:
+			for _, r := range pt.answer(a) {
+				emit(r)
+			}
+		case <-grace:
+			grace = nil
+			for _, r := range pt.flush() {
+				emit(r)
+			}
+		case send <- next:
+			queue = queue[1:]
+		case now := <-due:
+			queue = append(queue, later.ready(now)...)
+		case name := <-verdicts:
+			if c, ok := validating[name]; ok {
+				delete(validating, name)
+				queue = append(queue, c)
+			}
+		case <-tick:
+			sc.adjust(pl, len(queue))
+		case <-loadTick:
+			s.OnIPLoad(limiter.load(parked, 5))
+		case r := <-results:
+			if r.cancelled {
+				// still pending: it is counted as skipped
+				continue
+			}
+			if th != nil {
+				th.observe(r)
+				if r.retryAfter > 0 && r.IP != "" {
+					th.holds.hold(r.IP, r.retryAfter)
+				}
+			}
+			// throttled candidates go back to the queue, behind the backoff,
+			// or wait out their Retry-After
+			requeue := th != nil && r.throttled && !stopped && r.attempt < throttleRetries
+			// so do lookups a resolver refused or failed, for the next one
+			retryDNS := !requeue && !stopped && r.IP == "" && r.dnsRetry < dnsRetries &&
+				(r.Reason == ReasonDNSRefused || r.Reason == ReasonServfail)
+			if r.deferred && stopped {
+				pending--
+				dropped++
+			} else if r.deferred {
+				c := r.candidate()
+				c.ips, c.cnames = r.IPs, append([]string{}, r.CNAMEs...)
+				switch {
+				case !r.heldUntil.IsZero():
+					later.push(c, r.heldUntil)
+					atomic.AddInt64(&s.rateDeferred, 1)
+				case r.validating:
+					// the verdict may have come in before the candidate
+					if _, ok := v.verdict(c.Name); ok {
+						queue = append(queue, c)
+					} else {
+						validating[c.Name] = c
 					}
-					if _, ok := found[c3]; !ok {
-						jobs <- c3
+				case r.cname == nil:
+					parked[r.IP] = append(parked[r.IP], c)
+					parkedN++
+				case r.cname.settled.Load():
+					// the representative's result came in meanwhile
+					queue = append(queue, c)
+				default:
+					waiting[r.cname] = append(waiting[r.cname], c)
+					parkedN++
+				}
+			} else if requeue {
+				c := r.candidate()
+				c.ips, c.cnames, c.attempt = r.IPs, append([]string{}, r.CNAMEs...), r.attempt+1
+				if r.retryAfter > 0 {
+					later.push(c, time.Now().Add(min(r.retryAfter, holdMax)))
+					atomic.AddInt64(&s.rateDeferred, 1)
+				} else {
+					queue = append(queue, c)
+				}
+				unpark(r.limitIP)
+			} else if retryDNS {
+				c := r.candidate()
+				c.attempt, c.dnsRetry = r.attempt, r.dnsRetry+1
+				queue = append(queue, c)
+				atomic.AddInt64(&s.dnsRetried, 1)
+			} else {
+				pending--
+				unpark(r.limitIP)
+			}
+			if r.cname != nil && !r.deferred {
+				release(r.cname)
+			}
+			// with nothing in flight no probe will finish to wake the
+			// parked candidates, so release them all
+			if parkedN > 0 && pending-len(queue)-parkedN-later.Len()-len(validating) == 0 {
+				for ip := range parked {
+					for len(parked[ip]) > 0 {
+						unpark(ip)
 					}
-					mu.Unlock()
 				}
+				for g := range waiting {
+					release(g)
+				}
+			}
+			if r.deferred || requeue || retryDNS {
+				continue
+			}
+			if r.dnsRetry > 0 && r.IP != "" {
+				atomic.AddInt64(&s.dnsRescued, 1)
 			}
+			if sc != nil {
+				sc.observe(r)
+			}
+			if pt != nil {
+				var ready bool
+				if r, ready = pt.hold(ctx, r); !ready {
+					continue
+				}
+			}
+			emit(r)
 		}
-	}()
+	}
+	return dropped, retries, stopped
+}
+
+// candidate returns the candidate r was probed for.
+func (r Result) candidate() Candidate {
+	return Candidate{Name: r.Subdomain, Domain: r.Domain, Depth: r.Depth, Source: r.Source, Origin: r.Origin, URL: r.url}
+}
+
+// retryable reports whether r got no answer for a reason that may be
+// transient.
+func (r Result) retryable() bool {
+	return r.Status == 0 && r.BannerPort == 0 && (r.netFailure || r.dnsFailed)
+}
+
+// excluded reports whether name matches one of s.Exclude.
+func (s *Scanner) excluded(name string) bool {
+	for _, e := range s.Exclude {
+		if strings.ContainsAny(e, "*?[") {
+			if ok, _ := path.Match(e, name); ok {
+				return true
+			}
+		} else if InDomain(name, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand generates the deep mode candidates seeded by r.
+func (s *Scanner) expand(r Result, perms []PermPattern, enqueue func(Candidate) bool) {
+	// names in the CNAME chain, redirect targets and scraped references that
+	// belong to the target are new candidates at the same depth
+	related := func(names []string, source string) {
+		for _, name := range names {
+			if InDomain(name, r.Domain) {
+				enqueue(Candidate{Name: name, Domain: r.Domain, Depth: r.Depth, Source: source})
+			}
+		}
+	}
+	related(r.CNAMEs, SourceCNAME)
+	related(r.Redirects, SourceRedirect)
+	related(r.Referenced, SourceScrape)
+	related(r.PTR, SourcePTR)
+
+	if !InDomain(r.Subdomain, r.Domain) || r.Subdomain == r.Domain {
+		return
+	}
+	sub := strings.SplitN(r.Subdomain, ".", 2)[0]
+	if r.Status != 0 && r.Depth < s.Depth && atomic.LoadInt32(&s.noPerms) == 0 {
+		for _, p := range perms {
+			enqueue(Candidate{Name: p.Apply(sub) + "." + r.Domain, Domain: r.Domain, Depth: r.Depth + 1, Source: SourcePermutation})
+		}
+	}
+	// numbered siblings stay at the parent's depth so a run of hosts is
+	// followed regardless of Depth
+	if s.AltNumbers && IsLive(r.Status) {
+		for _, v := range numericVariants(sub, s.AltLimit) {
+			enqueue(Candidate{Name: v + "." + r.Domain, Domain: r.Domain, Depth: r.Depth, Source: SourceNumeric})
+		}
+		if r.Source == SourceNumeric {
+			for _, v := range nextNumbers(sub, s.AltMisses) {
+				enqueue(Candidate{Name: v + "." + r.Domain, Domain: r.Domain, Depth: r.Depth, Source: SourceNumeric})
+			}
+		}
+	}
+}
 
-	// If deep mode, allow recursion for a limited time then close jobs
-	if deep {
-		time.Sleep(6 * time.Second)
-		close(jobs)
+// dialTarget returns the address the pre-check connects to: the first one
+// inside the scope, or "" when there is none.
+func (p *probe) dialTarget(ips []string) string {
+	for _, ip := range ips {
+		if p.scope == nil || p.scope.Contains(ip) {
+			return ip
+		}
 	}
+	return ""
+}
+
+// schemePort is a port the pre-check connects to and the scheme spoken
+// on it.
+type schemePort struct{ scheme, port string }
 
-	// wait workers then close results
+// defaultPorts are the ports of the schemes check tries.
+var defaultPorts = []schemePort{{"http", "80"}, {"https", "443"}}
+
+// preflightSchemes connects to ip on ports, normally defaultPorts, and
+// returns the schemes worth an HTTP attempt. When no port accepts, state is
+// "refused" if a port actively refused and "filtered" otherwise.
+func (p *probe) preflightSchemes(ctx context.Context, ip string, ports []schemePort) (schemes []string, state string, closed []ProbeAttempt) {
+	// the ports are tried at once so a filtered host costs one timeout
+	errs := make([]error, len(ports))
+	took := make([]time.Duration, len(ports))
+	var wg sync.WaitGroup
+	for i, sp := range ports {
+		wg.Add(1)
+		go func(i int, port string) {
+			defer wg.Done()
+			start := time.Now()
+			addr := net.JoinHostPort(ip, port)
+			d := sourceDialer(ctx, "tcp", addr)
+			d.Timeout = p.preflight
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				conn.Close()
+			}
+			errs[i], took[i] = err, time.Since(start)
+		}(i, sp.port)
+	}
 	wg.Wait()
-	close(results)
-
-	// small pause to ensure collector processed remaining
-	time.Sleep(200 * time.Millisecond)
-
-	// collect found results
-	mu.Lock()
-	subs := make([]Result, 0, len(found))
-	for _, r := range found {
-		subs = append(subs, r)
-	}
-	mu.Unlock()
-
-	// classify
-	counts := map[string]int{"live": 0, "404": 0, "301": 0, "other": 0, "unreachable": 0}
-	for _, r := range subs {
-		if r.Status == 0 {
-			counts["unreachable"]++
-		} else if r.Status == 404 {
-			counts["404"]++
-		} else if r.Status == 301 || r.Status == 302 {
-			counts["301"]++
-		} else if r.Status >= 200 && r.Status < 400 {
-			counts["live"]++
-		} else {
-			counts["other"]++
+	refused := false
+	for i, err := range errs {
+		if err == nil {
+			schemes = append(schemes, ports[i].scheme)
+			continue
 		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			refused = true
+		}
+		closed = append(closed, newAttempt(ports[i].scheme, 0, err, took[i]))
+	}
+	if len(schemes) > 0 {
+		return schemes, "", closed
+	}
+	if refused {
+		return nil, "refused", closed
 	}
+	return nil, "filtered", closed
+}
 
-	// prepare output lines
-	lines := make([]string, 0, len(subs))
-	for _, r := range subs {
-		lines = append(lines, fmt.Sprintf("%s %d", r.Subdomain, r.Status))
+// defaultPort returns the port of scheme.
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
 	}
-	sort.Strings(lines)
+	return "80"
+}
 
-	outLines := []string{}
-	if *sortLive {
-		for _, r := range subs {
-			if r.Status >= 200 && r.Status < 400 {
-				outLines = append(outLines, fmt.Sprintf("%s %d", r.Subdomain, r.Status))
+// portsText names ports for the error of a failed pre-check, e.g. "ports
+// 80 and 443".
+func portsText(ports []schemePort) string {
+	if len(ports) == 1 {
+		return "port " + ports[0].port
+	}
+	nums := make([]string, len(ports))
+	for i, sp := range ports {
+		nums[i] = sp.port
+	}
+	return "ports " + strings.Join(nums[:len(nums)-1], ", ") + " and " + nums[len(nums)-1]
+}
+
+// isNetFailure reports whether err is a timeout or connection reset, the
+// errors that grow when a scan pushes the network too hard.
+func isNetFailure(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET)
+}
+
+// IsInternalIP reports whether ip is a private (RFC 1918, RFC 4193),
+// loopback, link-local or unspecified address.
+func IsInternalIP(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified()
+}
+
+// probe holds the per-scan state shared by workers.
+type probe struct {
+	// timeout is timeouts.Request
+	timeout  time.Duration
+	timeouts ProbeTimeouts
+	client   *http.Client
+	resolver *net.Resolver
+	// lookup and prober are Scanner.Resolver and Scanner.Prober, or the
+	// probe itself
+	lookup      Resolver
+	prober      Prober
+	nameservers []string
+	hosts       *HostCache
+	geo         *GeoDB
+	cdn         *CDNDetector
+	cloud       *CloudRanges
+	interesting *regexp.Regexp
+	scope       *Scope
+	probeLocal  bool
+	// bothFamilies and skipIPv6 are Scanner.ProbeBothFamilies and
+	// Scanner.SkipIPv6
+	bothFamilies, skipIPv6 bool
+	harvest                bool
+	headers                http.Header
+	userAgent              string
+	// preflight is the TCP pre-check timeout, 0 when it is off
+	preflight time.Duration
+	// bannerPorts is nil when banner grabbing is off
+	bannerPorts []int
+	// limiter is nil without a PerHost cap
+	limiter *ipLimiter
+	// jitterMin and jitterMax bound the random pre-probe delay
+	jitterMin, jitterMax time.Duration
+	// cnames looks up CNAME chains (see Scanner.CNAMEChains), and tcpDNS
+	// sends those queries over TCP
+	cnames bool
+	tcpDNS bool
+	// gate and holds are nil when NoBackoff is set
+	gate  *gate
+	holds *ipHolds
+	// validator is nil without Validate; with parkUnvalidated a name not
+	// validated yet is deferred until its verdict is in rather than
+	// waited for
+	validator       *validator
+	parkUnvalidated bool
+	// tlsConfig is shared by the TCP and QUIC clients
+	tlsConfig *tls.Config
+	// http3 tries QUIC after TCP, or instead with http3Only
+	http3, http3Only bool
+	h3Timeout        time.Duration
+	// sni is Scanner.SNI, empty when hosts are sent their own names
+	sni string
+	// records is nil without Scanner.Records
+	records *recordCache
+	// scrapers is keyed by root domain; nil when scraping is off
+	scrapers map[string]*scraper
+	// match and filter are tested against the first bodyMax bytes of
+	// every body, which scraping and counts read too
+	match, filter []BodyPattern
+	counts        bool
+	preview       int
+	previewBinary bool
+	fingerprint   bool
+	soft404       bool
+	keepSoft404   bool
+	bodyMax       int64
+	// profileNet times the phases of every probe into Result.Timing
+	profileNet bool
+	// paths are Scanner.Paths, and cacheBust Scanner.CacheBust
+	paths     []string
+	cacheBust bool
+	// collapse is nil without Scanner.CollapseCNAME
+	collapse *cnameGroups
+	// log is Scanner.Logger, discarding when that is nil
+	log *slog.Logger
+	// metrics may be nil
+	metrics *Metrics
+	// budget may be nil; the TCP client counts against it already
+	budget *budget
+	// pause is the Scanner's, see Scanner.Pause
+	pause *pauseGate
+	// resumed are the results of Scanner.Resumed, by name
+	resumed map[string]Result
+	// sources are the addresses probes are sent from, nil for the default
+	sources *sources
+}
+
+func (p *probe) worker(ctx context.Context, jobs <-chan Candidate, results chan<- Result, quit <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	p.metrics.worker(1)
+	defer p.metrics.worker(-1)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-quit:
+			return
+		case c, ok := <-jobs:
+			if !ok {
+				return
 			}
+			// the job stays pending, so it counts as skipped
+			if !p.pause.wait(ctx) {
+				return
+			}
+			if r, ok := p.resumed[c.Name]; ok {
+				results <- r
+				continue
+			}
+			r := p.check(p.sources.with(ctx), c)
+			r.CheckedAt = time.Now().UTC()
+			r.Class = ClassifyResult(r)
+			r.Findings = FindingsOf(r, p.interesting)
+			r.cancelled = ctx.Err() != nil
+			if r.cname != nil && !r.deferred {
+				p.collapse.settle(r.cname, r)
+			}
+			results <- r
 		}
-	} else {
-		outLines = lines
 	}
+}
 
-	// write output
-	if *outfile != "" {
-		f, err := os.Create(*outfile)
+// jitter sleeps for a random duration between jitterMin and jitterMax. It
+// returns false when ctx was cancelled first.
+func (p *probe) jitter(ctx context.Context) bool {
+	d := p.jitterMin
+	if p.jitterMax > d {
+		d += rand.N(p.jitterMax - d + 1)
+	}
+	return sleep(ctx, d)
+}
+
+// locate sets r.Geo from r.IP when a GeoIP database is loaded.
+func (p *probe) locate(r *Result) {
+	r.Geo = nil
+	if p.geo != nil {
+		if info := p.geo.Lookup(r.IP); info != (GeoInfo{}) {
+			r.Geo = &info
+		}
+	}
+}
+
+// check resolves and probes one candidate.
+func (p *probe) check(ctx context.Context, c Candidate) Result {
+	sub := c.Name
+	r := Result{Subdomain: sub, Unicode: DisplayName(sub), Domain: c.Domain, Depth: c.Depth, Source: c.Source, Origin: c.Origin, url: c.URL, attempt: c.attempt, dnsRetry: c.dnsRetry}
+
+	// Resolve quickly
+	// parked candidates come back with their addresses
+	ips, ok := c.ips, len(c.ips) > 0
+	r.CNAMEs = c.cnames
+	if !ok {
+		ips, ok = p.hosts.get(sub)
+	}
+	if ok && r.CNAMEs == nil && p.cnames {
+		r.CNAMEs = lookupCNAMEChain(ctx, p.nameservers, sub, p.tcpDNS)
+	}
+	if p.profileNet {
+		r.Timing = &NetTiming{}
+	}
+	if !ok {
+		lookupStart := time.Now()
+		res, err := p.lookup.Resolve(ctx, sub)
+		if r.Timing != nil {
+			r.Timing.DNSMs = ms(time.Since(lookupStart))
+		}
+		ips, r.CNAMEs = res.IPs, res.CNAMEs
+		p.hosts.put(sub, ips)
+		var dnsErr *net.DNSError
+		r.dnsFailed = err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound)
+		if r.dnsFailed && ctx.Err() == nil {
+			p.log.Info("lookup failed", "subdomain", sub, "error", err)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to write output: %v\n", err)
-			os.Exit(1)
+			r.setFailure(err)
 		}
-		defer f.Close()
-		for _, l := range outLines {
-			f.WriteString(l + "\n")
+	}
+	if len(ips) > 0 {
+		r.IP = ips[0]
+		r.IPs = ips
+		r.Family = AddressFamily(ips)
+		p.locate(&r)
+		if p.validator != nil {
+			verdict, ok := p.validator.verdict(sub)
+			switch {
+			case ok:
+				r.Validation = verdict
+			case p.parkUnvalidated:
+				p.validator.start(ctx, sub)
+				r.deferred, r.validating = true, true
+				return r
+			default:
+				r.Validation = p.validator.check(ctx, sub)
+			}
 		}
-		if *verbose { fmt.Printf("[+] wrote %d lines to %s\n", len(outLines), *outfile) }
-	} else {
-		for _, l := range outLines {
-			fmt.Println(l)
+	}
+	if r.Validation == ValidationPoisoned {
+		return r
+	}
+	if p.records != nil && len(ips) > 0 {
+		r.DNSRecords = p.records.get(ctx, sub)
+	}
+	// an address held by a Retry-After, or a saturated one, parks the
+	// candidate before any further work
+	if p.holds != nil && r.IP != "" {
+		if until := p.holds.held(ips); !until.IsZero() {
+			r.deferred, r.heldUntil = true, until
+			return r
+		}
+	}
+	if p.limiter != nil && r.IP != "" {
+		if !p.limiter.tryAcquire(r.IP) {
+			r.deferred = true
+			return r
+		}
+		r.limitIP = r.IP
+		defer p.limiter.release(r.limitIP)
+	}
+	internal := 0
+	for _, ip := range ips {
+		if IsInternalIP(ip) {
+			internal++
+		}
+	}
+	r.Internal = internal > 0
+	if internal > 0 && internal == len(ips) && !p.probeLocal {
+		return r
+	}
+	if p.scope != nil {
+		in := 0
+		for _, ip := range ips {
+			if p.scope.Contains(ip) {
+				in++
+			}
+		}
+		r.OutOfScope = len(ips) > 0 && in == 0
+		r.ScopePartial = in > 0 && in < len(ips)
+		// unresolved names can't be shown to be in scope either
+		if in == 0 {
+			return r
+		}
+	}
+
+	if p.skipIPv6 && len(ips) > 0 {
+		v4, _ := splitFamilies(ips)
+		if len(v4) == 0 {
+			r.IPv6Skipped = true
+			return r
 		}
+		ips = v4
 	}
 
-	elapsed := time.Since(start)
-	fmt.Printf("\nSummary for %s (t=%d) in %s:\n", *domain, *t, elapsed.Round(time.Millisecond))
-	fmt.Printf("  live (2xx): %d\n", counts["live"])
-	fmt.Printf("  redirects (301/302): %d\n", counts["301"])
-	fmt.Printf("  404: %d\n", counts["404"])
-	fmt.Printf("  other: %d\n", counts["other"])
-	fmt.Printf("  unreachable: %d\n", counts["unreachable"])
+	// names behind the same CNAME target wait for the result of the
+	// first one
+	if p.collapse != nil && len(r.CNAMEs) > 0 && c.Source != SourceRoot && c.URL == nil {
+		g, from, wait := p.collapse.join(r.CNAMEs[len(r.CNAMEs)-1], sub)
+		switch {
+		case wait:
+			r.deferred, r.cname = true, g
+			return r
+		case from != nil:
+			r.inherit(*from)
+			return r
+		}
+		r.cname = g
+	}
+
+	// the transport only dials the addresses resolved above, so a name
+	// that didn't resolve has nothing to connect to
+	if len(ips) == 0 || p.gate != nil && !p.gate.wait(ctx) || !p.jitter(ctx) {
+		return r
+	}
 
-	os.Exit(0)
+	// Try HTTP then HTTPS
+	pin := &pinned{host: sub, ips: ips}
+	if p.sni != sub {
+		pin.sni = p.sni
+	}
+	reqCtx := context.WithValue(ctx, pinnedKey{}, pin)
+	redirects := &redirectHarvest{harvest: p.harvest}
+	reqCtx = context.WithValue(reqCtx, harvestKey{}, redirects)
+	schemes, ports := []string{"http", "https"}, defaultPorts
+	pt := ProbeTarget{Host: sub, IPs: ips, Paths: p.paths}
+	if c.URL != nil {
+		pt.Port, pt.Paths = c.URL.Port(), []string{c.URL.RequestURI()}
+		r.Path = pt.Paths[0]
+		schemes, ports = []string{c.URL.Scheme}, []schemePort{{c.URL.Scheme, cmp.Or(pt.Port, defaultPort(c.URL.Scheme))}}
+	}
+	if p.http3Only {
+		schemes = nil
+	} else if target := p.dialTarget(ips); p.preflight > 0 && target != "" {
+		start := time.Now()
+		schemes, r.Conn, r.Attempts = p.preflightSchemes(ctx, target, ports)
+		r.netFailure = r.Conn == "filtered"
+		if r.Conn != "" {
+			r.Reason, r.Error = ReasonTimeout, portsText(ports)+" "+r.Conn
+			if r.Conn == "refused" {
+				r.Reason = ReasonRefused
+			}
+			if ctx.Err() == nil {
+				p.log.Info(r.Error, "subdomain", sub, "ip", target, "duration", time.Since(start))
+			}
+		}
+	}
+	pt.Schemes = schemes
+	pr, err := p.prober.Probe(reqCtx, pt)
+	resp, respScheme := pr.Response, pr.Scheme
+	if resp != nil && len(pt.Paths) > 0 {
+		r.Path = pr.Path
+	}
+	r.Attempts = append(r.Attempts, pr.Attempts...)
+	if r.Timing != nil {
+		t := pr.Timing
+		t.DNSMs = r.Timing.DNSMs
+		r.Timing = &t
+	}
+	if err != nil {
+		r.setFailure(err)
+	}
+	// dead stays set while every port tried refused or timed out
+	dead := true
+	for i, err := range pr.Errors {
+		if err == nil {
+			continue
+		}
+		if pr.Attempts[i].Scheme == "h3" {
+			if p.http3Only && isNetFailure(err) {
+				r.netFailure = true
+			}
+			continue
+		}
+		if reason := pr.Attempts[i].Reason; reason != ReasonRefused && reason != ReasonTimeout {
+			dead = false
+		}
+		if isNetFailure(err) {
+			r.netFailure = true
+		}
+		if errors.Is(err, syscall.ECONNRESET) {
+			r.throttled = true
+		}
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) {
+			r.TLSError = certErr.Err.Error()
+		}
+	}
+	if pin.sniUsed.Load() {
+		r.SNI = pin.sni
+	}
+	if resp != nil {
+		r.Reason, r.Error = "", ""
+		r.netFailure = false
+		r.throttled = resp.StatusCode == http.StatusTooManyRequests
+		if r.throttled || resp.StatusCode == http.StatusServiceUnavailable {
+			r.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+		r.RateLimit = parseRateLimit(resp.Header)
+		if pr.IP != "" && pr.IP != r.IP {
+			r.IP = pr.IP
+			p.locate(&r)
+		}
+	}
+	var respHeader http.Header
+	if resp != nil {
+		respHeader = resp.Header
+		r.Status = resp.StatusCode
+		r.Proto = resp.Proto
+		r.URL = baseURL(respScheme, sub, resp)
+		scr := p.scrapers[c.Domain]
+		if !IsLive(r.Status) {
+			scr = nil
+		}
+		root := c.Source == SourceRoot
+		if root && resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+			r.Cert = newCertInfo(resp.TLS.PeerCertificates[0])
+		} else if root && r.IP != "" && slices.Contains(schemes, "https") {
+			// the root answered over plain HTTP: fetch its certificate apart
+			if cert := peerCert(ctx, r.IP, sub, p.timeout); cert != nil {
+				r.Cert = newCertInfo(cert)
+			}
+		}
+		if scr != nil || p.readsBody() || root {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, p.bodyMax))
+			if scr != nil {
+				r.Referenced = scr.extract(resp.Header, body, sub)
+			}
+			p.inspectBody(&r, resp.Header, body)
+			if root && r.Title == "" {
+				r.Title = pageTitle(body)
+			}
+			// HTTP/3 responses don't come through p.client
+			if p.soft404 && Classify(r.Status) == ClassLive && resp.ProtoMajor != 3 {
+				r.Soft404 = p.isSoft404(ctx, pin, respScheme, pt.address(), r.Status, body)
+				r.Soft404Kept = r.Soft404 && p.keepSoft404
+			}
+		}
+		resp.Body.Close()
+	}
+	if p.bothFamilies && !p.skipIPv6 && r.Family == FamilyDual {
+		used := ""
+		if resp != nil {
+			used = pr.IP
+		}
+		r.FamilyStatus = p.familyStatus(ctx, pin, pt, used, r.Status)
+	}
+	if p.harvest {
+		r.Redirects = UniqStrings(redirects.hosts)
+	}
+	if resp != nil {
+		r.RedirectClass, r.RedirectTarget = classifyRedirects(sub, c.Domain, respScheme, redirects.chain)
+	}
+	if p.cdn != nil {
+		r.CDN = p.cdn.Detect(r.IP, r.CNAMEs, respHeader)
+	}
+	if p.cloud != nil && resp == nil && dead && !p.http3Only && ctx.Err() == nil {
+		r.DanglingCloud = p.danglingCloud(ctx, sub, ips)
+	}
+	if target := p.dialTarget(ips); resp == nil && target != "" {
+		for _, port := range p.bannerPorts {
+			if banner, open := grabBanner(ctx, target, port, 2*time.Second); open {
+				r.BannerPort, r.Banner = port, banner
+				break
+			}
+		}
+	}
+	return r
 }
@@ -0,0 +1,264 @@
+package sublive
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewTransport(t *testing.T) {
+	s := &Scanner{Domains: []string{"example.com"}, ConnectTimeout: time.Second, TLSTimeout: 2 * time.Second, ResponseTimeout: 4 * time.Second, DisableKeepAlives: true}
+	p := &probe{timeouts: s.Timeouts(), tlsConfig: newTLSConfig(s)}
+	tr := newTransport(s, p, 300, nil)
+	if tr.TLSHandshakeTimeout != 2*time.Second || tr.ResponseHeaderTimeout != 4*time.Second {
+		t.Errorf("TLS timeout %v, response timeout %v", tr.TLSHandshakeTimeout, tr.ResponseHeaderTimeout)
+	}
+	if tr.MaxIdleConns != 600 || tr.MaxIdleConnsPerHost != 2 || !tr.DisableKeepAlives {
+		t.Errorf("idle conns %d, per host %d, keep-alives off %v", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.DisableKeepAlives)
+	}
+	if got := s.Timeouts().Request; got != 8*time.Second {
+		t.Errorf("request timeout %v, want the phases plus a second", got)
+	}
+}
+
+func TestProbeTimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		in   ProbeTimeouts
+		want ProbeTimeouts
+	}{
+		{"defaults", ProbeTimeouts{}, ProbeTimeouts{Connect: 3 * time.Second, TLS: 3 * time.Second, Response: 5 * time.Second, Request: 8 * time.Second}},
+		{"one phase", ProbeTimeouts{Connect: time.Second}, ProbeTimeouts{Connect: time.Second, TLS: 3 * time.Second, Response: 5 * time.Second, Request: 10 * time.Second}},
+		{"request", ProbeTimeouts{Response: 15 * time.Second, Request: 4 * time.Second}, ProbeTimeouts{Connect: 3 * time.Second, TLS: 3 * time.Second, Response: 15 * time.Second, Request: 4 * time.Second}},
+	}
+	for _, tt := range tests {
+		if got := tt.in.WithDefaults(); got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// benchTargets returns n names served by srv, given as URLs so the
+// default client gets to the port of srv.
+func benchTargets(b *testing.B, srv *httptest.Server, n int) ([]Candidate, *fakeResolver) {
+	u, _ := url.Parse(srv.URL)
+	res := &fakeResolver{answers: map[string]ResolveResult{}}
+	var seeds []Candidate
+	for i := range n {
+		name := fmt.Sprintf("h%d.example.com", i)
+		target, _ := url.Parse("http://" + name + ":" + u.Port() + "/")
+		seeds = append(seeds, Candidate{Name: name, Domain: "example.com", Source: SourceInput, URL: target})
+		res.answers[name] = ResolveResult{IPs: []string{"127.0.0.1"}}
+	}
+	return seeds, res
+}
+
+// BenchmarkProbe scans 500 names of one local server with the default
+// client at 300 workers, with and without connection reuse.
+func BenchmarkProbe(b *testing.B) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	seeds, res := benchTargets(b, srv, 500)
+	for _, keepAlive := range []bool{true, false} {
+		b.Run(fmt.Sprintf("keepalive=%v", keepAlive), func(b *testing.B) {
+			for b.Loop() {
+				s := &Scanner{Seeds: seeds, Resolver: res, Workers: 300, ProbeInternal: true, NoBackoff: true, DisableKeepAlives: !keepAlive}
+				ch, err := s.Run(context.Background())
+				if err != nil {
+					b.Fatal(err)
+				}
+				for r := range ch {
+					if r.Status != 200 {
+						b.Fatalf("%s: status %d: %s", r.Subdomain, r.Status, r.Error)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRunMaxLive(t *testing.T) {
+	names := []string{"slow.example.com", "moved.example.com", "a.example.com", "b.example.com"}
+	pages := map[string]fakePage{"moved.example.com": {status: 302}, "a.example.com": {status: 200}, "b.example.com": {status: 200}}
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	tests := []struct {
+		name      string
+		words     []string
+		live      func(Result) bool
+		want, not []string
+	}{
+		// the queue is empty when a trips the limit: the held back slow
+		// host must not get a second pass
+		{"redirects don't count", []string{"slow", "moved", "a"}, nil, []string{"slow.example.com", "moved.example.com", "a.example.com"}, nil},
+		// the one worker may have taken a before the collector stops
+		{"custom predicate", []string{"moved", "a", "b"}, func(r Result) bool { return IsLive(r.Status) }, []string{"moved.example.com"}, []string{"b.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prb := &fakeProber{pages: pages, errs: map[string]error{"slow.example.com": timeout}}
+			s := &Scanner{Domains: []string{"example.com"}, Words: tt.words, MaxLive: 1, Live: tt.live, SecondPass: true, Workers: 1, NoBackoff: true, Resolver: &fakeResolver{answers: resolves("192.0.2.60", names...)}, Prober: prb}
+			got := runScan(t, s)
+			for _, n := range tt.want {
+				if _, ok := got[n]; !ok {
+					t.Errorf("no result for %s", n)
+				}
+			}
+			for _, n := range tt.not {
+				if _, ok := got[n]; ok {
+					t.Errorf("%s scanned after the limit", n)
+				}
+			}
+			if n := prb.probes("slow.example.com"); n > 1 {
+				t.Errorf("the slow host was probed %d times after the scan stopped", n)
+			}
+			if len(got)+s.Skipped() != len(tt.words) {
+				t.Errorf("%d results and %d skipped of %d names", len(got), s.Skipped(), len(tt.words))
+			}
+		})
+	}
+}
+
+func TestRunSlowReader(t *testing.T) {
+	var words, names []string
+	for i := range 100 {
+		words = append(words, fmt.Sprintf("h%d", i))
+		names = append(names, fmt.Sprintf("h%d.example.com", i))
+	}
+	pages := map[string]fakePage{}
+	for _, n := range names[:50] {
+		pages[n] = fakePage{status: 200}
+	}
+	s := &Scanner{Domains: []string{"example.com"}, Words: words, Workers: 20, NoBackoff: true, Resolver: &fakeResolver{answers: resolves("192.0.2.70", names...)}, Prober: &fakeProber{pages: pages}}
+	ch, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a reader far slower than the workers still gets every result
+	seen := map[string]bool{}
+	for r := range ch {
+		time.Sleep(time.Millisecond)
+		if seen[r.Subdomain] {
+			t.Errorf("%s twice", r.Subdomain)
+		}
+		seen[r.Subdomain] = true
+	}
+	for _, n := range names {
+		if !seen[n] {
+			t.Errorf("no result for %s", n)
+		}
+	}
+}
+
+func TestRunPerHost(t *testing.T) {
+	// the names resolve to two addresses and answer from the second,
+	// while slow holds a worker until they are all done: the ones parked
+	// on the first must be woken by the probes before them, not by the
+	// queue running dry
+	res := &fakeResolver{answers: map[string]ResolveResult{"slow.example.com": {IPs: []string{"192.0.2.90"}}}}
+	release := make(chan struct{})
+	pages := map[string]fakePage{"slow.example.com": {status: 200, wait: release}}
+	var words []string
+	for i := range 10 {
+		name := fmt.Sprintf("h%d.example.com", i)
+		words = append(words, fmt.Sprintf("h%d", i))
+		res.answers[name] = ResolveResult{IPs: []string{"192.0.2.80", "192.0.2.81"}}
+		pages[name] = fakePage{status: 200, ip: "192.0.2.81", delay: 10 * time.Millisecond}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s := &Scanner{Domains: []string{"example.com"}, Words: append([]string{"slow"}, words...), PerHost: 1, Workers: 4, NoBackoff: true, Resolver: res, Prober: &fakeProber{pages: pages}}
+	ch, err := s.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := 0
+	for r := range ch {
+		if r.Subdomain == "slow.example.com" {
+			continue
+		}
+		if r.Status != 200 {
+			t.Errorf("%s: status %d: %s", r.Subdomain, r.Status, r.Error)
+		}
+		if done++; done == len(words) {
+			close(release)
+		}
+	}
+	if done != len(words) {
+		t.Errorf("%d of %d names done before the timeout", done, len(words))
+	}
+}
+
+func TestRunHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	target, _ := url.Parse("https://h2.example.com:" + u.Port() + "/")
+	res := &fakeResolver{answers: resolves("127.0.0.1", "h2.example.com")}
+	for _, tt := range []struct {
+		http2 bool
+		want  string
+	}{{true, "HTTP/2.0"}, {false, "HTTP/1.1"}} {
+		s := &Scanner{Seeds: []Candidate{{Name: "h2.example.com", Domain: "example.com", Source: SourceInput, URL: target}}, HTTP2: tt.http2, ProbeInternal: true, NoBackoff: true, Resolver: res}
+		r := runScan(t, s)["h2.example.com"]
+		if r.Status != 200 || r.Proto != tt.want {
+			t.Errorf("HTTP2 %v: status %d proto %q (%s), want %s", tt.http2, r.Status, r.Proto, r.Error, tt.want)
+		}
+	}
+}
+
+func TestRunSNIReuse(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	var port string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Host, "a.") {
+			http.Redirect(w, r, "https://b.example.com:"+port+"/", http.StatusFound)
+		}
+	}))
+	srv.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		mu.Lock()
+		sent = append(sent, hello.ServerName)
+		mu.Unlock()
+		return nil, nil
+	}}
+	srv.StartTLS()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	port = u.Port()
+	dns := serveDNS(t, map[string][]string{"a.example.com": {"127.0.0.1"}, "b.example.com": {"127.0.0.1"}})
+	var seeds []Candidate
+	for _, name := range []string{"a.example.com", "b.example.com"} {
+		target, _ := url.Parse("https://" + name + ":" + port + "/")
+		seeds = append(seeds, Candidate{Name: name, Domain: "example.com", Source: SourceInput, URL: target})
+	}
+	// a's redirect reaches b under its own name first; b's own probe must
+	// still send the fronted name rather than reuse that connection
+	s := &Scanner{Seeds: seeds, SNI: "front.example.net", Resolvers: []string{dns.addr}, Workers: 1, ProbeInternal: true, NoBackoff: true}
+	got := runScan(t, s)
+	for _, name := range []string{"a.example.com", "b.example.com"} {
+		if r := got[name]; r.Status != 200 || r.SNI != "front.example.net" {
+			t.Errorf("%s: status %d SNI %q (%s)", name, r.Status, r.SNI, r.Error)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"front.example.net", "b.example.com", "front.example.net"}; !slices.Equal(sent, want) {
+		t.Errorf("server names sent %q, want %q", sent, want)
+	}
+}
@@ -0,0 +1,54 @@
+package sublive
+
+import "time"
+
+// Default timeouts of a probe request, see ProbeTimeouts. DefaultTimeout
+// bounds the attempts for a candidate when no phase is set.
+const (
+	DefaultTimeout         = 8 * time.Second
+	DefaultConnectTimeout  = 3 * time.Second
+	DefaultTLSTimeout      = 3 * time.Second
+	DefaultResponseTimeout = 5 * time.Second
+)
+
+// timeoutMargin is added to the sum of the phase timeouts to get the
+// request timeout when a phase is set.
+const timeoutMargin = time.Second
+
+// ProbeTimeouts are the deadlines of the HTTP attempts for one candidate.
+// Connect bounds each TCP connect, TLS each handshake and Response the
+// wait for the response headers once the request is sent. Request bounds
+// all the attempts for the candidate together.
+type ProbeTimeouts struct {
+	Connect  time.Duration
+	TLS      time.Duration
+	Response time.Duration
+	Request  time.Duration
+}
+
+// WithDefaults returns t with its zero fields set: the phases to their
+// Default timeouts and Request to DefaultTimeout, or to the sum of the
+// phases plus a second once any phase is set.
+func (t ProbeTimeouts) WithDefaults() ProbeTimeouts {
+	phased := t.Connect > 0 || t.TLS > 0 || t.Response > 0
+	if t.Connect <= 0 {
+		t.Connect = DefaultConnectTimeout
+	}
+	if t.TLS <= 0 {
+		t.TLS = DefaultTLSTimeout
+	}
+	if t.Response <= 0 {
+		t.Response = DefaultResponseTimeout
+	}
+	if t.Request <= 0 && phased {
+		t.Request = t.Connect + t.TLS + t.Response + timeoutMargin
+	} else if t.Request <= 0 {
+		t.Request = DefaultTimeout
+	}
+	return t
+}
+
+// Timeouts returns the effective timeouts of the Scanner's probes.
+func (s *Scanner) Timeouts() ProbeTimeouts {
+	return ProbeTimeouts{Connect: s.ConnectTimeout, TLS: s.TLSTimeout, Response: s.ResponseTimeout, Request: s.Timeout}.WithDefaults()
+}
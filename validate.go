@@ -0,0 +1,163 @@
+package sublive
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultTrustedResolvers are used by Scanner.Validate when
+// TrustedResolvers is empty.
+var DefaultTrustedResolvers = []string{"1.1.1.1:53", "8.8.8.8:53", "9.9.9.9:53"}
+
+// Verdicts recorded in Result.Validation.
+const (
+	// ValidationConfirmed means the trusted resolvers know the name too.
+	// Their addresses may differ, as CDNs answer per resolver location.
+	ValidationConfirmed = "confirmed"
+	// ValidationPoisoned means the trusted resolvers say the name doesn't
+	// exist, so the scanning resolver made the answer up.
+	ValidationPoisoned = "poisoned"
+	// ValidationUnvalidated means the trusted resolvers gave no usable
+	// answer (timeout, SERVFAIL, no address).
+	ValidationUnvalidated = "unvalidated"
+)
+
+// validateConcurrency caps validation lookups in flight so the trusted
+// resolvers only see a fraction of the scan's query rate.
+const validateConcurrency = 10
+
+// validator queries the trusted resolvers directly, so neither the hosts
+// file nor the system resolver takes part. Verdicts are cached for the
+// run, so parked and retried candidates are checked once. The lookups the
+// workers start run in their own goroutines and report to the collector
+// on done, so a worker never waits for the trusted resolvers.
+type validator struct {
+	servers []string
+	next    uint32
+	sem     chan struct{}
+	done    chan string
+	quit    chan struct{}
+	mu      sync.Mutex
+	seen    map[string]string
+	started map[string]bool
+}
+
+func newValidator(servers []string) *validator {
+	if len(servers) == 0 {
+		servers = DefaultTrustedResolvers
+	}
+	return &validator{
+		servers: servers,
+		sem:     make(chan struct{}, validateConcurrency),
+		done:    make(chan string),
+		quit:    make(chan struct{}),
+		seen:    map[string]string{},
+		started: map[string]bool{},
+	}
+}
+
+// verdict returns the cached verdict for name, if it was checked already.
+func (v *validator) verdict(name string) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	verdict, ok := v.seen[name]
+	return verdict, ok
+}
+
+// start looks name up in the background, unless that was done already,
+// and sends it on done once its verdict is cached. The lookup is given up
+// when ctx ends or the collector quits first.
+func (v *validator) start(ctx context.Context, name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.started[name] {
+		return
+	}
+	v.started[name] = true
+	go func() {
+		select {
+		case v.sem <- struct{}{}:
+		case <-v.quit:
+			return
+		case <-ctx.Done():
+			return
+		}
+		verdict := v.lookup(ctx, name)
+		<-v.sem
+		if verdict == "" {
+			return
+		}
+		v.store(name, verdict)
+		select {
+		case v.done <- name:
+		case <-v.quit:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// check returns the verdict for name, looking it up right away when it
+// isn't cached, or "" when ctx ended first.
+func (v *validator) check(ctx context.Context, name string) string {
+	if verdict, ok := v.verdict(name); ok {
+		return verdict
+	}
+	select {
+	case v.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ""
+	}
+	verdict := v.lookup(ctx, name)
+	<-v.sem
+	if verdict != "" {
+		v.store(name, verdict)
+	}
+	return verdict
+}
+
+func (v *validator) store(name, verdict string) {
+	v.mu.Lock()
+	v.seen[name] = verdict
+	v.mu.Unlock()
+}
+
+// lookup asks the trusted resolvers for the addresses of name and returns
+// the verdict, or "" when ctx ended first. Only an A record confirms the
+// name: an empty answer leaves it unvalidated, since the name may exist
+// with other records only.
+func (v *validator) lookup(ctx context.Context, name string) string {
+	// start at a different server each time to spread the load; the
+	// others are fallbacks
+	i := int(atomic.AddUint32(&v.next, 1)) % len(v.servers)
+	servers := append(append([]string{}, v.servers[i:]...), v.servers[:i]...)
+	p, h, err := exchange(ctx, servers, name, false)
+	switch {
+	case ctx.Err() != nil:
+		return ""
+	case err == nil && h.RCode == dnsmessage.RCodeSuccess && hasA(p):
+		return ValidationConfirmed
+	case err == nil && h.RCode == dnsmessage.RCodeNameError:
+		return ValidationPoisoned
+	default:
+		return ValidationUnvalidated
+	}
+}
+
+// hasA reports whether the answer section of p has an A record.
+func hasA(p *dnsmessage.Parser) bool {
+	for {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			return false
+		}
+		if h.Type == dnsmessage.TypeA {
+			return true
+		}
+		if err := p.SkipAnswer(); err != nil {
+			return false
+		}
+	}
+}
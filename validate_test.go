@@ -0,0 +1,64 @@
+package sublive
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestValidatorCheck(t *testing.T) {
+	dns := serveDNS(t, map[string][]string{"www.example.com": {"192.0.2.1"}, "txt.example.com": nil})
+	v := newValidator([]string{dns.addr})
+	tests := []struct {
+		name, want string
+	}{
+		{"www.example.com", ValidationConfirmed},
+		{"gone.example.com", ValidationPoisoned},
+		// NOERROR without an address confirms nothing
+		{"txt.example.com", ValidationUnvalidated},
+	}
+	for _, tt := range tests {
+		if got := v.check(context.Background(), tt.name); got != tt.want {
+			t.Errorf("check(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+		v.check(context.Background(), tt.name)
+		if n := dns.queries(tt.name); n != 1 {
+			t.Errorf("%s asked %d times, want the verdict cached", tt.name, n)
+		}
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	answers := map[string][]string{}
+	var words, names []string
+	pages := map[string]fakePage{}
+	for i := range 30 {
+		name := fmt.Sprintf("h%d.example.com", i)
+		words, names = append(words, fmt.Sprintf("h%d", i)), append(names, name)
+		pages[name] = fakePage{status: 200}
+		// every third name is made up by the scanning resolver
+		if i%3 != 0 {
+			answers[name] = []string{"192.0.2.100"}
+		}
+	}
+	dns := serveDNS(t, answers)
+	prb := &fakeProber{pages: pages}
+	s := &Scanner{Domains: []string{"example.com"}, Words: words, Validate: true, TrustedResolvers: []string{dns.addr}, Workers: 20, NoBackoff: true, Resolver: &fakeResolver{answers: resolves("192.0.2.100", names...)}, Prober: prb}
+	got := runScan(t, s)
+	for i, name := range names {
+		r := got[name]
+		want, status, probed := ValidationConfirmed, 200, 1
+		if i%3 == 0 {
+			want, status, probed = ValidationPoisoned, 0, 0
+		}
+		if r.Validation != want || r.Status != status {
+			t.Errorf("%s: validation %q status %d, want %q %d", name, r.Validation, r.Status, want, status)
+		}
+		if n := prb.probes(name); n != probed {
+			t.Errorf("%s probed %d times, want %d", name, n, probed)
+		}
+		if n := dns.queries(name); n != 1 {
+			t.Errorf("%s validated %d times", name, n)
+		}
+	}
+}